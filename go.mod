@@ -3,6 +3,8 @@ module github.com/fabiodcorreia/catch-my-file
 go 1.16
 
 require (
+	filippo.io/nistec v0.0.3
 	fyne.io/fyne/v2 v2.0.4
 	github.com/grandcat/zeroconf v1.0.0
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
 )
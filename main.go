@@ -25,6 +25,21 @@ func main() {
 
 	app := catchmyfile.New(port)
 
+	// Any argument other than the options runs a command on the terminal
+	// instead of the window.
+	if catchmyfile.IsCommand(os.Args[1:]) {
+		code := app.Command(os.Args[1:])
+		if err := clog.Close(); err != nil && code == catchmyfile.ExitOK {
+			code = catchmyfile.ExitError
+		}
+		os.Exit(code)
+	}
+
+	if err := app.Options(os.Args[1:]); err != nil {
+		clog.Close()
+		os.Exit(catchmyfile.ExitUsage)
+	}
+
 	defer clog.Close()
 	clog.Info("========== Catch My File - Started ==========")
 	clog.Info("Logging to file: %s", clog.LogFile())
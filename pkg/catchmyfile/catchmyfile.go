@@ -2,13 +2,20 @@ package catchmyfile
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
+	"path/filepath"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/control"
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
 	"github.com/fabiodcorreia/catch-my-file/pkg/layout"
 	"github.com/fabiodcorreia/catch-my-file/pkg/network"
 	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
@@ -16,31 +23,99 @@ import (
 	"github.com/fabiodcorreia/catch-my-file/pkg/worker"
 )
 
+// knownPeersFile is the name of the file with the fingerprints pinned
+// for each peer.
+const knownPeersFile = "known_peers.json"
+
+// historyFile is the name of the file with the transfers finished.
+const historyFile = "history.jsonl"
+
+// Directory and name of the Unix socket of the control API, the directory
+// is only for the socket and only the user can access it.
+const (
+	controlDir        = "control"
+	controlSocketFile = "control.sock"
+)
+
+// Preference keys of the bandwidth limits.
+const (
+	globalLimitKey = "limits.global"
+	peerLimitsKey  = "limits.peers"
+)
+
+// Preference keys of the workers that send the transfers.
+const (
+	workersKey   = "workers.count"
+	queueSizeKey = "workers.queue"
+)
+
+// Preference key of the network interfaces used, their names separated by
+// commas, if empty all the interfaces are used.
+const interfacesKey = "network.interfaces"
+
+// Default number of transfers sent at the same time and of transfers
+// queued waiting for a free worker.
+const (
+	defaultWorkers   = 2
+	defaultQueueSize = 16
+)
+
 type CatchMyFileApp struct {
 	a     fyne.App
 	w     fyne.Window
 	ctx   context.Context
 	port  int
 	wPool worker.WorkerPool
+	id    *identity.Identity
+	// Directory of the application storage and the preferences stored on
+	// it, they are set by Run or Command.
+	storage string
+	prefs   preferences
+	peers   []string // Peers added on the options, as host:port.
+	// Names of the network interfaces on the options, they replace the
+	// ones on the preferences.
+	ifaceNames []string
+	ifaces     []net.Interface // Network interfaces used, nil for all of them.
+	// Display name on the options, it replaces the one on the preferences.
+	displayName string
 }
 
-// New will create a new instance of the appplication.
+// New will create a new instance of the appplication, the Fyne application
+// is only created when the window is opened by Run.
 func New(port int) *CatchMyFileApp {
-	c := &CatchMyFileApp{
-		a:     app.NewWithID("github.fabiodcorreia.catch-my-file"),
-		ctx:   context.Background(),
-		port:  port,
-		wPool: worker.NewPool(2),
+	return &CatchMyFileApp{
+		ctx:  context.Background(),
+		port: port,
 	}
-	return c
 }
 
-// initSetup will initialize the window, size, position
-// and the OnClose action of the window.
+// newPool will create the pool of workers that send the transfers with the
+// number of workers and the queue size stored on the preferences.
+func newPool(prefs preferences) worker.WorkerPool {
+	workers := prefs.IntWithFallback(workersKey, defaultWorkers)
+	if workers < 1 {
+		workers = defaultWorkers
+	}
+
+	queueSize := prefs.IntWithFallback(queueSizeKey, defaultQueueSize)
+	if queueSize < 0 {
+		queueSize = defaultQueueSize
+	}
+
+	return worker.NewPool(workers, queueSize)
+}
+
+// initSetup will create the Fyne application and initialize the window,
+// size, position and the OnClose action of the window.
 func (c *CatchMyFileApp) initSetup() {
 	ctx, cancel := context.WithCancel(c.ctx)
 	c.ctx = ctx
 
+	c.a = app.NewWithID(appID)
+	c.storage = c.a.Storage().RootURI().Path()
+	c.prefs = c.a.Preferences()
+	c.wPool = newPool(c.prefs)
+
 	c.w = c.a.NewWindow("Catch My File")
 	c.w.Resize(fyne.NewSize(900, 600))
 	c.w.CenterOnScreen()
@@ -62,19 +137,99 @@ func handleError(err error, parent fyne.Window) {
 func (c *CatchMyFileApp) Run() error {
 	c.initSetup()
 
-	pStore := peer.NewStore()
+	pStore, tStore, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	ifaces, err := c.interfaces()
+	if err != nil {
+		return err
+	}
+	c.ifaces = ifaces
+
 	pView := peer.NewView(pStore)
-	pServer := peer.NewServer(network.Hostname(), c.port, pStore)
+	pServer := peer.NewServer(network.Hostname(), c.port, c.id.Fingerprint(), pStore)
+	pServer.Interfaces = ifaces
+	pServer.Metadata = c.metadata()
 
-	tStore := transfer.NewStore()
 	tView := transfer.NewView(tStore)
-	tReceiver := transfer.NewReceiver(c.port, tStore)
+	tReceiver := transfer.NewReceiver(c.port, tStore, c.id)
+	tReceiver.Interfaces = ifaces
+	tReceiver.VerifyPeer = func(addr net.Addr, fingerprint string) (string, bool) {
+		return verifyPeer(pStore, addr, fingerprint)
+	}
+	tReceiver.PairRequest = func(name string, addr net.Addr) (string, bool) {
+		return pView.AskPairCode(peerName(pStore, name, addr))
+	}
+	tReceiver.PairDone = func(name string, addr net.Addr, fingerprint string, err error) {
+		c.onPairDone(peerName(pStore, name, addr), fingerprint, err, pStore)
+	}
+
+	pView.PairRequest = func(ctx context.Context, code, peerName string, addr net.Addr) error {
+		fingerprint, err := transfer.Pair(ctx, addr, pStore.GetMe().Name, code, c.id, c.ifaces)
+		if err != nil {
+			return err
+		}
+		return pStore.SetPaired(peerName, fingerprint)
+	}
+
+	pView.AddPeerRequest = func(ctx context.Context, target string) error {
+		return c.addPeer(ctx, target, pStore)
+	}
+
+	pView.LimitRequest = func(peerName string) {
+		transfer.ShowLimitDialog(peerName, tStore.Limits.Peer(peerName), func(rate int64) {
+			tStore.Limits.SetPeer(peerName, rate)
+			pView.Refresh()
+		}, c.w)
+	}
+
+	pView.LimitLabel = func(peerName string) string {
+		if rate := tStore.Limits.Peer(peerName); rate > 0 {
+			return transfer.FormatRate(rate)
+		}
+		return ""
+	}
 
 	pView.TransferRequest = func(filePath, fileName, checksum, peerName string, size int64, addr net.Addr) {
 		t := transfer.NewTransfer(fileName, checksum, peerName, size, addr, transfer.Upload)
 		t.LocalFilePath = filePath
-		i := tStore.Add(t)
-		c.onTransferRequest(i, tStore, pStore)
+		id := tStore.Add(t)
+		c.onTransferRequest(id, 0, tStore, pStore)
+	}
+
+	pView.DirectoryRequest = func(dirPath, dirName, peerName string, files []file.Entry, addr net.Addr) {
+		t := transfer.NewDirectoryTransfer(dirName, peerName, files, addr, transfer.Upload)
+		t.LocalFilePath = dirPath
+		id := tStore.Add(t)
+		c.onTransferRequest(id, 0, tStore, pStore)
+	}
+
+	pView.BatchRequest = func(filePaths []string, files []file.Entry, peerName string, addr net.Addr) {
+		bFiles := make([]transfer.File, 0, len(files))
+		for j, f := range files {
+			bFiles = append(bFiles, transfer.File{Entry: f, LocalPath: filePaths[j], Status: transfer.Waiting})
+		}
+		t := transfer.NewBatchTransfer(peerName, bFiles, addr, transfer.Upload)
+		id := tStore.Add(t)
+		c.onTransferRequest(id, 0, tStore, pStore)
+	}
+
+	cServer := control.NewServer(filepath.Join(c.storage, controlDir, controlSocketFile), pStore, tStore)
+	cServer.SendRequest = func(peerName string, paths []string, priority int) (string, error) {
+		p := pStore.FindByName(peerName)
+		if p == nil {
+			return "", fmt.Errorf("peer %s not found", peerName)
+		}
+
+		t, err := newUpload(c.ctx, paths, p.Name, p.Address)
+		if err != nil {
+			return "", err
+		}
+		id := tStore.Add(t)
+		c.onTransferRequest(id, priority, tStore, pStore)
+		return id, nil
 	}
 
 	pDone := make(chan interface{})
@@ -83,15 +238,31 @@ func (c *CatchMyFileApp) Run() error {
 		c.a.Quit()
 	}
 
+	// The application works without the control API, like when another
+	// instance is running.
+	cDone := make(chan interface{})
+	if err := cServer.Run(c.ctx, cDone); err != nil {
+		handleError(err, c.w)
+	}
+
 	rDone := make(chan interface{})
 	if err := tReceiver.Run(c.ctx, rDone); err != nil {
 		handleError(err, c.w)
 		c.a.Quit()
 	}
 
+	go c.watchManualPeers(c.ctx, pStore)
+
 	c.w.SetContent(container.NewAppTabs(
-		layout.NewPeersTab(pView),
-		layout.NewTransferTab(tView),
+		layout.NewPeersTab(container.NewBorder(
+			container.NewBorder(nil, nil, nil, peer.NewAddButton(pView)),
+			nil, nil, nil, pView,
+		)),
+		layout.NewTransferTab(container.NewBorder(
+			container.NewBorder(nil, nil, nil, transfer.NewClearButton(tStore), transfer.NewLimitsBar(tStore.Limits)),
+			nil, nil, nil, tView,
+		)),
+		layout.NewHistoryTab(transfer.NewHistoryView(tStore.History)),
 	))
 
 	c.wPool.Run(c.ctx)
@@ -99,49 +270,295 @@ func (c *CatchMyFileApp) Run() error {
 	c.w.ShowAndRun()
 	<-pDone        // Wait for Peers server to finish
 	<-rDone        // Wait for Receiver server to finish
+	<-cDone        // Wait for Control server to finish
 	c.wPool.Stop() // Wait for the WorkerPool to finish
 
 	return nil
 }
 
+// load will load the identity, the known and manual peers, the bandwidth
+// limits and the history from the application storage and create the stores
+// that use them.
+func (c *CatchMyFileApp) load() (*peer.PeerStore, *transfer.TransferStore, error) {
+	id, err := identity.Load(c.storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.id = id
+	clog.Info("Identity fingerprint: %s", id.Fingerprint())
+
+	known, err := peer.LoadKnownPeers(filepath.Join(c.storage, knownPeersFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manual, err := peer.LoadManualPeers(filepath.Join(c.storage, manualPeersFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pStore := peer.NewStore()
+	pStore.Known = known
+	pStore.Manual = manual
+
+	history, err := transfer.LoadHistory(filepath.Join(c.storage, historyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tStore := transfer.NewStore()
+	tStore.History = history
+	c.loadLimits(tStore.Limits)
+
+	return pStore, tStore, nil
+}
+
 // onTransferRequest is the action that is executed everytime
 // a new transfer is added by the user to be sent to a peer.
-func (c *CatchMyFileApp) onTransferRequest(i int, tStore *transfer.TransferStore, pStore *peer.PeerStore) {
-	t := tStore.Get(i)
-	p := pStore.GetMe()
-
-	err := c.wPool.AddTask(func(ctx context.Context) {
-		clog.Info("Added transfer idx:%d to the worker", i)
-		t.SenderName = p.Name
-		conn, err := transfer.SendTransferReq(ctx, t)
-		if err != nil {
-			clog.Error(err)
-			t.SetError(err)
-			tStore.Update(i, t)
-			return
-		}
+//
+// The transfer is Queued until one of the workers is free, the transfers
+// with a higher priority start first and the others by arrival.
+func (c *CatchMyFileApp) onTransferRequest(id string, priority int, tStore *transfer.TransferStore, pStore *peer.PeerStore) {
+	t := tStore.Get(id)
+	if t == nil {
+		return
+	}
+	localName := localName(pStore)
+
+	t.Status = transfer.Queued
+	tStore.Update(id, t)
 
-		defer conn.Close()
-
-		if err = transfer.WaitConfirmation(ctx, i, conn, tStore); err != nil {
-			switch err {
-			case transfer.ErrRejected:
-				t.Status = transfer.Rejected
-			default:
-				clog.Error(err)
-				t.SetError(err)
-			}
-			tStore.Update(i, t)
+	err := c.wPool.AddPriorityTask(func(ctx context.Context) {
+		clog.Info("Added transfer id:%s to the worker", id)
+
+		// The transfer can be cancelled while it's waiting for a worker.
+		ctx, cancel := tStore.WithCancel(ctx, id)
+		defer cancel()
+		if ctx.Err() != nil {
 			return
 		}
 
-		t.Status = transfer.Completed
-		tStore.Update(i, t)
-	})
+		// Once started it waits for the decision of the peer.
+		t.Status = transfer.Waiting
+		tStore.Update(id, t)
+
+		t.LocalName = localName
+		err := c.send(ctx, id, t, tStore, pStore)
+		finish(id, err, tStore)
+	}, priority)
 
 	if err != nil {
 		clog.Error(err)
 		t.SetError(err)
-		tStore.Update(i, t)
+		tStore.Update(id, t)
+	}
+}
+
+// send will send the request of the transfer with the id and wait
+// until it ends, a paused transfer that lost the connection is reconnected.
+func (c *CatchMyFileApp) send(ctx context.Context, id string, t *transfer.Transfer, tStore *transfer.TransferStore, pStore *peer.PeerStore) error {
+	conn, err := c.sendTransferReq(ctx, t, pStore)
+	if err != nil {
+		return err
+	}
+
+	err = transfer.WaitConfirmation(ctx, id, conn, tStore)
+	conn.Close()
+
+	// A paused transfer that lost the connection continues from where
+	// it stopped.
+	for errors.Is(err, transfer.ErrConnectionLost) {
+		clog.Info("transfer id:%s lost the connection while paused, reconnecting", id)
+		err = c.reconnect(ctx, id, t, tStore)
+	}
+	return err
+}
+
+// finish will update the status of the transfer with the id with the
+// result of sending it.
+func finish(id string, err error, tStore *transfer.TransferStore) {
+	// Get the files status updated while waiting for the confirmation.
+	t := tStore.Get(id)
+	if t == nil {
+		return
+	}
+	switch {
+	case err == nil:
+		t.Status = transfer.Completed
+	case errors.Is(err, transfer.ErrRejected):
+		t.Status = transfer.Rejected
+	case errors.Is(err, transfer.ErrCancelled):
+		t.Status = transfer.Cancelled
+	default:
+		clog.Error(err)
+		t.SetError(err)
+	}
+	tStore.Update(id, t)
+}
+
+// reconnect will send again the request of the paused transfer with the
+// id and wait until it ends.
+func (c *CatchMyFileApp) reconnect(ctx context.Context, id string, t *transfer.Transfer, tStore *transfer.TransferStore) error {
+	conn, err := transfer.Reconnect(ctx, t, c.id)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return transfer.WaitConfirmation(ctx, id, conn, tStore)
+}
+
+// sendTransferReq will send the transfer request to the peer expecting the
+// fingerprint pinned for it and the protocol it advertised.
+//
+// If the peer fingerprint doesn't match the pinned one the request is not
+// sent since it can be an impersonation, and if there is a fingerprint
+// pinned for the peer name the receiver certificate must match it.
+// A peer discovered that can't be reached may have left the network, the
+// error tells it since the peer is only shown offline a while later.
+func (c *CatchMyFileApp) sendTransferReq(ctx context.Context, t *transfer.Transfer, pStore *peer.PeerStore) (*transfer.Conn, error) {
+	name := t.SenderName
+	p := pStore.FindByIP(addrIP(t.SenderAddr))
+	if p != nil {
+		if err := checkTrust(p); err != nil {
+			return nil, err
+		}
+		name = p.Name
+		t.PeerProtocol = p.Protocol
+		t.PeerCapabilities = p.Capabilities
+	}
+
+	if pStore.Known != nil {
+		t.PeerFingerprint = pStore.Known.Pinned(name)
+	}
+	t.Interfaces = c.ifaces
+
+	// A peer discovered that left the network is still shown online for a
+	// while, the user is told why it can't be reached.
+	conn, err := transfer.SendTransferReq(ctx, t, c.id)
+	if errors.Is(err, transfer.ErrUnreachable) && p != nil && !p.Manual && !p.Offline {
+		return nil, fmt.Errorf("%w, %s may have left the network, a peer that leaves is only shown offline up to %v later", err, name, peer.LeaveDelay)
+	}
+	return conn, err
+}
+
+// onPairDone is the action that is executed when a pairing started by a
+// peer ends, if the code matched the peer fingerprint is stored as paired.
+func (c *CatchMyFileApp) onPairDone(name, fingerprint string, err error, pStore *peer.PeerStore) {
+	if err == nil {
+		err = pStore.SetPaired(name, fingerprint)
+	}
+
+	switch {
+	case errors.Is(err, transfer.ErrPairRejected):
+		return
+	case err != nil:
+		handleError(fmt.Errorf("pairing with %s failed: %v", name, err), c.w)
+	default:
+		dialog.ShowInformation("Paired", fmt.Sprintf("%s is now paired", name), c.w)
+	}
+}
+
+// localName returns the name of the local peer, the local peer is only on
+// the store after it's registered.
+func localName(pStore *peer.PeerStore) string {
+	if p := pStore.GetMe(); p != nil {
+		return p.Name
+	}
+	return network.Hostname()
+}
+
+// peerName returns the name of the peer on the address, if it's not known
+// returns the name the peer sent.
+func peerName(pStore *peer.PeerStore, name string, addr net.Addr) string {
+	if p := pStore.FindByIP(addrIP(addr)); p != nil {
+		return p.Name
+	}
+	return name
+}
+
+// verifyPeer returns false if there is no known peer on the address or if
+// it has a pinned fingerprint and it doesn't match the fingerprint presented
+// on the connection.
+//
+// The name of the peer is only returned if the fingerprint presented matches
+// the one pinned for it.
+func verifyPeer(pStore *peer.PeerStore, addr net.Addr, fingerprint string) (string, bool) {
+	p := pStore.FindByIP(addrIP(addr))
+	if p == nil {
+		return "", false
+	}
+
+	if pStore.Known == nil {
+		return "", true
+	}
+
+	switch pinned := pStore.Known.Pinned(p.Name); {
+	case pinned == "":
+		return "", true
+	case pinned != fingerprint:
+		return "", false
+	}
+	return p.Name, true
+}
+
+// addrIP returns the IP of a TCP address, the first one if there are
+// several, nil for other addresses.
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case network.Addrs:
+		if len(a) > 0 {
+			return a[0].IP
+		}
+	}
+	return nil
+}
+
+// interfaces returns the network interfaces to use, the ones on the options
+// or on the preferences, nil to use all of them.
+//
+// If there is an error, it's because one of the interfaces doesn't exist.
+func (c *CatchMyFileApp) interfaces() ([]net.Interface, error) {
+	names := c.ifaceNames
+	if len(names) == 0 {
+		var prefs listFlag
+		if err := prefs.Set(c.prefs.String(interfacesKey)); err != nil {
+			return nil, err
+		}
+		names = prefs
+	}
+	return network.Interfaces(names)
+}
+
+// loadLimits will set the bandwidth limits stored on the preferences and
+// store them again everytime they change.
+func (c *CatchMyFileApp) loadLimits(limits *transfer.Limits) {
+	prefs := c.prefs
+
+	limits.SetGlobal(int64(prefs.Int(globalLimitKey)))
+
+	peers := make(map[string]int64)
+	if v := prefs.String(peerLimitsKey); v != "" {
+		if err := json.Unmarshal([]byte(v), &peers); err != nil {
+			clog.Error(fmt.Errorf("catchmyfile load limits error: %v", err))
+		}
+	}
+	for name, rate := range peers {
+		limits.SetPeer(name, rate)
+	}
+
+	limits.OnLimitsChange = func(peer string, rate int64) {
+		if peer == "" {
+			prefs.SetInt(globalLimitKey, int(rate))
+			return
+		}
+		b, err := json.Marshal(limits.Peers())
+		if err != nil {
+			clog.Error(fmt.Errorf("catchmyfile store limits error: %v", err))
+			return
+		}
+		prefs.SetString(peerLimitsKey, string(b))
 	}
 }
@@ -0,0 +1,288 @@
+package catchmyfile
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+// newPeerStore returns a store with the known peers in memory and the peers
+// added, the fingerprints pinned are the ones of each peer.
+func newPeerStore(t *testing.T, known bool, peers ...*peer.Peer) *peer.PeerStore {
+	pStore := peer.NewStore()
+	if known {
+		k, err := peer.LoadKnownPeers("")
+		if err != nil {
+			t.Fatalf("LoadKnownPeers not expected error = %v", err)
+		}
+		pStore.Known = k
+	}
+
+	for _, p := range peers {
+		pStore.Add(p)
+	}
+	return pStore
+}
+
+// newTestPeer returns a peer with the name and fingerprint on the address.
+func newTestPeer(name, fingerprint string, addr *net.TCPAddr) *peer.Peer {
+	return &peer.Peer{
+		Name:        name,
+		IPAddress:   addr.IP,
+		Port:        addr.Port,
+		Address:     addr,
+		Fingerprint: fingerprint,
+	}
+}
+
+func Test_verifyPeer(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("192.168.1.2"), Port: 8822}
+	other := &net.TCPAddr{IP: net.ParseIP("192.168.1.3"), Port: 8822}
+
+	tests := []struct {
+		name        string
+		known       bool
+		peers       []*peer.Peer
+		addr        net.Addr
+		fingerprint string
+		wantName    string
+		wantOk      bool
+	}{
+		{
+			name:        "unknown peer",
+			known:       true,
+			peers:       []*peer.Peer{newTestPeer("peer-1", "aaaa", addr)},
+			addr:        other,
+			fingerprint: "aaaa",
+		},
+		{
+			name:        "pinned fingerprint matches",
+			known:       true,
+			peers:       []*peer.Peer{newTestPeer("peer-1", "aaaa", addr)},
+			addr:        addr,
+			fingerprint: "aaaa",
+			wantName:    "peer-1",
+			wantOk:      true,
+		},
+		{
+			name:        "pinned fingerprint doesn't match",
+			known:       true,
+			peers:       []*peer.Peer{newTestPeer("peer-1", "aaaa", addr)},
+			addr:        addr,
+			fingerprint: "bbbb",
+		},
+		{
+			name:        "pinned fingerprint and none presented",
+			known:       true,
+			peers:       []*peer.Peer{newTestPeer("peer-1", "aaaa", addr)},
+			addr:        addr,
+			fingerprint: "",
+		},
+		{
+			name:        "peer without pinned fingerprint",
+			known:       true,
+			peers:       []*peer.Peer{newTestPeer("peer-1", "", addr)},
+			addr:        addr,
+			fingerprint: "aaaa",
+			wantOk:      true,
+		},
+		{
+			name:        "no known peers",
+			peers:       []*peer.Peer{newTestPeer("peer-1", "aaaa", addr)},
+			addr:        addr,
+			fingerprint: "bbbb",
+			wantOk:      true,
+		},
+		{
+			name:        "address not TCP",
+			known:       true,
+			peers:       []*peer.Peer{newTestPeer("peer-1", "aaaa", addr)},
+			addr:        &net.UDPAddr{IP: addr.IP, Port: addr.Port},
+			fingerprint: "aaaa",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pStore := newPeerStore(t, tt.known, tt.peers...)
+
+			name, ok := verifyPeer(pStore, tt.addr, tt.fingerprint)
+			if ok != tt.wantOk {
+				t.Errorf("verifyPeer expected ok = %v but got = %v", tt.wantOk, ok)
+			}
+
+			if name != tt.wantName {
+				t.Errorf("verifyPeer expected name = %v but got = %v", tt.wantName, name)
+			}
+		})
+	}
+
+	t.Run("fingerprint changed after pinned", func(t *testing.T) {
+		pStore := newPeerStore(t, true, newTestPeer("peer-1", "aaaa", addr))
+		pStore.Add(newTestPeer("peer-1", "bbbb", other))
+
+		if p := pStore.FindByIP(other.IP); p == nil || p.Trust != peer.Mismatch {
+			t.Fatalf("Add expected peer with trust = %v but got = %v", peer.Mismatch, p)
+		}
+
+		if name, ok := verifyPeer(pStore, other, "bbbb"); ok || name != "" {
+			t.Errorf("verifyPeer expected not verified but got = %v, %v", name, ok)
+		}
+	})
+}
+
+// listenCount will start a listener on the loopback that counts the
+// connections accepted until the test ends.
+func listenCount(t *testing.T) (*net.TCPAddr, <-chan struct{}) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	accepted := make(chan struct{}, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+			select {
+			case accepted <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return l.Addr().(*net.TCPAddr), accepted
+}
+
+// runReceiver will start a receiver on the port with a new identity until
+// the test ends.
+func runReceiver(t *testing.T, port int) *identity.Identity {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	rID, err := identity.New()
+	if err != nil {
+		t.Fatalf("identity New not expected error = %v", err)
+	}
+
+	rv := transfer.NewReceiver(port, transfer.NewStore(), rID)
+	if err := rv.Run(ctx, make(chan interface{})); err != nil {
+		t.Fatalf("receiver run not expected error = %v", err)
+	}
+	return rID
+}
+
+func Test_sendTransferReq(t *testing.T) {
+	sID, err := identity.New()
+	if err != nil {
+		t.Fatalf("identity New not expected error = %v", err)
+	}
+	c := New(0)
+	c.id = sID
+
+	t.Run("peer with fingerprint mismatch refused", func(t *testing.T) {
+		addr, accepted := listenCount(t)
+		pStore := newPeerStore(t, true, newTestPeer("peer-1", "aaaa", &net.TCPAddr{IP: net.ParseIP("192.168.1.2"), Port: addr.Port}))
+		pStore.Add(newTestPeer("peer-1", "bbbb", addr))
+
+		tr := transfer.NewTransfer("file.txt", "", "peer-1", 10, addr, transfer.Upload)
+		conn, err := c.sendTransferReq(context.Background(), tr, pStore)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("sendTransferReq expected error but got = %v", err)
+		}
+
+		if !strings.Contains(err.Error(), "impersonation") {
+			t.Errorf("sendTransferReq expected impersonation error but got = %v", err)
+		}
+
+		select {
+		case <-accepted:
+			t.Errorf("sendTransferReq expected the peer not connected")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("pinned fingerprint expected", func(t *testing.T) {
+		rID := runReceiver(t, 9954)
+		addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9954}
+		pStore := newPeerStore(t, true, newTestPeer("peer-1", rID.Fingerprint(), addr))
+
+		tr := transfer.NewTransfer("file.txt", "", "peer-1", 10, addr, transfer.Upload)
+		conn, err := c.sendTransferReq(context.Background(), tr, pStore)
+		if err != nil {
+			t.Fatalf("sendTransferReq not expected error = %v", err)
+		}
+		conn.Close()
+
+		if tr.PeerFingerprint != rID.Fingerprint() {
+			t.Errorf("sendTransferReq expected fingerprint = %v but got = %v", rID.Fingerprint(), tr.PeerFingerprint)
+		}
+	})
+
+	t.Run("receiver with another certificate refused", func(t *testing.T) {
+		runReceiver(t, 9955)
+		addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9955}
+		pStore := newPeerStore(t, true, newTestPeer("peer-1", "aaaa", addr))
+
+		tr := transfer.NewTransfer("file.txt", "", "peer-1", 10, addr, transfer.Upload)
+		conn, err := c.sendTransferReq(context.Background(), tr, pStore)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("sendTransferReq expected error but got = %v", err)
+		}
+
+		if tr.PeerFingerprint != "aaaa" {
+			t.Errorf("sendTransferReq expected fingerprint = %v but got = %v", "aaaa", tr.PeerFingerprint)
+		}
+	})
+
+	t.Run("peer that left the network", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := l.Addr().(*net.TCPAddr)
+		l.Close()
+
+		tests := []struct {
+			name   string
+			manual bool
+			left   bool
+		}{
+			{"discovered peer", false, true},
+			{"manual peer", true, false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				p := newTestPeer("peer-1", "", addr)
+				p.Manual = tt.manual
+				pStore := newPeerStore(t, true, p)
+
+				tr := transfer.NewTransfer("file.txt", "", "peer-1", 10, addr, transfer.Upload)
+				conn, err := c.sendTransferReq(context.Background(), tr, pStore)
+				if err == nil {
+					conn.Close()
+					t.Fatalf("sendTransferReq expected error but got = %v", err)
+				}
+
+				if !errors.Is(err, transfer.ErrUnreachable) {
+					t.Errorf("sendTransferReq expected error = %v but got = %v", transfer.ErrUnreachable, err)
+				}
+
+				if got := strings.Contains(err.Error(), "may have left the network"); got != tt.left {
+					t.Errorf("sendTransferReq expected peer left = %v but got = %v", tt.left, err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package catchmyfile
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+// Exit codes of the commands.
+const (
+	// The command completed with success.
+	ExitOK = 0
+	// The command failed with a local error, like a file that can't be read.
+	ExitError = 1
+	// The command or its arguments are not valid.
+	ExitUsage = 2
+	// The transfer was rejected by the peer.
+	ExitRejected = 3
+	// The peer failed the verification of the files received.
+	ExitVerification = 4
+	// The peer wasn't found or there was an error on the connection.
+	ExitNetwork = 5
+	// The transfer was cancelled by one of the peers.
+	ExitCancelled = 6
+)
+
+// IsCommand returns true if the args run a command on the terminal, the
+// args of the application window only have options.
+func IsCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "-h", "-help", "--help":
+		return true
+	}
+	return !strings.HasPrefix(args[0], "-")
+}
+
+// Options will parse the options of the application window on the args.
+//
+// If there is an error, it's because the options are not valid and the
+// usage was written to the stderr.
+func (c *CatchMyFileApp) Options(args []string) error {
+	var peers, ifaces listFlag
+	fs := flag.NewFlagSet("catch-my-file", flag.ContinueOnError)
+	fs.Var(&peers, "peer", "host:port of a peer that can't be discovered, can be repeated")
+	fs.Var(&ifaces, "interface", "network interface to use, can be repeated (default the interfaces on the preferences or all)")
+	name := fs.String("name", "", "name shown to the other peers (default the name on the preferences or the hostname)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: catch-my-file [--peer <host:port>] [--interface <name>] [--name <name>]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("catchmyfile options error: unexpected arguments %v", fs.Args())
+	}
+
+	c.peers = peers
+	c.ifaceNames = ifaces
+	c.displayName = *name
+	return nil
+}
+
+// Command will run the command on the args from the terminal without
+// opening the application window and return the exit code.
+//
+// The logs of the send and peers commands are only written to the log file
+// so their output is not mixed with them.
+//
+// The commands don't create the Fyne application, they use the application
+// storage and preferences directly so they run without a display.
+func (c *CatchMyFileApp) Command(args []string) int {
+	switch args[0] {
+	case "send", "receive", "peers":
+		if err := c.initStorage(); err != nil {
+			return fail(err, ExitError)
+		}
+	}
+
+	switch args[0] {
+	case "send":
+		clog.Quiet()
+		return c.sendCommand(args[1:])
+	case "receive":
+		return c.receiveCommand(args[1:])
+	case "peers":
+		clog.Quiet()
+		return c.peersCommand(args[1:])
+	case "help", "-h", "--help":
+		usage(os.Stdout)
+		return ExitOK
+	}
+
+	fmt.Fprintf(os.Stderr, "catch-my-file: unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	return ExitUsage
+}
+
+// initStorage will set the application storage and load the preferences
+// stored on it without the Fyne application.
+func (c *CatchMyFileApp) initStorage() error {
+	dir, err := storageDir()
+	if err != nil {
+		return err
+	}
+
+	prefs, err := loadPreferences(filepath.Join(dir, preferencesFile))
+	if err != nil {
+		return err
+	}
+
+	c.storage = dir
+	c.prefs = prefs
+	return nil
+}
+
+// usage will write the commands available to w.
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage:
+  catch-my-file [--peer <host:port>] [--interface <name>] [--name <name>]
+                                                       open the application window
+  catch-my-file send --peer <name|ip:port> <path>...   send files or a directory to a peer
+  catch-my-file receive --dir <path> [rules]           receive files accepted by the rules
+  catch-my-file peers [--timeout <duration>] [--json]  list the peers on the local network
+
+Run a command with -h to see its options.
+
+Exit codes:
+  0 completed, 1 local error, 2 invalid usage, 3 rejected,
+  4 verification failed, 5 network error, 6 cancelled
+`)
+}
+
+// exitCode returns the exit code of the error of a transfer.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, transfer.ErrRejected):
+		return ExitRejected
+	case errors.Is(err, transfer.ErrCancelled):
+		return ExitCancelled
+	case errors.Is(err, transfer.ErrChecksumMismatch),
+		errors.Is(err, transfer.ErrSizeMismatch),
+		errors.Is(err, transfer.ErrReceiveFailed):
+		return ExitVerification
+	}
+	return ExitNetwork
+}
+
+// fail will write the error and the log file to the stderr and return the
+// code.
+func fail(err error, code int) int {
+	fmt.Fprintf(os.Stderr, "catch-my-file: %v\nLog file: %s\n", err, clog.LogFile())
+	return code
+}
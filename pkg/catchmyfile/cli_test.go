@@ -0,0 +1,135 @@
+package catchmyfile
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+func Test_IsCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"no args", nil, false},
+		{"window options", []string{"--peer", "10.0.0.5:8822"}, false},
+		{"send command", []string{"send", "--peer", "nas", "file.txt"}, true},
+		{"unknown command", []string{"sned"}, true},
+		{"help", []string{"--help"}, true},
+		{"short help", []string{"-h"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCommand(tt.args); got != tt.want {
+				t.Errorf("IsCommand expected = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_CatchMyFileApp_Options(t *testing.T) {
+	t.Run("options parsed", func(t *testing.T) {
+		c := New(8822)
+		err := c.Options([]string{"--peer", "10.0.0.5:8822", "--peer", "nas,build-server", "--interface", "eth0", "--name", "Office"})
+		if err != nil {
+			t.Fatalf("Options not expected error = %v", err)
+		}
+
+		if want := []string{"10.0.0.5:8822", "nas", "build-server"}; !reflect.DeepEqual(c.peers, want) {
+			t.Errorf("Options expected peers = %v but got = %v", want, c.peers)
+		}
+
+		if want := []string{"eth0"}; !reflect.DeepEqual(c.ifaceNames, want) {
+			t.Errorf("Options expected interfaces = %v but got = %v", want, c.ifaceNames)
+		}
+
+		if c.displayName != "Office" {
+			t.Errorf("Options expected name = %v but got = %v", "Office", c.displayName)
+		}
+	})
+
+	t.Run("no options", func(t *testing.T) {
+		c := New(8822)
+		if err := c.Options(nil); err != nil {
+			t.Fatalf("Options not expected error = %v", err)
+		}
+
+		if len(c.peers) != 0 || len(c.ifaceNames) != 0 || c.displayName != "" {
+			t.Errorf("Options expected no options but got = %v, %v, %v", c.peers, c.ifaceNames, c.displayName)
+		}
+	})
+
+	for _, args := range [][]string{{"--unknown"}, {"--peer"}, {"--name", "Office", "extra"}} {
+		t.Run(fmt.Sprintf("invalid options %v", args), func(t *testing.T) {
+			if err := New(8822).Options(args); err == nil {
+				t.Errorf("Options expected error but got = %v", err)
+			}
+		})
+	}
+}
+
+func Test_exitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"completed", nil, ExitOK},
+		{"rejected", fmt.Errorf("sender error: %w", transfer.ErrRejected), ExitRejected},
+		{"cancelled", fmt.Errorf("sender error: %w", transfer.ErrCancelled), ExitCancelled},
+		{"checksum mismatch", fmt.Errorf("sender error: %w", transfer.ErrChecksumMismatch), ExitVerification},
+		{"size mismatch", transfer.ErrSizeMismatch, ExitVerification},
+		{"receive failed", transfer.ErrReceiveFailed, ExitVerification},
+		{"peer not found", fmt.Errorf("%w: nas", errPeerNotFound), ExitNetwork},
+		{"connection error", errors.New("connection refused"), ExitNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode expected = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_CatchMyFileApp_Command(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"help", []string{"help"}, ExitOK},
+		{"unknown command", []string{"sned"}, ExitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(8822).Command(tt.args); got != tt.want {
+				t.Errorf("Command expected exit code = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_CatchMyFileApp_sendCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"help", []string{"-h"}, ExitOK},
+		{"no peer", []string{"file.txt"}, ExitUsage},
+		{"no files", []string{"--peer", "nas"}, ExitUsage},
+		{"unknown option", []string{"--unknown", "--peer", "nas", "file.txt"}, ExitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(8822).sendCommand(tt.args); got != tt.want {
+				t.Errorf("sendCommand expected exit code = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package catchmyfile
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+// manualPeersFile is the name of the file with the peers added manually.
+const manualPeersFile = "manual_peers.json"
+
+// Interval between each check of the manual peers, the same of the
+// discovery of the other peers.
+const probeInterval = 30 * time.Second
+
+// watchManualPeers will add the manual peers stored and the peers on the
+// options and check them on every probeInterval until the context is
+// cancelled, the peers that don't answer are set offline.
+func (c *CatchMyFileApp) watchManualPeers(ctx context.Context, pStore *peer.PeerStore) {
+	c.probeManualPeers(ctx, pStore)
+
+	for _, target := range c.peers {
+		if err := c.addPeer(ctx, target, pStore); err != nil {
+			handleError(err, c.w)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(probeInterval):
+		}
+		c.probeManualPeers(ctx, pStore)
+	}
+}
+
+// probeManualPeers will check each one of the manual peers stored and
+// update them on the store.
+func (c *CatchMyFileApp) probeManualPeers(ctx context.Context, pStore *peer.PeerStore) {
+	for _, mp := range pStore.Manual.List() {
+		p, err := c.probePeer(ctx, mp.Address, pStore)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			clog.Error(err)
+			p = peer.NewManualPeer(mp.Name, mp.Address, nil)
+			p.Offline = true
+		}
+
+		if _, err = pStore.AddManual(p); err != nil {
+			clog.Error(err)
+		}
+	}
+}
+
+// addPeer will check the peer on the target and add it to the store as a
+// manual peer, the default port is used if the target doesn't have one.
+//
+// If there is an error, it can be because the peer didn't answer or the
+// manual peers couldn't be stored.
+func (c *CatchMyFileApp) addPeer(ctx context.Context, target string, pStore *peer.PeerStore) error {
+	p, err := c.probePeer(ctx, peerTarget(target, c.port), pStore)
+	if err != nil {
+		return err
+	}
+
+	_, err = pStore.AddManual(p)
+	return err
+}
+
+// probePeer will ping the peer on the target and return it with the name
+// and the fingerprint it answered.
+//
+// If there is an error, it can be because the target couldn't be resolved
+// or the peer didn't answer.
+func (c *CatchMyFileApp) probePeer(ctx context.Context, target string, pStore *peer.PeerStore) (*peer.Peer, error) {
+	addrs, err := network.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+
+	name, fingerprint, err := transfer.Ping(ctx, addrs, localName(pStore), c.id, c.ifaces)
+	if err != nil {
+		return nil, fmt.Errorf("peer %s didn't answer: %v", target, err)
+	}
+
+	p := peer.NewManualPeer(name, target, addrs)
+	p.Fingerprint = fingerprint
+	return p, nil
+}
+
+// peerTarget returns the target as host:port, the port is added if the
+// target doesn't have one.
+func peerTarget(target string, port int) string {
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(strings.Trim(target, "[]"), strconv.Itoa(port))
+}
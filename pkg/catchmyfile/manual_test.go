@@ -0,0 +1,118 @@
+package catchmyfile
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+)
+
+func Test_peerTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"host with port", "nas:9000", "nas:9000"},
+		{"host without port", "nas", "nas:8822"},
+		{"IPv4 without port", "10.0.0.5", "10.0.0.5:8822"},
+		{"IPv6 with port", "[fd00::5]:9000", "[fd00::5]:9000"},
+		{"IPv6 without port", "fd00::5", "[fd00::5]:8822"},
+		{"IPv6 with brackets without port", "[fd00::5]", "[fd00::5]:8822"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peerTarget(tt.target, 8822); got != tt.want {
+				t.Errorf("peerTarget expected = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// newManualStore returns a store with the known and manual peers stored
+// on a temporary directory.
+func newManualStore(t *testing.T) *peer.PeerStore {
+	pStore := newPeerStore(t, true)
+	manual, err := peer.LoadManualPeers(filepath.Join(t.TempDir(), manualPeersFile))
+	if err != nil {
+		t.Fatalf("LoadManualPeers not expected error = %v", err)
+	}
+	pStore.Manual = manual
+	return pStore
+}
+
+func Test_CatchMyFileApp_addPeer(t *testing.T) {
+	sID, err := identity.New()
+	if err != nil {
+		t.Fatalf("identity New not expected error = %v", err)
+	}
+	c := New(9958)
+	c.id = sID
+
+	t.Run("peer added with the default port", func(t *testing.T) {
+		rID := runReceiver(t, 9958)
+		pStore := newManualStore(t)
+
+		if err := c.addPeer(context.Background(), "127.0.0.1", pStore); err != nil {
+			t.Fatalf("addPeer not expected error = %v", err)
+		}
+
+		p := pStore.FindByIP(net.ParseIP("127.0.0.1"))
+		if p == nil {
+			t.Fatalf("addPeer expected peer on the store but got = %v", p)
+		}
+
+		if !p.Manual || p.Target != "127.0.0.1:9958" || p.Name != network.Hostname() {
+			t.Errorf("addPeer expected manual peer %v on 127.0.0.1:9958 but got = %v on %v", network.Hostname(), p.Name, p.Target)
+		}
+
+		if p.Fingerprint != rID.Fingerprint() || p.Trust != peer.Trusted {
+			t.Errorf("addPeer expected trusted fingerprint = %v but got = %v (%v)", rID.Fingerprint(), p.Fingerprint, p.Trust)
+		}
+
+		if list := pStore.Manual.List(); len(list) != 1 || list[0].Address != "127.0.0.1:9958" {
+			t.Errorf("addPeer expected the manual peer stored but got = %v", list)
+		}
+	})
+
+	t.Run("peer not answering", func(t *testing.T) {
+		pStore := newManualStore(t)
+
+		if err := c.addPeer(context.Background(), "127.0.0.1:1", pStore); err == nil {
+			t.Errorf("addPeer expected error but got = %v", err)
+		}
+
+		if pStore.Size() != 0 || len(pStore.Manual.List()) != 0 {
+			t.Errorf("addPeer expected no peer added but got = %v", pStore.List())
+		}
+	})
+}
+
+func Test_CatchMyFileApp_probeManualPeers(t *testing.T) {
+	sID, err := identity.New()
+	if err != nil {
+		t.Fatalf("identity New not expected error = %v", err)
+	}
+	c := New(8822)
+	c.id = sID
+
+	pStore := newManualStore(t)
+	if err := pStore.Manual.Add(peer.ManualPeer{Name: "nas", Address: "127.0.0.1:1"}); err != nil {
+		t.Fatalf("Manual Add not expected error = %v", err)
+	}
+
+	c.probeManualPeers(context.Background(), pStore)
+
+	list := pStore.List()
+	if len(list) != 1 {
+		t.Fatalf("probeManualPeers expected 1 peer but got = %v", list)
+	}
+
+	if p := list[0]; !p.Manual || !p.Offline || p.Name != "nas" || p.Target != "127.0.0.1:1" {
+		t.Errorf("probeManualPeers expected offline manual peer nas but got = %+v", p)
+	}
+}
@@ -0,0 +1,56 @@
+package catchmyfile
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+// Version is the version of the application advertised to the other peers,
+// it's set when building with -ldflags "-X ...catchmyfile.Version=1.2.3".
+var Version = "dev"
+
+// Preference keys of the metadata advertised to the other peers.
+const (
+	displayNameKey = "peer.display_name"
+	deviceIDKey    = "peer.device_id"
+)
+
+// metadata returns the metadata advertised to the other peers, the display
+// name on the options replaces the one on the preferences.
+//
+// The device ID is generated and stored on the preferences the first time,
+// so it doesn't change between executions.
+func (c *CatchMyFileApp) metadata() peer.Metadata {
+	prefs := c.prefs
+
+	displayName := c.displayName
+	if displayName == "" {
+		displayName = prefs.String(displayNameKey)
+	}
+
+	deviceID := prefs.String(deviceIDKey)
+	if deviceID == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			clog.Error(fmt.Errorf("catchmyfile generate device id error: %v", err))
+		} else {
+			deviceID = hex.EncodeToString(b)
+			prefs.SetString(deviceIDKey, deviceID)
+		}
+	}
+
+	return peer.Metadata{
+		Protocol:     transfer.ProtocolVersion,
+		AppVersion:   Version,
+		OS:           runtime.GOOS,
+		DisplayName:  displayName,
+		DeviceID:     deviceID,
+		Capabilities: transfer.Capabilities(c.id),
+	}
+}
@@ -0,0 +1,84 @@
+package catchmyfile
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+func Test_CatchMyFileApp_metadata(t *testing.T) {
+	id, err := identity.New()
+	if err != nil {
+		t.Fatalf("identity New not expected error = %v", err)
+	}
+
+	// newApp returns the application with the preferences stored on the path.
+	newApp := func(t *testing.T, path string) *CatchMyFileApp {
+		prefs, err := loadPreferences(path)
+		if err != nil {
+			t.Fatalf("loadPreferences not expected error = %v", err)
+		}
+
+		c := New(8822)
+		c.id = id
+		c.prefs = prefs
+		return c
+	}
+
+	t.Run("device id kept between executions", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), preferencesFile)
+
+		md := newApp(t, path).metadata()
+		if len(md.DeviceID) != 32 {
+			t.Fatalf("metadata expected device id with 32 characters but got = %q", md.DeviceID)
+		}
+
+		if got := newApp(t, path).metadata().DeviceID; got != md.DeviceID {
+			t.Errorf("metadata expected device id = %v but got = %v", md.DeviceID, got)
+		}
+
+		if got := newApp(t, filepath.Join(t.TempDir(), preferencesFile)).metadata().DeviceID; got == md.DeviceID {
+			t.Errorf("metadata expected another device id but got = %v", got)
+		}
+	})
+
+	t.Run("application advertised", func(t *testing.T) {
+		md := newApp(t, filepath.Join(t.TempDir(), preferencesFile)).metadata()
+
+		if md.Protocol != transfer.ProtocolVersion || md.AppVersion != Version || md.OS != runtime.GOOS {
+			t.Errorf("metadata expected protocol %v, version %v and os %v but got = %+v", transfer.ProtocolVersion, Version, runtime.GOOS, md)
+		}
+
+		if len(md.Capabilities) == 0 {
+			t.Errorf("metadata expected the capabilities but got = %v", md.Capabilities)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		option string
+		stored string
+		want   string
+	}{
+		{"no display name", "", "", ""},
+		{"display name on the preferences", "", "Office", "Office"},
+		{"display name on the options", "Laptop", "", "Laptop"},
+		{"display name on the options replaces the preferences", "Laptop", "Office", "Laptop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newApp(t, filepath.Join(t.TempDir(), preferencesFile))
+			c.displayName = tt.option
+			if tt.stored != "" {
+				c.prefs.SetString(displayNameKey, tt.stored)
+			}
+
+			if got := c.metadata().DisplayName; got != tt.want {
+				t.Errorf("metadata expected display name = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
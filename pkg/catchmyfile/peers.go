@@ -0,0 +1,130 @@
+package catchmyfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+)
+
+// Time to browse the local network for peers.
+const browseTimeout = 5 //seconds
+
+// peerOutput is a peer printed by the peers command.
+type peerOutput struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+	Address     string `json:"address"`
+	Port        int    `json:"port"`
+	Me          bool   `json:"me"`
+	OS          string `json:"os,omitempty"`
+	Version     string `json:"version,omitempty"`
+	DeviceID    string `json:"device_id,omitempty"`
+}
+
+// peersCommand will browse the local network for peers during the time
+// on the args and print the peers discovered as a table or as JSON.
+func (c *CatchMyFileApp) peersCommand(args []string) int {
+	fs := flag.NewFlagSet("peers", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", browseTimeout*time.Second, "time to browse the local network for peers")
+	asJSON := fs.Bool("json", false, "print the peers as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: catch-my-file peers [--timeout <duration>] [--json]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(c.ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	pStore := peer.NewStore()
+	done := make(chan interface{})
+	server := peer.NewServer(network.Hostname(), c.port, "", pStore)
+	if err := server.Discover(ctx, done); err != nil {
+		return fail(err, ExitNetwork)
+	}
+	<-done
+
+	peers := discovered(pStore)
+
+	var err error
+	if *asJSON {
+		err = printPeersJSON(os.Stdout, peers)
+	} else {
+		err = printPeersTable(os.Stdout, peers)
+	}
+	if err != nil {
+		return fail(err, ExitError)
+	}
+	return ExitOK
+}
+
+// discovered returns the peers on the store, a peer discovered more than
+// once is only returned once.
+func discovered(pStore *peer.PeerStore) []peerOutput {
+	list := pStore.List()
+	peers := make([]peerOutput, 0, len(list))
+	seen := make(map[peerOutput]bool, len(list))
+	for _, p := range list {
+		out := peerOutput{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			Address:     p.IPAddress.String(),
+			Port:        p.Port,
+			Me:          p.Me,
+			OS:          p.OS,
+			Version:     p.AppVersion,
+			DeviceID:    p.DeviceID,
+		}
+		if !seen[out] {
+			seen[out] = true
+			peers = append(peers, out)
+		}
+	}
+	return peers
+}
+
+// printPeersTable will write the peers to w as a table with a header.
+func printPeersTable(w io.Writer, peers []peerOutput) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDISPLAY NAME\tADDRESS\tPORT\tOS\tVERSION\tME")
+	for _, p := range peers {
+		me := ""
+		if p.Me {
+			me = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", p.Name, p.DisplayName, p.Address, p.Port, p.OS, p.Version, me)
+	}
+	return tw.Flush()
+}
+
+// printPeersJSON will write the peers to w as a JSON array.
+func printPeersJSON(w io.Writer, peers []peerOutput) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(peers)
+}
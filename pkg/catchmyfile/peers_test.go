@@ -0,0 +1,133 @@
+package catchmyfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+)
+
+func Test_discovered(t *testing.T) {
+	pStore := peer.NewStore()
+	pStore.Add(&peer.Peer{Name: "me", IPAddress: net.ParseIP("192.168.1.1"), Port: 8822, Me: true})
+	nas := &peer.Peer{
+		Name:      "nas",
+		IPAddress: net.ParseIP("192.168.1.2"),
+		Port:      8822,
+		Instance:  "nas-1",
+		Metadata:  peer.Metadata{DisplayName: "Storage", OS: "linux", AppVersion: "1.2.3", DeviceID: "abcd"},
+	}
+	pStore.Add(nas)
+	// The same peer discovered on another interface.
+	pStore.Add(&peer.Peer{
+		Name:      "nas",
+		IPAddress: net.ParseIP("192.168.1.2"),
+		Port:      8822,
+		Instance:  "nas-2",
+		Metadata:  nas.Metadata,
+	})
+
+	t.Run("peer discovered twice returned once", func(t *testing.T) {
+		want := []peerOutput{
+			{Name: "me", Address: "192.168.1.1", Port: 8822, Me: true},
+			{Name: "nas", DisplayName: "Storage", Address: "192.168.1.2", Port: 8822, OS: "linux", Version: "1.2.3", DeviceID: "abcd"},
+		}
+		if got := discovered(pStore); !reflect.DeepEqual(got, want) {
+			t.Errorf("discovered expected = %v but got = %v", want, got)
+		}
+	})
+
+	t.Run("no peers", func(t *testing.T) {
+		if got := discovered(peer.NewStore()); got == nil || len(got) != 0 {
+			t.Errorf("discovered expected empty but got = %v", got)
+		}
+	})
+}
+
+func Test_printPeersTable(t *testing.T) {
+	var out bytes.Buffer
+	err := printPeersTable(&out, []peerOutput{
+		{Name: "me", Address: "192.168.1.1", Port: 8822, Me: true},
+		{Name: "nas", DisplayName: "Storage", Address: "192.168.1.2", Port: 8822, OS: "linux", Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("printPeersTable not expected error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("printPeersTable expected 3 lines but got = %q", out.String())
+	}
+
+	if fields := strings.Fields(lines[0]); fields[0] != "NAME" || fields[len(fields)-1] != "ME" {
+		t.Errorf("printPeersTable expected header but got = %q", lines[0])
+	}
+
+	if fields := strings.Fields(lines[1]); fields[0] != "me" || fields[len(fields)-1] != "yes" {
+		t.Errorf("printPeersTable expected local peer but got = %q", lines[1])
+	}
+
+	if want := []string{"nas", "Storage", "192.168.1.2", "8822", "linux", "1.2.3"}; !reflect.DeepEqual(strings.Fields(lines[2]), want) {
+		t.Errorf("printPeersTable expected = %v but got = %q", want, lines[2])
+	}
+}
+
+func Test_printPeersJSON(t *testing.T) {
+	t.Run("peers", func(t *testing.T) {
+		peers := []peerOutput{
+			{Name: "nas", DisplayName: "Storage", Address: "192.168.1.2", Port: 8822, OS: "linux", Version: "1.2.3", DeviceID: "abcd"},
+		}
+
+		var out bytes.Buffer
+		if err := printPeersJSON(&out, peers); err != nil {
+			t.Fatalf("printPeersJSON not expected error = %v", err)
+		}
+
+		var got []map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("printPeersJSON expected JSON but got = %q", out.String())
+		}
+
+		want := map[string]interface{}{
+			"name": "nas", "display_name": "Storage", "address": "192.168.1.2", "port": float64(8822),
+			"me": false, "os": "linux", "version": "1.2.3", "device_id": "abcd",
+		}
+		if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+			t.Errorf("printPeersJSON expected = %v but got = %v", want, got)
+		}
+	})
+
+	t.Run("no peers", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printPeersJSON(&out, []peerOutput{}); err != nil {
+			t.Fatalf("printPeersJSON not expected error = %v", err)
+		}
+
+		if got := strings.TrimSpace(out.String()); got != "[]" {
+			t.Errorf("printPeersJSON expected = [] but got = %q", got)
+		}
+	})
+}
+
+func Test_CatchMyFileApp_peersCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"help", []string{"-h"}, ExitOK},
+		{"unexpected arguments", []string{"nas"}, ExitUsage},
+		{"invalid timeout", []string{"--timeout", "soon"}, ExitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(8822).peersCommand(tt.args); got != tt.want {
+				t.Errorf("peersCommand expected exit code = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package catchmyfile
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+// listFlag is a flag that can be repeated or have several values separated
+// by commas.
+type listFlag []string
+
+// String returns the values separated by commas.
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set will add the values separated by commas.
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// receiveCommand will run the peer server and the receiver without the
+// application window until it's interrupted, the transfers received are
+// decided by the rules on the args and the accepted ones are stored on
+// the directory.
+func (c *CatchMyFileApp) receiveCommand(args []string) int {
+	var allow, patterns, ifaces listFlag
+	fs := flag.NewFlagSet("receive", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory where the files received are stored")
+	maxSize := fs.String("max-size", "", "maximum size of a transfer, like 500MB or 2GB (default no limit)")
+	name := fs.String("name", "", "name shown to the other peers (default the name on the preferences or the hostname)")
+	fs.Var(&allow, "allow", "name of a known peer allowed to send, verified by its pinned fingerprint, can be repeated (default any peer)")
+	fs.Var(&patterns, "pattern", "pattern the file names must match, like *.zip, can be repeated (default any name)")
+	fs.Var(&ifaces, "interface", "network interface to use, can be repeated (default the interfaces on the preferences or all)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: catch-my-file receive --dir <path> [--allow <name>] [--max-size <size>] [--pattern <pattern>] [--interface <name>] [--name <name>]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if *dir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	rules := &transfer.Rules{Allow: allow, Patterns: patterns}
+	if *maxSize != "" {
+		size, err := transfer.ParseSize(*maxSize)
+		if err != nil {
+			return fail(err, ExitUsage)
+		}
+		rules.MaxSize = size
+	}
+	if err := rules.Validate(); err != nil {
+		return fail(err, ExitUsage)
+	}
+
+	if st, err := os.Stat(*dir); err != nil || !st.IsDir() {
+		return fail(fmt.Errorf("%s is not a directory", *dir), ExitUsage)
+	}
+
+	ctx, stop := signal.NotifyContext(c.ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pStore, tStore, err := c.load()
+	if err != nil {
+		return fail(err, ExitError)
+	}
+
+	c.ifaceNames = ifaces
+	interfaces, err := c.interfaces()
+	if err != nil {
+		return fail(err, ExitUsage)
+	}
+
+	pServer := peer.NewServer(network.Hostname(), c.port, c.id.Fingerprint(), pStore)
+	pServer.Interfaces = interfaces
+	c.displayName = *name
+	pServer.Metadata = c.metadata()
+	tReceiver := transfer.NewReceiver(c.port, tStore, c.id)
+	tReceiver.Interfaces = interfaces
+	tReceiver.VerifyPeer = func(addr net.Addr, fingerprint string) (string, bool) {
+		return verifyPeer(pStore, addr, fingerprint)
+	}
+
+	// The status of each transfer already logged, the store changes are
+	// notified from the goroutine of each transfer.
+	var mu sync.Mutex
+	statuses := make(map[string]transfer.Status)
+	tStore.OnStoreChange = func(id string) {
+		t := tStore.Get(id)
+		if t == nil {
+			return
+		}
+
+		mu.Lock()
+		changed := statuses[id] != t.Status
+		statuses[id] = t.Status
+		mu.Unlock()
+
+		if t.Direction != transfer.Download || !changed {
+			return
+		}
+
+		if t.Status == transfer.Waiting {
+			decide(id, t, *dir, rules, tStore)
+			return
+		}
+		logTransfer(id, t)
+	}
+
+	pDone := make(chan interface{})
+	if err = pServer.Run(ctx, pDone); err != nil {
+		return fail(err, ExitNetwork)
+	}
+
+	rDone := make(chan interface{})
+	if err = tReceiver.Run(ctx, rDone); err != nil {
+		stop()
+		<-pDone
+		return fail(err, ExitNetwork)
+	}
+
+	clog.Info("Receiving on port %d into %s", c.port, *dir)
+
+	<-pDone // Wait for Peers server to finish
+	<-rDone // Wait for Receiver server to finish
+
+	return ExitOK
+}
+
+// decide will accept or reject the transfer with the id with the rules.
+func decide(id string, t *transfer.Transfer, dir string, rules *transfer.Rules, tStore *transfer.TransferStore) {
+	if err := rules.Decide(t, dir); err != nil {
+		clog.Info("transfer %s of %s from %s rejected: %v", id, t.FileName, t.SenderName, err)
+	}
+	if err := tStore.Decide(id, t); err != nil {
+		clog.Error(err)
+	}
+}
+
+// logTransfer will log the status of the transfer with the id.
+func logTransfer(id string, t *transfer.Transfer) {
+	switch t.Status {
+	case transfer.Rejected:
+		// It's logged with the reason when decided.
+	case transfer.Accepted:
+		clog.Info("transfer %s of %s from %s accepted into %s", id, t.FileName, t.SenderName, t.LocalFilePath)
+	case transfer.Error:
+		clog.Error(fmt.Errorf("transfer %s of %s from %s failed: %v", id, t.FileName, t.SenderName, t.Error()))
+	default:
+		clog.Info("transfer %s of %s from %s: %v", id, t.FileName, t.SenderName, t.Status)
+	}
+}
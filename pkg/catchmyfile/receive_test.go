@@ -0,0 +1,158 @@
+package catchmyfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+func Test_listFlag_Set(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"single value", []string{"nas"}, []string{"nas"}},
+		{"repeated", []string{"nas", "build-server"}, []string{"nas", "build-server"}},
+		{"separated by commas", []string{"nas, build-server,,"}, []string{"nas", "build-server"}},
+		{"empty", []string{""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l listFlag
+			for _, v := range tt.values {
+				if err := l.Set(v); err != nil {
+					t.Fatalf("Set not expected error = %v", err)
+				}
+			}
+
+			if !reflect.DeepEqual([]string(l), tt.want) {
+				t.Errorf("Set expected = %v but got = %v", tt.want, l)
+			}
+		})
+	}
+}
+
+func Test_decide(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		rules     *transfer.Rules
+		verified  string
+		untrusted bool
+		size      int64
+		want      transfer.Status
+	}{
+		{
+			name:  "accepted without rules",
+			rules: &transfer.Rules{},
+			size:  10,
+			want:  transfer.Accepted,
+		},
+		{
+			name:     "accepted from an allowed sender",
+			rules:    &transfer.Rules{Allow: []string{"peer-1"}},
+			verified: "peer-1",
+			size:     10,
+			want:     transfer.Accepted,
+		},
+		{
+			name:     "rejected from a sender not allowed",
+			rules:    &transfer.Rules{Allow: []string{"peer-2"}},
+			verified: "peer-1",
+			size:     10,
+			want:     transfer.Rejected,
+		},
+		{
+			name:  "rejected from a sender not verified",
+			rules: &transfer.Rules{Allow: []string{"peer-1"}},
+			size:  10,
+			want:  transfer.Rejected,
+		},
+		{
+			name:      "rejected from an untrusted sender",
+			rules:     &transfer.Rules{},
+			untrusted: true,
+			size:      10,
+			want:      transfer.Rejected,
+		},
+		{
+			name:  "rejected over the maximum size",
+			rules: &transfer.Rules{MaxSize: 5},
+			size:  10,
+			want:  transfer.Rejected,
+		},
+		{
+			name:  "rejected not matching the patterns",
+			rules: &transfer.Rules{Patterns: []string{"*.zip"}},
+			size:  10,
+			want:  transfer.Rejected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tStore := transfer.NewStore()
+			tr := transfer.NewTransfer("file.txt", "", "peer-1", tt.size, nil, transfer.Download)
+			tr.VerifiedName = tt.verified
+			tr.Untrusted = tt.untrusted
+			id := tStore.Add(tr)
+
+			decide(id, tStore.Get(id), dir, tt.rules, tStore)
+
+			got := tStore.Get(id)
+			if got.Status != tt.want {
+				t.Fatalf("decide expected status = %v but got = %v", tt.want, got.Status)
+			}
+
+			if tt.want == transfer.Accepted && got.LocalFilePath != filepath.Join(dir, "file.txt") {
+				t.Errorf("decide expected path = %v but got = %v", filepath.Join(dir, "file.txt"), got.LocalFilePath)
+			}
+		})
+	}
+
+	t.Run("transfer already decided", func(t *testing.T) {
+		tStore := transfer.NewStore()
+		id := tStore.Add(transfer.NewTransfer("file.txt", "", "peer-1", 10, nil, transfer.Download))
+		tr := tStore.Get(id)
+		tr.Status = transfer.Cancelled
+		tStore.Update(id, tr)
+
+		decide(id, tStore.Get(id), dir, &transfer.Rules{}, tStore)
+
+		if got := tStore.Get(id).Status; got != transfer.Cancelled {
+			t.Errorf("decide expected status = %v but got = %v", transfer.Cancelled, got)
+		}
+	})
+}
+
+func Test_CatchMyFileApp_receiveCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"help", []string{"-h"}, ExitOK},
+		{"no directory", []string{"--allow", "nas"}, ExitUsage},
+		{"unexpected arguments", []string{"--dir", t.TempDir(), "extra"}, ExitUsage},
+		{"invalid size", []string{"--dir", t.TempDir(), "--max-size", "big"}, ExitUsage},
+		{"invalid pattern", []string{"--dir", t.TempDir(), "--pattern", "[a-"}, ExitUsage},
+		{"directory doesn't exist", []string{"--dir", filepath.Join(t.TempDir(), "missing")}, ExitUsage},
+		{"directory is a file", []string{"--dir", file}, ExitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(8822).receiveCommand(tt.args); got != tt.want {
+				t.Errorf("receiveCommand expected exit code = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
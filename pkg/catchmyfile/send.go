@@ -0,0 +1,291 @@
+package catchmyfile
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+const (
+	// Time to wait for a peer to be discovered by name.
+	discoverTimeout = 10 //seconds
+	// Interval between each lookup of the peer on the store.
+	discoverInterval = 200 * time.Millisecond
+)
+
+// errPeerNotFound signals that no peer was discovered with the name.
+var errPeerNotFound = errors.New("peer not found")
+
+// sendCommand will send the files or directory on the args to the peer
+// and print the progress until the transfer ends.
+//
+// A single file or directory is sent as it is, several files are sent as
+// a batch. Interrupting the command cancels the transfer.
+func (c *CatchMyFileApp) sendCommand(args []string) int {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	target := fs.String("peer", "", "name or ip:port of the peer that receives the files")
+	timeout := fs.Duration("timeout", discoverTimeout*time.Second, "time to wait for the peer to be discovered by name")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: catch-my-file send --peer <name|ip:port> <path>...")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if *target == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(c.ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pStore, tStore, err := c.load()
+	if err != nil {
+		return fail(err, ExitError)
+	}
+
+	if c.ifaces, err = c.interfaces(); err != nil {
+		return fail(err, ExitUsage)
+	}
+
+	name, addr, err := c.findPeer(ctx, *target, *timeout, pStore)
+	if err != nil {
+		return fail(err, ExitNetwork)
+	}
+
+	t, err := newUpload(ctx, fs.Args(), name, addr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fail(transfer.ErrCancelled, ExitCancelled)
+		}
+		return fail(err, ExitError)
+	}
+	t.LocalName = network.Hostname()
+
+	id := tStore.Add(t)
+	pr := &progressPrinter{w: os.Stdout, last: -1, status: t.Status}
+	tStore.OnStoreChange = func(id string) {
+		pr.update(tStore.Get(id))
+	}
+	progress, _ := tStore.Subscribe(id)
+	done := pr.follow(progress)
+
+	fmt.Printf("Sending %s to %s (%v), waiting for the peer to accept\n", t.FileName, name, addr)
+
+	err = c.send(ctx, id, t, tStore, pStore)
+	finish(id, err, tStore)
+	<-done
+
+	if err != nil {
+		return fail(err, exitCode(err))
+	}
+	return ExitOK
+}
+
+// findPeer returns the name and address of the peer on the target, it can
+// be the ip:port of the peer or the name of a peer discovered on the local
+// network before the timeout.
+//
+// The peer on the ip:port is pinged to get its name and fingerprint, and
+// added to the store so its fingerprint is checked with the one pinned for
+// its name like the peers discovered. A peer with a fingerprint that doesn't
+// match the pinned one is refused.
+func (c *CatchMyFileApp) findPeer(ctx context.Context, target string, timeout time.Duration, pStore *peer.PeerStore) (string, net.Addr, error) {
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		p, err := c.probePeer(ctx, target, pStore)
+		if err != nil {
+			return "", nil, fmt.Errorf("catchmyfile find peer error: %v", err)
+		}
+
+		pStore.Add(p)
+		if err = checkTrust(p); err != nil {
+			return "", nil, err
+		}
+		return p.Name, p.Address, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan interface{})
+	server := peer.NewServer(network.Hostname(), c.port, c.id.Fingerprint(), pStore)
+	server.Interfaces = c.ifaces
+	if err := server.Discover(ctx, done); err != nil {
+		return "", nil, err
+	}
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	ticker := time.NewTicker(discoverInterval)
+	defer ticker.Stop()
+
+	for {
+		if p := pStore.FindByName(target); p != nil {
+			if err := checkTrust(p); err != nil {
+				return "", nil, err
+			}
+			return p.Name, p.Address, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", nil, fmt.Errorf("%w: %s", errPeerNotFound, target)
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkTrust returns an error if the fingerprint of the peer doesn't match
+// the pinned one, since it can be an impersonation.
+func checkTrust(p *peer.Peer) error {
+	if p.Trust == peer.Mismatch {
+		return fmt.Errorf("peer %s fingerprint doesn't match the pinned fingerprint, possible impersonation", p.Name)
+	}
+	return nil
+}
+
+// newUpload will create the upload of the paths to the peer, a single path
+// is sent as a file or a directory and several paths as a batch of files.
+//
+// If there is an error, it can be because a path doesn't exist, it's not
+// valid for the upload or the checksum couldn't be generated.
+func newUpload(ctx context.Context, paths []string, name string, addr net.Addr) (*transfer.Transfer, error) {
+	if len(paths) > 1 {
+		entries, err := peer.BatchEntries(ctx, paths)
+		if err != nil {
+			return nil, err
+		}
+
+		files := make([]transfer.File, 0, len(entries))
+		for j, e := range entries {
+			files = append(files, transfer.File{Entry: e, LocalPath: paths[j], Status: transfer.Waiting})
+		}
+		return transfer.NewBatchTransfer(name, files, addr, transfer.Upload), nil
+	}
+
+	path := paths[0]
+	fileName, size, err := file.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var t *transfer.Transfer
+	if file.IsDir(path) {
+		entries, err := file.Manifest(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		t = transfer.NewDirectoryTransfer(fileName, name, entries, addr, transfer.Upload)
+	} else {
+		check, err := checksum(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		t = transfer.NewTransfer(fileName, check, name, size, addr, transfer.Upload)
+	}
+
+	t.LocalFilePath = path
+	return t, nil
+}
+
+// checksum returns the checksum of the file on the path.
+func checksum(ctx context.Context, path string) (string, error) {
+	f, err := file.Open(path, file.OPEN_READ)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if cErr := f.Close(); cErr != nil {
+			clog.Error(cErr)
+		}
+	}()
+
+	return file.Checksum(ctx, f)
+}
+
+// progressPrinter will print the progress and the status changes of a
+// transfer on the terminal.
+type progressPrinter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	last   int // last is the percentage printed, -1 if there is none.
+	status transfer.Status
+}
+
+// follow will start a new goroutine that prints the progress received on
+// the channel, the channel returned is closed once the progress ends.
+func (p *progressPrinter) follow(progress <-chan transfer.Progress) <-chan interface{} {
+	done := make(chan interface{})
+	go func() {
+		for v := range progress {
+			p.progress(v)
+		}
+		close(done)
+	}()
+	return done
+}
+
+// progress will print the percentage, with the rate and the time left once
+// they are known, if it changed since the last one, only while the data is
+// being transferred.
+func (p *progressPrinter) progress(v transfer.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pct := int(v.Fraction * 100)
+	if pct == p.last || p.status != transfer.Accepted {
+		return
+	}
+	p.last = pct
+
+	if v.Rate <= 0 {
+		fmt.Fprintf(p.w, "\r%3d%%", pct)
+		return
+	}
+	fmt.Fprintf(p.w, "\r%3d%% %12s %8s left", pct, transfer.FormatRate(int64(v.Rate)), v.ETA.Round(time.Second))
+}
+
+// update will print the status of the transfer if it changed, on a new line
+// if the progress is being printed.
+func (p *progressPrinter) update(t *transfer.Transfer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t == nil || t.Status == p.status {
+		return
+	}
+	p.status = t.Status
+
+	if p.last >= 0 {
+		// All the data was sent once the verification starts.
+		if t.Status == transfer.Verifying || t.Status == transfer.Completed {
+			fmt.Fprint(p.w, "\r100%")
+		}
+		fmt.Fprintln(p.w)
+		p.last = -1
+	}
+	fmt.Fprintln(p.w, t.Status)
+}
@@ -0,0 +1,130 @@
+package catchmyfile
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+func Test_findPeer(t *testing.T) {
+	sID, err := identity.New()
+	if err != nil {
+		t.Fatalf("identity New not expected error = %v", err)
+	}
+	c := New(0)
+	c.id = sID
+
+	// The receivers answer the ping with the hostname.
+	name := network.Hostname()
+
+	t.Run("peer on the address pinned and expected", func(t *testing.T) {
+		rID := runReceiver(t, 9956)
+		pStore := newPeerStore(t, true)
+
+		got, addr, err := c.findPeer(context.Background(), "127.0.0.1:9956", time.Second, pStore)
+		if err != nil {
+			t.Fatalf("findPeer not expected error = %v", err)
+		}
+
+		if got != name {
+			t.Errorf("findPeer expected name = %v but got = %v", name, got)
+		}
+
+		if pinned := pStore.Known.Pinned(name); pinned != rID.Fingerprint() {
+			t.Errorf("findPeer expected pinned fingerprint = %v but got = %v", rID.Fingerprint(), pinned)
+		}
+
+		tr := transfer.NewTransfer("file.txt", "", got, 10, addr, transfer.Upload)
+		conn, err := c.sendTransferReq(context.Background(), tr, pStore)
+		if err != nil {
+			t.Fatalf("sendTransferReq not expected error = %v", err)
+		}
+		conn.Close()
+
+		if tr.PeerFingerprint != rID.Fingerprint() {
+			t.Errorf("sendTransferReq expected fingerprint = %v but got = %v", rID.Fingerprint(), tr.PeerFingerprint)
+		}
+	})
+
+	t.Run("peer on the address with another certificate refused", func(t *testing.T) {
+		runReceiver(t, 9957)
+		pStore := newPeerStore(t, true)
+		pStore.Known.Check(name, "aaaa")
+
+		_, _, err := c.findPeer(context.Background(), "127.0.0.1:9957", time.Second, pStore)
+		if err == nil || !strings.Contains(err.Error(), "impersonation") {
+			t.Errorf("findPeer expected impersonation error but got = %v", err)
+		}
+
+		if pinned := pStore.Known.Pinned(name); pinned != "aaaa" {
+			t.Errorf("findPeer expected pinned fingerprint = %v but got = %v", "aaaa", pinned)
+		}
+	})
+
+	t.Run("peer on the address not answering", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := l.Addr().String()
+		l.Close()
+
+		if _, _, err := c.findPeer(context.Background(), target, time.Second, newPeerStore(t, true)); err == nil {
+			t.Errorf("findPeer expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_progressPrinter(t *testing.T) {
+	t.Run("progress only while accepted", func(t *testing.T) {
+		var out bytes.Buffer
+		pr := &progressPrinter{w: &out, last: -1, status: transfer.Waiting}
+
+		pr.progress(transfer.Progress{Fraction: 0.1})
+		if out.Len() != 0 {
+			t.Errorf("progress expected nothing printed but got = %q", out.String())
+		}
+
+		tr := transfer.NewTransfer("file.txt", "", "peer-1", 10, nil, transfer.Upload)
+		tr.Status = transfer.Accepted
+		pr.update(tr)
+		pr.progress(transfer.Progress{Fraction: 0.5})
+		pr.progress(transfer.Progress{Fraction: 0.501})
+		tr.Status = transfer.Completed
+		pr.update(tr)
+		pr.update(tr)
+
+		want := "Accepted\n\r 50%\r100%\nCompleted\n"
+		if out.String() != want {
+			t.Errorf("progressPrinter expected = %q but got = %q", want, out.String())
+		}
+	})
+
+	t.Run("progress with rate and time left", func(t *testing.T) {
+		var out bytes.Buffer
+		pr := &progressPrinter{w: &out, last: -1, status: transfer.Accepted}
+
+		pr.progress(transfer.Progress{Fraction: 0.25, Rate: 2000, ETA: 3 * time.Second})
+
+		if got := out.String(); !strings.HasPrefix(got, "\r 25%") || !strings.HasSuffix(got, "3s left") {
+			t.Errorf("progress expected percentage, rate and time left but got = %q", got)
+		}
+	})
+
+	t.Run("transfer removed", func(t *testing.T) {
+		var out bytes.Buffer
+		pr := &progressPrinter{w: &out, last: -1, status: transfer.Accepted}
+
+		pr.update(nil)
+		if out.Len() != 0 {
+			t.Errorf("update expected nothing printed but got = %q", out.String())
+		}
+	})
+}
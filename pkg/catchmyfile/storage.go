@@ -0,0 +1,152 @@
+package catchmyfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+)
+
+// appID is the unique ID of the application, it names the directory of the
+// application storage.
+const appID = "github.fabiodcorreia.catch-my-file"
+
+// preferencesFile is the name of the file with the preferences on the
+// application storage.
+const preferencesFile = "preferences.json"
+
+// preferences are the preferences of the application, fyne.Preferences
+// when the window is open and filePreferences on the commands.
+type preferences interface {
+	Int(key string) int
+	IntWithFallback(key string, fallback int) int
+	SetInt(key string, value int)
+	String(key string) string
+	SetString(key string, value string)
+}
+
+// storageDir returns the directory of the application storage, it's the same
+// directory Fyne uses for the application so the commands run without
+// creating the Fyne application.
+//
+// If there is an error, it's because the home directory is unknown.
+func storageDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("catchmyfile storage dir error: %v", err)
+	}
+
+	var config string
+	switch runtime.GOOS {
+	case "darwin":
+		config = filepath.Join(home, "Library", "Preferences")
+	case "windows":
+		config = filepath.Join(home, "AppData", "Roaming")
+	default:
+		config = filepath.Join(home, ".config")
+	}
+	return filepath.Join(config, "fyne", appID), nil
+}
+
+// filePreferences are the preferences stored on the same file and format
+// Fyne uses, a JSON object with the values of each key.
+type filePreferences struct {
+	mu     sync.Mutex
+	path   string
+	values map[string]interface{}
+}
+
+// loadPreferences will read the preferences stored on the file on path, if
+// the file doesn't exist there are no preferences.
+//
+// If there is an error, it's because the file can't be read or decoded.
+func loadPreferences(path string) (*filePreferences, error) {
+	p := &filePreferences{path: path, values: make(map[string]interface{})}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("catchmyfile preferences load error: %v", err)
+	}
+
+	if err = json.Unmarshal(data, &p.values); err != nil {
+		return nil, fmt.Errorf("catchmyfile preferences load error decoding: %v", err)
+	}
+	return p, nil
+}
+
+// Int returns the int value of the key, 0 if it's not set.
+func (p *filePreferences) Int(key string) int {
+	return p.IntWithFallback(key, 0)
+}
+
+// IntWithFallback returns the int value of the key, the fallback if it's not
+// set or it's not a number.
+func (p *filePreferences) IntWithFallback(key string, fallback int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The numbers decoded from JSON are float64.
+	switch v := p.values[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return fallback
+}
+
+// SetInt will set the int value of the key and store the preferences.
+func (p *filePreferences) SetInt(key string, value int) {
+	p.set(key, value)
+}
+
+// String returns the string value of the key, empty if it's not set.
+func (p *filePreferences) String(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	v, _ := p.values[key].(string)
+	return v
+}
+
+// SetString will set the string value of the key and store the preferences.
+func (p *filePreferences) SetString(key string, value string) {
+	p.set(key, value)
+}
+
+// set will set the value of the key and store the preferences, the errors
+// are logged since the value is still used until the application ends.
+func (p *filePreferences) set(key string, value interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.values[key] = value
+	if err := p.save(); err != nil {
+		clog.Error(err)
+	}
+}
+
+// save will store the preferences on the file, it must be called with the
+// lock held.
+func (p *filePreferences) save() error {
+	data, err := json.Marshal(p.values)
+	if err != nil {
+		return fmt.Errorf("catchmyfile preferences save error encoding: %v", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return fmt.Errorf("catchmyfile preferences save error creating the directory: %v", err)
+	}
+
+	if err = os.WriteFile(p.path, data, 0600); err != nil {
+		return fmt.Errorf("catchmyfile preferences save error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package catchmyfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_storageDir(t *testing.T) {
+	dir, err := storageDir()
+	if err != nil {
+		t.Fatalf("storageDir not expected error = %v", err)
+	}
+
+	if filepath.Base(dir) != appID || filepath.Base(filepath.Dir(dir)) != "fyne" {
+		t.Errorf("storageDir expected the fyne directory of %v but got = %v", appID, dir)
+	}
+}
+
+func Test_loadPreferences(t *testing.T) {
+	t.Run("values kept after load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app", preferencesFile)
+		p, err := loadPreferences(path)
+		if err != nil {
+			t.Fatalf("loadPreferences not expected error = %v", err)
+		}
+
+		p.SetInt(workersKey, 4)
+		p.SetString(interfacesKey, "eth0,wlan0")
+
+		p, err = loadPreferences(path)
+		if err != nil {
+			t.Fatalf("loadPreferences not expected error = %v", err)
+		}
+
+		if got := p.Int(workersKey); got != 4 {
+			t.Errorf("Int expected = %v but got = %v", 4, got)
+		}
+
+		if got := p.String(interfacesKey); got != "eth0,wlan0" {
+			t.Errorf("String expected = %v but got = %v", "eth0,wlan0", got)
+		}
+
+		st, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("preferences file expected to exist but got = %v", err)
+		}
+
+		if perm := st.Mode().Perm(); perm != 0600 {
+			t.Errorf("preferences file expected permissions = %o but got = %o", 0600, perm)
+		}
+	})
+
+	t.Run("values not set", func(t *testing.T) {
+		p, err := loadPreferences(filepath.Join(t.TempDir(), preferencesFile))
+		if err != nil {
+			t.Fatalf("loadPreferences not expected error = %v", err)
+		}
+
+		if got := p.IntWithFallback(workersKey, defaultWorkers); got != defaultWorkers {
+			t.Errorf("IntWithFallback expected = %v but got = %v", defaultWorkers, got)
+		}
+
+		if got := p.Int(workersKey); got != 0 {
+			t.Errorf("Int expected = %v but got = %v", 0, got)
+		}
+
+		if got := p.String(interfacesKey); got != "" {
+			t.Errorf("String expected empty but got = %v", got)
+		}
+	})
+
+	t.Run("values stored by Fyne", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), preferencesFile)
+		if err := os.WriteFile(path, []byte(`{"workers.count":3,"workers.queue":"many"}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := loadPreferences(path)
+		if err != nil {
+			t.Fatalf("loadPreferences not expected error = %v", err)
+		}
+
+		if got := p.Int(workersKey); got != 3 {
+			t.Errorf("Int expected = %v but got = %v", 3, got)
+		}
+
+		if got := p.IntWithFallback(queueSizeKey, defaultQueueSize); got != defaultQueueSize {
+			t.Errorf("IntWithFallback expected = %v but got = %v", defaultQueueSize, got)
+		}
+	})
+
+	t.Run("file not valid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), preferencesFile)
+		if err := os.WriteFile(path, []byte(`not json`), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := loadPreferences(path); err == nil {
+			t.Errorf("loadPreferences expected error but got = %v", err)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package clog
 
 import (
+	"io"
 	"log"
 	"os"
 )
@@ -55,6 +56,13 @@ func Error(err error) {
 	errorFLogger.Println(err)
 }
 
+// Quiet will stop logging to the stdout and stderr, the messages are only
+// logged to the log file.
+func Quiet() {
+	infoLogger.SetOutput(io.Discard)
+	errorLogger.SetOutput(io.Discard)
+}
+
 // LogFile returns the log file path and name.
 func LogFile() string {
 	return logFile.Name()
@@ -0,0 +1,380 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+// Done is channel used to singal the termination of the service.
+type Done chan<- interface{}
+
+// SendRequest is a function that queues the sending of the files on the
+// paths to the peer and returns the id of the transfer. The transfers with
+// a higher priority start before the others queued.
+type SendRequest func(peerName string, paths []string, priority int) (string, error)
+
+// Server is the local control API, an HTTP API on a Unix domain socket that
+// allows other programs to drive the running application.
+//
+// It exposes the peers and transfers of the stores, the operations over the
+// transfers and a stream with the changes of the stores. Only the user that
+// runs the application can connect to the socket.
+type Server struct {
+	SendRequest
+	path   string
+	pStore *peer.PeerStore
+	tStore *transfer.TransferStore
+	mu     sync.Mutex
+	subs   map[chan event]struct{}
+	// Functions that stop following the progress of each transfer.
+	follows map[string]func()
+}
+
+// NewServer will create a new control server that listens on the socket on
+// the path.
+func NewServer(path string, pStore *peer.PeerStore, tStore *transfer.TransferStore) *Server {
+	return &Server{
+		path:    path,
+		pStore:  pStore,
+		tStore:  tStore,
+		subs:    make(map[chan event]struct{}),
+		follows: make(map[string]func()),
+	}
+}
+
+// Run will start listening on the socket and watching the changes of the
+// stores until the context is cancelled, then the socket is removed.
+//
+// It must be called after the views are created since the functions that
+// notify the changes of the stores are wrapped.
+//
+// If there is an error, it can be because another instance is listening on
+// the socket or the socket couldn't be created.
+func (s *Server) Run(ctx context.Context, done Done) error {
+	l, err := s.listen()
+	if err != nil {
+		close(done)
+		return err
+	}
+
+	s.watch()
+
+	srv := &http.Server{Handler: s.handler()}
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			clog.Error(fmt.Errorf("control server serve error: %v", err))
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		if err := srv.Close(); err != nil {
+			clog.Error(err)
+		}
+		s.unfollow()
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			clog.Error(err)
+		}
+		close(done)
+		clog.Info("Control server is closed")
+	}()
+
+	clog.Info("Control API listening on %s", s.path)
+	return nil
+}
+
+// listen will create the socket, a socket left by an instance that is not
+// running anymore is replaced but any other file on the path is kept.
+//
+// The socket is created inside of a directory dedicated to it that only the
+// user can access, so no other user can connect to it before its
+// permissions are restricted.
+func (s *Server) listen() (net.Listener, error) {
+	if err := privateDir(filepath.Dir(s.path)); err != nil {
+		return nil, err
+	}
+
+	if st, err := os.Lstat(s.path); err == nil {
+		if st.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("control server run error: %s is not a socket", s.path)
+		}
+		if conn, err := net.Dial("unix", s.path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control server run error: socket %s in use by another instance", s.path)
+		}
+		if err = os.Remove(s.path); err != nil {
+			return nil, fmt.Errorf("control server run error removing the socket: %v", err)
+		}
+	}
+
+	l, err := net.Listen("unix", s.path)
+	if err != nil {
+		return nil, fmt.Errorf("control server run error to listen: %v", err)
+	}
+
+	if err = os.Chmod(s.path, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("control server run error setting the socket permissions: %v", err)
+	}
+	return l, nil
+}
+
+// privateDir will create the directory with access only for the user, or
+// remove the access of the others if it already exists, it must be a
+// directory only for the socket so no other files are affected.
+//
+// If there is an error, it's because the path is not a directory or its
+// permissions can't be changed.
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("control server run error creating the directory: %v", err)
+	}
+
+	st, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("control server run error: %v", err)
+	}
+
+	if !st.IsDir() {
+		return fmt.Errorf("control server run error: %s is not a directory", dir)
+	}
+
+	if st.Mode().Perm()&0077 != 0 {
+		if err = os.Chmod(dir, 0700); err != nil {
+			return fmt.Errorf("control server run error setting the directory permissions: %v", err)
+		}
+	}
+	return nil
+}
+
+// handler returns the handler with the routes of the API.
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/peers", s.handlePeers)
+	mux.HandleFunc("/transfers", s.handleTransfers)
+	mux.HandleFunc("/transfers/", s.handleTransfer)
+	mux.HandleFunc("/events", s.handleEvents)
+	return mux
+}
+
+// handlePeers will answer with the peers discovered.
+//
+//	GET /peers
+func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	list := s.pStore.List()
+	peers := make([]peerInfo, 0, len(list))
+	for _, p := range list {
+		peers = append(peers, newPeerInfo(p))
+	}
+	writeJSON(w, http.StatusOK, peers)
+}
+
+// sendBody is the body of the request to send files.
+type sendBody struct {
+	Peer     string   `json:"peer"`
+	Paths    []string `json:"paths"`
+	Priority int      `json:"priority,omitempty"`
+}
+
+// handleTransfers will answer with the transfers, queue the sending of
+// files to a peer or remove the finished transfers.
+//
+//	GET    /transfers
+//	POST   /transfers {"peer": "name", "paths": ["/absolute/path"], "priority": 0}
+//	DELETE /transfers
+func (s *Server) handleTransfers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list := s.tStore.List()
+		transfers := make([]transferInfo, 0, len(list))
+		for _, t := range list {
+			transfers = append(transfers, newTransferInfo(t))
+		}
+		writeJSON(w, http.StatusOK, transfers)
+	case http.MethodPost:
+		var body sendBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+			return
+		}
+
+		if body.Peer == "" || len(body.Paths) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("peer and paths are required"))
+			return
+		}
+		for _, p := range body.Paths {
+			if !filepath.IsAbs(p) {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("path %s is not absolute", p))
+				return
+			}
+		}
+
+		if s.SendRequest == nil {
+			writeError(w, http.StatusNotImplemented, fmt.Errorf("sending is not supported"))
+			return
+		}
+
+		id, err := s.SendRequest(body.Peer, body.Paths, body.Priority)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		t := s.tStore.Get(id)
+		if t == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("transfer %s not found", id))
+			return
+		}
+		writeJSON(w, http.StatusCreated, newTransferInfo(t))
+	case http.MethodDelete:
+		writeJSON(w, http.StatusOK, map[string]int{"removed": s.tStore.RemoveFinished()})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// acceptBody is the body of the request to accept a download.
+type acceptBody struct {
+	Dir   string `json:"dir"`
+	Files []int  `json:"files,omitempty"`
+}
+
+// handleTransfer will answer with the transfer, remove it or run an
+// operation over it.
+//
+//	GET    /transfers/{id}
+//	DELETE /transfers/{id}
+//	POST   /transfers/{id}/accept {"dir": "/absolute/path", "files": [0, 2]}
+//	POST   /transfers/{id}/reject
+//	POST   /transfers/{id}/cancel
+//	POST   /transfers/{id}/pause
+//	POST   /transfers/{id}/resume
+//
+// The files of the accept are the indexes of the files of a batch to
+// receive, all the files if empty.
+func (s *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/transfers/"), "/")
+
+	id := parts[0]
+	t := s.tStore.Get(id)
+	if t == nil || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("transfer %s not found", id))
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, newTransferInfo(t))
+		case http.MethodDelete:
+			if err := s.tStore.Remove(id); err != nil {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, newTransferInfo(t))
+		default:
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	var err error
+	switch parts[1] {
+	case "accept":
+		err = s.accept(t, r)
+	case "reject":
+		err = s.decide(t, transfer.Rejected)
+	case "cancel":
+		if t.Status.IsFinal() {
+			err = fmt.Errorf("transfer %s already ended", id)
+			break
+		}
+		s.tStore.Cancel(id)
+	case "pause", "resume":
+		if t.Status != transfer.Accepted && t.Status != transfer.Paused {
+			err = fmt.Errorf("transfer %s is not running", id)
+			break
+		}
+		s.tStore.Pause(id, parts[1] == "pause")
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("operation %s not found", parts[1]))
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	// The transfer can be removed meanwhile, like by the window.
+	if t = s.tStore.Get(id); t == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("transfer %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, newTransferInfo(t))
+}
+
+// accept will accept the download t to be stored inside of the directory on
+// the body of the request.
+func (s *Server) accept(t *transfer.Transfer, r *http.Request) error {
+	var body acceptBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return fmt.Errorf("invalid body: %v", err)
+	}
+
+	if !filepath.IsAbs(body.Dir) {
+		return fmt.Errorf("dir %q is not absolute", body.Dir)
+	}
+
+	if len(body.Files) > 0 {
+		if err := t.Select(body.Files); err != nil {
+			return err
+		}
+	}
+
+	if err := t.AcceptInto(body.Dir); err != nil {
+		return err
+	}
+	return s.decide(t, transfer.Accepted)
+}
+
+// decide will update the download t that is waiting for a decision with the
+// status.
+func (s *Server) decide(t *transfer.Transfer, status transfer.Status) error {
+	t.Status = status
+	return s.tStore.Decide(t.ID, t)
+}
+
+// writeJSON will write the value v as JSON with the status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		clog.Error(err)
+	}
+}
+
+// writeError will write the error as JSON with the status code.
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
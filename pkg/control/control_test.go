@@ -0,0 +1,385 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+func newTestServer() *Server {
+	pStore := peer.NewStore()
+	pStore.Add(&peer.Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.1"), Port: 8822, Me: true})
+	pStore.Add(&peer.Peer{Name: "peer-2", IPAddress: net.ParseIP("192.168.1.2"), Port: 8822, Metadata: peer.Metadata{OS: "linux", DisplayName: "Office"}})
+
+	// The transfers have known ids to be used on the requests.
+	tStore := transfer.NewStore()
+	for i, tr := range []*transfer.Transfer{
+		transfer.NewTransfer("file.txt", "abc", "peer-2", 10, nil, transfer.Download),
+		transfer.NewTransfer("file.zip", "abc", "peer-2", 20, nil, transfer.Upload),
+		transfer.NewBatchTransfer("peer-2", []transfer.File{
+			{Entry: file.Entry{Path: "a.txt", Size: 1}, Status: transfer.Waiting},
+			{Entry: file.Entry{Path: "b.txt", Size: 2}, Status: transfer.Waiting},
+		}, nil, transfer.Download),
+	} {
+		tr.ID = fmt.Sprintf("t%d", i)
+		tStore.Add(tr)
+	}
+
+	return NewServer("", pStore, tStore)
+}
+
+func request(s *Server, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func Test_Server_handlePeers(t *testing.T) {
+	s := newTestServer()
+
+	t.Run("peers listed", func(t *testing.T) {
+		w := request(s, http.MethodGet, "/peers", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("handlePeers expected code %d but got = %d", http.StatusOK, w.Code)
+		}
+
+		var peers []peerInfo
+		if err := json.NewDecoder(w.Body).Decode(&peers); err != nil {
+			t.Fatalf("handlePeers expected JSON but got error = %v", err)
+		}
+
+		if len(peers) != 2 || peers[1].Name != "peer-2" || peers[1].Address != "192.168.1.2" || !peers[0].Me {
+			t.Errorf("handlePeers expected the 2 peers but got = %v", peers)
+		}
+
+		if !peers[1].Online {
+			t.Errorf("handlePeers expected peer-2 online but got = %v", peers[1])
+		}
+
+		if peers[1].OS != "linux" || peers[1].DisplayName != "Office" {
+			t.Errorf("handlePeers expected peer-2 metadata but got = %v", peers[1])
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		if w := request(s, http.MethodPost, "/peers", ""); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("handlePeers expected code %d but got = %d", http.StatusMethodNotAllowed, w.Code)
+		}
+	})
+}
+
+func Test_Server_handleTransfers(t *testing.T) {
+	s := newTestServer()
+
+	var sent []string
+	var sentPriority int
+	s.SendRequest = func(peerName string, paths []string, priority int) (string, error) {
+		if peerName != "peer-2" {
+			return "", fmt.Errorf("peer %s not found", peerName)
+		}
+		sent, sentPriority = paths, priority
+		return s.tStore.Add(transfer.NewTransfer("new.txt", "abc", peerName, 1, nil, transfer.Upload)), nil
+	}
+
+	t.Run("transfers listed", func(t *testing.T) {
+		w := request(s, http.MethodGet, "/transfers", "")
+
+		var transfers []transferInfo
+		if err := json.NewDecoder(w.Body).Decode(&transfers); err != nil {
+			t.Fatalf("handleTransfers expected JSON but got error = %v", err)
+		}
+
+		if len(transfers) != 3 {
+			t.Fatalf("handleTransfers expected 3 transfers but got = %d", len(transfers))
+		}
+
+		if transfers[0].Direction != "download" || transfers[1].Direction != "upload" || transfers[1].Status != "Waiting" {
+			t.Errorf("handleTransfers expected download and upload waiting but got = %v", transfers)
+		}
+
+		if !transfers[2].Batch || len(transfers[2].Files) != 2 {
+			t.Errorf("handleTransfers expected batch with 2 files but got = %v", transfers[2])
+		}
+	})
+
+	t.Run("send queued", func(t *testing.T) {
+		w := request(s, http.MethodPost, "/transfers", `{"peer":"peer-2","paths":["/tmp/new.txt"]}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("handleTransfers expected code %d but got = %d %s", http.StatusCreated, w.Code, w.Body)
+		}
+
+		var info transferInfo
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatalf("handleTransfers expected JSON but got error = %v", err)
+		}
+
+		if s.tStore.Get(info.ID) == nil || info.Name != "new.txt" || len(sent) != 1 {
+			t.Errorf("handleTransfers expected the transfer of new.txt but got = %v", info)
+		}
+	})
+
+	t.Run("send queued with priority", func(t *testing.T) {
+		w := request(s, http.MethodPost, "/transfers", `{"peer":"peer-2","paths":["/tmp/new.txt"],"priority":5}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("handleTransfers expected code %d but got = %d %s", http.StatusCreated, w.Code, w.Body)
+		}
+
+		if sentPriority != 5 {
+			t.Errorf("handleTransfers expected priority 5 but got = %d", sentPriority)
+		}
+	})
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "invalid body", body: `{`, code: http.StatusBadRequest},
+		{name: "missing paths", body: `{"peer":"peer-2"}`, code: http.StatusBadRequest},
+		{name: "relative path", body: `{"peer":"peer-2","paths":["new.txt"]}`, code: http.StatusBadRequest},
+		{name: "peer not found", body: `{"peer":"peer-3","paths":["/tmp/new.txt"]}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := request(s, http.MethodPost, "/transfers", tt.body); w.Code != tt.code {
+				t.Errorf("handleTransfers expected code %d but got = %d", tt.code, w.Code)
+			}
+		})
+	}
+}
+
+func Test_Server_handleTransfer(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		code   int
+		status transfer.Status
+	}{
+		{name: "get transfer", method: http.MethodGet, target: "/transfers/t0", code: http.StatusOK, status: transfer.Waiting},
+		{name: "transfer not found", method: http.MethodGet, target: "/transfers/t9", code: http.StatusNotFound},
+		{name: "empty id", method: http.MethodGet, target: "/transfers/", code: http.StatusNotFound},
+		{name: "operation not found", method: http.MethodPost, target: "/transfers/t0/open", code: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodGet, target: "/transfers/t0/accept", code: http.StatusMethodNotAllowed},
+		{name: "accept download", method: http.MethodPost, target: "/transfers/t0/accept", body: fmt.Sprintf(`{"dir":%q}`, dir), code: http.StatusOK, status: transfer.Accepted},
+		{name: "accept relative dir", method: http.MethodPost, target: "/transfers/t0/accept", body: `{"dir":"files"}`, code: http.StatusConflict, status: transfer.Waiting},
+		{name: "accept upload", method: http.MethodPost, target: "/transfers/t1/accept", body: fmt.Sprintf(`{"dir":%q}`, dir), code: http.StatusConflict, status: transfer.Waiting},
+		{name: "accept batch files", method: http.MethodPost, target: "/transfers/t2/accept", body: fmt.Sprintf(`{"dir":%q,"files":[1]}`, dir), code: http.StatusOK, status: transfer.Accepted},
+		{name: "reject download", method: http.MethodPost, target: "/transfers/t0/reject", code: http.StatusOK, status: transfer.Rejected},
+		{name: "pause waiting", method: http.MethodPost, target: "/transfers/t0/pause", code: http.StatusConflict, status: transfer.Waiting},
+		{name: "cancel upload", method: http.MethodPost, target: "/transfers/t1/cancel", code: http.StatusOK, status: transfer.Cancelled},
+		{name: "remove waiting", method: http.MethodDelete, target: "/transfers/t0", code: http.StatusConflict, status: transfer.Waiting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+
+			w := request(s, tt.method, tt.target, tt.body)
+			if w.Code != tt.code {
+				t.Fatalf("handleTransfer expected code %d but got = %d %s", tt.code, w.Code, w.Body)
+			}
+
+			if tt.code != http.StatusOK && tt.code != http.StatusConflict {
+				return
+			}
+
+			id := strings.Split(strings.TrimPrefix(tt.target, "/transfers/"), "/")[0]
+			if got := s.tStore.Get(id); tt.status != 0 && got.Status != tt.status {
+				t.Errorf("handleTransfer expected status %v but got = %v", tt.status, got.Status)
+			}
+		})
+	}
+
+	t.Run("accept batch files selected", func(t *testing.T) {
+		s := newTestServer()
+		request(s, http.MethodPost, "/transfers/t2/accept", fmt.Sprintf(`{"dir":%q,"files":[1]}`, dir))
+
+		got := s.tStore.Get("t2")
+		if got.LocalFilePath != dir || got.Files[0].Status != transfer.Rejected || got.Files[1].Status != transfer.Waiting {
+			t.Errorf("handleTransfer expected only file 1 selected into %s but got = %s %v", dir, got.LocalFilePath, got.Files)
+		}
+	})
+}
+
+func Test_Server_remove(t *testing.T) {
+	s := newTestServer()
+	s.tStore.Cancel("t1")
+
+	t.Run("finished transfer removed", func(t *testing.T) {
+		if w := request(s, http.MethodDelete, "/transfers/t1", ""); w.Code != http.StatusOK {
+			t.Fatalf("handleTransfer expected code %d but got = %d %s", http.StatusOK, w.Code, w.Body)
+		}
+
+		if s.tStore.Get("t1") != nil {
+			t.Errorf("handleTransfer expected transfer t1 removed")
+		}
+	})
+
+	t.Run("finished transfers cleared", func(t *testing.T) {
+		s.tStore.Cancel("t2")
+
+		w := request(s, http.MethodDelete, "/transfers", "")
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"removed":1}` {
+			t.Errorf("handleTransfers expected 1 removed but got = %d %s", w.Code, w.Body)
+		}
+
+		if s.tStore.Size() != 1 {
+			t.Errorf("handleTransfers expected only t0 but got = %d transfers", s.tStore.Size())
+		}
+	})
+}
+
+func Test_Server_Run(t *testing.T) {
+	storage := filepath.Join(t.TempDir(), "storage")
+	if err := os.Mkdir(storage, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(storage, "control")
+	path := filepath.Join(dir, "control.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan interface{})
+	s := newTestServer()
+	s.path = path
+	if err := s.Run(ctx, done); err != nil {
+		t.Fatalf("Run expected no error but got = %v", err)
+	}
+
+	t.Run("socket only for the user", func(t *testing.T) {
+		st, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Run expected the socket created but got error = %v", err)
+		}
+
+		if st.Mode().Perm() != 0600 {
+			t.Errorf("Run expected permissions 0600 but got = %v", st.Mode().Perm())
+		}
+
+		st, err = os.Stat(dir)
+		if err != nil {
+			t.Fatalf("Run expected the directory but got error = %v", err)
+		}
+
+		if st.Mode().Perm() != 0700 {
+			t.Errorf("Run expected directory permissions 0700 but got = %v", st.Mode().Perm())
+		}
+
+		st, err = os.Stat(storage)
+		if err != nil {
+			t.Fatalf("Run expected the storage directory but got error = %v", err)
+		}
+
+		if st.Mode().Perm() != 0755 {
+			t.Errorf("Run expected storage directory permissions kept 0755 but got = %v", st.Mode().Perm())
+		}
+	})
+
+	t.Run("peers over the socket", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+
+		resp, err := client.Get("http://control/peers")
+		if err != nil {
+			t.Fatalf("Run expected no error but got = %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Run expected code %d but got = %d", http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	t.Run("socket in use", func(t *testing.T) {
+		other := newTestServer()
+		other.path = path
+		if err := other.Run(ctx, make(chan interface{})); err == nil {
+			t.Errorf("Run expected error but got = %v", err)
+		}
+	})
+
+	cancel()
+	<-done
+
+	t.Run("socket removed", func(t *testing.T) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Run expected the socket removed but got error = %v", err)
+		}
+	})
+
+	t.Run("stale socket replaced", func(t *testing.T) {
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan interface{})
+		stale := newTestServer()
+		stale.path = path
+		if err := stale.Run(ctx, done); err != nil {
+			t.Errorf("Run expected no error but got = %v", err)
+		}
+		cancel()
+		<-done
+	})
+
+	t.Run("directory of the socket restricted", func(t *testing.T) {
+		if err := os.Chmod(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan interface{})
+		other := newTestServer()
+		other.path = path
+		if err := other.Run(ctx, done); err != nil {
+			t.Errorf("Run expected no error but got = %v", err)
+		}
+		cancel()
+		<-done
+
+		st, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("Run expected the directory but got error = %v", err)
+		}
+
+		if st.Mode().Perm() != 0700 {
+			t.Errorf("Run expected directory permissions 0700 but got = %v", st.Mode().Perm())
+		}
+	})
+
+	t.Run("file that is not a socket kept", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		other := newTestServer()
+		other.path = path
+		if err := other.Run(context.Background(), make(chan interface{})); err == nil {
+			t.Errorf("Run expected error but got = %v", err)
+		}
+
+		if data, _ := os.ReadFile(path); string(data) != "data" {
+			t.Errorf("Run expected the file kept but got = %q", data)
+		}
+	})
+}
@@ -0,0 +1,301 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+// Number of events kept for a client that is not reading, the events after
+// it are dropped so the stores are never blocked.
+const eventsBuffer = 64
+
+// peerInfo is the representation of a peer on the API.
+type peerInfo struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"display_name,omitempty"`
+	Address      string   `json:"address"`
+	Port         int      `json:"port"`
+	Me           bool     `json:"me"`
+	Fingerprint  string   `json:"fingerprint,omitempty"`
+	Trust        string   `json:"trust"`
+	Online       bool     `json:"online"`
+	Manual       bool     `json:"manual,omitempty"`
+	Protocol     int      `json:"protocol,omitempty"`
+	Version      string   `json:"version,omitempty"`
+	OS           string   `json:"os,omitempty"`
+	DeviceID     string   `json:"device_id,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// newPeerInfo will create the representation of the peer.
+func newPeerInfo(p *peer.Peer) peerInfo {
+	return peerInfo{
+		ID:           p.ID,
+		Name:         p.Name,
+		DisplayName:  p.DisplayName,
+		Address:      p.IPAddress.String(),
+		Port:         p.Port,
+		Me:           p.Me,
+		Fingerprint:  p.Fingerprint,
+		Trust:        p.Trust.String(),
+		Online:       !p.Offline,
+		Manual:       p.Manual,
+		Protocol:     p.Protocol,
+		Version:      p.AppVersion,
+		OS:           p.OS,
+		DeviceID:     p.DeviceID,
+		Capabilities: p.Capabilities,
+	}
+}
+
+// fileInfo is the representation of a file of a transfer on the API.
+type fileInfo struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+}
+
+// transferInfo is the representation of a transfer on the API.
+type transferInfo struct {
+	ID        string     `json:"id"`
+	Direction string     `json:"direction"`
+	Status    string     `json:"status"`
+	Peer      string     `json:"peer"`
+	Name      string     `json:"name"`
+	Size      int64      `json:"size"`
+	LocalPath string     `json:"local_path,omitempty"`
+	Directory bool       `json:"directory,omitempty"`
+	Batch     bool       `json:"batch,omitempty"`
+	Files     []fileInfo `json:"files,omitempty"`
+	Untrusted bool       `json:"untrusted,omitempty"`
+	Progress  float64    `json:"progress"`
+	// Transferred is the number of bytes transferred, Rate the bytes per
+	// second and ETA the seconds left, 0 if unknown.
+	Transferred int64   `json:"transferred"`
+	Rate        float64 `json:"rate"`
+	ETA         float64 `json:"eta"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// newTransferInfo will create the representation of the transfer.
+func newTransferInfo(t *transfer.Transfer) transferInfo {
+	info := transferInfo{
+		ID:        t.ID,
+		Direction: "download",
+		Status:    t.Status.String(),
+		Peer:      t.SenderName,
+		Name:      t.FileName,
+		Size:      t.FileSize,
+		LocalPath: t.LocalFilePath,
+		Directory: t.Directory,
+		Batch:     t.Batch,
+		Untrusted: t.Untrusted,
+	}
+
+	info.setProgress(t.Progress())
+
+	if t.Direction == transfer.Upload {
+		info.Direction = "upload"
+	}
+
+	if t.Error() != nil {
+		info.Error = t.Error().Error()
+	}
+
+	for _, f := range t.Files {
+		info.Files = append(info.Files, fileInfo{Path: f.Path, Size: f.Size, Status: f.Status.String()})
+	}
+	return info
+}
+
+// setProgress will set the progress of the transfer, it's not set until the
+// size is known.
+func (info *transferInfo) setProgress(p transfer.Progress) {
+	if p.Size > 0 {
+		info.Progress = p.Fraction
+		info.Transferred = p.Transferred
+		info.Rate = p.Rate
+		info.ETA = p.ETA.Seconds()
+	}
+}
+
+// event is a change of one of the stores sent on the events stream, the
+// type is transfer, progress or peer. The transfer or peer is not sent if
+// it was removed.
+type event struct {
+	Type     string        `json:"type"`
+	ID       string        `json:"id"`
+	Removed  bool          `json:"removed,omitempty"`
+	Transfer *transferInfo `json:"transfer,omitempty"`
+	Peer     *peerInfo     `json:"peer,omitempty"`
+}
+
+// watch will wrap the functions that notify the changes of the stores to
+// also publish the changes as events, and follow the progress of the
+// transfers that are not finished.
+func (s *Server) watch() {
+	for _, t := range s.tStore.List() {
+		if !t.Status.IsFinal() {
+			s.follow(t.ID)
+		}
+	}
+
+	onTransfer := s.tStore.OnStoreChange
+	s.tStore.OnStoreChange = func(id string) {
+		if onTransfer != nil {
+			onTransfer(id)
+		}
+
+		e := event{Type: "transfer", ID: id, Removed: true}
+		t := s.tStore.Get(id)
+		if t != nil {
+			info := newTransferInfo(t)
+			e.Transfer, e.Removed = &info, false
+		}
+		s.publish(e)
+
+		if t != nil && !t.Status.IsFinal() {
+			s.follow(id)
+		}
+	}
+
+	onPeer := s.pStore.OnPeerStoreChange
+	s.pStore.OnPeerStoreChange = func(id string) {
+		if onPeer != nil {
+			onPeer(id)
+		}
+
+		e := event{Type: "peer", ID: id, Removed: true}
+		if p := s.pStore.Get(id); p != nil {
+			info := newPeerInfo(p)
+			e.Peer, e.Removed = &info, false
+		}
+		s.publish(e)
+	}
+}
+
+// follow will start a new goroutine that publishes the progress of the
+// transfer with the id as events, it's subscribed to the progress of the
+// store so the progress is throttled like on the window.
+//
+// It ends when the transfer gets a final status or is removed, or when the
+// server stops following the transfers.
+func (s *Server) follow(id string) {
+	s.mu.Lock()
+	if _, ok := s.follows[id]; ok || s.follows == nil {
+		s.mu.Unlock()
+		return
+	}
+	progress, unsubscribe := s.tStore.Subscribe(id)
+	s.follows[id] = unsubscribe
+	s.mu.Unlock()
+
+	go func() {
+		for p := range progress {
+			t := s.tStore.Get(id)
+			if t == nil {
+				continue
+			}
+
+			info := newTransferInfo(t)
+			info.setProgress(p)
+			s.publish(event{Type: "progress", ID: id, Transfer: &info})
+		}
+
+		s.mu.Lock()
+		delete(s.follows, id)
+		s.mu.Unlock()
+	}()
+}
+
+// unfollow will stop publishing the progress of all the transfers, no
+// transfer is followed after it.
+func (s *Server) unfollow() {
+	s.mu.Lock()
+	unsubscribes := make([]func(), 0, len(s.follows))
+	for _, unsubscribe := range s.follows {
+		unsubscribes = append(unsubscribes, unsubscribe)
+	}
+	s.follows = nil
+	s.mu.Unlock()
+
+	for _, unsubscribe := range unsubscribes {
+		unsubscribe()
+	}
+}
+
+// subscribe returns a new channel that receives the events published.
+func (s *Server) subscribe() chan event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := make(chan event, eventsBuffer)
+	s.subs[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe will stop sending the events to the channel.
+func (s *Server) unsubscribe(sub chan event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, sub)
+}
+
+// publish will send the event to each subscriber without blocking, if the
+// subscriber is not reading the event is dropped.
+func (s *Server) publish(e event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subs {
+		select {
+		case sub <- e:
+		default:
+		}
+	}
+}
+
+// handleEvents will stream the changes of the stores as JSON, one event
+// per line, until the client disconnects. The progress of the running
+// transfers is sent at most once per ProgressInterval of the store.
+//
+//	GET /events
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	sub := s.subscribe()
+	defer s.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-sub:
+			if err := enc.Encode(e); err != nil {
+				clog.Error(fmt.Errorf("control server events error: %v", err))
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
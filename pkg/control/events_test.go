@@ -0,0 +1,210 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/peer"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer"
+)
+
+func Test_Server_watch(t *testing.T) {
+	s := newTestServer()
+
+	var changed []string
+	s.tStore.OnStoreChange = func(id string) {
+		changed = append(changed, id)
+	}
+	s.watch()
+
+	sub := s.subscribe()
+	defer s.unsubscribe(sub)
+
+	t.Run("transfer change published", func(t *testing.T) {
+		s.tStore.Cancel("t1")
+
+		if len(changed) != 1 || changed[0] != "t1" {
+			t.Errorf("watch expected the previous function called but got = %v", changed)
+		}
+
+		e := <-sub
+		if e.Type != "transfer" || e.ID != "t1" || e.Transfer == nil || e.Transfer.Status != "Cancelled" {
+			t.Errorf("watch expected transfer t1 cancelled but got = %v", e)
+		}
+	})
+
+	t.Run("transfer removal published", func(t *testing.T) {
+		if err := s.tStore.Remove("t1"); err != nil {
+			t.Fatalf("Remove not expected error = %v", err)
+		}
+
+		e := <-sub
+		if e.Type != "transfer" || e.ID != "t1" || !e.Removed || e.Transfer != nil {
+			t.Errorf("watch expected transfer t1 removed but got = %v", e)
+		}
+	})
+
+	t.Run("peer change published", func(t *testing.T) {
+		s.pStore.Add(&peer.Peer{Name: "peer-3", IPAddress: net.ParseIP("192.168.1.3")})
+
+		e := <-sub
+		if e.Type != "peer" || e.Peer == nil || e.Peer.Name != "peer-3" {
+			t.Errorf("watch expected peer-3 but got = %v", e)
+		}
+	})
+}
+
+func Test_Server_publish(t *testing.T) {
+	s := newTestServer()
+	sub := s.subscribe()
+
+	t.Run("events dropped when full", func(t *testing.T) {
+		for i := 0; i < eventsBuffer+1; i++ {
+			s.publish(event{Type: "transfer"})
+		}
+
+		if len(sub) != eventsBuffer {
+			t.Errorf("publish expected %d events but got = %d", eventsBuffer, len(sub))
+		}
+	})
+
+	t.Run("no events after unsubscribe", func(t *testing.T) {
+		s.unsubscribe(sub)
+		for len(sub) > 0 {
+			<-sub
+		}
+
+		s.publish(event{Type: "transfer"})
+		if len(sub) != 0 {
+			t.Errorf("publish expected no events but got = %d", len(sub))
+		}
+	})
+}
+
+// nextEvent returns the next event of the type published to the sub.
+func nextEvent(t *testing.T, sub chan event, typ string) event {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-sub:
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("expected a %s event but got none", typ)
+		}
+	}
+}
+
+func Test_Server_follow(t *testing.T) {
+	s := newTestServer()
+	s.tStore.ProgressInterval = 200 * time.Millisecond
+	s.watch()
+
+	sub := s.subscribe()
+	defer s.unsubscribe(sub)
+
+	t.Run("progress published", func(t *testing.T) {
+		tr := s.tStore.Get("t0")
+		tr.Status = transfer.Accepted
+		s.tStore.Update(tr.ID, tr)
+
+		s.tStore.UpdateProgress(tr.ID, 5, 10)
+
+		e := nextEvent(t, sub, "progress")
+		if e.ID != "t0" || e.Transfer.Progress != 0.5 || e.Transfer.Transferred != 5 || e.Transfer.Status != "Accepted" {
+			t.Errorf("follow expected transfer t0 at 0.5 but got = %+v", e.Transfer)
+		}
+	})
+
+	t.Run("progress throttled", func(t *testing.T) {
+		s.tStore.UpdateProgress("t0", 6, 10)
+		s.tStore.UpdateProgress("t0", 7, 10)
+		s.tStore.UpdateProgress("t0", 8, 10)
+
+		// The updates inside of the same interval are merged.
+		for e := nextEvent(t, sub, "progress"); e.Transfer.Transferred != 8; e = nextEvent(t, sub, "progress") {
+			if e.Transfer.Transferred == 7 {
+				t.Errorf("follow expected the progress merged but got = %+v", e.Transfer)
+			}
+		}
+	})
+
+	t.Run("finished transfer not followed", func(t *testing.T) {
+		tr := s.tStore.Get("t0")
+		tr.Status = transfer.Completed
+		s.tStore.Update(tr.ID, tr)
+
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			s.mu.Lock()
+			_, ok := s.follows["t0"]
+			s.mu.Unlock()
+			if !ok {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("follow expected t0 not followed after completed")
+	})
+
+	t.Run("no transfer followed after unfollow", func(t *testing.T) {
+		s.unfollow()
+
+		tr := s.tStore.Get("t1")
+		tr.Status = transfer.Accepted
+		s.tStore.Update(tr.ID, tr)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.follows) != 0 {
+			t.Errorf("unfollow expected no transfer followed but got = %v", s.follows)
+		}
+	})
+}
+
+func Test_Server_handleEvents(t *testing.T) {
+	s := newTestServer()
+	s.watch()
+
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("handleEvents expected no error but got = %v", err)
+	}
+	defer resp.Body.Close()
+
+	t.Run("change streamed", func(t *testing.T) {
+		s.tStore.Cancel("t1")
+
+		line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("handleEvents expected a line but got error = %v", err)
+		}
+
+		var e event
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("handleEvents expected JSON but got error = %v", err)
+		}
+
+		if e.Type != "transfer" || e.Transfer.ID != "t1" {
+			t.Errorf("handleEvents expected transfer t1 but got = %s", line)
+		}
+	})
+}
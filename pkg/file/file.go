@@ -25,10 +25,13 @@ type OnProgressChange func(transferred int)
 // The optional argument onProg is callback function that is executed everytime
 // a new chuck of data is transferred with success. If not needed nil can be sent.
 //
+// The optional limiters limit the rate of the stream, each chunk waits for
+// all of them before it's written.
+//
 // At the end it will return the total of bytes transferred and an error if any.
 // If there is an error, it can be because the context got interrupted, an
 // error reading the input content or writing to the output.
-func Stream(ctx context.Context, in io.Reader, out io.Writer, onProg OnProgressChange) (int, error) {
+func Stream(ctx context.Context, in io.Reader, out io.Writer, onProg OnProgressChange, limiters ...*Limiter) (int, error) {
 
 	if in == nil {
 		return -1, fmt.Errorf("file stream error: input reader is nil")
@@ -38,29 +41,57 @@ func Stream(ctx context.Context, in io.Reader, out io.Writer, onProg OnProgressC
 		return -1, fmt.Errorf("file stream error: output writer is nil")
 	}
 
-	return stream(ctx, in, out, onProg)
+	return stream(ctx, in, out, onProg, limiters)
+}
+
+// StreamFrom will move the in to the offset and copy the remaining content
+// to the out, it allows to resume a stream that was interrupted.
+//
+// The onProg callback and the returned total only account the bytes
+// transferred after the offset.
+//
+// If there is an error, it can be because the offset is not valid, the
+// seek failed or any of the errors returned by Stream.
+func StreamFrom(ctx context.Context, in io.ReadSeeker, out io.Writer, offset int64, onProg OnProgressChange, limiters ...*Limiter) (int, error) {
+	if in == nil {
+		return -1, fmt.Errorf("file stream from error: input reader is nil")
+	}
+
+	if offset < 0 {
+		return -1, fmt.Errorf("file stream from error: invalid offset %d", offset)
+	}
+
+	if _, err := in.Seek(offset, io.SeekStart); err != nil {
+		return -1, fmt.Errorf("file stream from error seeking the input: %v", err)
+	}
+
+	return Stream(ctx, in, out, onProg, limiters...)
 }
 
-func stream(ctx context.Context, in io.Reader, out io.Writer, onProg OnProgressChange) (int, error) {
+func stream(ctx context.Context, in io.Reader, out io.Writer, onProg OnProgressChange, limiters []*Limiter) (int, error) {
 	var transferred int
 	buf := make([]byte, transferChunkSize)
 	for {
 		if ctx.Err() != nil {
-			return -1, fmt.Errorf("file stream interrupted: %v", ctx.Err())
+			return -1, fmt.Errorf("file stream interrupted: %w", ctx.Err())
 		}
 
 		rc, err := in.Read(buf)
 		if err != nil && err != io.EOF {
-			return -1, fmt.Errorf("file stream error read file: %v", err)
+			return -1, fmt.Errorf("file stream error read file: %w", err)
 		}
 
 		if rc == 0 {
 			break
 		}
 
+		if err = waitLimiters(ctx, rc, limiters); err != nil {
+			return -1, fmt.Errorf("file stream interrupted: %w", err)
+		}
+
 		wc, err := out.Write(buf[:rc])
 		if err != nil {
-			return -1, fmt.Errorf("file stream error write file: %v", err)
+			return -1, fmt.Errorf("file stream error write file: %w", err)
 		}
 
 		transferred += wc
@@ -73,11 +104,16 @@ func stream(ctx context.Context, in io.Reader, out io.Writer, onProg OnProgressC
 
 // Lookup will get the file information based on the provided full path.
 //
-// Returns the file name and size.
+// Returns the file name and size, if the path points to a directory the size
+// is the sum of the size of all the regular files inside of it.
 //
 // If there is an error, it can be because the file doesn't exists not possible
-// to access or if the path points to a folder or a non regular file.
+// to access or if the path points to a non regular file.
 func Lookup(fileFullPath string) (string, int64, error) {
+	if fileFullPath == "" {
+		return "", -1, fmt.Errorf("file lookup error: file path is empty")
+	}
+
 	cleanPath := filepath.Clean(fileFullPath)
 
 	st, err := os.Stat(cleanPath)
@@ -85,13 +121,43 @@ func Lookup(fileFullPath string) (string, int64, error) {
 		return "", -1, fmt.Errorf("file lookup error getting file info: %v", err)
 	}
 
-	if st.IsDir() || !st.Mode().IsRegular() {
+	if st.IsDir() {
+		size, err := dirSize(cleanPath)
+		if err != nil {
+			return "", -1, fmt.Errorf("file lookup error getting directory size: %v", err)
+		}
+		return filepath.Base(cleanPath), size, nil
+	}
+
+	if !st.Mode().IsRegular() {
 		return "", -1, fmt.Errorf("file lookup error chekcing the file: file is not valid")
 	}
 
 	return filepath.Base(cleanPath), st.Size(), nil
 }
 
+// IsDir returns true if the path points to a directory.
+func IsDir(fileFullPath string) bool {
+	st, err := os.Stat(filepath.Clean(fileFullPath))
+	return err == nil && st.IsDir()
+}
+
+// dirSize returns the sum of the size of all the regular files inside of
+// the directory and its sub directories.
+func dirSize(dirPath string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
 // Checksum will make an SHA256 of the file content.
 //
 // It opens the file in read-only mode, used the file.Stream copy the content
@@ -127,3 +193,55 @@ func Open(fileFullPath string, isRead bool) (*os.File, error) {
 	}
 	return os.OpenFile(filepath.Clean(fileFullPath), os.O_WRONLY, os.ModePerm)
 }
+
+// partialSuffix is added to the file name while the file is being received.
+const partialSuffix = ".part"
+
+// PartialPath returns the path of the partial file used while the file
+// is being received.
+func PartialPath(fileFullPath string) string {
+	return filepath.Clean(fileFullPath) + partialSuffix
+}
+
+// PartialSize returns the size of the partial file of a previous transfer
+// that didn't finish, if there is no partial file it returns 0.
+func PartialSize(fileFullPath string) int64 {
+	st, err := os.Stat(PartialPath(fileFullPath))
+	if err != nil || !st.Mode().IsRegular() {
+		return 0
+	}
+	return st.Size()
+}
+
+// OpenPartial will open the partial file in write mode, creating it if needed,
+// and discards any content after the offset so the writes continue from there.
+//
+// If there is an error, it can be because the file couldn't be opened,
+// truncated or moved to the offset.
+func OpenPartial(fileFullPath string, offset int64) (*os.File, error) {
+	f, err := os.OpenFile(PartialPath(fileFullPath), os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("file open partial error: %v", err)
+	}
+
+	if err = f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("file open partial error truncating: %v", err)
+	}
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("file open partial error seeking: %v", err)
+	}
+
+	return f, nil
+}
+
+// CompletePartial will replace the file with the partial file content once
+// the file is fully received.
+func CompletePartial(fileFullPath string) error {
+	if err := os.Rename(PartialPath(fileFullPath), filepath.Clean(fileFullPath)); err != nil {
+		return fmt.Errorf("file complete partial error: %v", err)
+	}
+	return nil
+}
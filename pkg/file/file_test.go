@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -71,6 +72,91 @@ func Test_Stream(t *testing.T) {
 	})
 }
 
+func Test_StreamFrom(t *testing.T) {
+	t.Run("stream from offset", func(t *testing.T) {
+		input := bytes.NewReader([]byte("stream great content! 88392931 :)"))
+		output := &bytes.Buffer{}
+		var progress int
+
+		count, err := StreamFrom(context.Background(), input, output, 7, func(transferred int) {
+			progress = transferred
+		})
+
+		if err != nil {
+			t.Errorf("StreamFrom not expected error = %v", err)
+		}
+
+		if output.String() != "great content! 88392931 :)" {
+			t.Errorf("StreamFrom expected output = %v but got output = %v", "great content! 88392931 :)", output.String())
+		}
+
+		if count != output.Len() || progress != count {
+			t.Errorf("StreamFrom expected count and progress = %v but got count = %v and progress = %v", output.Len(), count, progress)
+		}
+	})
+
+	t.Run("invalid offset", func(t *testing.T) {
+		input := bytes.NewReader([]byte("stream great content! 88392931 :)"))
+
+		if _, err := StreamFrom(context.Background(), input, &bytes.Buffer{}, -1, nil); err == nil {
+			t.Errorf("StreamFrom expected error = %v", err)
+		}
+	})
+
+	t.Run("input reader is nil", func(t *testing.T) {
+		if _, err := StreamFrom(context.Background(), nil, &bytes.Buffer{}, 0, nil); err == nil {
+			t.Errorf("StreamFrom expected error = %v", err)
+		}
+	})
+}
+
+func Test_Partial(t *testing.T) {
+	t.Run("no partial file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file.txt")
+
+		if size := PartialSize(path); size != 0 {
+			t.Errorf("PartialSize expected = %v but got = %v", 0, size)
+		}
+	})
+
+	t.Run("resume partial file and complete it", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file.txt")
+		os.WriteFile(PartialPath(path), []byte("partial content with garbage"), 0600)
+
+		f, err := OpenPartial(path, 7)
+		if err != nil {
+			t.Errorf("OpenPartial not expected error = %v", err)
+		}
+		f.Write([]byte("-done"))
+		f.Close()
+
+		if size := PartialSize(path); size != 12 {
+			t.Errorf("PartialSize expected = %v but got = %v", 12, size)
+		}
+
+		if err = CompletePartial(path); err != nil {
+			t.Errorf("CompletePartial not expected error = %v", err)
+		}
+
+		content, _ := os.ReadFile(path)
+		if string(content) != "partial-done" {
+			t.Errorf("CompletePartial expected content = %v but got = %v", "partial-done", string(content))
+		}
+
+		if size := PartialSize(path); size != 0 {
+			t.Errorf("PartialSize expected = %v but got = %v", 0, size)
+		}
+	})
+
+	t.Run("complete without partial file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file.txt")
+
+		if err := CompletePartial(path); err == nil {
+			t.Errorf("CompletePartial expected error = %v", err)
+		}
+	})
+}
+
 func Test_Lookup(t *testing.T) {
 	t.Run("empty file path", func(t *testing.T) {
 		_, _, err := Lookup("")
@@ -90,8 +176,26 @@ func Test_Lookup(t *testing.T) {
 	})
 
 	t.Run("file path is a dir", func(t *testing.T) {
-		input := os.TempDir()
-		_, _, err := Lookup(input)
+		input := t.TempDir()
+		os.MkdirAll(filepath.Join(input, "sub"), 0750)
+		os.WriteFile(filepath.Join(input, "a.txt"), make([]byte, 100), 0600)
+		os.WriteFile(filepath.Join(input, "sub", "b.txt"), make([]byte, 50), 0600)
+
+		outName, outSize, err := Lookup(input)
+
+		if err != nil {
+			t.Errorf("Lookup not expected error = %v", err)
+		}
+		if outName != filepath.Base(input) {
+			t.Errorf("Lookup expected output name = %v but got output name = %v", filepath.Base(input), outName)
+		}
+		if outSize != 150 {
+			t.Errorf("Lookup expected output size = %v but got output size = %v", 150, outSize)
+		}
+	})
+
+	t.Run("file path is not a regular file", func(t *testing.T) {
+		_, _, err := Lookup(os.DevNull)
 
 		if err == nil {
 			t.Errorf("Lookup expected error = %v", err)
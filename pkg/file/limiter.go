@@ -0,0 +1,127 @@
+package file
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket that limits the number of bytes per second
+// transferred by the streams that share it.
+//
+// The bucket holds up to one second of tokens, a stream can take more
+// tokens than the bucket has and waits until the debt is paid. The rate
+// can be changed while the streams are running, a rate of 0 means the
+// streams are not limited.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    int64         // rate is the number of bytes per second.
+	tokens  float64       // tokens available, negative if the streams are in debt.
+	last    time.Time     // last time the tokens were refilled.
+	changed chan struct{} // changed is closed when the rate changes.
+}
+
+// NewLimiter will create a Limiter with the rate in bytes per second, 0 means
+// no limit.
+func NewLimiter(rate int64) *Limiter {
+	if rate < 0 {
+		rate = 0
+	}
+	return &Limiter{
+		rate:    rate,
+		tokens:  float64(rate),
+		last:    time.Now(),
+		changed: make(chan struct{}),
+	}
+}
+
+// Rate returns the current rate in bytes per second, 0 means no limit.
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// SetRate will change the rate in bytes per second, the streams waiting
+// are woken up to wait again with the new rate. A rate of 0 removes the
+// limit and any debt.
+func (l *Limiter) SetRate(rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = rate
+	if rate == 0 || l.tokens > float64(rate) {
+		l.tokens = float64(rate)
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// WaitN will take n tokens from the bucket and wait until the bucket is
+// not in debt or the context is cancelled.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	l.refill(time.Now())
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.tokens -= float64(n)
+
+	for l.rate > 0 && l.tokens < 0 {
+		wait := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+		changed := l.changed
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		l.mu.Lock()
+		l.refill(time.Now())
+	}
+
+	l.mu.Unlock()
+	return nil
+}
+
+// refill will add the tokens of the time elapsed since the last refill, up
+// to one second of tokens.
+func (l *Limiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+
+	if l.rate == 0 {
+		return
+	}
+
+	l.tokens += elapsed * float64(l.rate)
+	if l.tokens > float64(l.rate) {
+		l.tokens = float64(l.rate)
+	}
+}
+
+// waitLimiters will wait n tokens of each one of the limiters.
+func waitLimiters(ctx context.Context, n int, limiters []*Limiter) error {
+	for _, l := range limiters {
+		if l == nil {
+			continue
+		}
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
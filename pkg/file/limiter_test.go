@@ -0,0 +1,76 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_Limiter(t *testing.T) {
+	t.Run("stream limited", func(t *testing.T) {
+		content := bytes.Repeat([]byte("a"), 150000)
+		output := &bytes.Buffer{}
+
+		// The bucket starts with one second of tokens, the remaining
+		// 50000 bytes take half a second.
+		start := time.Now()
+		count, err := Stream(context.Background(), bytes.NewReader(content), output, nil, NewLimiter(100000))
+		elapsed := time.Since(start)
+
+		if err != nil {
+			t.Errorf("Stream not expected error = %v", err)
+		}
+
+		if count != len(content) {
+			t.Errorf("Stream expected count = %v but got count = %v", len(content), count)
+		}
+
+		if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+			t.Errorf("Stream expected to take about 500ms but took = %v", elapsed)
+		}
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		l := NewLimiter(0)
+
+		if err := l.WaitN(context.Background(), 1<<30); err != nil {
+			t.Errorf("WaitN not expected error = %v", err)
+		}
+	})
+
+	t.Run("rate removed while waiting", func(t *testing.T) {
+		l := NewLimiter(1)
+
+		time.AfterFunc(20*time.Millisecond, func() { l.SetRate(0) })
+
+		done := make(chan error)
+		go func() {
+			done <- l.WaitN(context.Background(), 100000)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("WaitN not expected error = %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("WaitN expected to end after the rate is removed")
+		}
+
+		if l.Rate() != 0 {
+			t.Errorf("Rate expected = %v but got = %v", 0, l.Rate())
+		}
+	})
+
+	t.Run("wait cancelled", func(t *testing.T) {
+		l := NewLimiter(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if err := l.WaitN(ctx, 100000); err == nil {
+			t.Errorf("WaitN expected error = %v", err)
+		}
+	})
+}
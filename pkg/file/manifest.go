@@ -0,0 +1,96 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Entry describes one regular file inside of a directory.
+type Entry struct {
+	Path     string // Path relative to the directory, using slash as separator.
+	Size     int64  // Size of the file in bytes.
+	Checksum string // Checksum is the SHA256 of the file content.
+}
+
+// Manifest will walk the directory and return an Entry for each regular
+// file found inside of it or its sub directories, other kinds of files
+// like symbolic links are ignored.
+//
+// The checksum of each file is generated, this will read the full content
+// of the directory so it can take a while on large directories.
+//
+// If there is an error, it can be because the directory couldn't be walked,
+// a file couldn't be opened or the context got interrupted.
+func Manifest(ctx context.Context, dirPath string) ([]Entry, error) {
+	root := filepath.Clean(dirPath)
+	entries := make([]Entry, 0)
+
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		check, err := fileChecksum(ctx, p)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, Entry{
+			Path:     filepath.ToSlash(rel),
+			Size:     info.Size(),
+			Checksum: check,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("file manifest error: %v", err)
+	}
+
+	return entries, nil
+}
+
+// fileChecksum will open the file and generate the checksum of its content.
+func fileChecksum(ctx context.Context, filePath string) (string, error) {
+	f, err := Open(filePath, OPEN_READ)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return Checksum(ctx, f)
+}
+
+// SafeJoin will join the relative path, using slash as separator, to the
+// root directory and make sure the result is still inside of the root.
+//
+// It's used to prevent an entry received from a peer, like ../../.bashrc,
+// from writing outside of the destination directory.
+func SafeJoin(root, rel string) (string, error) {
+	clean := path.Clean("/" + rel)
+	if rel == "" || clean == "/" || strings.Contains(rel, "\\") || path.IsAbs(rel) || clean != "/"+rel {
+		return "", fmt.Errorf("file safe join error: invalid relative path %q", rel)
+	}
+
+	return filepath.Join(filepath.Clean(root), filepath.FromSlash(clean[1:])), nil
+}
+
+// CreateDirs will create all the directories needed to store the file.
+func CreateDirs(fileFullPath string) error {
+	if err := os.MkdirAll(filepath.Dir(filepath.Clean(fileFullPath)), 0750); err != nil {
+		return fmt.Errorf("file create dirs error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_Manifest(t *testing.T) {
+	t.Run("directory with sub directories", func(t *testing.T) {
+		input := t.TempDir()
+		os.MkdirAll(filepath.Join(input, "sub"), 0750)
+		os.WriteFile(filepath.Join(input, "a.txt"), []byte("sample text to hash"), 0600)
+		os.WriteFile(filepath.Join(input, "sub", "b.txt"), []byte{}, 0600)
+		want := []Entry{
+			{Path: "a.txt", Size: 19, Checksum: "b1668ccc2110b0ce6d103144e5eabc6b0cc59ec84cc58be543536c62f8d6fc00"},
+			{Path: "sub/b.txt", Size: 0, Checksum: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		}
+
+		output, err := Manifest(context.Background(), input)
+
+		if err != nil {
+			t.Errorf("Manifest not expected error = %v", err)
+		}
+		if !reflect.DeepEqual(output, want) {
+			t.Errorf("Manifest expected output = %v but got output = %v", want, output)
+		}
+	})
+
+	t.Run("empty directory", func(t *testing.T) {
+		output, err := Manifest(context.Background(), t.TempDir())
+
+		if err != nil {
+			t.Errorf("Manifest not expected error = %v", err)
+		}
+		if len(output) != 0 {
+			t.Errorf("Manifest expected empty output but got output = %v", output)
+		}
+	})
+
+	t.Run("directory doesn't exists", func(t *testing.T) {
+		if _, err := Manifest(context.Background(), "/sample-dir"); err == nil {
+			t.Errorf("Manifest expected error = %v", err)
+		}
+	})
+
+	t.Run("cancel context", func(t *testing.T) {
+		input := t.TempDir()
+		os.WriteFile(filepath.Join(input, "a.txt"), []byte("sample text to hash"), 0600)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := Manifest(ctx, input); err == nil {
+			t.Errorf("Manifest expected error = %v", err)
+		}
+	})
+}
+
+func Test_SafeJoin(t *testing.T) {
+	t.Run("valid relative paths", func(t *testing.T) {
+		for _, rel := range []string{"a.txt", "sub/b.txt", "..a/b.txt"} {
+			output, err := SafeJoin("/tmp/root", rel)
+			want := filepath.Join("/tmp/root", filepath.FromSlash(rel))
+
+			if err != nil {
+				t.Errorf("SafeJoin not expected error = %v", err)
+			}
+			if output != want {
+				t.Errorf("SafeJoin expected output = %v but got output = %v", want, output)
+			}
+		}
+	})
+
+	t.Run("paths outside of the root", func(t *testing.T) {
+		for _, rel := range []string{"", ".", "../a.txt", "sub/../../a.txt", "/etc/passwd", "sub\\..\\..\\a.txt", "sub/./a.txt"} {
+			if _, err := SafeJoin("/tmp/root", rel); err == nil {
+				t.Errorf("SafeJoin expected error for %q", rel)
+			}
+		}
+	})
+}
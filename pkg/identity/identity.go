@@ -0,0 +1,206 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// certFileName is the name of the file with the PEM encoded certificate.
+	certFileName = "identity.crt"
+	// keyFileName is the name of the file with the PEM encoded private key.
+	keyFileName = "identity.key"
+	// validity is how long the generated certificate is valid, the peers
+	// trust the fingerprint and not the validity so it only needs to be long.
+	validity = 20 * 365 * 24 * time.Hour
+)
+
+// ErrFingerprintMismatch signals that the certificate presented by the peer
+// doesn't match with the fingerprint expected, it can be an impersonation.
+var ErrFingerprintMismatch = errors.New("identity verify error: peer fingerprint doesn't match, possible impersonation")
+
+// Identity is the key pair and self signed certificate that identifies this
+// installation to the other peers.
+type Identity struct {
+	cert        tls.Certificate
+	fingerprint string
+}
+
+// Load will read the identity stored on the directory, if there is no
+// identity stored yet a new one is generated and stored so the same
+// identity is used every time the application starts.
+//
+// If there is an error, it can be because the stored identity is not valid
+// or it wasn't possible to generate or store a new identity.
+func Load(dir string) (*Identity, error) {
+	certPath := filepath.Join(dir, certFileName)
+	keyPath := filepath.Join(dir, keyFileName)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		return newIdentity(cert)
+	}
+
+	if _, sErr := os.Stat(certPath); !os.IsNotExist(sErr) {
+		return nil, fmt.Errorf("identity load error: %v", err)
+	}
+
+	certPEM, keyPEM, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("identity load error creating the directory: %v", err)
+	}
+
+	if err = os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("identity load error storing the key: %v", err)
+	}
+
+	if err = os.WriteFile(certPath, certPEM, 0600); err != nil {
+		return nil, fmt.Errorf("identity load error storing the certificate: %v", err)
+	}
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("identity load error: %v", err)
+	}
+	return newIdentity(cert)
+}
+
+// New will generate a new identity that is not stored.
+func New() (*Identity, error) {
+	certPEM, keyPEM, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("identity new error: %v", err)
+	}
+	return newIdentity(cert)
+}
+
+// newIdentity will create the identity from the certificate and calculate
+// its fingerprint.
+func newIdentity(cert tls.Certificate) (*Identity, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("identity error: certificate is empty")
+	}
+
+	return &Identity{
+		cert:        cert,
+		fingerprint: Fingerprint(cert.Certificate[0]),
+	}, nil
+}
+
+// generate will create a new ECDSA key pair and a self signed certificate
+// and return both PEM encoded.
+func generate() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("identity generate key error: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("identity generate serial error: %v", err)
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "catch-my-file"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("identity generate certificate error: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("identity generate key encoding error: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// Fingerprint returns the SHA256 of the DER encoded certificate as an
+// hexadecimal string.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// PeerFingerprint returns the fingerprint of the certificate presented by
+// the peer on the TLS connection, empty if the peer didn't present one.
+func PeerFingerprint(cs tls.ConnectionState) string {
+	if len(cs.PeerCertificates) == 0 {
+		return ""
+	}
+	return Fingerprint(cs.PeerCertificates[0].Raw)
+}
+
+// Fingerprint returns the fingerprint of the identity certificate.
+func (i *Identity) Fingerprint() string {
+	return i.fingerprint
+}
+
+// ServerConfig returns the TLS configuration for the receiver side of the
+// connection.
+//
+// The peer must present a certificate but since all the certificates are
+// self signed it's not verified, the fingerprint is checked by the caller.
+func (i *Identity) ServerConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{i.cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// ClientConfig returns the TLS configuration for the sender side of the
+// connection.
+//
+// Since all the certificates are self signed the chain is not verified,
+// instead if the expected fingerprint is not empty the certificate of the
+// peer must match it or the handshake fails with ErrFingerprintMismatch.
+func (i *Identity) ClientConfig(expected string) *tls.Config {
+	return &tls.Config{
+		Certificates:       []tls.Certificate{i.cert},
+		InsecureSkipVerify: true, // #nosec G402 the certificate is verified by fingerprint.
+		MinVersion:         tls.VersionTLS12,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("identity verify error: peer didn't present a certificate")
+			}
+			if expected != "" && Fingerprint(rawCerts[0]) != expected {
+				return ErrFingerprintMismatch
+			}
+			return nil
+		},
+	}
+}
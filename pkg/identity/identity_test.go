@@ -0,0 +1,103 @@
+package identity
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Load(t *testing.T) {
+	t.Run("generate and load the same identity", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "config")
+
+		first, err := Load(dir)
+		if err != nil {
+			t.Fatalf("Load not expected error = %v", err)
+		}
+
+		second, err := Load(dir)
+		if err != nil {
+			t.Fatalf("Load not expected error = %v", err)
+		}
+
+		if first.Fingerprint() != second.Fingerprint() {
+			t.Errorf("Load expected fingerprint = %v but got = %v", first.Fingerprint(), second.Fingerprint())
+		}
+
+		if len(first.Fingerprint()) != 64 {
+			t.Errorf("Load expected fingerprint length = %v but got = %v", 64, len(first.Fingerprint()))
+		}
+	})
+
+	t.Run("stored identity is not valid", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, certFileName), []byte("invalid"), 0600)
+
+		if _, err := Load(dir); err == nil {
+			t.Errorf("Load expected error = %v", err)
+		}
+	})
+}
+
+// handshake will make a TLS handshake between a client and a server using
+// the identities and return the fingerprint seen by each side.
+func handshake(t *testing.T, client, server *Identity, expected string) (string, string, error) {
+	cConn, sConn := net.Pipe()
+	defer cConn.Close()
+	defer sConn.Close()
+
+	seen := make(chan string, 1)
+	go func() {
+		tc := tls.Server(sConn, server.ServerConfig())
+		if err := tc.Handshake(); err != nil {
+			seen <- ""
+			return
+		}
+		seen <- PeerFingerprint(tc.ConnectionState())
+	}()
+
+	tc := tls.Client(cConn, client.ClientConfig(expected))
+	err := tc.Handshake()
+	if err != nil {
+		cConn.Close()
+		<-seen
+		return "", "", err
+	}
+	return PeerFingerprint(tc.ConnectionState()), <-seen, nil
+}
+
+func Test_Identity_TLS(t *testing.T) {
+	client, _ := New()
+	server, _ := New()
+
+	t.Run("both sides see the fingerprint of the other", func(t *testing.T) {
+		cSeen, sSeen, err := handshake(t, client, server, server.Fingerprint())
+		if err != nil {
+			t.Fatalf("handshake not expected error = %v", err)
+		}
+
+		if cSeen != server.Fingerprint() {
+			t.Errorf("client expected fingerprint = %v but got = %v", server.Fingerprint(), cSeen)
+		}
+
+		if sSeen != client.Fingerprint() {
+			t.Errorf("server expected fingerprint = %v but got = %v", client.Fingerprint(), sSeen)
+		}
+	})
+
+	t.Run("no expected fingerprint", func(t *testing.T) {
+		if _, _, err := handshake(t, client, server, ""); err != nil {
+			t.Errorf("handshake not expected error = %v", err)
+		}
+	})
+
+	t.Run("fingerprint mismatch", func(t *testing.T) {
+		_, _, err := handshake(t, client, server, client.Fingerprint())
+		if !errors.Is(err, ErrFingerprintMismatch) {
+			t.Errorf("handshake expected error = %v but got = %v", ErrFingerprintMismatch, err)
+		}
+	})
+}
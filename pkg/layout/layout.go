@@ -31,11 +31,16 @@ func ResizeAndMove(obj fyne.CanvasObject, width, posX, height float32) {
 }
 
 // NewTab creates a new tab icon for the peers.
-func NewPeersTab(w fyne.Widget) *container.TabItem {
+func NewPeersTab(w fyne.CanvasObject) *container.TabItem {
 	return container.NewTabItemWithIcon("Peers", theme.ComputerIcon(), w)
 }
 
 // NewTab creates a new tab icon for the Transfers.
-func NewTransferTab(w fyne.Widget) *container.TabItem {
+func NewTransferTab(w fyne.CanvasObject) *container.TabItem {
 	return container.NewTabItemWithIcon("Transfers", theme.StorageIcon(), w)
 }
+
+// NewHistoryTab creates a new tab icon for the History.
+func NewHistoryTab(w fyne.CanvasObject) *container.TabItem {
+	return container.NewTabItemWithIcon("History", theme.HistoryIcon(), w)
+}
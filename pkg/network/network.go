@@ -1,14 +1,241 @@
 package network
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"time"
 )
 
-// Socket Type.
-const Type = `tcp4`
+// Socket Type, the sockets are dual-stack to use IPv4 and IPv6.
+const Type = `tcp`
+
+// Time to wait for a connection attempt before starting the next one with
+// the following address, as recommended by Happy Eyeballs (RFC 8305).
+const attemptDelay = 250 * time.Millisecond
+
+// dialContext connects to the address of each attempt of Dial.
+var dialContext = (&net.Dialer{}).DialContext
+
+// Addrs are all the addresses of a peer, IPv6 and IPv4, the connections
+// made with Dial try all of them.
+type Addrs []*net.TCPAddr
+
+// Network returns the name of the network.
+func (a Addrs) Network() string {
+	return Type
+}
+
+// String returns the first address, empty if there are none.
+func (a Addrs) String() string {
+	if len(a) == 0 {
+		return ""
+	}
+	return a[0].String()
+}
+
+// NewAddrs returns the addresses of the ips on the port.
+//
+// The IPv6 link-local addresses need the zone of the interface, since it's
+// not known there is one address for each interface that can reach it.
+func NewAddrs(ips []net.IP, port int) Addrs {
+	addrs := make(Addrs, 0, len(ips))
+	for _, ip := range ips {
+		if ip.To4() != nil || !ip.IsLinkLocalUnicast() {
+			addrs = append(addrs, &net.TCPAddr{IP: ip, Port: port})
+			continue
+		}
+
+		zones := linkLocalZones()
+		if len(zones) == 0 {
+			addrs = append(addrs, &net.TCPAddr{IP: ip, Port: port})
+		}
+		for _, zone := range zones {
+			addrs = append(addrs, &net.TCPAddr{IP: ip, Port: port, Zone: zone})
+		}
+	}
+	return addrs
+}
+
+// Resolve returns all the addresses of the host:port on the target.
+//
+// If there is an error, it can be because the target is not valid or the
+// host couldn't be resolved.
+func Resolve(target string) (Addrs, error) {
+	host, p, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, fmt.Errorf("network resolve error: %v", err)
+	}
+
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("network resolve error converting port: %v", err)
+	}
+
+	// The addresses with a zone, like fe80::1%eth0, are kept as they are.
+	if addr, err := net.ResolveTCPAddr(Type, target); err == nil && addr.Zone != "" {
+		return Addrs{addr}, nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("network resolve error: %v", err)
+	}
+	return NewAddrs(ips, port), nil
+}
+
+// Dial will connect to the address before the timeout.
+//
+// If the address is Addrs, all of them are tried in the Happy Eyeballs
+// style, alternating between IPv6 and IPv4, a new attempt starts when the
+// previous one fails or after attemptDelay and the first to connect wins.
+// The addresses on the same network of one of the ifaces, all the local
+// interfaces if nil, are tried first.
+//
+// If there is an error, it's because none of the addresses connected.
+func Dial(addr net.Addr, timeout time.Duration, ifaces []net.Interface) (net.Conn, error) {
+	addrs, ok := addr.(Addrs)
+	if !ok {
+		return net.DialTimeout(Type, addr.String(), timeout)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("network dial error: no addresses")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(addrs))
+
+	ordered := order(addrs, LocalNets(ifaces))
+	next := time.NewTimer(0)
+	defer next.Stop()
+
+	started, pending := 0, 0
+	var firstErr error
+	for {
+		select {
+		case <-next.C:
+			a := ordered[started]
+			started++
+			pending++
+			go func() {
+				conn, err := dialContext(ctx, Type, a.String())
+				results <- result{conn, err}
+			}()
+			if started < len(ordered) {
+				next.Reset(attemptDelay)
+			}
+
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// The attempts still running are cancelled, the ones
+				// that connect anyway are closed.
+				cancel()
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.err == nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+
+			if firstErr == nil {
+				firstErr = r.err
+			}
+
+			switch {
+			case started < len(ordered):
+				// The next attempt starts right away.
+				if !next.Stop() {
+					select {
+					case <-next.C:
+					default:
+					}
+				}
+				next.Reset(0)
+			case pending == 0:
+				return nil, fmt.Errorf("network dial error: %v", firstErr)
+			}
+		}
+	}
+}
+
+// order returns the addresses on the same network of one of the nets first
+// and then the others, each group alternating between IPv6 and IPv4.
+func order(addrs Addrs, nets []*net.IPNet) Addrs {
+	var local, other Addrs
+	for _, a := range addrs {
+		if isLocal(a.IP, nets) {
+			local = append(local, a)
+		} else {
+			other = append(other, a)
+		}
+	}
+	return append(interleave(local), interleave(other)...)
+}
+
+// interleave returns the addresses alternating between IPv6 and IPv4,
+// starting with IPv6, keeping the order of each family.
+func interleave(addrs Addrs) Addrs {
+	var v4, v6 Addrs
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			v4 = append(v4, a)
+		} else {
+			v6 = append(v6, a)
+		}
+	}
+
+	ordered := make(Addrs, 0, len(addrs))
+	for j := 0; j < len(v4) || j < len(v6); j++ {
+		if j < len(v6) {
+			ordered = append(ordered, v6[j])
+		}
+		if j < len(v4) {
+			ordered = append(ordered, v4[j])
+		}
+	}
+	return ordered
+}
+
+// linkLocalZones returns the names of the interfaces up with an IPv6
+// link-local address.
+func linkLocalZones() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	zones := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+				zones = append(zones, iface.Name)
+				break
+			}
+		}
+	}
+	return zones
+}
 
 // Hostname return the marchine hostname.
 func Hostname() string {
@@ -19,21 +246,72 @@ func Hostname() string {
 	return hostname
 }
 
-// GetLocalIP returns the local ip besides the localhost.
-func GetLocalIP() (*net.IPNet, error) {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return nil, err
+// Interfaces returns the network interfaces with the names, all of them
+// must exist. If there are no names it returns nil, meaning all the
+// interfaces.
+//
+// If there is an error, it's because one of the interfaces doesn't exist.
+func Interfaces(names []string) ([]net.Interface, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	ifaces := make([]net.Interface, 0, len(names))
+	for _, name := range names {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("network interfaces error %s: %v", name, err)
+		}
+		ifaces = append(ifaces, *iface)
+	}
+	return ifaces, nil
+}
+
+// LocalNets returns the networks of the addresses of the interfaces besides
+// the loopback, if ifaces is nil the addresses of all the interfaces.
+func LocalNets(ifaces []net.Interface) []*net.IPNet {
+	var addrs []net.Addr
+	if ifaces == nil {
+		addrs, _ = net.InterfaceAddrs()
+	}
+	for _, iface := range ifaces {
+		if a, err := iface.Addrs(); err == nil {
+			addrs = append(addrs, a...)
+		}
 	}
+
+	nets := make([]*net.IPNet, 0, len(addrs))
 	for _, address := range addrs {
-		// check the address type and if it is not a loopback the display it
 		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				return ipnet, nil
-			}
+			nets = append(nets, ipnet)
+		}
+	}
+	return nets
+}
+
+// PreferLocal returns the ips on the same network of one of the nets
+// first, the order of the others is kept.
+func PreferLocal(ips []net.IP, nets []*net.IPNet) []net.IP {
+	local := make([]net.IP, 0, len(ips))
+	var other []net.IP
+	for _, ip := range ips {
+		if isLocal(ip, nets) {
+			local = append(local, ip)
+		} else {
+			other = append(other, ip)
+		}
+	}
+	return append(local, other...)
+}
+
+// isLocal returns true if the ip is on the same network of one of the nets.
+func isLocal(ip net.IP, nets []*net.IPNet) bool {
+	for _, ipnet := range nets {
+		if SameNetwork(ipnet, ip) {
+			return true
 		}
 	}
-	return nil, fmt.Errorf("network get local ip found")
+	return false
 }
 
 // SameNetworks return if the ip provided is part tof the same network
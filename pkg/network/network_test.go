@@ -0,0 +1,449 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAddrs returns the addresses of the ips on the port.
+func newAddrs(port int, ips ...string) Addrs {
+	addrs := make(Addrs, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, &net.TCPAddr{IP: net.ParseIP(ip), Port: port})
+	}
+	return addrs
+}
+
+// ipsOf returns the ips of the addresses separated by commas.
+func ipsOf(addrs Addrs) string {
+	ips := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP.String())
+	}
+	return strings.Join(ips, ",")
+}
+
+// mustParseCIDR returns the network of the CIDR.
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ipnet
+}
+
+func Test_interleave(t *testing.T) {
+	tests := []struct {
+		name  string
+		addrs Addrs
+		want  string
+	}{
+		{"no addresses", nil, ""},
+		{"only IPv4 keeps the order", newAddrs(1, "10.0.0.2", "10.0.0.1"), "10.0.0.2,10.0.0.1"},
+		{"IPv6 first", newAddrs(1, "10.0.0.1", "2001:db8::1"), "2001:db8::1,10.0.0.1"},
+		{"more IPv4 than IPv6", newAddrs(1, "10.0.0.1", "10.0.0.2", "2001:db8::1", "10.0.0.3"), "2001:db8::1,10.0.0.1,10.0.0.2,10.0.0.3"},
+		{"more IPv6 than IPv4", newAddrs(1, "2001:db8::1", "2001:db8::2", "10.0.0.1"), "2001:db8::1,10.0.0.1,2001:db8::2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipsOf(interleave(tt.addrs)); got != tt.want {
+				t.Errorf("interleave expected = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_order(t *testing.T) {
+	nets := []*net.IPNet{mustParseCIDR(t, "192.168.1.0/24"), mustParseCIDR(t, "fd00::/64")}
+
+	tests := []struct {
+		name  string
+		addrs Addrs
+		nets  []*net.IPNet
+		want  string
+	}{
+		{
+			name:  "without local networks",
+			addrs: newAddrs(1, "192.168.1.5", "10.0.0.1", "fd00::5"),
+			want:  "fd00::5,192.168.1.5,10.0.0.1",
+		},
+		{
+			name:  "local addresses first",
+			addrs: newAddrs(1, "10.0.0.1", "2001:db8::1", "192.168.1.5", "fd00::5", "10.0.0.2", "2001:db8::2"),
+			nets:  nets,
+			want:  "fd00::5,192.168.1.5,2001:db8::1,10.0.0.1,2001:db8::2,10.0.0.2",
+		},
+		{
+			name:  "only local IPv4",
+			addrs: newAddrs(1, "2001:db8::1", "192.168.1.5"),
+			nets:  nets,
+			want:  "192.168.1.5,2001:db8::1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipsOf(order(tt.addrs, tt.nets)); got != tt.want {
+				t.Errorf("order expected = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	t.Run("ip and port", func(t *testing.T) {
+		addrs, err := Resolve("127.0.0.1:8822")
+		if err != nil {
+			t.Fatalf("Resolve not expected error = %v", err)
+		}
+
+		if len(addrs) != 1 || addrs.String() != "127.0.0.1:8822" {
+			t.Errorf("Resolve expected = 127.0.0.1:8822 but got = %v", addrs)
+		}
+	})
+
+	t.Run("address with zone kept", func(t *testing.T) {
+		addrs, err := Resolve("[fe80::1%eth9]:8822")
+		if err != nil {
+			t.Fatalf("Resolve not expected error = %v", err)
+		}
+
+		if len(addrs) != 1 || addrs[0].Zone != "eth9" {
+			t.Errorf("Resolve expected = [fe80::1%%eth9]:8822 but got = %v", addrs)
+		}
+	})
+
+	for _, target := range []string{"127.0.0.1", "127.0.0.1:port"} {
+		t.Run("invalid target "+target, func(t *testing.T) {
+			if _, err := Resolve(target); err == nil {
+				t.Errorf("Resolve expected error but got = %v", err)
+			}
+		})
+	}
+}
+
+// listen will start a listener on the loopback that accepts the connections
+// until the test ends, it returns its port.
+func listen(t *testing.T) int {
+	l, err := net.Listen(Type, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns a port on the loopback without listener.
+func closedPort(t *testing.T) int {
+	l, err := net.Listen(Type, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+// silentDial replaces the dial of the attempts, the attempts to the address
+// never answer until they are cancelled and the cancelled channel gets
+// closed, the others connect.
+func silentDial(t *testing.T, silent string) <-chan struct{} {
+	cancelled := make(chan struct{})
+	dial := dialContext
+	dialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address != silent {
+			return dial(ctx, network, address)
+		}
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+	t.Cleanup(func() { dialContext = dial })
+	return cancelled
+}
+
+func Test_Dial(t *testing.T) {
+	t.Run("next address after the attempt delay", func(t *testing.T) {
+		port := listen(t)
+		silent := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: port}
+		cancelled := silentDial(t, silent.String())
+
+		start := time.Now()
+		conn, err := Dial(Addrs{&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: port}, silent}, 5*time.Second, nil)
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatalf("Dial not expected error = %v", err)
+		}
+		defer conn.Close()
+
+		if want := fmt.Sprintf("127.0.0.1:%d", port); conn.RemoteAddr().String() != want {
+			t.Errorf("Dial expected connection to %v but got = %v", want, conn.RemoteAddr())
+		}
+
+		if elapsed < attemptDelay || elapsed > 2*time.Second {
+			t.Errorf("Dial expected to connect after %v but got = %v", attemptDelay, elapsed)
+		}
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Errorf("Dial expected the silent attempt cancelled")
+		}
+	})
+
+	t.Run("next address right away after a failure", func(t *testing.T) {
+		port := listen(t)
+		// Both are IPv4 so the closed port is tried first.
+		addrs := Addrs{
+			&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: closedPort(t)},
+			&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: port},
+		}
+
+		start := time.Now()
+		conn, err := Dial(addrs, 5*time.Second, nil)
+		if err != nil {
+			t.Fatalf("Dial not expected error = %v", err)
+		}
+		conn.Close()
+
+		if elapsed := time.Since(start); elapsed >= attemptDelay {
+			t.Errorf("Dial expected to connect before %v but got = %v", attemptDelay, elapsed)
+		}
+	})
+
+	t.Run("no address answers before the timeout", func(t *testing.T) {
+		silent := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 8822}
+		cancelled := silentDial(t, silent.String())
+
+		start := time.Now()
+		if _, err := Dial(Addrs{silent}, 300*time.Millisecond, nil); err == nil {
+			t.Errorf("Dial expected error but got = %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+			t.Errorf("Dial expected to fail after %v but got = %v", 300*time.Millisecond, elapsed)
+		}
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Errorf("Dial expected the silent attempt cancelled")
+		}
+	})
+
+	t.Run("addresses on the networks of the interfaces first", func(t *testing.T) {
+		iface, ip := localIPv4(t)
+		l, err := net.Listen(Type, net.JoinHostPort(ip.String(), "0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+
+		port := l.Addr().(*net.TCPAddr).Port
+		silent := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: port}
+		addrs := Addrs{silent, &net.TCPAddr{IP: ip, Port: port}}
+		silentDial(t, silent.String())
+
+		start := time.Now()
+		conn, err := Dial(addrs, 5*time.Second, []net.Interface{iface})
+		if err != nil {
+			t.Fatalf("Dial not expected error = %v", err)
+		}
+		conn.Close()
+
+		if elapsed := time.Since(start); elapsed >= attemptDelay {
+			t.Errorf("Dial expected to connect to %v first but got after = %v", ip, elapsed)
+		}
+
+		// On the loopback the address isn't local, the IPv6 one is first.
+		start = time.Now()
+		conn, err = Dial(addrs, 5*time.Second, []net.Interface{loopback(t)})
+		if err != nil {
+			t.Fatalf("Dial not expected error = %v", err)
+		}
+		conn.Close()
+
+		if elapsed := time.Since(start); elapsed < attemptDelay {
+			t.Errorf("Dial expected to connect to %v after %v but got = %v", ip, attemptDelay, elapsed)
+		}
+	})
+
+	t.Run("no addresses", func(t *testing.T) {
+		if _, err := Dial(Addrs{}, time.Second, nil); err == nil {
+			t.Errorf("Dial expected error but got = %v", err)
+		}
+	})
+
+	t.Run("single address", func(t *testing.T) {
+		port := listen(t)
+		conn, err := Dial(&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: port}, time.Second, nil)
+		if err != nil {
+			t.Fatalf("Dial not expected error = %v", err)
+		}
+		conn.Close()
+	})
+}
+
+func Test_PreferLocal(t *testing.T) {
+	nets := []*net.IPNet{mustParseCIDR(t, "192.168.1.0/24"), mustParseCIDR(t, "fd00::/64")}
+	ips := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("192.168.1.5"), net.ParseIP("2001:db8::1"), net.ParseIP("fd00::5")}
+
+	tests := []struct {
+		name string
+		nets []*net.IPNet
+		want string
+	}{
+		{"without local networks the order is kept", nil, "10.0.0.1,192.168.1.5,2001:db8::1,fd00::5"},
+		{"local ips first", nets, "192.168.1.5,fd00::5,10.0.0.1,2001:db8::1"},
+		{"only one local network", nets[1:], "fd00::5,10.0.0.1,192.168.1.5,2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0, len(ips))
+			for _, ip := range PreferLocal(ips, tt.nets) {
+				got = append(got, ip.String())
+			}
+
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("PreferLocal expected = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// localIPv4 returns an interface up besides the loopback and its IPv4
+// address.
+func localIPv4(t *testing.T) (net.Interface, net.IP) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				return iface, ipnet.IP
+			}
+		}
+	}
+	t.Skip("there is no interface with an IPv4 address")
+	return net.Interface{}, nil
+}
+
+// loopback returns the loopback interface.
+func loopback(t *testing.T) net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface
+		}
+	}
+	t.Skip("there is no loopback interface")
+	return net.Interface{}
+}
+
+func Test_Interfaces(t *testing.T) {
+	t.Run("all the interfaces without names", func(t *testing.T) {
+		if ifaces, err := Interfaces(nil); err != nil || ifaces != nil {
+			t.Errorf("Interfaces expected = nil but got = %v, %v", ifaces, err)
+		}
+	})
+
+	t.Run("interface with the name", func(t *testing.T) {
+		lo := loopback(t)
+		ifaces, err := Interfaces([]string{lo.Name})
+		if err != nil {
+			t.Fatalf("Interfaces not expected error = %v", err)
+		}
+
+		if len(ifaces) != 1 || ifaces[0].Name != lo.Name {
+			t.Errorf("Interfaces expected = %v but got = %v", lo.Name, ifaces)
+		}
+	})
+
+	t.Run("interface that doesn't exist", func(t *testing.T) {
+		if _, err := Interfaces([]string{loopback(t).Name, "catch-none0"}); err == nil {
+			t.Errorf("Interfaces expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_LocalNets(t *testing.T) {
+	t.Run("all the interfaces without loopback", func(t *testing.T) {
+		for _, ipnet := range LocalNets(nil) {
+			if ipnet.IP.IsLoopback() {
+				t.Errorf("LocalNets expected without loopback but got = %v", ipnet)
+			}
+		}
+	})
+
+	t.Run("only the loopback interface", func(t *testing.T) {
+		if nets := LocalNets([]net.Interface{loopback(t)}); len(nets) != 0 {
+			t.Errorf("LocalNets expected no networks but got = %v", nets)
+		}
+	})
+
+	t.Run("networks of the interface", func(t *testing.T) {
+		ifaces, err := net.Interfaces()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, iface := range ifaces {
+			addrs, err := iface.Addrs()
+			if err != nil || iface.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+
+			want := make(map[string]bool)
+			for _, a := range addrs {
+				if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+					want[ipnet.String()] = true
+				}
+			}
+
+			nets := LocalNets([]net.Interface{iface})
+			if len(nets) != len(want) {
+				t.Errorf("LocalNets expected = %v of %s but got = %v", want, iface.Name, nets)
+			}
+			for _, ipnet := range nets {
+				if !want[ipnet.String()] {
+					t.Errorf("LocalNets expected = %v of %s but got = %v", want, iface.Name, ipnet)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package pake
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// CodeLen is the number of digits of a pairing code.
+const CodeLen = 6
+
+// NewCode will generate a random pairing code with CodeLen digits.
+func NewCode() (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(CodeLen), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", fmt.Errorf("pake new code error: %v", err)
+	}
+	return fmt.Sprintf("%0*d", CodeLen, n), nil
+}
+
+// NormalizeCode will remove the spaces and dashes the user may type
+// between the digits of the code.
+func NormalizeCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+}
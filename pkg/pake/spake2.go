@@ -0,0 +1,268 @@
+// Package pake implements the password-authenticated key exchange used to
+// pair two peers with a short code.
+//
+// The code has only CodeLen digits, that is acceptable because SPAKE2 gives
+// nothing to guess the code offline from the messages exchanged, an attacker
+// in the middle can only try one code for each exchange it takes part and a
+// wrong code fails the confirmation. Each exchange needs the user to type the
+// code on the receiver and the code is not used again, so the chance of a
+// guess is one in a million for each pairing the user agrees to.
+package pake
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"filippo.io/nistec"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Role identifies each side of the key exchange, the initiator is A and
+// the responder is B.
+type Role int
+
+const (
+	// RoleA is the side that starts the pairing.
+	RoleA Role = iota + 1
+	// RoleB is the side that answers the pairing.
+	RoleB
+)
+
+// The M and N points for P-256 defined on RFC 9382, nobody knows their
+// discrete logarithm which is what makes the exchange secure.
+const (
+	pointM = "02886e2f97ace46e55ba9dd7242579f2993b64e16ef3dcab95afd497333d8fa12f"
+	pointN = "03d8bbd6c639c62937b04d997f38c3770719c629d7014d49a24b4f98baa1292b49"
+)
+
+// keyLen is the length of each key derived from the transcript.
+const keyLen = 16
+
+// scalarLen is the length of the P-256 scalars.
+const scalarLen = 32
+
+// Parameters of the scrypt that hashes the password, the hash is 16 bytes
+// longer than the scalar so its reduction by the order is uniform.
+const (
+	scryptN   = 1 << 15
+	scryptR   = 8
+	scryptP   = 1
+	scryptLen = scalarLen + 16
+)
+
+// order is the order of the P-256 group.
+var order, _ = new(big.Int).SetString("ffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551", 16)
+
+// ErrConfirmation signals that the confirmation of the peer is not valid,
+// which means the peer used a different password or the messages were
+// modified.
+var ErrConfirmation = errors.New("pake confirmation error: peer confirmation doesn't match")
+
+// SPAKE2 holds the state of one side of a SPAKE2 key exchange (RFC 9382)
+// over the P-256 curve.
+//
+// Both sides must use the same password and the same identities, the
+// identities are bound into the transcript so the keys are only the same
+// if both sides agree on who is talking to who.
+//
+// The curve operations are constant time and the password is hashed with
+// scrypt, salted with the identities, before being used as a scalar.
+type SPAKE2 struct {
+	role      Role
+	w         []byte
+	x         []byte
+	share     []byte
+	idA, idB  []byte
+	secret    []byte
+	confirmA  []byte
+	confirmB  []byte
+	completed bool
+}
+
+// New creates one side of the key exchange with the password and the
+// identities of both sides.
+//
+// If there is an error, it can be because the role is not valid or it
+// wasn't possible to hash the password or generate the random scalar.
+func New(role Role, password, idA, idB []byte) (*SPAKE2, error) {
+	if role != RoleA && role != RoleB {
+		return nil, fmt.Errorf("pake new error: invalid role %d", role)
+	}
+
+	hash, err := scrypt.Key(password, transcript(idA, idB), scryptN, scryptR, scryptP, scryptLen)
+	if err != nil {
+		return nil, fmt.Errorf("pake new error hashing the password: %v", err)
+	}
+	w := scalar(new(big.Int).Mod(new(big.Int).SetBytes(hash), order))
+
+	r, err := rand.Int(rand.Reader, new(big.Int).Sub(order, big.NewInt(1)))
+	if err != nil {
+		return nil, fmt.Errorf("pake new error generating the scalar: %v", err)
+	}
+	x := scalar(r.Add(r, big.NewInt(1)))
+
+	s := &SPAKE2{
+		role: role,
+		w:    w,
+		x:    x,
+		idA:  idA,
+		idB:  idB,
+	}
+
+	// share = x*G + w*M for A or x*G + w*N for B
+	gx, err := nistec.NewP256Point().ScalarBaseMult(x)
+	if err != nil {
+		return nil, fmt.Errorf("pake new error: %v", err)
+	}
+	bw, err := nistec.NewP256Point().ScalarMult(blinding(role), w)
+	if err != nil {
+		return nil, fmt.Errorf("pake new error: %v", err)
+	}
+	s.share = gx.Add(gx, bw).Bytes()
+
+	return s, nil
+}
+
+// Share returns the message that must be sent to the other side.
+func (s *SPAKE2) Share() []byte {
+	return s.share
+}
+
+// Finish will compute the shared secret and the confirmation keys using the
+// share received from the other side.
+//
+// If there is an error, it can be because the share is not a valid point
+// or the exchange is already finished.
+func (s *SPAKE2) Finish(peerShare []byte) error {
+	if s.completed {
+		return fmt.Errorf("pake finish error: exchange already finished")
+	}
+
+	// The point at infinity is encoded with a single byte.
+	p, err := nistec.NewP256Point().SetBytes(peerShare)
+	if err != nil || len(peerShare) == 1 {
+		return fmt.Errorf("pake finish error: invalid peer share")
+	}
+
+	// K = x*(peerShare - w*N) for A or x*(peerShare - w*M) for B
+	other := RoleB
+	if s.role == RoleB {
+		other = RoleA
+	}
+	bw, err := nistec.NewP256Point().ScalarMult(blinding(other), s.w)
+	if err != nil {
+		return fmt.Errorf("pake finish error: %v", err)
+	}
+	u := p.Add(p, bw.Negate(bw))
+	kp, err := nistec.NewP256Point().ScalarMult(u, s.x)
+	if err != nil {
+		return fmt.Errorf("pake finish error: %v", err)
+	}
+	k := kp.Bytes()
+	if len(k) == 1 {
+		return fmt.Errorf("pake finish error: invalid shared point")
+	}
+
+	shareA, shareB := s.share, peerShare
+	if s.role == RoleB {
+		shareA, shareB = peerShare, s.share
+	}
+
+	tt := transcript(s.idA, s.idB, shareA, shareB, k, s.w)
+	sum := sha256.Sum256(tt)
+	ke, ka := sum[:keyLen], sum[keyLen:]
+
+	kc := make([]byte, 2*keyLen)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, ka, nil, []byte("ConfirmationKeys")), kc); err != nil {
+		return fmt.Errorf("pake finish error deriving the confirmation keys: %v", err)
+	}
+	s.confirmA = mac(kc[:keyLen], shareB)
+	s.confirmB = mac(kc[keyLen:], shareA)
+	s.secret = ke
+	s.completed = true
+
+	return nil
+}
+
+// Confirmation returns the confirmation that must be sent to the other side
+// to prove that both have the same secret, only valid after Finish.
+func (s *SPAKE2) Confirmation() []byte {
+	if s.role == RoleA {
+		return s.confirmA
+	}
+	return s.confirmB
+}
+
+// Verify will check the confirmation received from the other side, if it
+// doesn't match ErrConfirmation is returned.
+func (s *SPAKE2) Verify(peerConfirmation []byte) error {
+	if !s.completed {
+		return fmt.Errorf("pake verify error: exchange not finished")
+	}
+
+	expected := s.confirmB
+	if s.role == RoleB {
+		expected = s.confirmA
+	}
+
+	if !hmac.Equal(expected, peerConfirmation) {
+		return ErrConfirmation
+	}
+	return nil
+}
+
+// Secret returns the shared secret, it should only be used after the
+// confirmation of the other side is verified.
+func (s *SPAKE2) Secret() []byte {
+	return s.secret
+}
+
+// blinding returns the point used to blind the share of the role.
+func blinding(role Role) *nistec.P256Point {
+	encoded := pointM
+	if role == RoleB {
+		encoded = pointN
+	}
+
+	b, _ := hex.DecodeString(encoded)
+	p, err := nistec.NewP256Point().SetBytes(b)
+	if err != nil {
+		panic(fmt.Sprintf("pake blinding error: %v", err))
+	}
+	return p
+}
+
+// scalar returns the scalar n encoded as big endian with scalarLen bytes.
+func scalar(n *big.Int) []byte {
+	b := n.Bytes()
+	return append(bytes.Repeat([]byte{0}, scalarLen-len(b)), b...)
+}
+
+// transcript will concatenate all the values each one prefixed by its
+// length as 8 bytes little endian.
+func transcript(values ...[]byte) []byte {
+	tt := make([]byte, 0, 512)
+	for _, v := range values {
+		l := make([]byte, 8)
+		binary.LittleEndian.PutUint64(l, uint64(len(v)))
+		tt = append(tt, l...)
+		tt = append(tt, v...)
+	}
+	return tt
+}
+
+// mac returns the HMAC-SHA256 of the data with the key.
+func mac(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,139 @@
+package pake
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// exchange will run the key exchange between both sides and return them.
+func exchange(t *testing.T, passA, passB string) (*SPAKE2, *SPAKE2) {
+	idA, idB := []byte("peer-a"), []byte("peer-b")
+
+	a, err := New(RoleA, []byte(passA), idA, idB)
+	if err != nil {
+		t.Fatalf("New not expected error = %v", err)
+	}
+
+	b, err := New(RoleB, []byte(passB), idA, idB)
+	if err != nil {
+		t.Fatalf("New not expected error = %v", err)
+	}
+
+	if err = a.Finish(b.Share()); err != nil {
+		t.Fatalf("Finish not expected error = %v", err)
+	}
+
+	if err = b.Finish(a.Share()); err != nil {
+		t.Fatalf("Finish not expected error = %v", err)
+	}
+	return a, b
+}
+
+func Test_SPAKE2(t *testing.T) {
+	t.Run("same password", func(t *testing.T) {
+		a, b := exchange(t, "123456", "123456")
+
+		if err := a.Verify(b.Confirmation()); err != nil {
+			t.Errorf("Verify not expected error = %v", err)
+		}
+
+		if err := b.Verify(a.Confirmation()); err != nil {
+			t.Errorf("Verify not expected error = %v", err)
+		}
+
+		if !bytes.Equal(a.Secret(), b.Secret()) || len(a.Secret()) != keyLen {
+			t.Errorf("Secret expected to be equal on both sides")
+		}
+	})
+
+	t.Run("different password", func(t *testing.T) {
+		a, b := exchange(t, "123456", "654321")
+
+		if err := a.Verify(b.Confirmation()); !errors.Is(err, ErrConfirmation) {
+			t.Errorf("Verify expected error = %v but got = %v", ErrConfirmation, err)
+		}
+
+		if err := b.Verify(a.Confirmation()); !errors.Is(err, ErrConfirmation) {
+			t.Errorf("Verify expected error = %v but got = %v", ErrConfirmation, err)
+		}
+	})
+
+	t.Run("different identities", func(t *testing.T) {
+		a, _ := New(RoleA, []byte("123456"), []byte("peer-a"), []byte("peer-b"))
+		b, _ := New(RoleB, []byte("123456"), []byte("peer-a"), []byte("peer-c"))
+		a.Finish(b.Share())
+		b.Finish(a.Share())
+
+		if err := a.Verify(b.Confirmation()); !errors.Is(err, ErrConfirmation) {
+			t.Errorf("Verify expected error = %v but got = %v", ErrConfirmation, err)
+		}
+	})
+
+	t.Run("invalid peer share", func(t *testing.T) {
+		a, _ := New(RoleA, []byte("123456"), nil, nil)
+
+		if err := a.Finish([]byte("invalid")); err == nil {
+			t.Errorf("Finish expected error = %v", err)
+		}
+	})
+
+	t.Run("peer share at infinity", func(t *testing.T) {
+		a, _ := New(RoleA, []byte("123456"), nil, nil)
+
+		if err := a.Finish([]byte{0}); err == nil {
+			t.Errorf("Finish expected error = %v", err)
+		}
+	})
+
+	t.Run("peer share not on the curve", func(t *testing.T) {
+		a, _ := New(RoleA, []byte("123456"), nil, nil)
+		share := append([]byte(nil), a.Share()...)
+		share[len(share)-1] ^= 1
+
+		if err := a.Finish(share); err == nil {
+			t.Errorf("Finish expected error = %v", err)
+		}
+	})
+
+	t.Run("finish twice", func(t *testing.T) {
+		a, b := exchange(t, "123456", "123456")
+
+		if err := a.Finish(b.Share()); err == nil {
+			t.Errorf("Finish expected error = %v", err)
+		}
+	})
+
+	t.Run("verify before finish", func(t *testing.T) {
+		a, _ := New(RoleA, []byte("123456"), nil, nil)
+
+		if err := a.Verify(nil); err == nil {
+			t.Errorf("Verify expected error = %v", err)
+		}
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		if _, err := New(Role(0), []byte("123456"), nil, nil); err == nil {
+			t.Errorf("New expected error = %v", err)
+		}
+	})
+}
+
+func Test_NewCode(t *testing.T) {
+	t.Run("code has the digits", func(t *testing.T) {
+		code, err := NewCode()
+		if err != nil {
+			t.Errorf("NewCode not expected error = %v", err)
+		}
+
+		if len(code) != CodeLen {
+			t.Errorf("NewCode expected length = %v but got = %v", CodeLen, len(code))
+		}
+	})
+
+	t.Run("normalize code typed by the user", func(t *testing.T) {
+		if code := NormalizeCode(" 123-456 "); code != "123456" {
+			t.Errorf("NormalizeCode expected = %v but got = %v", "123456", code)
+		}
+	})
+}
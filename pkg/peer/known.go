@@ -0,0 +1,167 @@
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Trust represents if the identity of the peer can be trusted.
+type Trust int
+
+const (
+	// Peer didn't advertise a fingerprint, it can't be verified.
+	Unverified Trust = iota
+	// Peer fingerprint matches the fingerprint pinned the first time it was seen.
+	Trusted
+	// Peer fingerprint doesn't match the pinned fingerprint, possible impersonation.
+	Mismatch
+	// Peer fingerprint was confirmed with a pairing code.
+	Paired
+)
+
+// String convert the trust into a string representation.
+func (t Trust) String() string {
+	switch t {
+	case Unverified:
+		return `Unverified`
+	case Trusted:
+		return `Trusted`
+	case Mismatch:
+		return `Mismatch`
+	case Paired:
+		return `Paired`
+	}
+	return ``
+}
+
+// Verified returns true if the peer fingerprint is pinned or paired.
+func (t Trust) Verified() bool {
+	return t == Trusted || t == Paired
+}
+
+// knownPeer is the fingerprint pinned for a peer and if it was confirmed
+// with a pairing code.
+type knownPeer struct {
+	Fingerprint string `json:"fingerprint"`
+	Paired      bool   `json:"paired,omitempty"`
+}
+
+// KnownPeers is a thread-safe store of the fingerprints pinned for each peer
+// name, the first fingerprint seen for a peer is pinned and stored on a file
+// so it's kept between executions (trust on first use). A fingerprint can
+// also be pinned by pairing with the peer.
+type KnownPeers struct {
+	mu   sync.Mutex
+	path string
+	pins map[string]knownPeer
+}
+
+// LoadKnownPeers will load the pinned fingerprints from the file on the path,
+// if the file doesn't exist yet there are no pinned fingerprints. If the path
+// is empty the pinned fingerprints are only kept in memory.
+//
+// If there is an error, it can be because the file couldn't be read or the
+// content is not valid.
+func LoadKnownPeers(path string) (*KnownPeers, error) {
+	k := &KnownPeers{
+		path: path,
+		pins: make(map[string]knownPeer),
+	}
+
+	if path == "" {
+		return k, nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("peer known peers load error: %v", err)
+	}
+
+	if err = json.Unmarshal(data, &k.pins); err == nil {
+		return k, nil
+	}
+
+	// Before pairing the file only had the fingerprint for each name.
+	var pins map[string]string
+	if err = json.Unmarshal(data, &pins); err != nil {
+		return nil, fmt.Errorf("peer known peers load error decoding: %v", err)
+	}
+	for name, fingerprint := range pins {
+		k.pins[name] = knownPeer{Fingerprint: fingerprint}
+	}
+	return k, nil
+}
+
+// Check will compare the fingerprint with the one pinned for the peer name,
+// if there is no fingerprint pinned yet it gets pinned and stored. A peer
+// with a fingerprint pinned that doesn't advertise one is a Mismatch.
+//
+// If there is an error, it can be because the pinned fingerprints couldn't
+// be stored, the fingerprint is pinned anyway for this execution.
+func (k *KnownPeers) Check(name, fingerprint string) (Trust, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	pinned, ok := k.pins[name]
+	switch {
+	case ok && pinned.Fingerprint != fingerprint:
+		return Mismatch, nil
+	case ok && pinned.Paired:
+		return Paired, nil
+	case ok:
+		return Trusted, nil
+	case fingerprint == "":
+		return Unverified, nil
+	}
+
+	k.pins[name] = knownPeer{Fingerprint: fingerprint}
+	return Trusted, k.save()
+}
+
+// Pair will pin the fingerprint confirmed with a pairing code for the peer
+// name, replacing any fingerprint pinned before.
+//
+// If there is an error, it can be because the pinned fingerprints couldn't
+// be stored, the fingerprint is paired anyway for this execution.
+func (k *KnownPeers) Pair(name, fingerprint string) error {
+	if fingerprint == "" {
+		return fmt.Errorf("peer known peers pair error: fingerprint is empty")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.pins[name] = knownPeer{Fingerprint: fingerprint, Paired: true}
+	return k.save()
+}
+
+// Pinned returns the fingerprint pinned for the peer name, empty if there
+// is none.
+func (k *KnownPeers) Pinned(name string) string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.pins[name].Fingerprint
+}
+
+// save will write the pinned fingerprints to the file.
+func (k *KnownPeers) save() error {
+	if k.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(k.pins, "", "  ")
+	if err != nil {
+		return fmt.Errorf("peer known peers save error encoding: %v", err)
+	}
+
+	if err = os.WriteFile(k.path, data, 0600); err != nil {
+		return fmt.Errorf("peer known peers save error: %v", err)
+	}
+	return nil
+}
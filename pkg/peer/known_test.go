@@ -0,0 +1,120 @@
+package peer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_KnownPeers_Check(t *testing.T) {
+	t.Run("pin on first use and keep it after load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_peers.json")
+		k, err := LoadKnownPeers(path)
+		if err != nil {
+			t.Fatalf("LoadKnownPeers not expected error = %v", err)
+		}
+
+		if trust, err := k.Check("peer-1", "aaaa"); err != nil || trust != Trusted {
+			t.Errorf("Check expected trust = %v but got = %v (%v)", Trusted, trust, err)
+		}
+
+		k, err = LoadKnownPeers(path)
+		if err != nil {
+			t.Fatalf("LoadKnownPeers not expected error = %v", err)
+		}
+
+		if k.Pinned("peer-1") != "aaaa" {
+			t.Errorf("Pinned expected = %v but got = %v", "aaaa", k.Pinned("peer-1"))
+		}
+
+		if trust, _ := k.Check("peer-1", "aaaa"); trust != Trusted {
+			t.Errorf("Check expected trust = %v but got = %v", Trusted, trust)
+		}
+	})
+
+	t.Run("fingerprint changed", func(t *testing.T) {
+		k, _ := LoadKnownPeers("")
+		k.Check("peer-1", "aaaa")
+
+		if trust, _ := k.Check("peer-1", "bbbb"); trust != Mismatch {
+			t.Errorf("Check expected trust = %v but got = %v", Mismatch, trust)
+		}
+
+		if k.Pinned("peer-1") != "aaaa" {
+			t.Errorf("Pinned expected = %v but got = %v", "aaaa", k.Pinned("peer-1"))
+		}
+	})
+
+	t.Run("fingerprint not advertised", func(t *testing.T) {
+		k, _ := LoadKnownPeers("")
+
+		if trust, _ := k.Check("peer-1", ""); trust != Unverified {
+			t.Errorf("Check expected trust = %v but got = %v", Unverified, trust)
+		}
+	})
+
+	t.Run("pinned peer without fingerprint", func(t *testing.T) {
+		k, _ := LoadKnownPeers("")
+		k.Check("peer-1", "aaaa")
+
+		if trust, _ := k.Check("peer-1", ""); trust != Mismatch {
+			t.Errorf("Check expected trust = %v but got = %v", Mismatch, trust)
+		}
+	})
+
+	t.Run("file not valid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_peers.json")
+		os.WriteFile(path, []byte("invalid"), 0600)
+
+		if _, err := LoadKnownPeers(path); err == nil {
+			t.Errorf("LoadKnownPeers expected error = %v", err)
+		}
+	})
+}
+
+func Test_KnownPeers_Pair(t *testing.T) {
+	t.Run("pair replaces the pinned fingerprint", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_peers.json")
+		k, _ := LoadKnownPeers(path)
+		k.Check("peer-1", "aaaa")
+
+		if err := k.Pair("peer-1", "bbbb"); err != nil {
+			t.Fatalf("Pair not expected error = %v", err)
+		}
+
+		k, err := LoadKnownPeers(path)
+		if err != nil {
+			t.Fatalf("LoadKnownPeers not expected error = %v", err)
+		}
+
+		if trust, _ := k.Check("peer-1", "bbbb"); trust != Paired {
+			t.Errorf("Check expected trust = %v but got = %v", Paired, trust)
+		}
+
+		if trust, _ := k.Check("peer-1", "aaaa"); trust != Mismatch {
+			t.Errorf("Check expected trust = %v but got = %v", Mismatch, trust)
+		}
+	})
+
+	t.Run("pair without fingerprint", func(t *testing.T) {
+		k, _ := LoadKnownPeers("")
+
+		if err := k.Pair("peer-1", ""); err == nil {
+			t.Errorf("Pair expected error = %v", err)
+		}
+	})
+
+	t.Run("load file without pairing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_peers.json")
+		os.WriteFile(path, []byte(`{"peer-1":"aaaa"}`), 0600)
+
+		k, err := LoadKnownPeers(path)
+		if err != nil {
+			t.Fatalf("LoadKnownPeers not expected error = %v", err)
+		}
+
+		if trust, _ := k.Check("peer-1", "aaaa"); trust != Trusted {
+			t.Errorf("Check expected trust = %v but got = %v", Trusted, trust)
+		}
+	})
+}
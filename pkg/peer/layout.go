@@ -20,12 +20,42 @@ func (l *peerLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
 	col2Width := (size.Width - col1Width) * 0.42
 	col2X := col1X + col1Width + theme.Padding()
 
-	col3Width := float32(40)
-	col3X := size.Width - theme.Padding() - col3Width
+	col5Width := float32(40)
+	col5X := size.Width - theme.Padding() - col5Width
+
+	col4Width := col5Width
+	col4X := col5X - theme.Padding() - col4Width
+
+	col3Width := col5Width
+	col3X := col4X - theme.Padding() - col3Width
+
+	col6Width := col5Width
+	col6X := col3X - theme.Padding() - col6Width
+
+	col7Width := col5Width
+	col7X := col6X - theme.Padding() - col7Width
+
+	col8Width := col5Width
+	col8X := col7X - theme.Padding() - col8Width
+
+	// The address column ends before the buttons, the remove button is
+	// only shown for the manual peers.
+	end := col7X - theme.Padding()
+	if objects[7].Visible() {
+		end = col8X - theme.Padding()
+	}
+	if col2X+col2Width > end {
+		col2Width = end - col2X
+	}
 
 	layout.ResizeAndMove(objects[0], col1Width, col1X, l.maxMinSizeHeight)
 	layout.ResizeAndMove(objects[1], col2Width, col2X, l.maxMinSizeHeight)
 	layout.ResizeAndMove(objects[2], col3Width, col3X, l.maxMinSizeHeight)
+	layout.ResizeAndMove(objects[3], col4Width, col4X, l.maxMinSizeHeight)
+	layout.ResizeAndMove(objects[4], col5Width, col5X, l.maxMinSizeHeight)
+	layout.ResizeAndMove(objects[5], col6Width, col6X, l.maxMinSizeHeight)
+	layout.ResizeAndMove(objects[6], col7Width, col7X, l.maxMinSizeHeight)
+	layout.ResizeAndMove(objects[7], col8Width, col8X, l.maxMinSizeHeight)
 }
 
 // MinSize will calculate the minimum size allowed that
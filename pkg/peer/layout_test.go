@@ -36,10 +36,18 @@ func Test_peerLayout_Layout(t *testing.T) {
 			}
 		}()
 
+		remove := container.NewWithoutLayout()
+		remove.Hide()
+
 		objects := []fyne.CanvasObject{
 			container.NewWithoutLayout(),
 			container.NewWithoutLayout(),
 			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			remove,
 		}
 
 		l.Layout(objects, fyne.NewSize(900, 600))
@@ -48,14 +56,55 @@ func Test_peerLayout_Layout(t *testing.T) {
 			t.Errorf("object 0: %v", err0)
 		}
 
-		if err1 := checkPosAndSize(objects[1], 151.2, 548); err1 != nil {
+		if err1 := checkPosAndSize(objects[1], 128, 548); err1 != nil {
 			t.Errorf("object 1: %v", err1)
 		}
 
-		if err2 := checkPosAndSize(objects[2], 40, 856); err2 != nil {
+		if err2 := checkPosAndSize(objects[2], 40, 768); err2 != nil {
 			t.Errorf("object 2: %v", err2)
 		}
 
+		if err3 := checkPosAndSize(objects[3], 40, 812); err3 != nil {
+			t.Errorf("object 3: %v", err3)
+		}
+
+		if err4 := checkPosAndSize(objects[4], 40, 856); err4 != nil {
+			t.Errorf("object 4: %v", err4)
+		}
+
+		if err5 := checkPosAndSize(objects[5], 40, 724); err5 != nil {
+			t.Errorf("object 5: %v", err5)
+		}
+
+		if err6 := checkPosAndSize(objects[6], 40, 680); err6 != nil {
+			t.Errorf("object 6: %v", err6)
+		}
+
+	})
+
+	t.Run("with remove button", func(t *testing.T) {
+		l := &peerLayout{}
+
+		objects := []fyne.CanvasObject{
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+		}
+
+		l.Layout(objects, fyne.NewSize(900, 600))
+
+		if err1 := checkPosAndSize(objects[1], 84, 548); err1 != nil {
+			t.Errorf("object 1: %v", err1)
+		}
+
+		if err7 := checkPosAndSize(objects[7], 40, 636); err7 != nil {
+			t.Errorf("object 7: %v", err7)
+		}
 	})
 
 }
@@ -0,0 +1,116 @@
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ManualPeer is a peer added by its address instead of being discovered,
+// like on the networks that block the multicast.
+type ManualPeer struct {
+	Name    string `json:"name"`
+	Address string `json:"address"` // Address is the host:port the peer was added with.
+}
+
+// ManualPeers is a thread-safe store of the peers added manually, they are
+// stored on a file so they are added again on the next executions.
+type ManualPeers struct {
+	mu    sync.Mutex
+	path  string
+	peers []ManualPeer
+}
+
+// LoadManualPeers will load the manual peers from the file on the path, if
+// the file doesn't exist yet there are no manual peers. If the path is empty
+// the manual peers are only kept in memory.
+//
+// If there is an error, it can be because the file couldn't be read or the
+// content is not valid.
+func LoadManualPeers(path string) (*ManualPeers, error) {
+	m := &ManualPeers{path: path}
+
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("peer manual peers load error: %v", err)
+	}
+
+	if err = json.Unmarshal(data, &m.peers); err != nil {
+		return nil, fmt.Errorf("peer manual peers load error decoding: %v", err)
+	}
+	return m, nil
+}
+
+// List returns the manual peers in the order they were added.
+func (m *ManualPeers) List() []ManualPeer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ManualPeer(nil), m.peers...)
+}
+
+// Add will add the peer and store it, a peer with the same address is
+// replaced.
+//
+// If there is an error, it can be because the manual peers couldn't be
+// stored, the peer is added anyway for this execution.
+func (m *ManualPeers) Add(p ManualPeer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for j := range m.peers {
+		if m.peers[j].Address != p.Address {
+			continue
+		}
+		if m.peers[j] == p {
+			return nil
+		}
+		m.peers[j] = p
+		return m.save()
+	}
+
+	m.peers = append(m.peers, p)
+	return m.save()
+}
+
+// Remove will remove the peer with the address and store the others.
+//
+// If there is an error, it can be because there is no peer with the address
+// or the manual peers couldn't be stored.
+func (m *ManualPeers) Remove(address string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for j := range m.peers {
+		if m.peers[j].Address == address {
+			m.peers = append(m.peers[:j], m.peers[j+1:]...)
+			return m.save()
+		}
+	}
+	return fmt.Errorf("peer manual peers remove error: peer %s not found", address)
+}
+
+// save will write the manual peers to the file.
+func (m *ManualPeers) save() error {
+	if m.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m.peers, "", "  ")
+	if err != nil {
+		return fmt.Errorf("peer manual peers save error encoding: %v", err)
+	}
+
+	if err = os.WriteFile(m.path, data, 0600); err != nil {
+		return fmt.Errorf("peer manual peers save error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package peer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_ManualPeers_Add(t *testing.T) {
+	t.Run("add and keep it after load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "manual_peers.json")
+		m, err := LoadManualPeers(path)
+		if err != nil {
+			t.Fatalf("LoadManualPeers not expected error = %v", err)
+		}
+
+		p := ManualPeer{Name: "peer-1", Address: "10.0.0.1:8822"}
+		if err = m.Add(p); err != nil {
+			t.Fatalf("Add not expected error = %v", err)
+		}
+
+		m, err = LoadManualPeers(path)
+		if err != nil {
+			t.Fatalf("LoadManualPeers not expected error = %v", err)
+		}
+
+		if list := m.List(); !reflect.DeepEqual(list, []ManualPeer{p}) {
+			t.Errorf("List expected = %v but got = %v", []ManualPeer{p}, list)
+		}
+	})
+
+	t.Run("peer with the same address replaced", func(t *testing.T) {
+		m, _ := LoadManualPeers("")
+		m.Add(ManualPeer{Name: "peer-1", Address: "10.0.0.1:8822"})
+		m.Add(ManualPeer{Name: "peer-2", Address: "10.0.0.2:8822"})
+		m.Add(ManualPeer{Name: "peer-3", Address: "10.0.0.1:8822"})
+
+		list := m.List()
+		if len(list) != 2 || list[0].Name != "peer-3" || list[1].Name != "peer-2" {
+			t.Errorf("List expected peer-3 and peer-2 but got = %v", list)
+		}
+	})
+
+	t.Run("file not valid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "manual_peers.json")
+		os.WriteFile(path, []byte("invalid"), 0600)
+
+		if _, err := LoadManualPeers(path); err == nil {
+			t.Errorf("LoadManualPeers expected error = %v", err)
+		}
+	})
+}
+
+func Test_ManualPeers_Remove(t *testing.T) {
+	t.Run("peer removed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "manual_peers.json")
+		m, _ := LoadManualPeers(path)
+		m.Add(ManualPeer{Name: "peer-1", Address: "10.0.0.1:8822"})
+
+		if err := m.Remove("10.0.0.1:8822"); err != nil {
+			t.Fatalf("Remove not expected error = %v", err)
+		}
+
+		m, _ = LoadManualPeers(path)
+		if list := m.List(); len(list) != 0 {
+			t.Errorf("List expected no peers but got = %v", list)
+		}
+	})
+
+	t.Run("peer not found", func(t *testing.T) {
+		m, _ := LoadManualPeers("")
+
+		if err := m.Remove("10.0.0.1:8822"); err == nil {
+			t.Errorf("Remove expected error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package peer
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Zeroconf TXT record keys of the metadata advertised by the peer.
+const (
+	txtProtocol     = `pv=`
+	txtAppVersion   = `av=`
+	txtOS           = `os=`
+	txtDisplayName  = `dn=`
+	txtDeviceID     = `id=`
+	txtCapabilities = `caps=`
+)
+
+// Names of the capabilities the view checks before sending.
+const (
+	capDirectory = "directory"
+	capBatch     = "batch"
+)
+
+// Maximum length of a TXT record, the values longer are cut.
+const maxTXTLen = 255
+
+// Metadata is the information a peer advertises on the discovery besides
+// its address, the fields are empty if the peer doesn't advertise them,
+// like the peers of older versions.
+type Metadata struct {
+	Protocol    int    // Protocol is the version of the transfer protocol, 0 if unknown.
+	AppVersion  string // AppVersion is the version of the application.
+	OS          string // OS is the operating system, like linux, darwin or windows.
+	DisplayName string // DisplayName is the name chosen by the user to show instead of the hostname.
+	// DeviceID identifies the installation of the peer, it doesn't change
+	// when the peer restarts or changes its hostname.
+	DeviceID string
+	// Capabilities are the names of the protocol features supported, nil
+	// if unknown.
+	Capabilities []string
+}
+
+// Supports returns false if the peer advertised its capabilities and the
+// capability is not one of them, a peer that didn't advertise them may
+// support it.
+func (m Metadata) Supports(capability string) bool {
+	if m.Capabilities == nil {
+		return true
+	}
+
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// text returns the TXT records of the metadata, the empty fields are not
+// included.
+func (m Metadata) text() []string {
+	var text []string
+	if m.Protocol > 0 {
+		text = append(text, txtProtocol+strconv.Itoa(m.Protocol))
+	}
+
+	for _, kv := range [][2]string{
+		{txtAppVersion, m.AppVersion},
+		{txtOS, m.OS},
+		{txtDisplayName, m.DisplayName},
+		{txtDeviceID, m.DeviceID},
+	} {
+		if kv[1] != "" {
+			text = append(text, txtRecord(kv[0], kv[1]))
+		}
+	}
+
+	if m.Capabilities != nil {
+		text = append(text, txtRecord(txtCapabilities, strings.Join(m.Capabilities, ",")))
+	}
+	return text
+}
+
+// parseMetadata returns the metadata on the TXT records, an invalid
+// protocol version is ignored.
+func parseMetadata(text []string) Metadata {
+	m := Metadata{
+		AppVersion:  txtValue(text, txtAppVersion),
+		OS:          txtValue(text, txtOS),
+		DisplayName: txtValue(text, txtDisplayName),
+		DeviceID:    txtValue(text, txtDeviceID),
+	}
+
+	if v, err := strconv.Atoi(txtValue(text, txtProtocol)); err == nil && v > 0 {
+		m.Protocol = v
+	}
+
+	for _, t := range text {
+		if strings.HasPrefix(t, txtCapabilities) {
+			m.Capabilities = make([]string, 0)
+			for _, c := range strings.Split(strings.TrimPrefix(t, txtCapabilities), ",") {
+				if c != "" {
+					m.Capabilities = append(m.Capabilities, c)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// txtRecord returns the TXT record of the key and value, the value is cut
+// without splitting a character if the record is longer than maxTXTLen.
+func txtRecord(key, value string) string {
+	r := key + value
+	if len(r) <= maxTXTLen {
+		return r
+	}
+
+	n := maxTXTLen
+	for n > 0 && !utf8.RuneStart(r[n]) {
+		n--
+	}
+	return r[:n]
+}
@@ -0,0 +1,77 @@
+package peer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_Metadata_text(t *testing.T) {
+	t.Run("metadata advertised and parsed", func(t *testing.T) {
+		m := Metadata{
+			Protocol:     1,
+			AppVersion:   "1.2.0",
+			OS:           "linux",
+			DisplayName:  "Office laptop",
+			DeviceID:     "d1",
+			Capabilities: []string{"resume", "tls"},
+		}
+
+		if got := parseMetadata(append([]string{"fp=aaaa"}, m.text()...)); !reflect.DeepEqual(got, m) {
+			t.Errorf("parseMetadata expected = %v but got = %v", m, got)
+		}
+	})
+
+	t.Run("empty fields not advertised", func(t *testing.T) {
+		if text := (Metadata{}).text(); len(text) != 0 {
+			t.Errorf("text expected no records but got = %v", text)
+		}
+	})
+
+	t.Run("no capabilities advertised", func(t *testing.T) {
+		got := parseMetadata(Metadata{Capabilities: []string{}}.text())
+		if got.Capabilities == nil || len(got.Capabilities) != 0 {
+			t.Errorf("parseMetadata expected empty capabilities but got = %v", got.Capabilities)
+		}
+	})
+
+	t.Run("peer without metadata", func(t *testing.T) {
+		if got := parseMetadata([]string{"fp=aaaa"}); !reflect.DeepEqual(got, Metadata{}) {
+			t.Errorf("parseMetadata expected empty metadata but got = %v", got)
+		}
+	})
+
+	t.Run("invalid protocol version", func(t *testing.T) {
+		if got := parseMetadata([]string{"pv=x"}); got.Protocol != 0 {
+			t.Errorf("parseMetadata expected protocol 0 but got = %v", got.Protocol)
+		}
+	})
+
+	t.Run("long display name cut", func(t *testing.T) {
+		text := Metadata{DisplayName: strings.Repeat("ç", 200)}.text()
+		if len(text) != 1 || len(text[0]) > maxTXTLen || !utf8.ValidString(text[0]) {
+			t.Errorf("text expected one valid record up to %d bytes but got = %v", maxTXTLen, text)
+		}
+	})
+}
+
+func Test_Metadata_Supports(t *testing.T) {
+	t.Run("capabilities unknown", func(t *testing.T) {
+		if !(Metadata{}).Supports("batch") {
+			t.Errorf("Supports expected true but got false")
+		}
+	})
+
+	t.Run("capability advertised", func(t *testing.T) {
+		if !(Metadata{Capabilities: []string{"directory", "batch"}}).Supports("batch") {
+			t.Errorf("Supports expected true but got false")
+		}
+	})
+
+	t.Run("capability not advertised", func(t *testing.T) {
+		if (Metadata{Capabilities: []string{"directory"}}).Supports("batch") {
+			t.Errorf("Supports expected false but got true")
+		}
+	})
+}
@@ -1,16 +1,58 @@
 package peer
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net"
+	"strconv"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
 )
 
 // Peer defines a network peer that can send and receive files.
 type Peer struct {
+	ID        string   // ID identifies the peer on the store.
 	Name      string   // Name is the peers name.
-	IPAddress net.IP   // IPAddress is the net.IP address of the peer.
+	IPAddress net.IP   // IPAddress is the net.IP address of the peer, the IPv4 one if it has both.
 	Port      int      // Port is the network port where the peer will receive connections.
-	Address   net.Addr // Address is the resolved TCP Address of the peer IP+Port.
+	Address   net.Addr // Address is the resolved TCP Address of the peer IP+Port, all of them if it has several.
 	Me        bool     // Me identify the peer as the local peer.
+	// Fingerprint is the fingerprint of the peer certificate advertised
+	// on the discovery, empty if the peer doesn't support TLS.
+	Fingerprint string
+	Trust       Trust // Trust is the result of checking the Fingerprint with the pinned one.
+	// Instance is the zeroconf instance name of the peer, a peer that
+	// restarts keeps the same instance.
+	Instance string
+	// Expires is the time the peer goes offline if it's not seen again,
+	// zero if it never expires.
+	Expires time.Time
+	// Offline is true if the peer expired, like when it left the network,
+	// which is only noticed up to the LeaveDelay after it left.
+	Offline bool
+	// Manual is true if the peer was added by its address instead of
+	// being discovered, Target is the host:port it was added with.
+	Manual bool
+	Target string
+	// Metadata is the information advertised by the peer on the discovery,
+	// the peers added manually don't have it.
+	Metadata
+}
+
+// copy returns a copy of the peer, nil if p is nil.
+func (p *Peer) copy() *Peer {
+	if p == nil {
+		return nil
+	}
+
+	cp := new(Peer)
+	*cp = *p
+	// The capabilities are nil if unknown and empty if there are none.
+	if p.Capabilities != nil {
+		cp.Capabilities = append(make([]string, 0, len(p.Capabilities)), p.Capabilities...)
+	}
+	return cp
 }
 
 // newPeer will create a new instance of Peer struct and return it.
@@ -22,3 +64,46 @@ func newPeer(name string, ipAddress net.IP, port int, addr net.Addr) *Peer {
 		Address:   addr,
 	}
 }
+
+// NewManualPeer will create a new instance of a Peer added by the user on
+// the target host:port and return it, the addrs are empty if the target
+// couldn't be resolved.
+func NewManualPeer(name, target string, addrs network.Addrs) *Peer {
+	p := &Peer{
+		Name:   name,
+		Manual: true,
+		Target: target,
+	}
+
+	if len(addrs) > 0 {
+		p.IPAddress = addrs[0].IP
+		p.Port = addrs[0].Port
+		p.Address = addrs
+	}
+	return p
+}
+
+// HasIP returns true if the ip is one of the addresses of the peer.
+func (p *Peer) HasIP(ip net.IP) bool {
+	if p.IPAddress.Equal(ip) {
+		return true
+	}
+
+	if addrs, ok := p.Address.(network.Addrs); ok {
+		for _, a := range addrs {
+			if a.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newID returns a new random ID for a peer.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
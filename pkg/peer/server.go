@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
 	"github.com/fabiodcorreia/catch-my-file/pkg/network"
@@ -16,30 +17,52 @@ const (
 	serviceName = `_catchmyfile._tcp`
 	// Zeroconf service domain we use local network.
 	serviceDomain = `local.`
+	// Zeroconf TXT record key with the peer certificate fingerprint.
+	txtFingerprint = `fp=`
+	// Time each discovery round takes, the peers online answer on every
+	// round.
+	browseInterval = 30 * time.Second
+	// Maximum time a peer stays online without being seen, even if its
+	// records have a longer TTL. It allows to miss one round.
+	peerTTL = 2*browseInterval + 15*time.Second
 )
 
+// LeaveDelay is the longest time a peer discovered that left the network
+// is still shown online. The goodbye it sends when it leaves is not
+// delivered by the resolver, so it's only set offline once it expires.
+const LeaveDelay = peerTTL
+
 // Done is channel used to singal the termination of the service.
 type Done chan<- interface{}
 
 // PeerServer defines the server that registers the peer and discover other peers.
 // It wrappes the logic for zeroconf.
+//
+// If Interfaces is set the peer is only registered and the peers are only
+// discovered on those network interfaces, otherwise on all of them. The
+// Metadata is advertised with the registration.
 type PeerServer struct {
-	name     string
-	port     int
-	store    *PeerStore
-	instance string
+	Interfaces  []net.Interface
+	Metadata    Metadata
+	name        string
+	port        int
+	fingerprint string
+	store       *PeerStore
+	instance    string
 }
 
 // NewServer will create a new peer server instace.
 //
 // The name to be added to the instance name, the port is the port number
-// used for the TCP connections from where the files will be transferred.
-func NewServer(name string, port int, store *PeerStore) *PeerServer {
+// used for the TCP connections from where the files will be transferred and
+// the fingerprint of the local certificate advertised to the other peers.
+func NewServer(name string, port int, fingerprint string, store *PeerStore) *PeerServer {
 	return &PeerServer{
-		name:     name,
-		port:     port,
-		store:    store,
-		instance: "catch-" + name,
+		name:        name,
+		port:        port,
+		fingerprint: fingerprint,
+		store:       store,
+		instance:    "catch-" + name,
 	}
 }
 
@@ -53,57 +76,171 @@ func NewServer(name string, port int, store *PeerStore) *PeerServer {
 // the discovery process.
 func (s *PeerServer) Run(ctx context.Context, done Done) error {
 
-	sv, err := zeroconf.Register(s.instance, serviceName, serviceDomain, s.port, nil, nil)
+	var text []string
+	if s.fingerprint != "" {
+		text = append(text, txtFingerprint+s.fingerprint)
+	}
+	text = append(text, s.Metadata.text()...)
+
+	sv, err := zeroconf.Register(s.instance, serviceName, serviceDomain, s.port, text, s.Interfaces)
 	if err != nil {
 		return fmt.Errorf("peer server run error to register: %v", err)
 	}
+	sv.TTL(uint32(peerTTL.Seconds()))
 
-	resolver, err := zeroconf.NewResolver(zeroconf.SelectIPTraffic(zeroconf.IPv4))
+	err = s.browse(ctx, func() {
+		sv.Shutdown()
+		close(done)
+	})
 	if err != nil {
-		return fmt.Errorf("peer server run error on start listening: %v", err)
+		sv.Shutdown()
 	}
+	return err
+}
 
-	entries := make(chan *zeroconf.ServiceEntry)
+// Discover will start looking for peers on the local network with zeroconf
+// without registering the peer, so it's not seen by the other peers.
+//
+// Each peer that is discovered will be added to the peer store.
+//
+// If there is an error, it can be because the server listener couldn't
+// start or fail to start the discovery process.
+func (s *PeerServer) Discover(ctx context.Context, done Done) error {
+	return s.browse(ctx, func() {
+		close(done)
+	})
+}
 
-	if err = resolver.Browse(ctx, serviceName, serviceDomain, entries); err != nil {
-		close(entries)
-		return fmt.Errorf("peer server run error to discover: %v", err)
+// browse will start the discovery of the peers until the context is
+// cancelled, then onClose is called.
+//
+// The discovery runs in rounds, after each round the peers that were not
+// seen again expire.
+func (s *PeerServer) browse(ctx context.Context, onClose func()) error {
+	entries, stop, err := discover(ctx, s.Interfaces)
+	if err != nil {
+		return err
 	}
 
-	go func(results <-chan *zeroconf.ServiceEntry) {
-		convEntry(results, s.store, s.instance)
-		sv.Shutdown()
-		close(done)
+	nets := network.LocalNets(s.Interfaces)
+
+	go func() {
+		for {
+			convEntry(entries, s.store, s.instance, nets)
+			stop()
+			s.store.Expire(time.Now())
+			if ctx.Err() != nil {
+				break
+			}
+
+			// The discovery is tried again on the next round.
+			if entries, stop, err = discover(ctx, s.Interfaces); err != nil {
+				clog.Error(err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(browseInterval):
+				}
+			}
+		}
+		onClose()
 		clog.Info("Peer server is closed")
-	}(entries)
+	}()
 
 	return nil
 }
 
+// discover will start a discovery round on the interfaces, all if nil, that
+// sends the peers found to the entries channel, the channel is closed when
+// the round ends after the browseInterval or the context is cancelled. The
+// function returned ends the round.
+func discover(ctx context.Context, ifaces []net.Interface) (<-chan *zeroconf.ServiceEntry, func(), error) {
+	resolver, err := newResolver(ifaces)
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("peer server run error on start listening: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, browseInterval)
+	entries := make(chan *zeroconf.ServiceEntry)
+
+	// The entries channel is closed by the resolver once the round ends.
+	if err = resolver.Browse(ctx, serviceName, serviceDomain, entries); err != nil {
+		cancel()
+		return nil, func() {}, fmt.Errorf("peer server run error to discover: %v", err)
+	}
+
+	return entries, cancel, nil
+}
+
+// newResolver will create a resolver on the interfaces, all if nil, that
+// uses IPv4 and IPv6, if one of them is not available on the network only
+// the other is used.
+func newResolver(ifaces []net.Interface) (*zeroconf.Resolver, error) {
+	var err error
+	for _, ipType := range []zeroconf.IPType{zeroconf.IPv4AndIPv6, zeroconf.IPv4, zeroconf.IPv6} {
+		resolver, rErr := zeroconf.NewResolver(zeroconf.SelectIPTraffic(ipType), zeroconf.SelectIfaces(ifaces))
+		if rErr == nil {
+			return resolver, nil
+		}
+		err = rErr
+	}
+	return nil, err
+}
+
 // convEntry will grab each entry received from results channel, convert it
-// into a Peer instance and add it to the store.
-func convEntry(results <-chan *zeroconf.ServiceEntry, store *PeerStore, instance string) {
+// into a Peer instance with the metadata of its TXT records and update it
+// on the store.
+//
+// The address shown of the peer is the first one on the same network of
+// the nets, the local networks.
+//
+// The resolver doesn't deliver the entries without TTL a peer sends when it
+// leaves the network, so a peer that left is only set offline once it
+// expires, up to the LeaveDelay after leaving.
+func convEntry(results <-chan *zeroconf.ServiceEntry, store *PeerStore, instance string, nets []*net.IPNet) {
 	if results != nil {
 		for entry := range results {
 			name := entry.HostName[:strings.Index(entry.HostName, `.`)]
 
-			if len(entry.AddrIPv4) == 0 {
-				clog.Error(fmt.Errorf("peer server conving entry error finding ipv4 for peer:%v", entry))
+			ips := network.PreferLocal(append(append([]net.IP(nil), entry.AddrIPv4...), entry.AddrIPv6...), nets)
+			if len(ips) == 0 {
+				clog.Error(fmt.Errorf("peer server conving entry error finding ip for peer:%v", entry))
 				continue
 			}
 
-			ipAddr := entry.AddrIPv4[0]
-			addr, err := net.ResolveTCPAddr(network.Type, fmt.Sprintf("%v:%d", ipAddr, entry.Port))
-			if err != nil {
-				clog.Error(fmt.Errorf("peer server conving entry error resolving peer address:%v", err))
+			if entry.Port < 1 || entry.Port > 65535 {
+				clog.Error(fmt.Errorf("peer server conving entry error invalid port for peer:%v", entry))
 				continue
 			}
-			p := newPeer(name, ipAddr, entry.Port, addr)
+
+			p := newPeer(name, ips[0], entry.Port, network.NewAddrs(ips, entry.Port))
+			p.Fingerprint = txtValue(entry.Text, txtFingerprint)
+			p.Metadata = parseMetadata(entry.Text)
+			p.Instance = entry.Instance
+			p.Expires = time.Now().Add(entryTTL(entry.TTL))
 			if entry.Instance == instance {
 				p.Me = true
 			}
-			fmt.Println(p)
-			store.Add(p)
+			store.Update(p)
+		}
+	}
+}
+
+// entryTTL returns the time a peer stays online with the TTL of its
+// records in seconds, limited to the peerTTL.
+func entryTTL(ttl uint32) time.Duration {
+	if d := time.Duration(ttl) * time.Second; d < peerTTL {
+		return d
+	}
+	return peerTTL
+}
+
+// txtValue returns the value of the TXT record with the key, empty if the
+// key is not present.
+func txtValue(text []string, key string) string {
+	for _, t := range text {
+		if strings.HasPrefix(t, key) {
+			return strings.TrimPrefix(t, key)
 		}
 	}
+	return ""
 }
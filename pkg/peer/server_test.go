@@ -5,56 +5,117 @@ import (
 	"testing"
 	"time"
 
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
 	"github.com/grandcat/zeroconf"
 )
 
 func Test_convEntry(t *testing.T) {
 	t.Run("entries is nil", func(t *testing.T) {
 
-		convEntry(nil, nil, "catch")
+		convEntry(nil, nil, "catch", nil)
 	})
 
 	t.Run("entries send one peer and it get updated on the store", func(t *testing.T) {
 		entries := make(chan *zeroconf.ServiceEntry)
 		store := NewStore()
 
-		go convEntry(entries, store, "catch")
+		go convEntry(entries, store, "catch", nil)
 
 		entry := zeroconf.NewServiceEntry("instance", "service", "domain")
 		entry.HostName = "peer-1.lan"
 		entry.AddrIPv4 = append(entry.AddrIPv4, net.ParseIP("192.168.1.1"))
 		entry.Port = 8822
+		entry.Text = []string{"fp=aaaa"}
+		entry.TTL = 120
 
 		entries <- entry
 
 		time.Sleep(500 * time.Millisecond)
 		close(entries)
 
-		if store.Get(0).Name != "peer-1" {
-			t.Errorf("convEntry expected name = %v but got %v", "peer-1", store.Get(0).Name)
+		if store.List()[0].Name != "peer-1" {
+			t.Errorf("convEntry expected name = %v but got %v", "peer-1", store.List()[0].Name)
 		}
 
-		if store.Get(0).IPAddress.String() != "192.168.1.1" {
-			t.Errorf("convEntry expected ip address = %v but got %v", "192.168.1.1", store.Get(0).Address.String())
+		if store.List()[0].IPAddress.String() != "192.168.1.1" {
+			t.Errorf("convEntry expected ip address = %v but got %v", "192.168.1.1", store.List()[0].Address.String())
 		}
 
-		if store.Get(0).Port != 8822 {
-			t.Errorf("convEntry expected port = %v but got %v", "192.168.1.1", store.Get(0).Port)
+		if store.List()[0].Port != 8822 {
+			t.Errorf("convEntry expected port = %v but got %v", "192.168.1.1", store.List()[0].Port)
 		}
 
-		if store.Get(0).Address.String() != "192.168.1.1:8822" {
-			t.Errorf("convEntry expected port = %v but got %v", "192.168.1.1:8822", store.Get(0).Port)
+		if store.List()[0].Address.String() != "192.168.1.1:8822" {
+			t.Errorf("convEntry expected port = %v but got %v", "192.168.1.1:8822", store.List()[0].Port)
+		}
+
+		if store.List()[0].Fingerprint != "aaaa" {
+			t.Errorf("convEntry expected fingerprint = %v but got %v", "aaaa", store.List()[0].Fingerprint)
+		}
+	})
+
+	t.Run("entries send one peer with metadata", func(t *testing.T) {
+		entries := make(chan *zeroconf.ServiceEntry)
+		store := NewStore()
+
+		go convEntry(entries, store, "catch", nil)
+
+		entry := zeroconf.NewServiceEntry("instance", "service", "domain")
+		entry.HostName = "peer-1.lan"
+		entry.AddrIPv4 = append(entry.AddrIPv4, net.ParseIP("192.168.1.1"))
+		entry.Port = 8822
+		entry.Text = []string{"fp=aaaa", "pv=1", "av=1.2.0", "os=linux", "dn=Office", "id=d1", "caps=directory,batch"}
+		entry.TTL = 120
+
+		entries <- entry
+
+		time.Sleep(500 * time.Millisecond)
+		close(entries)
+
+		p := store.List()[0]
+		if p.Protocol != 1 || p.AppVersion != "1.2.0" || p.OS != "linux" || p.DisplayName != "Office" || p.DeviceID != "d1" {
+			t.Errorf("convEntry expected the peer metadata but got %v", p.Metadata)
+		}
+
+		if p.Supports("tls") || !p.Supports("batch") {
+			t.Errorf("convEntry expected capabilities = %v but got %v", "directory,batch", p.Capabilities)
+		}
+	})
+
+	t.Run("entries send a peer with a different fingerprint", func(t *testing.T) {
+		entries := make(chan *zeroconf.ServiceEntry)
+		store := NewStore()
+		store.Known, _ = LoadKnownPeers("")
+		store.Known.Check("peer-1", "aaaa")
+
+		go convEntry(entries, store, "catch", nil)
+
+		entry := zeroconf.NewServiceEntry("instance", "service", "domain")
+		entry.HostName = "peer-1.lan"
+		entry.AddrIPv4 = append(entry.AddrIPv4, net.ParseIP("192.168.1.1"))
+		entry.Port = 8822
+		entry.Text = []string{"fp=bbbb"}
+		entry.TTL = 120
+
+		entries <- entry
+
+		time.Sleep(500 * time.Millisecond)
+		close(entries)
+
+		if store.List()[0].Trust != Mismatch {
+			t.Errorf("convEntry expected trust = %v but got %v", Mismatch, store.List()[0].Trust)
 		}
 	})
 
-	t.Run("entries send one peer with no IPv4", func(t *testing.T) {
+	t.Run("entries send one peer with no address", func(t *testing.T) {
 		entries := make(chan *zeroconf.ServiceEntry)
 		store := NewStore()
 
-		go convEntry(entries, store, "catch")
+		go convEntry(entries, store, "catch", nil)
 
 		entry := zeroconf.NewServiceEntry("instance", "service", "domain")
 		entry.HostName = "peer-1.lan"
+		entry.TTL = 120
 
 		entries <- entry
 
@@ -66,16 +127,94 @@ func Test_convEntry(t *testing.T) {
 		}
 	})
 
+	t.Run("entries send one peer with IPv4 and IPv6", func(t *testing.T) {
+		entries := make(chan *zeroconf.ServiceEntry)
+		store := NewStore()
+
+		go convEntry(entries, store, "catch", nil)
+
+		entry := zeroconf.NewServiceEntry("instance", "service", "domain")
+		entry.HostName = "peer-1.lan"
+		entry.AddrIPv6 = append(entry.AddrIPv6, net.ParseIP("2001:db8::1"))
+		entry.AddrIPv4 = append(entry.AddrIPv4, net.ParseIP("192.168.1.1"))
+		entry.Port = 8822
+		entry.TTL = 120
+
+		entries <- entry
+
+		time.Sleep(500 * time.Millisecond)
+		close(entries)
+
+		p := store.FindByIP(net.ParseIP("2001:db8::1"))
+		if p == nil {
+			t.Fatalf("convEntry expected peer with the IPv6 address but got %v", store.List())
+		}
+
+		if !p.IPAddress.Equal(net.ParseIP("192.168.1.1")) {
+			t.Errorf("convEntry expected IPv4 address = %v but got %v", "192.168.1.1", p.IPAddress)
+		}
+
+		if addrs, ok := p.Address.(network.Addrs); !ok || len(addrs) != 2 {
+			t.Errorf("convEntry expected 2 addresses but got %v", p.Address)
+		}
+	})
+
+	t.Run("entries send one peer with the address on the local network", func(t *testing.T) {
+		entries := make(chan *zeroconf.ServiceEntry)
+		store := NewStore()
+		_, local, _ := net.ParseCIDR("10.0.0.1/8")
+
+		go convEntry(entries, store, "catch", []*net.IPNet{local})
+
+		entry := zeroconf.NewServiceEntry("instance", "service", "domain")
+		entry.HostName = "peer-1.lan"
+		entry.AddrIPv4 = append(entry.AddrIPv4, net.ParseIP("172.17.0.1"), net.ParseIP("10.0.0.5"))
+		entry.Port = 8822
+		entry.TTL = 120
+
+		entries <- entry
+
+		time.Sleep(500 * time.Millisecond)
+		close(entries)
+
+		if store.Size() != 1 || !store.List()[0].IPAddress.Equal(net.ParseIP("10.0.0.5")) {
+			t.Errorf("convEntry expected peer on %v but got %v", "10.0.0.5", store.List())
+		}
+	})
+
+	t.Run("entries send one peer with IPv6 only", func(t *testing.T) {
+		entries := make(chan *zeroconf.ServiceEntry)
+		store := NewStore()
+
+		go convEntry(entries, store, "catch", nil)
+
+		entry := zeroconf.NewServiceEntry("instance", "service", "domain")
+		entry.HostName = "peer-1.lan"
+		entry.AddrIPv6 = append(entry.AddrIPv6, net.ParseIP("2001:db8::1"))
+		entry.Port = 8822
+		entry.TTL = 120
+
+		entries <- entry
+
+		time.Sleep(500 * time.Millisecond)
+		close(entries)
+
+		if store.Size() != 1 || !store.List()[0].IPAddress.Equal(net.ParseIP("2001:db8::1")) {
+			t.Errorf("convEntry expected peer on %v but got %v", "2001:db8::1", store.List())
+		}
+	})
+
 	t.Run("entries send one peer with invalid port", func(t *testing.T) {
 		entries := make(chan *zeroconf.ServiceEntry)
 		store := NewStore()
 
-		go convEntry(entries, store, "catch")
+		go convEntry(entries, store, "catch", nil)
 
 		entry := zeroconf.NewServiceEntry("instance", "service", "domain")
 		entry.HostName = "peer-1.lan"
 		entry.AddrIPv4 = append(entry.AddrIPv4, net.ParseIP("192.168.1.1"))
 		entry.Port = -1
+		entry.TTL = 120
 
 		entries <- entry
 
@@ -87,4 +226,41 @@ func Test_convEntry(t *testing.T) {
 		}
 	})
 
+	t.Run("entries update the peer of the same instance", func(t *testing.T) {
+		entries := make(chan *zeroconf.ServiceEntry)
+		store := NewStore()
+
+		go convEntry(entries, store, "catch", nil)
+
+		for _, ip := range []string{"192.168.1.1", "192.168.1.2"} {
+			entry := zeroconf.NewServiceEntry("catch-peer-1", "service", "domain")
+			entry.HostName = "peer-1.lan"
+			entry.AddrIPv4 = append(entry.AddrIPv4, net.ParseIP(ip))
+			entry.Port = 8822
+			entry.TTL = 120
+			entries <- entry
+		}
+
+		time.Sleep(500 * time.Millisecond)
+		close(entries)
+
+		if store.Size() != 1 || store.List()[0].IPAddress.String() != "192.168.1.2" {
+			t.Errorf("convEntry expected one peer on 192.168.1.2 but got %v", store.List())
+		}
+
+		if exp := time.Until(store.List()[0].Expires); exp <= 0 || exp > peerTTL {
+			t.Errorf("convEntry expected peer expiring in %v but got %v", peerTTL, exp)
+		}
+	})
+
+}
+
+func Test_entryTTL(t *testing.T) {
+	if ttl := entryTTL(10); ttl != 10*time.Second {
+		t.Errorf("entryTTL expected = %v but got %v", 10*time.Second, ttl)
+	}
+
+	if ttl := entryTTL(3200); ttl != peerTTL {
+		t.Errorf("entryTTL expected = %v but got %v", peerTTL, ttl)
+	}
 }
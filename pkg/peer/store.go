@@ -1,82 +1,432 @@
 package peer
 
 import (
+	"fmt"
+	"net"
 	"sync"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
 )
 
 // OnPeerStoreChange is a function that is executed everytime a
-// peer is added to the store.
-type OnPeerStoreChange func(i int)
+// peer is added, removed or updated on the store.
+type OnPeerStoreChange func(id string)
+
+// DefaultOfflineTimeout is the time an offline peer is kept on the store
+// before it gets removed.
+const DefaultOfflineTimeout = 5 * time.Minute
 
 // PeerStore is a thread-safe store that allows to store and retrieve
 // peers and also get notification when the content of the store changes.
+//
+// The peers are identified by their ID and kept in the order they were
+// added. If Known is set the fingerprint of each peer added is checked
+// against the pinned fingerprints to set the peer Trust.
+//
+// The peers discovered are updated by their zeroconf instance, they go
+// offline when they expire, like up to the LeaveDelay after they leave the
+// network, and are removed after being offline for the OfflineTimeout.
+//
+// The peers added manually are updated by their target and if Manual is set
+// they are stored to be added again on the next executions.
+//
+// The peers returned are copies of the stored peers and the peers added are
+// copied before being stored, so the changes to the stored peers are only
+// done by the store and don't affect the peers already returned.
 type PeerStore struct {
 	OnPeerStoreChange
-	mu   sync.Mutex
-	data []*Peer
+	Known          *KnownPeers
+	Manual         *ManualPeers
+	OfflineTimeout time.Duration
+	mu             sync.Mutex
+	data           []*Peer
+	index          map[string]*Peer
 }
 
 // NewStore create a new instance of PeerStore.
 func NewStore() *PeerStore {
 	return &PeerStore{
-		data: make([]*Peer, 0, 3),
+		OfflineTimeout: DefaultOfflineTimeout,
+		data:           make([]*Peer, 0, 3),
+		index:          make(map[string]*Peer),
 	}
 }
 
-// Get return a peer from the specified index.
+// Get return a copy of the peer with the id.
 //
-// If the index doesn't exists returns nil.
-func (s *PeerStore) Get(i int) *Peer {
+// If there is no peer with that id returns nil.
+func (s *PeerStore) Get(id string) *Peer {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.index[id].copy()
+}
 
-	if i >= len(s.data) {
-		return nil
+// List returns a copy of all the peers in the order they were added.
+func (s *PeerStore) List() []*Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Peer, 0, len(s.data))
+	for _, p := range s.data {
+		list = append(list, p.copy())
 	}
-
-	return s.data[i]
+	return list
 }
 
+// GetMe returns a copy of the local peer, if it's not registered yet
+// returns nil.
 func (s *PeerStore) GetMe() *Peer {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for _, p := range s.data {
 		if p.Me {
-			return p
+			return p.copy()
+		}
+	}
+	return nil
+}
+
+// FindByIP returns a copy of the peer with the IP address on any of its
+// addresses, if there is no peer with that address returns nil.
+func (s *PeerStore) FindByIP(ip net.IP) *Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.data {
+		if p.HasIP(ip) {
+			return p.copy()
 		}
 	}
 	return nil
 }
 
+// FindByName returns a copy of the first peer with the name that is not the
+// local peer, if there is no peer with that name returns the first one with
+// that display name or nil.
+func (s *PeerStore) FindByName(name string) *Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found *Peer
+	for _, p := range s.data {
+		if p.Me {
+			continue
+		}
+		if p.Name == name {
+			return p.copy()
+		}
+		if found == nil && p.DisplayName == name {
+			found = p
+		}
+	}
+	return found.copy()
+}
+
 // Add will append a peer to the existing list of peers.
 //
-// It returns the index where the peer whas stored.
+// It returns the id of the peer, a new id is given to the peer if it
+// doesn't have one or there is already a peer with the same id.
 //
 // After the peer gets added the function OnPeerStoreChanged is executed.
-func (s *PeerStore) Add(p *Peer) int {
-	i := s.add(p)
+func (s *PeerStore) Add(p *Peer) string {
+	s.checkTrust(p)
+	id := s.add(p)
 
 	if s.OnPeerStoreChange != nil {
-		s.OnPeerStoreChange(i)
+		s.OnPeerStoreChange(id)
 	}
 
-	return i
+	return id
 }
 
-// Size returns the length of the store.
+// FindByInstance returns a copy of the peer with the zeroconf instance, if
+// there is no peer with that instance returns nil.
+func (s *PeerStore) FindByInstance(instance string) *Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findByInstance(instance).copy()
+}
+
+// Update will update the peer with the same zeroconf instance of p, or the
+// offline peer with the same device ID if the instance changed, with its
+// address, fingerprint, metadata and expiration and set it online. If there
+// is no such peer p is added.
+//
+// It returns the id of the peer updated or added.
+//
+// After the peer gets updated the function OnPeerStoreChanged is executed.
+func (s *PeerStore) Update(p *Peer) string {
+	s.checkTrust(p)
+
+	s.mu.Lock()
+	stored := s.findByInstance(p.Instance)
+	if stored == nil && p.DeviceID != "" {
+		stored = s.findByDevice(p.DeviceID)
+	}
+	var id string
+	if stored == nil {
+		id = s.insert(p)
+	} else {
+		stored.Name = p.Name
+		stored.IPAddress = p.IPAddress
+		stored.Port = p.Port
+		stored.Address = p.Address
+		stored.Me = p.Me
+		stored.Fingerprint = p.Fingerprint
+		stored.Trust = p.Trust
+		stored.Metadata = p.Metadata
+		stored.Instance = p.Instance
+		stored.Expires = p.Expires
+		stored.Offline = false
+		id = stored.ID
+	}
+	s.mu.Unlock()
+
+	if s.OnPeerStoreChange != nil {
+		s.OnPeerStoreChange(id)
+	}
+	return id
+}
+
+// Expire will set offline the peers that expired before now and remove the
+// ones that are offline for longer than the OfflineTimeout.
+//
+// After each peer gets updated or removed the function OnPeerStoreChanged
+// is executed.
+func (s *PeerStore) Expire(now time.Time) {
+	s.mu.Lock()
+	changed := make([]string, 0)
+	data := s.data[:0]
+	for _, p := range s.data {
+		switch {
+		case p.Expires.IsZero() || now.Before(p.Expires):
+		case p.Offline && !now.Before(p.Expires.Add(s.OfflineTimeout)):
+			delete(s.index, p.ID)
+			changed = append(changed, p.ID)
+			continue
+		case !p.Offline:
+			p.Offline = true
+			changed = append(changed, p.ID)
+		}
+		data = append(data, p)
+	}
+	for j := len(data); j < len(s.data); j++ {
+		s.data[j] = nil
+	}
+	s.data = data
+	s.mu.Unlock()
+
+	if s.OnPeerStoreChange != nil {
+		for _, id := range changed {
+			s.OnPeerStoreChange(id)
+		}
+	}
+}
+
+// AddManual will update the manual peer with the same target of p with its
+// address and fingerprint, if there is no peer with that target p is added.
+// An offline p only sets the stored peer as offline.
+//
+// The peer is also added to the Manual peers, if they are set, to be added
+// again on the next executions.
+//
+// It returns the id of the peer updated or added.
+//
+// After the peer gets updated the function OnPeerStoreChanged is executed.
+//
+// If there is an error, it's because the manual peers couldn't be stored,
+// the peer is updated anyway.
+func (s *PeerStore) AddManual(p *Peer) (string, error) {
+	p.Manual = true
+	if !p.Offline {
+		s.checkTrust(p)
+	}
+
+	s.mu.Lock()
+	stored := s.findByTarget(p.Target)
+	var id string
+	switch {
+	case stored == nil:
+		id = s.insert(p)
+	case p.Offline:
+		stored.Offline = true
+		id = stored.ID
+	default:
+		stored.Name = p.Name
+		stored.IPAddress = p.IPAddress
+		stored.Port = p.Port
+		stored.Address = p.Address
+		stored.Fingerprint = p.Fingerprint
+		stored.Trust = p.Trust
+		stored.Offline = false
+		id = stored.ID
+	}
+	name := s.index[id].Name
+	s.mu.Unlock()
+
+	if s.OnPeerStoreChange != nil {
+		s.OnPeerStoreChange(id)
+	}
+
+	if s.Manual == nil {
+		return id, nil
+	}
+	return id, s.Manual.Add(ManualPeer{Name: name, Address: p.Target})
+}
+
+// Remove will remove the peer with the id from the store, a manual peer is
+// also removed from the Manual peers so it's not added again.
+//
+// After the peer gets removed the function OnPeerStoreChanged is executed.
+//
+// If there is an error, it's because there is no peer with the id or the
+// manual peers couldn't be stored.
+func (s *PeerStore) Remove(id string) error {
+	s.mu.Lock()
+	p, ok := s.index[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("peer store remove error: peer %s not found", id)
+	}
+
+	delete(s.index, id)
+	for j := range s.data {
+		if s.data[j] == p {
+			s.data = append(s.data[:j], s.data[j+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if s.OnPeerStoreChange != nil {
+		s.OnPeerStoreChange(id)
+	}
+
+	if !p.Manual || s.Manual == nil {
+		return nil
+	}
+	return s.Manual.Remove(p.Target)
+}
+
+// checkTrust will set the peer Trust based on the fingerprint pinned for
+// the peer, the local peer is always trusted.
+func (s *PeerStore) checkTrust(p *Peer) {
+	if p.Me {
+		p.Trust = Trusted
+		return
+	}
+
+	if s.Known == nil {
+		return
+	}
+
+	trust, err := s.Known.Check(p.Name, p.Fingerprint)
+	if err != nil {
+		clog.Error(err)
+	}
+
+	if trust == Mismatch {
+		clog.Info("peer %s fingerprint doesn't match the pinned fingerprint, possible impersonation", p.Name)
+	}
+	p.Trust = trust
+}
+
+// SetPaired will pin the fingerprint confirmed by pairing with the peer
+// name and update the Trust of the peers with that name.
+//
+// After each peer gets updated the function OnPeerStoreChanged is executed.
+//
+// If there is an error, it can be because the known peers are not set or
+// the pairing couldn't be stored.
+func (s *PeerStore) SetPaired(name, fingerprint string) error {
+	if s.Known == nil {
+		return fmt.Errorf("peer store set paired error: known peers not set")
+	}
+
+	err := s.Known.Pair(name, fingerprint)
+
+	s.mu.Lock()
+	changed := make([]string, 0, 1)
+	for _, p := range s.data {
+		if p.Me || p.Name != name {
+			continue
+		}
+		p.Trust = Paired
+		if p.Fingerprint != fingerprint {
+			p.Trust = Mismatch
+		}
+		changed = append(changed, p.ID)
+	}
+	s.mu.Unlock()
 
+	if s.OnPeerStoreChange != nil {
+		for _, id := range changed {
+			s.OnPeerStoreChange(id)
+		}
+	}
+	return err
+}
+
+// Size returns the length of the store.
 func (s *PeerStore) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return len(s.data)
 }
 
+// findByInstance returns the peer with the zeroconf instance, the lock
+// must be held.
+func (s *PeerStore) findByInstance(instance string) *Peer {
+	if instance == "" {
+		return nil
+	}
+
+	for _, p := range s.data {
+		if p.Instance == instance {
+			return p
+		}
+	}
+	return nil
+}
+
+// findByDevice returns the offline peer discovered with the device ID, like
+// a peer that restarted with another hostname, the lock must be held.
+func (s *PeerStore) findByDevice(deviceID string) *Peer {
+	for _, p := range s.data {
+		if p.Offline && !p.Manual && p.DeviceID == deviceID {
+			return p
+		}
+	}
+	return nil
+}
+
+// findByTarget returns the manual peer added with the target, the lock
+// must be held.
+func (s *PeerStore) findByTarget(target string) *Peer {
+	for _, p := range s.data {
+		if p.Manual && p.Target == target {
+			return p
+		}
+	}
+	return nil
+}
+
 // add will append a peer to the store using a mutext safe guard.
 //
-// Returns the index where the peer was stored.
-func (s *PeerStore) add(p *Peer) int {
+// Returns the id of the peer stored.
+func (s *PeerStore) add(p *Peer) string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.insert(p)
+}
 
-	s.data = append(s.data, p)
-	return len(s.data) - 1
-
+// insert will append a copy of the peer to the store, the lock must be held.
+//
+// Returns the id of the peer stored.
+func (s *PeerStore) insert(p *Peer) string {
+	if _, ok := s.index[p.ID]; ok || p.ID == "" {
+		p.ID = newID()
+	}
+	stored := p.copy()
+	s.data = append(s.data, stored)
+	s.index[p.ID] = stored
+	return p.ID
 }
@@ -0,0 +1,266 @@
+package peer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+)
+
+func Test_PeerStore_FindByName(t *testing.T) {
+	store := NewStore()
+	store.Add(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.1"), Me: true})
+	store.Add(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.2")})
+	store.Add(&Peer{Name: "peer-3", IPAddress: net.ParseIP("192.168.1.3"), Metadata: Metadata{DisplayName: "peer-1"}})
+	store.Add(&Peer{Name: "peer-4", IPAddress: net.ParseIP("192.168.1.4"), Metadata: Metadata{DisplayName: "Office"}})
+
+	t.Run("peer found", func(t *testing.T) {
+		p := store.FindByName("peer-1")
+		if p == nil {
+			t.Fatalf("FindByName expected peer but got = %v", p)
+		}
+
+		if p.Me {
+			t.Errorf("FindByName expected the local peer to be ignored but got = %v", p.IPAddress)
+		}
+	})
+
+	t.Run("peer found by the display name", func(t *testing.T) {
+		if p := store.FindByName("Office"); p == nil || p.Name != "peer-4" {
+			t.Errorf("FindByName expected peer-4 but got = %v", p)
+		}
+	})
+
+	t.Run("peer not found", func(t *testing.T) {
+		if p := store.FindByName("peer-2"); p != nil {
+			t.Errorf("FindByName expected nil but got = %v", p)
+		}
+	})
+}
+
+func Test_PeerStore_Add(t *testing.T) {
+	store := NewStore()
+
+	t.Run("id assigned", func(t *testing.T) {
+		id := store.Add(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.1")})
+		if id == "" || store.Get(id) == nil || store.Get(id).Name != "peer-1" {
+			t.Errorf("Add expected peer-1 stored with an id but got = %q", id)
+		}
+	})
+
+	t.Run("duplicated id replaced", func(t *testing.T) {
+		first := store.List()[0].ID
+		id := store.Add(&Peer{ID: first, Name: "peer-2", IPAddress: net.ParseIP("192.168.1.2")})
+
+		if id == first || store.Get(first).Name != "peer-1" || store.Get(id).Name != "peer-2" {
+			t.Errorf("Add expected a new id for peer-2 but got = %q", id)
+		}
+	})
+
+	t.Run("list on insertion order", func(t *testing.T) {
+		list := store.List()
+		if len(list) != 2 || list[0].Name != "peer-1" || list[1].Name != "peer-2" {
+			t.Errorf("List expected peer-1 and peer-2 but got = %v", list)
+		}
+	})
+}
+
+func Test_PeerStore_Remove(t *testing.T) {
+	store := NewStore()
+	id := store.Add(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.1")})
+
+	var changed string
+	store.OnPeerStoreChange = func(id string) {
+		changed = id
+	}
+
+	t.Run("peer removed", func(t *testing.T) {
+		if err := store.Remove(id); err != nil {
+			t.Fatalf("Remove not expected error = %v", err)
+		}
+
+		if store.Get(id) != nil || store.Size() != 0 || changed != id {
+			t.Errorf("Remove expected the peer %s removed but got = %v", id, store.List())
+		}
+	})
+
+	t.Run("peer not found", func(t *testing.T) {
+		if err := store.Remove(id); err == nil {
+			t.Errorf("Remove expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_PeerStore_Update(t *testing.T) {
+	store := NewStore()
+
+	t.Run("peer added", func(t *testing.T) {
+		id := store.Update(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.1"), Instance: "catch-peer-1"})
+		if id == "" || store.FindByInstance("catch-peer-1") == nil {
+			t.Errorf("Update expected peer-1 added but got = %v", store.List())
+		}
+	})
+
+	t.Run("peer of the same instance updated", func(t *testing.T) {
+		first := store.FindByInstance("catch-peer-1").ID
+		store.Update(&Peer{Name: "peer-1", Instance: "catch-peer-1", Expires: time.Now().Add(-time.Second)})
+		store.Expire(time.Now())
+
+		var changed string
+		store.OnPeerStoreChange = func(id string) {
+			changed = id
+		}
+		defer func() { store.OnPeerStoreChange = nil }()
+
+		id := store.Update(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.5"), Instance: "catch-peer-1"})
+
+		p := store.Get(first)
+		if id != first || store.Size() != 1 || changed != first {
+			t.Fatalf("Update expected peer %s updated but got = %v", first, store.List())
+		}
+
+		if !p.IPAddress.Equal(net.ParseIP("192.168.1.5")) || p.Offline {
+			t.Errorf("Update expected peer online on 192.168.1.5 but got = %v", p)
+		}
+	})
+
+	t.Run("peer returned not changed by the update", func(t *testing.T) {
+		p := store.FindByInstance("catch-peer-1")
+		store.Update(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.6"), Instance: "catch-peer-1"})
+
+		if !p.IPAddress.Equal(net.ParseIP("192.168.1.5")) {
+			t.Errorf("Update expected the peer returned on 192.168.1.5 but got = %v", p.IPAddress)
+		}
+
+		if got := store.Get(p.ID); !got.IPAddress.Equal(net.ParseIP("192.168.1.6")) {
+			t.Errorf("Update expected peer on 192.168.1.6 but got = %v", got.IPAddress)
+		}
+	})
+
+	t.Run("peers without instance added", func(t *testing.T) {
+		store.Update(&Peer{Name: "peer-2"})
+		store.Update(&Peer{Name: "peer-2"})
+
+		if store.Size() != 3 {
+			t.Errorf("Update expected 3 peers but got = %v", store.List())
+		}
+	})
+
+	t.Run("offline peer of the same device updated", func(t *testing.T) {
+		first := store.Update(&Peer{Name: "peer-5", Instance: "catch-peer-5", Metadata: Metadata{DeviceID: "d5"}, Expires: time.Now().Add(-time.Second)})
+		store.Expire(time.Now())
+
+		id := store.Update(&Peer{Name: "peer-6", Instance: "catch-peer-6", Metadata: Metadata{DeviceID: "d5"}})
+
+		p := store.Get(first)
+		if id != first || store.Size() != 4 {
+			t.Fatalf("Update expected peer %s updated but got = %v", first, store.List())
+		}
+
+		if p.Name != "peer-6" || p.Instance != "catch-peer-6" || p.Offline {
+			t.Errorf("Update expected peer-6 online but got = %v", p)
+		}
+	})
+
+	t.Run("online peer of the same device not updated", func(t *testing.T) {
+		store.Update(&Peer{Name: "peer-7", Instance: "catch-peer-7", Metadata: Metadata{DeviceID: "d5"}})
+
+		if store.Size() != 5 {
+			t.Errorf("Update expected 5 peers but got = %v", store.List())
+		}
+	})
+}
+
+func Test_PeerStore_AddManual(t *testing.T) {
+	store := NewStore()
+	store.Manual, _ = LoadManualPeers("")
+	addr := network.Addrs{{IP: net.ParseIP("10.0.0.1"), Port: 8822}}
+
+	t.Run("peer added and stored", func(t *testing.T) {
+		id, err := store.AddManual(NewManualPeer("peer-1", "host-1:8822", addr))
+		if err != nil {
+			t.Fatalf("AddManual not expected error = %v", err)
+		}
+
+		if p := store.Get(id); p == nil || !p.Manual || p.Port != 8822 {
+			t.Errorf("AddManual expected manual peer-1 on port 8822 but got = %v", p)
+		}
+
+		if list := store.Manual.List(); len(list) != 1 || list[0].Address != "host-1:8822" {
+			t.Errorf("AddManual expected host-1:8822 stored but got = %v", list)
+		}
+	})
+
+	t.Run("offline peer keeps the address", func(t *testing.T) {
+		p := NewManualPeer("peer-1", "host-1:8822", nil)
+		p.Offline = true
+		id, _ := store.AddManual(p)
+
+		if p = store.Get(id); store.Size() != 1 || !p.Offline || !p.IPAddress.Equal(addr[0].IP) {
+			t.Errorf("AddManual expected peer-1 offline on %v but got = %v", addr[0].IP, p)
+		}
+	})
+
+	t.Run("peer of the same target updated", func(t *testing.T) {
+		id, _ := store.AddManual(NewManualPeer("peer-2", "host-1:8822", addr))
+
+		if p := store.Get(id); store.Size() != 1 || p.Offline || p.Name != "peer-2" {
+			t.Errorf("AddManual expected peer-2 online but got = %v", p)
+		}
+
+		if list := store.Manual.List(); len(list) != 1 || list[0].Name != "peer-2" {
+			t.Errorf("AddManual expected peer-2 stored but got = %v", list)
+		}
+	})
+
+	t.Run("removed peer not stored", func(t *testing.T) {
+		if err := store.Remove(store.List()[0].ID); err != nil {
+			t.Fatalf("Remove not expected error = %v", err)
+		}
+
+		if list := store.Manual.List(); len(list) != 0 {
+			t.Errorf("Remove expected no peers stored but got = %v", list)
+		}
+	})
+}
+
+func Test_PeerStore_Expire(t *testing.T) {
+	now := time.Now()
+
+	store := NewStore()
+	store.Add(&Peer{Name: "manual"})
+	store.Update(&Peer{Name: "online", Instance: "online", Expires: now.Add(time.Minute)})
+	store.Update(&Peer{Name: "expired", Instance: "expired", Expires: now.Add(-time.Second)})
+	store.Update(&Peer{Name: "gone", Instance: "gone", Expires: now.Add(-time.Hour), Offline: true})
+
+	store.Expire(now)
+
+	t.Run("expired peer offline", func(t *testing.T) {
+		if p := store.FindByInstance("expired"); p == nil || !p.Offline {
+			t.Errorf("Expire expected peer offline but got = %v", p)
+		}
+
+		if p := store.FindByInstance("online"); p == nil || p.Offline {
+			t.Errorf("Expire expected peer online but got = %v", p)
+		}
+	})
+
+	t.Run("peer offline for too long removed", func(t *testing.T) {
+		if p := store.FindByInstance("gone"); p != nil {
+			t.Errorf("Expire expected peer removed but got = %v", p)
+		}
+
+		if store.Size() != 3 || store.FindByName("manual") == nil {
+			t.Errorf("Expire expected 3 peers but got = %v", store.List())
+		}
+	})
+
+	t.Run("expired peer removed after the timeout", func(t *testing.T) {
+		store.Expire(now.Add(store.OfflineTimeout))
+
+		if p := store.FindByInstance("expired"); p != nil {
+			t.Errorf("Expire expected peer removed but got = %v", p)
+		}
+	})
+}
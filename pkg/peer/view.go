@@ -2,8 +2,12 @@ package peer
 
 import (
 	"context"
+	"fmt"
 	"image/color"
 	"net"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -13,20 +17,56 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
 	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+	"github.com/fabiodcorreia/catch-my-file/pkg/pake"
 )
 
 // TransferRequest represents the callback that is executed when a new
 // transfer is added to the queue to be transferred or waiting for confirmation.
 type TransferRequest func(filePath, fileName, checksum, peerNames string, size int64, addr net.Addr)
 
+// DirectoryRequest represents the callback that is executed when a new
+// directory transfer is added to the queue to be transferred.
+type DirectoryRequest func(dirPath, dirName, peerName string, files []file.Entry, addr net.Addr)
+
+// BatchRequest represents the callback that is executed when a new batch
+// transfer is added to the queue to be transferred, filePaths are the local
+// paths of each one of the files.
+type BatchRequest func(filePaths []string, files []file.Entry, peerName string, addr net.Addr)
+
+// PairRequest represents the callback that is executed when the user wants
+// to pair with a peer, the code is shown to the user to be typed on the
+// peer. It blocks until the pairing ends or the context is cancelled.
+type PairRequest func(ctx context.Context, code, peerName string, addr net.Addr) error
+
+// LimitRequest represents the callback that is executed when the user wants
+// to change the bandwidth limit of a peer.
+type LimitRequest func(peerName string)
+
+// LimitLabel represents the callback that returns the description of the
+// bandwidth limit of a peer, empty if the peer is not limited.
+type LimitLabel func(peerName string) string
+
+// AddPeerRequest represents the callback that is executed when the user
+// adds a peer by its host:port, it blocks until the peer answers or the
+// context is cancelled.
+type AddPeerRequest func(ctx context.Context, target string) error
+
 // PeerList is an extended version of widget.List where is uses a store
 // to hold the list items, has a callback to the ouside and has is own
 // layout.
 type PeerList struct {
 	widget.List
 	TransferRequest
+	DirectoryRequest
+	BatchRequest
+	PairRequest
+	LimitRequest
+	LimitLabel
+	AddPeerRequest
 	store  *PeerStore
 	Parent fyne.Window
+	mu     sync.Mutex
+	rows   map[*fyne.Container]string // Peer id shown on each row.
 }
 
 // NewView creates a new PeerList which is just an extended version
@@ -37,9 +77,10 @@ func NewView(store *PeerStore) *PeerList {
 	pl := &PeerList{
 		store:  store,
 		Parent: fyne.CurrentApp().Driver().AllWindows()[0],
+		rows:   make(map[*fyne.Container]string),
 	}
 
-	pl.store.OnPeerStoreChange = func(i int) {
+	pl.store.OnPeerStoreChange = func(id string) {
 		pl.Refresh()
 	}
 
@@ -58,23 +99,66 @@ func (pl *PeerList) createItem() fyne.CanvasObject {
 		&peerLayout{},
 		widget.NewLabel(""), //Name
 		widget.NewLabel(""), //Ip Address
-		widget.NewButtonWithIcon("", theme.MailSendIcon(), func() {}), //Send File
+		widget.NewButtonWithIcon("", theme.FolderIcon(), func() {}),         //Send Directory
+		widget.NewButtonWithIcon("", theme.MailAttachmentIcon(), func() {}), //Send Batch
+		widget.NewButtonWithIcon("", theme.MailSendIcon(), func() {}),       //Send File
+		widget.NewButtonWithIcon("", theme.ConfirmIcon(), func() {}),        //Pair
+		widget.NewButtonWithIcon("", theme.SettingsIcon(), func() {}),       //Bandwidth limit
+		widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {}),         //Remove manual peer
 	)
 }
 
 // updateItem will be executed for each row of the list when it needs
-// to be updated.
+// to be updated, the rows are reused by other peers when a peer is removed.
 func (pl *PeerList) updateItem(i widget.ListItemID, item fyne.CanvasObject) {
-	p := pl.store.Get(i)
+	p := pl.peerAt(i)
+	if p == nil {
+		return
+	}
+
+	row := item.(*fyne.Container)
+	wName := row.Objects[0].(*widget.Label)
+	wAddress := row.Objects[1].(*widget.Label)
+	wSendDir := row.Objects[2].(*widget.Button)
+	wSendBatch := row.Objects[3].(*widget.Button)
+	wSend := row.Objects[4].(*widget.Button)
+	wPair := row.Objects[5].(*widget.Button)
+	wLimit := row.Objects[6].(*widget.Button)
+	wRemove := row.Objects[7].(*widget.Button)
 
-	wName := item.(*fyne.Container).Objects[0].(*widget.Label)
-	wAddress := item.(*fyne.Container).Objects[1].(*widget.Label)
-	wSend := item.(*fyne.Container).Objects[2].(*widget.Button)
+	// The trust changes after pairing, the limit when the user changes it
+	// and the address and state when the peer is seen again.
+	wName.SetText(pl.displayName(p))
+	if address := displayAddress(p); wAddress.Text != address {
+		wAddress.SetText(address)
+	}
+
+	// An offline peer can't receive files until it's seen again, neither
+	// directories or batches if it advertised it doesn't support them.
+	setEnabled(wSendDir, !p.Offline && p.Supports(capDirectory))
+	setEnabled(wSendBatch, !p.Offline && p.Supports(capBatch))
+	setEnabled(wSend, !p.Offline)
+	setEnabled(wPair, !p.Offline)
 
-	if wName.Text == "" { // The peer information doesn't change
-		wName.SetText(p.Name)
-		wAddress.SetText(p.IPAddress.String())
+	if p.Me || p.Fingerprint == "" {
+		wPair.Hide()
+	} else {
+		wPair.Show()
+	}
 
+	if p.Me || pl.LimitRequest == nil {
+		wLimit.Hide()
+	} else {
+		wLimit.Show()
+	}
+
+	if p.Manual {
+		wRemove.Show()
+	} else {
+		wRemove.Hide()
+	}
+
+	if pl.bind(row, p.ID) { // The actions only change when the row shows another peer
 		wSend.OnTapped = func() {
 			dialog.ShowFileOpen(func(uc fyne.URIReadCloser, openErr error) {
 				if openErr != nil || uc == nil {
@@ -92,7 +176,212 @@ func (pl *PeerList) updateItem(i widget.ListItemID, item fyne.CanvasObject) {
 				go prepRequest(filePath, pl.TransferRequest, name, p.Name, size, p.Address, pl.Parent)
 			}, pl.Parent)
 		}
+		wSendDir.OnTapped = func() {
+			dialog.ShowFolderOpen(func(lu fyne.ListableURI, openErr error) {
+				if openErr != nil || lu == nil {
+					return
+				}
+
+				dirPath := lu.Path()
+				name, _, err := file.Lookup(dirPath)
+				if err != nil {
+					clog.Error(err)
+					dialog.ShowError(err, pl.Parent)
+					return
+				}
+				go prepDirRequest(dirPath, pl.DirectoryRequest, name, p.Name, p.Address, pl.Parent)
+			}, pl.Parent)
+		}
+		wSendBatch.OnTapped = func() {
+			batchDialog(func(paths []string) {
+				go prepBatchRequest(paths, pl.BatchRequest, p.Name, p.Address, pl.Parent)
+			}, pl.Parent).Show()
+		}
+		wPair.OnTapped = func() {
+			go pair(pl.PairRequest, p.Name, p.Address, pl.Parent)
+		}
+		wLimit.OnTapped = func() {
+			pl.LimitRequest(p.Name)
+		}
+		wRemove.OnTapped = func() {
+			dialog.ShowConfirm("Remove peer", fmt.Sprintf("Remove %s from the peers?", p.Name), func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := pl.store.Remove(p.ID); err != nil {
+					clog.Error(err)
+				}
+			}, pl.Parent)
+		}
+	}
+}
+
+// setEnabled will enable or disable the button.
+func setEnabled(b *widget.Button, enabled bool) {
+	if enabled {
+		b.Enable()
+	} else {
+		b.Disable()
+	}
+}
+
+// displayName returns the name of the peer with the suffixes of the trust
+// and the bandwidth limit, followed by the OS and version it advertised.
+func (pl *PeerList) displayName(p *Peer) string {
+	name := displayName(p)
+	if pl.LimitLabel != nil && !p.Me {
+		if limit := pl.LimitLabel(p.Name); limit != "" {
+			name = fmt.Sprintf("%s (limited to %s)", name, limit)
+		}
+	}
+
+	if details := strings.TrimSpace(p.OS + " " + p.AppVersion); details != "" {
+		return fmt.Sprintf("%s - %s", name, details)
+	}
+	return name
+}
+
+// displayName returns the display name of the peer followed by its
+// hostname, or only the hostname, with a suffix if it's paired or its
+// fingerprint changed, and if it's offline.
+func displayName(p *Peer) string {
+	name := p.Name
+	if p.DisplayName != "" && p.DisplayName != p.Name {
+		name = fmt.Sprintf("%s (%s)", p.DisplayName, p.Name)
+	}
+
+	switch p.Trust {
+	case Mismatch:
+		name += " (fingerprint changed)"
+	case Paired:
+		name += " (paired)"
+	}
+
+	if p.Offline {
+		name += " (offline)"
+	}
+	return name
+}
+
+// displayAddress returns the address of the peer, the manual peers show
+// the host:port they were added with.
+func displayAddress(p *Peer) string {
+	if p.Manual {
+		return p.Target
+	}
+	return p.IPAddress.String()
+}
+
+// bind will set the peer with the id as the one shown on the row and
+// return true if the row was showing another peer.
+func (pl *PeerList) bind(row *fyne.Container, id string) bool {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if pl.rows[row] == id {
+		return false
+	}
+	pl.rows[row] = id
+	return true
+}
+
+// AskPairCode will show a dialog where the user types the code shown on
+// the peer that wants to pair, it blocks until the user confirms or
+// cancels so it must not be called from the UI.
+func (pl *PeerList) AskPairCode(peerName string) (string, bool) {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder(strings.Repeat("0", pake.CodeLen))
+
+	answer := make(chan bool, 1)
+	items := []*widget.FormItem{widget.NewFormItem("Code", entry)}
+	dialog.ShowForm(fmt.Sprintf("Pair with %s", peerName), "Pair", "Cancel", items, func(ok bool) {
+		answer <- ok
+	}, pl.Parent)
+
+	ok := <-answer
+	return entry.Text, ok && entry.Text != ""
+}
+
+// NewAddButton will create a new button that asks the user for the
+// host:port of a peer to add, used when the peer can't be discovered.
+func NewAddButton(pl *PeerList) *widget.Button {
+	return widget.NewButtonWithIcon("Add peer", theme.ContentAddIcon(), func() {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("host:port")
+
+		items := []*widget.FormItem{widget.NewFormItem("Address", entry)}
+		dialog.ShowForm("Add peer", "Add", "Cancel", items, func(ok bool) {
+			if ok && entry.Text != "" && pl.AddPeerRequest != nil {
+				go addPeer(pl.AddPeerRequest, strings.TrimSpace(entry.Text), pl.Parent)
+			}
+		}, pl.Parent)
+	})
+}
+
+// addPeer will show a progress dialog while the peer on the target is
+// checked and added.
+func addPeer(req AddPeerRequest, target string, parent fyne.Window) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := dialog.NewCustom(fmt.Sprintf("Adding %s", target), "Cancel", widget.NewProgressBarInfinite(), parent)
+	d.SetOnClosed(func() {
+		cancel()
+	})
+	d.Show()
+
+	err := req(ctx, target)
+	if ctx.Err() != nil { //This means the user pressed cancel.
+		return
+	}
+	d.Hide()
+
+	if err != nil {
+		clog.Error(err)
+		dialog.ShowError(err, parent)
+	}
+}
+
+// pairDialog will create and return a new dialog that shows the code the
+// user needs to type on the peer.
+func pairDialog(code, peer string, parent fyne.Window) dialog.Dialog {
+	text := widget.NewLabel(fmt.Sprintf("Type this code on %s: %s %s", peer, code[:pake.CodeLen/2], code[pake.CodeLen/2:]))
+	bar := widget.NewProgressBarInfinite()
+
+	return dialog.NewCustom(fmt.Sprintf("Pair with %s", peer), "Cancel", container.NewVBox(text, bar), parent)
+}
+
+// pair will generate a new code, show it to the user and wait until the
+// pairing ends or the user cancels.
+func pair(req PairRequest, peer string, addr net.Addr, parent fyne.Window) {
+	code, err := pake.NewCode()
+	if err != nil {
+		clog.Error(err)
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := pairDialog(code, peer, parent)
+	d.SetOnClosed(func() {
+		cancel()
+	})
+	d.Show()
+
+	err = req(ctx, code, peer, addr)
+	if ctx.Err() != nil { //This means the user pressed cancel.
+		return
+	}
+	d.Hide()
+
+	if err != nil {
+		clog.Error(err)
+		dialog.ShowError(err, parent)
+		return
 	}
+	dialog.ShowInformation("Paired", fmt.Sprintf("%s is now paired", peer), parent)
 }
 
 // length return the length of the List
@@ -100,6 +389,16 @@ func (pl *PeerList) length() int {
 	return pl.store.Size()
 }
 
+// peerAt returns the peer shown on the row i, if there is no peer on that
+// row returns nil.
+func (pl *PeerList) peerAt(i int) *Peer {
+	list := pl.store.List()
+	if i < 0 || i >= len(list) {
+		return nil
+	}
+	return list[i]
+}
+
 // prepFileDialog will create and return a new dialog
 // to inform the user that the file is getting prepared.
 func prepFileDialog(parent fyne.Window) dialog.Dialog {
@@ -152,3 +451,166 @@ func prepRequest(path string, req TransferRequest, name, peer string, size int64
 	req(path, name, check, peer, size, addr)
 	d.Hide()
 }
+
+// prepDirRequest will show a progress dialog while is generating the
+// checksum of each file inside of the directory and send it to the worker
+// to handle.
+func prepDirRequest(path string, req DirectoryRequest, name, peer string, addr net.Addr, parent fyne.Window) {
+	d := prepFileDialog(parent)
+	d.Show()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.SetOnClosed(func() {
+		cancel()
+	})
+
+	files, err := file.Manifest(ctx, path)
+	if err != nil {
+		if ctx.Err() == nil { //This means the user pressed cancel.
+			clog.Error(err)
+			dialog.ShowError(err, parent)
+		}
+		d.Hide()
+		return
+	}
+
+	req(path, name, peer, files, addr)
+	d.Hide()
+}
+
+// batchDialog will create and return a new dialog where the user can add
+// the files to send on a batch, onSend is called with the path of the
+// files when the user confirms.
+func batchDialog(onSend func(paths []string), parent fyne.Window) dialog.Dialog {
+	paths := make([]string, 0, 3)
+	files := container.NewVBox()
+
+	rect := canvas.NewRectangle(color.Transparent)
+	rect.SetMinSize(fyne.NewSize(400, 200))
+
+	add := widget.NewButtonWithIcon("Add file", theme.ContentAddIcon(), func() {
+		dialog.ShowFileOpen(func(uc fyne.URIReadCloser, openErr error) {
+			if openErr != nil || uc == nil {
+				return
+			}
+
+			if err := uc.Close(); err != nil {
+				clog.Error(err)
+			}
+
+			filePath := uc.URI().Path()
+			for _, p := range paths {
+				if p == filePath {
+					return
+				}
+			}
+
+			paths = append(paths, filePath)
+			files.Add(widget.NewLabel(filePath))
+		}, parent)
+	})
+
+	content := container.NewBorder(nil, add, nil, nil, container.NewMax(rect, container.NewVScroll(files)))
+
+	return dialog.NewCustomConfirm("Send files", "Send", "Cancel", content, func(send bool) {
+		if send && len(paths) > 0 {
+			onSend(paths)
+		}
+	}, parent)
+}
+
+// prepBatchRequest will show a progress dialog while is generating the
+// checksum of each file of the batch and send it to the worker to handle.
+func prepBatchRequest(paths []string, req BatchRequest, peer string, addr net.Addr, parent fyne.Window) {
+	d := prepFileDialog(parent)
+	d.Show()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.SetOnClosed(func() {
+		cancel()
+	})
+
+	files, err := BatchEntries(ctx, paths)
+	if err != nil {
+		if ctx.Err() == nil { //This means the user pressed cancel.
+			clog.Error(err)
+			dialog.ShowError(err, parent)
+		}
+		d.Hide()
+		return
+	}
+
+	req(paths, files, peer, addr)
+	d.Hide()
+}
+
+// BatchEntries will lookup each one of the files on the paths and generate
+// its checksum, the entries returned are on the same order of the paths.
+//
+// Files with the same name get a suffix to make each name unique since
+// the receiver stores all of them on the same folder.
+//
+// If there is an error, it can be because one of the paths is a directory,
+// a file couldn't be read or the context was cancelled.
+func BatchEntries(ctx context.Context, paths []string) ([]file.Entry, error) {
+	files := make([]file.Entry, 0, len(paths))
+	used := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		e, err := batchEntry(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Path = uniqueName(e.Path, used)
+		used[e.Path] = true
+		files = append(files, e)
+	}
+	return files, nil
+}
+
+// batchEntry will lookup the file on the path and generate its checksum.
+func batchEntry(ctx context.Context, path string) (file.Entry, error) {
+	name, size, err := file.Lookup(path)
+	if err != nil {
+		return file.Entry{}, err
+	}
+
+	if file.IsDir(path) {
+		return file.Entry{}, fmt.Errorf("peer batch request error: %s is a directory", name)
+	}
+
+	f, err := file.Open(path, file.OPEN_READ)
+	if err != nil {
+		return file.Entry{}, err
+	}
+
+	defer func() {
+		if cErr := f.Close(); cErr != nil {
+			clog.Error(cErr)
+		}
+	}()
+
+	check, err := file.Checksum(ctx, f)
+	if err != nil {
+		return file.Entry{}, err
+	}
+
+	return file.Entry{Path: name, Size: size, Checksum: check}, nil
+}
+
+// uniqueName returns the name if it's not used yet, otherwise it adds a
+// number before the extension until the name is unique.
+func uniqueName(name string, used map[string]bool) string {
+	if !used[name] {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if !used[candidate] {
+			return candidate
+		}
+	}
+}
@@ -3,6 +3,7 @@ package peer
 import (
 	"net"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -10,7 +11,10 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/widget"
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
 	"github.com/fabiodcorreia/catch-my-file/pkg/layout"
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
 )
 
 func Test_PeerList_length(t *testing.T) {
@@ -155,6 +159,262 @@ func Test_prepRequest(t *testing.T) {
 
 }
 
+func Test_prepDirRequest(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	t.Run("request prepared with the directory files", func(t *testing.T) {
+		w := a.NewWindow("request prepared with the directory files")
+		w.Resize(fyne.NewSize(900, 600))
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "a.txt"), []byte("content"), 0600)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go prepDirRequest(
+			dir,
+			func(dirPath, dirName, peerName string, files []file.Entry, addr net.Addr) {
+				if dirPath != dir || dirName != "dir" {
+					t.Errorf("prepDirRequest expected dir = %v but got = %v", dir, dirPath)
+				}
+				if len(files) != 1 || files[0].Path != "a.txt" {
+					t.Errorf("prepDirRequest expected files = [a.txt] but got = %v", files)
+				}
+				wg.Done()
+			},
+			"dir",
+			"peer-1",
+			nil,
+			w,
+		)
+		wg.Wait()
+	})
+
+	t.Run("invalid directory path", func(t *testing.T) {
+		w := a.NewWindow("invalid directory path")
+		w.Resize(fyne.NewSize(900, 600))
+
+		done := make(chan interface{})
+		go func() {
+			prepDirRequest(
+				".invalid",
+				func(dirPath, dirName, peerName string, files []file.Entry, addr net.Addr) {
+					t.Errorf("prepDirRequest not expected request")
+				},
+				"dir",
+				"peer-1",
+				nil,
+				w,
+			)
+			close(done)
+		}()
+		<-done
+	})
+}
+
+func Test_prepBatchRequest(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	t.Run("request prepared with unique file names", func(t *testing.T) {
+		w := a.NewWindow("request prepared with unique file names")
+		w.Resize(fyne.NewSize(900, 600))
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, "sub"), 0750)
+		os.WriteFile(filepath.Join(dir, "a.txt"), []byte("content"), 0600)
+		os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("other"), 0600)
+		paths := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "a.txt")}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go prepBatchRequest(
+			paths,
+			func(filePaths []string, files []file.Entry, peerName string, addr net.Addr) {
+				if len(files) != 2 || files[0].Path != "a.txt" || files[1].Path != "a (1).txt" {
+					t.Errorf("prepBatchRequest expected files = [a.txt a (1).txt] but got = %v", files)
+				}
+				if files[1].Size != 5 {
+					t.Errorf("prepBatchRequest expected size = %v but got = %v", 5, files[1].Size)
+				}
+				wg.Done()
+			},
+			"peer-1",
+			nil,
+			w,
+		)
+		wg.Wait()
+	})
+
+	t.Run("directory on the batch", func(t *testing.T) {
+		w := a.NewWindow("directory on the batch")
+		w.Resize(fyne.NewSize(900, 600))
+
+		done := make(chan interface{})
+		go func() {
+			prepBatchRequest(
+				[]string{t.TempDir()},
+				func(filePaths []string, files []file.Entry, peerName string, addr net.Addr) {
+					t.Errorf("prepBatchRequest not expected request")
+				},
+				"peer-1",
+				nil,
+				w,
+			)
+			close(done)
+		}()
+		<-done
+	})
+}
+
+func Test_uniqueName(t *testing.T) {
+	t.Run("name not used", func(t *testing.T) {
+		if n := uniqueName("a.txt", map[string]bool{"b.txt": true}); n != "a.txt" {
+			t.Errorf("uniqueName expected = %v but got = %v", "a.txt", n)
+		}
+	})
+
+	t.Run("name already used", func(t *testing.T) {
+		if n := uniqueName("a.txt", map[string]bool{"a.txt": true, "a (1).txt": true}); n != "a (2).txt" {
+			t.Errorf("uniqueName expected = %v but got = %v", "a (2).txt", n)
+		}
+	})
+}
+
+func Test_PeerList_displayName(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	pl := NewView(NewStore())
+	pl.LimitLabel = func(peerName string) string {
+		if peerName == "peer-1" {
+			return "1.0 MB/s"
+		}
+		return ""
+	}
+
+	t.Run("peer limited", func(t *testing.T) {
+		p := &Peer{Name: "peer-1", Trust: Paired}
+		if n := pl.displayName(p); n != "peer-1 (paired) (limited to 1.0 MB/s)" {
+			t.Errorf("displayName expected = %v but got = %v", "peer-1 (paired) (limited to 1.0 MB/s)", n)
+		}
+	})
+
+	t.Run("peer not limited", func(t *testing.T) {
+		p := &Peer{Name: "peer-2"}
+		if n := pl.displayName(p); n != "peer-2" {
+			t.Errorf("displayName expected = %v but got = %v", "peer-2", n)
+		}
+	})
+
+	t.Run("peer offline", func(t *testing.T) {
+		p := &Peer{Name: "peer-2", Trust: Paired, Offline: true}
+		if n := pl.displayName(p); n != "peer-2 (paired) (offline)" {
+			t.Errorf("displayName expected = %v but got = %v", "peer-2 (paired) (offline)", n)
+		}
+	})
+
+	t.Run("peer with metadata", func(t *testing.T) {
+		p := &Peer{Name: "peer-1", Metadata: Metadata{DisplayName: "Office", OS: "linux", AppVersion: "1.2.0"}}
+		if n := pl.displayName(p); n != "Office (peer-1) (limited to 1.0 MB/s) - linux 1.2.0" {
+			t.Errorf("displayName expected = %v but got = %v", "Office (peer-1) (limited to 1.0 MB/s) - linux 1.2.0", n)
+		}
+	})
+}
+
+func TestPeerList_offline(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	st := NewStore()
+	pl := NewView(st)
+
+	first := st.Add(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.1"), Instance: "catch-peer-1"})
+	st.Add(&Peer{Name: "peer-2", IPAddress: net.ParseIP("192.168.1.2"), Instance: "catch-peer-2"})
+
+	item := pl.createItem().(*fyne.Container)
+	pl.updateItem(0, item)
+
+	t.Run("offline peer can't receive files", func(t *testing.T) {
+		st.Update(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.1"), Instance: "catch-peer-1", Expires: time.Now().Add(-time.Second)})
+		st.Expire(time.Now())
+		pl.updateItem(0, item)
+
+		if !item.Objects[4].(*widget.Button).Disabled() {
+			t.Errorf("updateItem expected send button disabled")
+		}
+	})
+
+	t.Run("row reused by the next peer", func(t *testing.T) {
+		st.Remove(first)
+		pl.updateItem(0, item)
+
+		if addr := item.Objects[1].(*widget.Label).Text; addr != "192.168.1.2" {
+			t.Errorf("updateItem expected address = %v but got = %v", "192.168.1.2", addr)
+		}
+
+		if item.Objects[4].(*widget.Button).Disabled() {
+			t.Errorf("updateItem expected send button enabled")
+		}
+	})
+}
+
+func TestPeerList_capabilities(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	st := NewStore()
+	pl := NewView(st)
+
+	st.Add(&Peer{Name: "peer-1", IPAddress: net.ParseIP("192.168.1.1"), Metadata: Metadata{Capabilities: []string{"directory"}}})
+
+	item := pl.createItem().(*fyne.Container)
+
+	t.Run("peer can't receive what it doesn't support", func(t *testing.T) {
+		pl.updateItem(0, item)
+
+		if item.Objects[2].(*widget.Button).Disabled() {
+			t.Errorf("updateItem expected send directory button enabled")
+		}
+
+		if !item.Objects[3].(*widget.Button).Disabled() {
+			t.Errorf("updateItem expected send batch button disabled")
+		}
+	})
+}
+
+func TestPeerList_manual(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	st := NewStore()
+	pl := NewView(st)
+
+	st.AddManual(NewManualPeer("peer-1", "host-1:8822", network.Addrs{{IP: net.ParseIP("10.0.0.1"), Port: 8822}}))
+	st.Add(&Peer{Name: "peer-2", IPAddress: net.ParseIP("192.168.1.2")})
+
+	item := pl.createItem().(*fyne.Container)
+
+	t.Run("manual peer shows the target and can be removed", func(t *testing.T) {
+		pl.updateItem(0, item)
+
+		if addr := item.Objects[1].(*widget.Label).Text; addr != "host-1:8822" {
+			t.Errorf("updateItem expected address = %v but got = %v", "host-1:8822", addr)
+		}
+
+		if !item.Objects[7].Visible() {
+			t.Errorf("updateItem expected remove button visible")
+		}
+	})
+
+	t.Run("discovered peer can't be removed", func(t *testing.T) {
+		pl.updateItem(1, item)
+
+		if item.Objects[7].Visible() {
+			t.Errorf("updateItem expected remove button hidden")
+		}
+	})
+}
+
 func TestPeerList_updateItem(t *testing.T) {
 	a := test.NewApp()
 	defer a.Quit()
@@ -0,0 +1,309 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+)
+
+// Layout of the dates on the History view.
+const historyDateLayout = "2006-01-02 15:04"
+
+// OnHistoryChange is a function that is executed everytime a record is
+// added to the history.
+type OnHistoryChange func()
+
+// Record is a finished transfer kept on the History.
+type Record struct {
+	Direction string    `json:"direction"` // Direction is upload or download.
+	Peer      string    `json:"peer"`
+	FileName  string    `json:"file_name"`
+	FileSize  int64     `json:"file_size"`
+	Checksum  string    `json:"checksum,omitempty"`
+	Status    Status    `json:"status"`
+	Files     int       `json:"files,omitempty"` // Files is the number of files of a directory or batch.
+	LocalPath string    `json:"local_path,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Created   time.Time `json:"created"`
+	Finished  time.Time `json:"finished"`
+}
+
+// NewRecord creates the record of the transfer that finished at the time.
+func NewRecord(t *Transfer, finished time.Time) Record {
+	r := Record{
+		Direction: "download",
+		Peer:      t.SenderName,
+		FileName:  t.FileName,
+		FileSize:  t.FileSize,
+		Checksum:  t.FileChecksum,
+		Status:    t.Status,
+		Files:     len(t.Files),
+		LocalPath: t.LocalFilePath,
+		Created:   t.Created,
+		Finished:  finished,
+	}
+
+	if t.Direction == Upload {
+		r.Direction = "upload"
+	}
+
+	if t.Error() != nil {
+		r.Error = t.Error().Error()
+	}
+	return r
+}
+
+// matches returns true if the peer, file name, local path or status of the
+// record contains the query, ignoring the case.
+func (r Record) matches(query string) bool {
+	query = strings.ToLower(query)
+	for _, field := range []string{r.Peer, r.FileName, r.LocalPath, r.Status.String()} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// History is a thread-safe store of the finished transfers, each record is
+// appended to a file with one JSON record per line so it's kept between
+// executions.
+type History struct {
+	OnHistoryChange
+	mu      sync.Mutex
+	path    string
+	records []Record
+}
+
+// LoadHistory will load the records from the file on the path, if the file
+// doesn't exist yet the history is empty. If the path is empty the records
+// are only kept in memory.
+//
+// Lines that are not valid are skipped, like the last line of a file that
+// was not completely written.
+//
+// If there is an error, it can be because the file couldn't be read.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+
+	if path == "" {
+		return h, nil
+	}
+
+	f, err := os.Open(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("transfer history load error: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var r Record
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			clog.Error(fmt.Errorf("transfer history load error decoding line %d: %v", line, err))
+			continue
+		}
+		h.records = append(h.records, r)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("transfer history load error: %v", err)
+	}
+	return h, nil
+}
+
+// Add will add the record to the history and append it to the file.
+//
+// It also executes the function OnHistoryChange after the record gets added.
+//
+// If there is an error, it can be because the record couldn't be stored,
+// the record is kept anyway for this execution.
+func (h *History) Add(r Record) error {
+	h.mu.Lock()
+	h.records = append(h.records, r)
+	err := h.append(r)
+	h.mu.Unlock()
+
+	if h.OnHistoryChange != nil {
+		h.OnHistoryChange()
+	}
+	return err
+}
+
+// append will write the record at the end of the file.
+func (h *History) append(r Record) error {
+	if h.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("transfer history add error encoding: %v", err)
+	}
+
+	f, err := os.OpenFile(filepath.Clean(h.path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("transfer history add error: %v", err)
+	}
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("transfer history add error: %v", err)
+	}
+	return f.Close()
+}
+
+// Search returns the records that contain the query on the peer, file name,
+// local path or status, the newest first. An empty query returns all the
+// records.
+func (h *History) Search(query string) []Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	query = strings.TrimSpace(query)
+	records := make([]Record, 0, len(h.records))
+	for i := len(h.records) - 1; i >= 0; i-- {
+		if query == "" || h.records[i].matches(query) {
+			records = append(records, h.records[i])
+		}
+	}
+	return records
+}
+
+// Size will return the number of records on the history.
+func (h *History) Size() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.records)
+}
+
+// HistoryList is an extended version of widget.List that shows the records
+// of the History that match the search.
+type HistoryList struct {
+	widget.List
+	history *History
+	mu      sync.Mutex
+	query   string
+	records []Record
+}
+
+// NewHistoryView creates the History view, a search entry on top of the
+// list of records.
+//
+// Everytime a record is added to the history the view is refreshed.
+func NewHistoryView(history *History) fyne.CanvasObject {
+	hl := &HistoryList{history: history}
+	hl.records = history.Search("")
+
+	history.OnHistoryChange = func() {
+		hl.search(hl.currentQuery())
+	}
+
+	hl.List.Length = hl.length
+	hl.List.CreateItem = hl.createItem
+	hl.List.UpdateItem = hl.updateItem
+	hl.ExtendBaseWidget(hl)
+
+	search := widget.NewEntry()
+	search.SetPlaceHolder("Search by peer, file, path or status")
+	search.OnChanged = hl.search
+
+	return container.NewBorder(search, nil, nil, nil, hl)
+}
+
+// search will show the records that match the query.
+func (hl *HistoryList) search(query string) {
+	records := hl.history.Search(query)
+
+	hl.mu.Lock()
+	hl.query = query
+	hl.records = records
+	hl.mu.Unlock()
+
+	hl.Refresh()
+}
+
+// currentQuery returns the query of the records shown.
+func (hl *HistoryList) currentQuery() string {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	return hl.query
+}
+
+// record returns the record shown on the row i.
+func (hl *HistoryList) record(i int) (Record, bool) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	if i < 0 || i >= len(hl.records) {
+		return Record{}, false
+	}
+	return hl.records[i], true
+}
+
+// length returns the number of records shown.
+func (hl *HistoryList) length() int {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	return len(hl.records)
+}
+
+// createItem creates a new template list item with the
+// default widgets and custom layout.
+func (hl *HistoryList) createItem() fyne.CanvasObject {
+	return container.New(
+		&historyLayout{},
+		widget.NewIcon(nil), // Upload/Download
+		widget.NewLabel(""), // Name
+		widget.NewLabel(""), // Peer
+		widget.NewLabel(""), // Size
+		widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{
+			Bold: true,
+		}), // Status
+		widget.NewLabel(""), // Finished
+	)
+}
+
+// updateItem will be executed for each row of the list when it needs
+// to be updated, the rows are reused by other records when searching.
+func (hl *HistoryList) updateItem(i widget.ListItemID, item fyne.CanvasObject) {
+	r, ok := hl.record(i)
+	if !ok {
+		return
+	}
+
+	objects := item.(*fyne.Container).Objects
+	wDirection := objects[0].(*widget.Icon)
+
+	wDirection.SetResource(nil)
+	if r.Direction == "upload" {
+		setItemDirection(wDirection, Upload)
+	} else {
+		setItemDirection(wDirection, Download)
+	}
+
+	name := r.FileName
+	if r.Files > 0 {
+		name = fmt.Sprintf("%s (%d files)", r.FileName, r.Files)
+	}
+
+	for j, text := range []string{name, r.Peer, byteCountSI(r.FileSize), r.Status.String(), r.Finished.Local().Format(historyDateLayout)} {
+		wLabel := objects[j+1].(*widget.Label)
+		wLabel.Wrapping = fyne.TextTruncate
+		wLabel.SetText(text)
+	}
+}
@@ -0,0 +1,239 @@
+package transfer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/widget"
+)
+
+func Test_NewRecord(t *testing.T) {
+	finished := time.Now()
+
+	t.Run("record of an upload", func(t *testing.T) {
+		tr := NewTransfer("file.txt", "abc", "peer-1", 10, nil, Upload)
+		tr.LocalFilePath = "/tmp/file.txt"
+		tr.Status = Completed
+
+		r := NewRecord(tr, finished)
+		if r.Direction != "upload" || r.Peer != "peer-1" || r.FileName != "file.txt" || r.FileSize != 10 ||
+			r.Checksum != "abc" || r.Status != Completed || r.LocalPath != "/tmp/file.txt" {
+			t.Errorf("NewRecord expected the transfer values but got = %v", r)
+		}
+
+		if !r.Created.Equal(tr.Created) || !r.Finished.Equal(finished) {
+			t.Errorf("NewRecord expected created %v and finished %v but got = %v %v", tr.Created, finished, r.Created, r.Finished)
+		}
+	})
+
+	t.Run("record of a failed download", func(t *testing.T) {
+		tr := NewTransfer("file.txt", "abc", "peer-1", 10, nil, Download)
+		tr.SetError(errors.New("connection lost"))
+
+		r := NewRecord(tr, finished)
+		if r.Direction != "download" || r.Status != Error || r.Error != "connection lost" {
+			t.Errorf("NewRecord expected download with error but got = %v", r)
+		}
+	})
+}
+
+func Test_History_Add(t *testing.T) {
+	t.Run("records kept after load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		h, err := LoadHistory(path)
+		if err != nil {
+			t.Fatalf("LoadHistory not expected error = %v", err)
+		}
+
+		changed := 0
+		h.OnHistoryChange = func() {
+			changed++
+		}
+
+		for _, name := range []string{"a.txt", "b.txt"} {
+			if err = h.Add(Record{Direction: "upload", FileName: name, Status: Completed, Finished: time.Now()}); err != nil {
+				t.Fatalf("Add not expected error = %v", err)
+			}
+		}
+
+		if changed != 2 {
+			t.Errorf("Add expected OnHistoryChange called 2 times but got = %d", changed)
+		}
+
+		h, err = LoadHistory(path)
+		if err != nil {
+			t.Fatalf("LoadHistory not expected error = %v", err)
+		}
+
+		records := h.Search("")
+		if len(records) != 2 || records[0].FileName != "b.txt" || records[1].Status != Completed {
+			t.Errorf("LoadHistory expected the 2 records newest first but got = %v", records)
+		}
+	})
+
+	t.Run("history only in memory", func(t *testing.T) {
+		h, _ := LoadHistory("")
+
+		if err := h.Add(Record{FileName: "a.txt"}); err != nil || h.Size() != 1 {
+			t.Errorf("Add expected 1 record but got = %d (%v)", h.Size(), err)
+		}
+	})
+
+	t.Run("file can't be written", func(t *testing.T) {
+		h, _ := LoadHistory(filepath.Join(t.TempDir(), "missing", "history.jsonl"))
+
+		if err := h.Add(Record{FileName: "a.txt"}); err == nil || h.Size() != 1 {
+			t.Errorf("Add expected error and the record kept but got = %d (%v)", h.Size(), err)
+		}
+	})
+}
+
+func Test_LoadHistory(t *testing.T) {
+	t.Run("file doesn't exist", func(t *testing.T) {
+		h, err := LoadHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+		if err != nil || h.Size() != 0 {
+			t.Errorf("LoadHistory expected empty history but got = %v (%v)", h, err)
+		}
+	})
+
+	t.Run("invalid lines skipped", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		content := `{"direction":"upload","file_name":"a.txt","status":"Completed"}
+{"direction":"download","file_name":"b.txt","status":"Unknown"}
+{"direction":"download","file_na`
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		h, err := LoadHistory(path)
+		if err != nil {
+			t.Fatalf("LoadHistory not expected error = %v", err)
+		}
+
+		if h.Size() != 1 {
+			t.Errorf("LoadHistory expected 1 record but got = %d", h.Size())
+		}
+	})
+
+	t.Run("path is a directory", func(t *testing.T) {
+		if _, err := LoadHistory(t.TempDir()); err == nil {
+			t.Errorf("LoadHistory expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_History_Search(t *testing.T) {
+	h, _ := LoadHistory("")
+	h.Add(Record{Peer: "peer-1", FileName: "photo.jpg", Status: Completed, LocalPath: "/home/user/Pictures/photo.jpg"})
+	h.Add(Record{Peer: "peer-2", FileName: "notes.txt", Status: Rejected})
+	h.Add(Record{Peer: "peer-1", FileName: "report.pdf", Status: Error})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "all records", query: "", want: []string{"report.pdf", "notes.txt", "photo.jpg"}},
+		{name: "by peer", query: "PEER-1", want: []string{"report.pdf", "photo.jpg"}},
+		{name: "by file name", query: "notes", want: []string{"notes.txt"}},
+		{name: "by local path", query: "pictures", want: []string{"photo.jpg"}},
+		{name: "by status", query: "rejected", want: []string{"notes.txt"}},
+		{name: "no match", query: "video", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := h.Search(tt.query)
+			if len(records) != len(tt.want) {
+				t.Fatalf("Search expected %d records but got = %v", len(tt.want), records)
+			}
+
+			for j, r := range records {
+				if r.FileName != tt.want[j] {
+					t.Errorf("Search expected %v but got = %v", tt.want[j], r.FileName)
+				}
+			}
+		})
+	}
+}
+
+func Test_Status_UnmarshalText(t *testing.T) {
+	t.Run("status converted back", func(t *testing.T) {
+		for st := Waiting; st <= Queued; st++ {
+			text, _ := st.MarshalText()
+
+			var got Status
+			if err := got.UnmarshalText(text); err != nil || got != st {
+				t.Errorf("UnmarshalText expected %v but got = %v (%v)", st, got, err)
+			}
+		}
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		var got Status
+		if err := got.UnmarshalText([]byte("Unknown")); err == nil {
+			t.Errorf("UnmarshalText expected error but got = %v", got)
+		}
+	})
+}
+
+func Test_HistoryList_search(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	h, _ := LoadHistory("")
+	h.Add(Record{Direction: "upload", Peer: "peer-1", FileName: "photo.jpg", Status: Completed})
+
+	view := NewHistoryView(h).(*fyne.Container)
+	w := a.NewWindow("History")
+	w.SetContent(view)
+
+	var hl *HistoryList
+	for _, o := range view.Objects {
+		if l, ok := o.(*HistoryList); ok {
+			hl = l
+		}
+	}
+
+	t.Run("record added shown", func(t *testing.T) {
+		h.Add(Record{Direction: "download", Peer: "peer-2", FileName: "notes.txt", Files: 2, Status: Rejected})
+
+		if hl.length() != 2 {
+			t.Fatalf("search expected 2 records but got = %d", hl.length())
+		}
+
+		item := hl.createItem()
+		hl.updateItem(0, item)
+
+		wName := item.(*fyne.Container).Objects[1].(*widget.Label)
+		if wName.Text != "notes.txt (2 files)" {
+			t.Errorf("updateItem expected name %v but got = %v", "notes.txt (2 files)", wName.Text)
+		}
+	})
+
+	t.Run("records filtered", func(t *testing.T) {
+		hl.search("photo")
+
+		if hl.length() != 1 {
+			t.Fatalf("search expected 1 record but got = %d", hl.length())
+		}
+
+		h.Add(Record{Peer: "peer-3", FileName: "video.mp4"})
+		if hl.length() != 1 {
+			t.Errorf("search expected the query kept after a record is added but got = %d", hl.length())
+		}
+	})
+
+	t.Run("layout of the row", func(t *testing.T) {
+		item := hl.createItem().(*fyne.Container)
+		item.Resize(fyne.NewSize(600, 40))
+
+		if _, ok := item.Layout.(*historyLayout); !ok || item.Objects[5].Size().Width <= 0 {
+			t.Errorf("createItem expected the history layout but got = %v", item.Layout)
+		}
+	})
+}
@@ -0,0 +1,623 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Version is the current version of the framed protocol.
+const Version uint8 = 1
+
+// magic are the bytes that start every connection using the framed protocol.
+//
+// The first byte is not a valid character of the legacy request message,
+// which always starts with an hexadecimal checksum or a zero byte, this
+// allows the receiver to tell both protocols apart.
+var magic = []byte{0xCA, 0x7C, 'M', 'F'}
+
+// helloLen is the length of the handshake message, the magic bytes plus
+// 1 byte for the version and 4 bytes for the capabilities.
+const helloLen = 9
+
+// Capability is a protocol feature that a peer supports.
+//
+// Both peers exchange the capabilities they support during the handshake
+// and only the features supported by both can be used on the connection.
+type Capability uint32
+
+const (
+	// CapResume allows the receiver to ask the sender to resume the
+	// transfer from an offset.
+	CapResume Capability = 1 << iota
+	// CapDirectory allows the sender to transfer a directory.
+	CapDirectory
+	// CapBatch allows the sender to transfer a batch of files and the
+	// receiver to select which files of the batch it wants.
+	CapBatch
+	// CapTLS signals that the connection is upgraded to TLS right after the
+	// handshake, before any other message is sent.
+	CapTLS
+	// CapPair allows the sender to start a pairing instead of a transfer,
+	// it requires CapTLS.
+	CapPair
+	// CapResult signals that the receiver sends the result of the
+	// verification after all the data is received.
+	CapResult
+	// CapCancel allows both peers to cancel the transfer after it's accepted
+	// by sending a cancel message, the other peer answers with a cancel
+	// message too.
+	CapCancel
+	// CapPause allows both peers to pause and resume the transfer while the
+	// data is sent, the connection is kept open while it's paused.
+	CapPause
+	// CapPing allows the sender to check the receiver is reachable and get
+	// its name instead of starting a transfer.
+	CapPing
+)
+
+// Capabilities are all the capabilities supported by this implementation.
+const Capabilities = CapResume | CapDirectory | CapBatch | CapTLS | CapPair | CapResult | CapCancel | CapPause | CapPing
+
+// capNames are the names of the capabilities, used to advertise them
+// outside of the handshake.
+var capNames = []struct {
+	c    Capability
+	name string
+}{
+	{CapResume, "resume"},
+	{CapDirectory, "directory"},
+	{CapBatch, "batch"},
+	{CapTLS, "tls"},
+	{CapPair, "pair"},
+	{CapResult, "result"},
+	{CapCancel, "cancel"},
+	{CapPause, "pause"},
+	{CapPing, "ping"},
+}
+
+// Names returns the names of the capabilities set, the unknown ones are
+// not included.
+func (c Capability) Names() []string {
+	names := make([]string, 0, len(capNames))
+	for _, cn := range capNames {
+		if c&cn.c == cn.c {
+			names = append(names, cn.name)
+		}
+	}
+	return names
+}
+
+// ParseCapabilities returns the capabilities with the names, the unknown
+// names are ignored.
+func ParseCapabilities(names []string) Capability {
+	var c Capability
+	for _, name := range names {
+		for _, cn := range capNames {
+			if cn.name == name {
+				c |= cn.c
+			}
+		}
+	}
+	return c
+}
+
+// ErrLegacyPeer signals that the remote peer didn't answer the handshake
+// and probably only supports the legacy protocol.
+var ErrLegacyPeer = errors.New("protocol handshake error: peer doesn't support the framed protocol")
+
+// ErrCancelled signals that the peer cancelled the transfer.
+var ErrCancelled = errors.New("protocol error: transfer cancelled by the peer")
+
+// Conn wraps the connection with a peer and hides the differences between
+// the legacy fixed layout protocol and the framed protocol.
+//
+// The write operations are safe to be used from multiple goroutines.
+//
+// The pause and resume messages can arrive between any other message, they
+// are not returned by the read operations, OnPause is called instead.
+type Conn struct {
+	OnPause func(paused bool)
+
+	in      io.Reader
+	out     io.Writer
+	mu      sync.Mutex
+	legacy  bool
+	version uint8
+	caps    Capability
+	next    *frame // next is the frame already read by Peek.
+}
+
+// frame is a frame read from the input.
+type frame struct {
+	t       MsgType
+	payload []byte
+}
+
+// NewLegacyConn will create a Conn that uses the legacy protocol, used to
+// communicate with peers that don't support the handshake.
+func NewLegacyConn(rw io.ReadWriter) *Conn {
+	return &Conn{
+		in:     rw,
+		out:    rw,
+		legacy: true,
+	}
+}
+
+// Handshake starts the framed protocol from the sender side, it will send
+// the hello message with the local capabilities and wait for the receiver
+// to answer with its own.
+//
+// If the receiver doesn't answer with a valid hello message ErrLegacyPeer is
+// returned and the connection should be discarded since the receiver
+// already consumed part of the hello message.
+func Handshake(rw io.ReadWriter, caps Capability) (*Conn, error) {
+	if rw == nil {
+		return nil, fmt.Errorf("protocol handshake error: connection is nil")
+	}
+
+	if err := writeHello(Version, caps, rw); err != nil {
+		return nil, err
+	}
+
+	hello := make([]byte, helloLen)
+	if _, err := io.ReadFull(rw, hello); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLegacyPeer, err)
+	}
+
+	if !bytes.Equal(hello[:len(magic)], magic) {
+		return nil, ErrLegacyPeer
+	}
+
+	return newConn(rw, rw, hello[len(magic)], Capability(binary.BigEndian.Uint32(hello[len(magic)+1:])), caps)
+}
+
+// Accept starts the protocol from the receiver side, it will check if the
+// sender started the connection with the hello message and answer it with
+// the local capabilities.
+//
+// If the sender didn't start with the hello message the connection will use
+// the legacy protocol and the bytes already read are kept to be read again.
+func Accept(rw io.ReadWriter, caps Capability) (*Conn, error) {
+	if rw == nil {
+		return nil, fmt.Errorf("protocol accept error: connection is nil")
+	}
+
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(rw, prefix); err != nil {
+		return nil, fmt.Errorf("protocol accept error reading the input: %v", err)
+	}
+
+	if !bytes.Equal(prefix, magic) {
+		return &Conn{
+			in:     io.MultiReader(bytes.NewReader(prefix), rw),
+			out:    rw,
+			legacy: true,
+		}, nil
+	}
+
+	hello := make([]byte, helloLen-len(magic))
+	if _, err := io.ReadFull(rw, hello); err != nil {
+		return nil, fmt.Errorf("protocol accept error reading hello: %v", err)
+	}
+
+	if err := writeHello(Version, caps, rw); err != nil {
+		return nil, err
+	}
+
+	return newConn(rw, rw, hello[0], Capability(binary.BigEndian.Uint32(hello[1:])), caps)
+}
+
+// newConn will create a Conn for the framed protocol with the version and
+// capabilities supported by both peers.
+func newConn(in io.Reader, out io.Writer, version uint8, remote, local Capability) (*Conn, error) {
+	if version == 0 {
+		return nil, fmt.Errorf("protocol handshake error: invalid version %d", version)
+	}
+
+	if version > Version {
+		version = Version
+	}
+
+	return &Conn{
+		in:      in,
+		out:     out,
+		version: version,
+		caps:    remote & local,
+	}, nil
+}
+
+// writeHello will write the hello message to the output.
+func writeHello(version uint8, caps Capability, out io.Writer) error {
+	hello := make([]byte, helloLen)
+	copy(hello, magic)
+	hello[len(magic)] = version
+	binary.BigEndian.PutUint32(hello[len(magic)+1:], uint32(caps))
+
+	if _, err := out.Write(hello); err != nil {
+		return fmt.Errorf("protocol write hello error writing the output: %v", err)
+	}
+	return nil
+}
+
+// Upgrade will replace the connection with rw, it's used to continue the
+// protocol over a TLS connection that wraps the original connection.
+//
+// It must be called before any message is sent or received.
+func (c *Conn) Upgrade(rw io.ReadWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.in = rw
+	c.out = rw
+}
+
+// Legacy returns true if the connection uses the legacy protocol.
+func (c *Conn) Legacy() bool {
+	return c.legacy
+}
+
+// Version returns the protocol version negotiated with the peer, the legacy
+// protocol is version 0.
+func (c *Conn) Version() uint8 {
+	return c.version
+}
+
+// Has returns true if both peers support the capability.
+func (c *Conn) Has(capability Capability) bool {
+	return !c.legacy && c.caps&capability == capability
+}
+
+// WriteRequest will send the request message to the receiver.
+func (c *Conn) WriteRequest(m RequestMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.legacy {
+		return WriteRequestMessage(m, c.out)
+	}
+	return writeMessage(MsgRequest, m, c.out)
+}
+
+// ReadRequest will read the request message sent by the sender and bind it
+// into the m.
+func (c *Conn) ReadRequest(m *RequestMessage) error {
+	if m == nil {
+		return fmt.Errorf("protocol read request error: request message is nil")
+	}
+
+	if c.legacy {
+		return ReadRequestMessage(m, c.in)
+	}
+	return c.readMessage(MsgRequest, m)
+}
+
+// DecisionMessage wraps the answer of the receiver to a request message.
+//
+// Offset is the position of the file from where the sender should start
+// sending the content, it requires CapResume.
+//
+// Files are the indexes of the batch files selected by the receiver, the
+// sender will only send those files in the same order, it requires CapBatch.
+type DecisionMessage struct {
+	Accept bool  `json:"accept"`
+	Offset int64 `json:"offset,omitempty"`
+	Files  []int `json:"files,omitempty"`
+}
+
+// WriteDecision will send the decision to the sender.
+func (c *Conn) WriteDecision(m DecisionMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.legacy {
+		return WriteDecision(m.Accept, c.out)
+	}
+	return writeMessage(MsgDecision, m, c.out)
+}
+
+// ReadDecision will wait for the decision sent by the receiver.
+func (c *Conn) ReadDecision() (DecisionMessage, error) {
+	var m DecisionMessage
+	if c.legacy {
+		accept, err := ReadDecision(c.in)
+		m.Accept = accept
+		return m, err
+	}
+	err := c.readMessage(MsgDecision, &m)
+	return m, err
+}
+
+// ResultCode is the outcome of the verification made by the receiver.
+type ResultCode string
+
+const (
+	// ResultOK signals that all the data received is valid.
+	ResultOK ResultCode = "ok"
+	// ResultChecksumMismatch signals that the checksum of the data received
+	// doesn't match.
+	ResultChecksumMismatch ResultCode = "checksum_mismatch"
+	// ResultSizeMismatch signals that the size of the data received
+	// doesn't match.
+	ResultSizeMismatch ResultCode = "size_mismatch"
+	// ResultIOError signals that the receiver failed to receive or store
+	// the data.
+	ResultIOError ResultCode = "io_error"
+)
+
+// ResultMessage wraps the result of the verification made by the receiver,
+// on a batch Failed has the indexes of the files that are not valid.
+type ResultMessage struct {
+	Code   ResultCode `json:"code"`
+	Reason string     `json:"reason,omitempty"`
+	Failed []int      `json:"failed,omitempty"`
+}
+
+// WriteResult will send the result of the verification to the sender.
+func (c *Conn) WriteResult(m ResultMessage) error {
+	if !c.Has(CapResult) {
+		return fmt.Errorf("protocol write result error: peer doesn't support results")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return writeMessage(MsgResult, m, c.out)
+}
+
+// ReadResult will wait for the result of the verification sent by the
+// receiver.
+func (c *Conn) ReadResult() (ResultMessage, error) {
+	var m ResultMessage
+	if !c.Has(CapResult) {
+		return m, fmt.Errorf("protocol read result error: peer doesn't support results")
+	}
+	err := c.readMessage(MsgResult, &m)
+	return m, err
+}
+
+// PairMessage wraps the messages exchanged during the pairing.
+//
+// The sender starts with its Name and Share, the receiver answers with
+// Accept, its Share and Confirm and the sender ends with its Confirm.
+type PairMessage struct {
+	Name    string `json:"name,omitempty"`
+	Accept  bool   `json:"accept,omitempty"`
+	Share   []byte `json:"share,omitempty"`
+	Confirm []byte `json:"confirm,omitempty"`
+}
+
+// WritePair will send the pair message to the peer.
+func (c *Conn) WritePair(m PairMessage) error {
+	if !c.Has(CapPair) {
+		return fmt.Errorf("protocol write pair error: peer doesn't support pairing")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return writeMessage(MsgPair, m, c.out)
+}
+
+// ReadPair will read the pair message sent by the peer.
+func (c *Conn) ReadPair() (PairMessage, error) {
+	var m PairMessage
+	if !c.Has(CapPair) {
+		return m, fmt.Errorf("protocol read pair error: peer doesn't support pairing")
+	}
+	err := c.readMessage(MsgPair, &m)
+	return m, err
+}
+
+// PingMessage wraps the messages exchanged to check the peer, the sender
+// starts with its Name and the receiver answers with its own.
+type PingMessage struct {
+	Name string `json:"name"`
+}
+
+// WritePing will send the ping message to the peer.
+func (c *Conn) WritePing(m PingMessage) error {
+	if !c.Has(CapPing) {
+		return fmt.Errorf("protocol write ping error: peer doesn't support ping")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return writeMessage(MsgPing, m, c.out)
+}
+
+// ReadPing will read the ping message sent by the peer.
+func (c *Conn) ReadPing() (PingMessage, error) {
+	var m PingMessage
+	if !c.Has(CapPing) {
+		return m, fmt.Errorf("protocol read ping error: peer doesn't support ping")
+	}
+	err := c.readMessage(MsgPing, &m)
+	return m, err
+}
+
+// Peek returns the type of the next message without consuming it, on the
+// legacy protocol the only message expected is the request. The pause and
+// resume frames are passed to OnPause and skipped like on the reads.
+func (c *Conn) Peek() (MsgType, error) {
+	if c.legacy {
+		return MsgRequest, nil
+	}
+
+	if c.next == nil {
+		t, payload, err := c.nextFrame()
+		if err != nil {
+			return 0, err
+		}
+		c.next = &frame{t: t, payload: payload}
+	}
+	return c.next.t, nil
+}
+
+// readFrame will return the frame read by Peek or read the next frame.
+func (c *Conn) readFrame() (MsgType, []byte, error) {
+	if f := c.next; f != nil {
+		c.next = nil
+		return f.t, f.payload, nil
+	}
+	return c.nextFrame()
+}
+
+// nextFrame will read the next frame from the input, the pause and resume
+// frames are passed to OnPause and skipped.
+func (c *Conn) nextFrame() (MsgType, []byte, error) {
+	for {
+		t, payload, err := ReadFrame(c.in)
+		if err != nil || (t != MsgPause && t != MsgResume) {
+			return t, payload, err
+		}
+		if c.OnPause != nil {
+			c.OnPause(t == MsgPause)
+		}
+	}
+}
+
+// WriteCancel will signal the peer that the transfer is cancelled.
+func (c *Conn) WriteCancel() error {
+	if !c.Has(CapCancel) {
+		return fmt.Errorf("protocol write cancel error: peer doesn't support cancel")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return WriteFrame(MsgCancel, nil, c.out)
+}
+
+// WritePause will signal the peer that the transfer is paused or that it
+// continues if paused is false.
+func (c *Conn) WritePause(paused bool) error {
+	if !c.Has(CapPause) {
+		return fmt.Errorf("protocol write pause error: peer doesn't support pause")
+	}
+
+	t := MsgResume
+	if paused {
+		t = MsgPause
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return WriteFrame(t, nil, c.out)
+}
+
+// readMessage will read the next frame and decode it into m, if the frame
+// is not of the type t an error is returned. If the frame is a cancel
+// ErrCancelled is returned.
+func (c *Conn) readMessage(t MsgType, m interface{}) error {
+	mt, payload, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+
+	if mt == MsgCancel {
+		return ErrCancelled
+	}
+
+	if mt != t {
+		return fmt.Errorf("protocol read message error: expected %v but got %v", t, mt)
+	}
+
+	return decodeMessage(t, payload, m)
+}
+
+// DataWriter returns a writer that sends the file content to the peer.
+//
+// On the framed protocol each write is sent as a data frame, after the
+// content is sent CloseData must be called to signal the end of the data.
+func (c *Conn) DataWriter() io.Writer {
+	if c.legacy {
+		return c.out
+	}
+	return &dataWriter{c: c}
+}
+
+// CloseData signals the receiver that all the file content was sent.
+//
+// On the legacy protocol the end of the data is signaled by closing
+// the connection so nothing is done.
+func (c *Conn) CloseData() error {
+	if c.legacy {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return WriteFrame(MsgDataEnd, nil, c.out)
+}
+
+// DataReader returns a reader that receives the file content sent by the
+// peer, it returns io.EOF once all the content is received.
+func (c *Conn) DataReader() io.Reader {
+	if c.legacy {
+		return c.in
+	}
+	return &dataReader{c: c}
+}
+
+// dataWriter is an io.Writer that sends each write as a data frame.
+type dataWriter struct {
+	c *Conn
+}
+
+// Write will send p as one or more data frames.
+func (w *dataWriter) Write(p []byte) (int, error) {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+
+	var written int
+	for written < len(p) {
+		end := written + MaxPayloadLen
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := WriteFrame(MsgData, p[written:end], w.c.out); err != nil {
+			return written, err
+		}
+		written = end
+	}
+	return written, nil
+}
+
+// dataReader is an io.Reader that reads the content of the data frames.
+type dataReader struct {
+	c   *Conn
+	buf []byte
+	eof bool
+}
+
+// Read will copy the content of the data frames into p, once the data end
+// frame is received it returns io.EOF and if a cancel frame is received it
+// returns ErrCancelled.
+func (r *dataReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+
+		t, payload, err := r.c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+
+		switch t {
+		case MsgData:
+			r.buf = payload
+		case MsgDataEnd:
+			r.eof = true
+		case MsgCancel:
+			return 0, ErrCancelled
+		default:
+			return 0, fmt.Errorf("protocol read data error: unexpected message %v", t)
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
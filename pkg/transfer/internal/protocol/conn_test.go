@@ -0,0 +1,475 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// pipeHandshake will make the handshake between a sender and a receiver
+// connected by a net.Pipe and return both sides of the connection.
+func pipeHandshake(t *testing.T, senderCaps, receiverCaps Capability) (*Conn, *Conn) {
+	sConn, rConn := net.Pipe()
+	t.Cleanup(func() {
+		sConn.Close()
+		rConn.Close()
+	})
+
+	type result struct {
+		c   *Conn
+		err error
+	}
+	accepted := make(chan result)
+	go func() {
+		c, err := Accept(rConn, receiverCaps)
+		accepted <- result{c, err}
+	}()
+
+	sender, err := Handshake(sConn, senderCaps)
+	if err != nil {
+		t.Fatalf("Handshake not expected error = %v", err)
+	}
+
+	r := <-accepted
+	if r.err != nil {
+		t.Fatalf("Accept not expected error = %v", r.err)
+	}
+
+	return sender, r.c
+}
+
+func Test_Capability_Names(t *testing.T) {
+	t.Run("names of the capabilities", func(t *testing.T) {
+		want := []string{"directory", "tls", "ping"}
+		if got := (CapDirectory | CapTLS | CapPing).Names(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Names expected = %v but got = %v", want, got)
+		}
+	})
+
+	t.Run("parse the names", func(t *testing.T) {
+		got := ParseCapabilities([]string{"batch", "unknown", "pause"})
+		if got != CapBatch|CapPause {
+			t.Errorf("ParseCapabilities expected = %v but got = %v", CapBatch|CapPause, got)
+		}
+	})
+
+	t.Run("all the capabilities", func(t *testing.T) {
+		if got := ParseCapabilities(Capabilities.Names()); got != Capabilities {
+			t.Errorf("ParseCapabilities expected = %v but got = %v", Capabilities, got)
+		}
+	})
+}
+
+func Test_Handshake(t *testing.T) {
+	t.Run("negotiate capabilities supported by both", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capability(3), Capability(6))
+
+		if sender.Legacy() || receiver.Legacy() {
+			t.Errorf("Handshake expected framed protocol but got legacy")
+		}
+		if sender.Version() != Version || receiver.Version() != Version {
+			t.Errorf("Handshake expected version = %v but got = %v and %v", Version, sender.Version(), receiver.Version())
+		}
+		if !sender.Has(Capability(2)) || !receiver.Has(Capability(2)) {
+			t.Errorf("Handshake expected common capability to be supported")
+		}
+		if sender.Has(Capability(1)) || receiver.Has(Capability(4)) {
+			t.Errorf("Handshake expected capability not supported by both to be unsupported")
+		}
+	})
+
+	t.Run("peer closes without answer", func(t *testing.T) {
+		sConn, rConn := net.Pipe()
+		defer sConn.Close()
+
+		go func() {
+			buf := make([]byte, messageRequestLen)
+			rConn.Read(buf)
+			rConn.Close()
+		}()
+
+		if _, err := Handshake(sConn, Capabilities); !errors.Is(err, ErrLegacyPeer) {
+			t.Errorf("Handshake expected error = %v but got = %v", ErrLegacyPeer, err)
+		}
+	})
+
+	t.Run("peer answers with invalid magic", func(t *testing.T) {
+		inOut := &struct {
+			io.Reader
+			io.Writer
+		}{bytes.NewBuffer(make([]byte, helloLen)), &bytes.Buffer{}}
+
+		if _, err := Handshake(inOut, Capabilities); !errors.Is(err, ErrLegacyPeer) {
+			t.Errorf("Handshake expected error = %v but got = %v", ErrLegacyPeer, err)
+		}
+	})
+
+	t.Run("connection is nil", func(t *testing.T) {
+		if _, err := Handshake(nil, Capabilities); err == nil {
+			t.Errorf("Handshake expected error = %v", err)
+		}
+	})
+}
+
+func Test_Accept(t *testing.T) {
+	rm := RequestMessage{
+		Checksum: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		FileName: "file-name.txt",
+		Hostname: "my-hostname",
+		FileSize: 2312321,
+	}
+
+	t.Run("legacy request message", func(t *testing.T) {
+		inOut := &bytes.Buffer{}
+		WriteRequestMessage(rm, inOut)
+
+		c, err := Accept(inOut, Capabilities)
+		if err != nil {
+			t.Errorf("Accept not expected error = %v", err)
+		}
+		if !c.Legacy() {
+			t.Errorf("Accept expected legacy protocol but got framed")
+		}
+
+		var output RequestMessage
+		if err = c.ReadRequest(&output); err != nil {
+			t.Errorf("ReadRequest not expected error = %v", err)
+		}
+		if !reflect.DeepEqual(output, rm) {
+			t.Errorf("ReadRequest expected output = %v but got output = %v", rm, output)
+		}
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		inOut := &bytes.Buffer{}
+		writeHello(0, Capabilities, inOut)
+
+		if _, err := Accept(inOut, Capabilities); err == nil {
+			t.Errorf("Accept expected error = %v", err)
+		}
+	})
+
+	t.Run("input is empty", func(t *testing.T) {
+		if _, err := Accept(&bytes.Buffer{}, Capabilities); err == nil {
+			t.Errorf("Accept expected error = %v", err)
+		}
+	})
+
+	t.Run("connection is nil", func(t *testing.T) {
+		if _, err := Accept(nil, Capabilities); err == nil {
+			t.Errorf("Accept expected error = %v", err)
+		}
+	})
+}
+
+func Test_Conn_Transfer(t *testing.T) {
+	rm := RequestMessage{
+		Checksum: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		FileName: "a file name longer than the legacy protocol allows, which is only possible with the framed protocol.txt",
+		Hostname: "my-hostname",
+		FileSize: 11,
+	}
+
+	t.Run("request, decision and data on the framed protocol", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+
+		go func() {
+			sender.WriteRequest(rm)
+			if d, _ := sender.ReadDecision(); d.Accept {
+				sender.DataWriter().Write([]byte("hello "))
+				sender.DataWriter().Write([]byte("world"))
+				sender.CloseData()
+			}
+		}()
+
+		var output RequestMessage
+		if err := receiver.ReadRequest(&output); err != nil {
+			t.Errorf("ReadRequest not expected error = %v", err)
+		}
+		if !reflect.DeepEqual(output, rm) {
+			t.Errorf("ReadRequest expected output = %v but got output = %v", rm, output)
+		}
+
+		if err := receiver.WriteDecision(DecisionMessage{Accept: true}); err != nil {
+			t.Errorf("WriteDecision not expected error = %v", err)
+		}
+
+		data, err := io.ReadAll(receiver.DataReader())
+		if err != nil {
+			t.Errorf("DataReader not expected error = %v", err)
+		}
+		if string(data) != "hello world" {
+			t.Errorf("DataReader expected = %v but got = %v", "hello world", string(data))
+		}
+	})
+
+	t.Run("unexpected message while reading data", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+
+		go sender.WriteRequest(rm)
+
+		if _, err := io.ReadAll(receiver.DataReader()); err == nil {
+			t.Errorf("DataReader expected error = %v", err)
+		}
+	})
+
+	t.Run("request message pointer is nil", func(t *testing.T) {
+		c := NewLegacyConn(&bytes.Buffer{})
+
+		if err := c.ReadRequest(nil); err == nil {
+			t.Errorf("ReadRequest expected error = %v", err)
+		}
+	})
+
+	t.Run("decision on the legacy protocol", func(t *testing.T) {
+		inOut := &bytes.Buffer{}
+		c := NewLegacyConn(inOut)
+
+		if err := c.WriteDecision(DecisionMessage{Accept: true}); err != nil {
+			t.Errorf("WriteDecision not expected error = %v", err)
+		}
+		if !reflect.DeepEqual(inOut.Bytes(), []byte{1}) {
+			t.Errorf("WriteDecision expected output = %v but got output = %v", []byte{1}, inOut.Bytes())
+		}
+
+		d, err := c.ReadDecision()
+		if err != nil {
+			t.Errorf("ReadDecision not expected error = %v", err)
+		}
+		if !d.Accept {
+			t.Errorf("ReadDecision expected accept but got reject")
+		}
+	})
+}
+
+func Test_Conn_Pair(t *testing.T) {
+	t.Run("peek and read the pair message", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+		pm := PairMessage{Name: "peer-1", Share: []byte{1, 2, 3}}
+
+		go sender.WritePair(pm)
+
+		mt, err := receiver.Peek()
+		if err != nil {
+			t.Errorf("Peek not expected error = %v", err)
+		}
+		if mt != MsgPair {
+			t.Errorf("Peek expected type = %v but got type = %v", MsgPair, mt)
+		}
+
+		output, err := receiver.ReadPair()
+		if err != nil {
+			t.Errorf("ReadPair not expected error = %v", err)
+		}
+		if !reflect.DeepEqual(output, pm) {
+			t.Errorf("ReadPair expected output = %v but got output = %v", pm, output)
+		}
+	})
+
+	t.Run("peek on the legacy protocol", func(t *testing.T) {
+		c := NewLegacyConn(&bytes.Buffer{})
+
+		if mt, err := c.Peek(); err != nil || mt != MsgRequest {
+			t.Errorf("Peek expected type = %v but got type = %v (%v)", MsgRequest, mt, err)
+		}
+	})
+
+	t.Run("peer doesn't support pairing", func(t *testing.T) {
+		sender, _ := pipeHandshake(t, Capabilities, Capabilities&^CapPair)
+
+		if err := sender.WritePair(PairMessage{}); err == nil {
+			t.Errorf("WritePair expected error = %v", err)
+		}
+	})
+}
+
+func Test_Conn_Ping(t *testing.T) {
+	t.Run("ping and answer", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+
+		go func() {
+			if mt, err := receiver.Peek(); err != nil || mt != MsgPing {
+				t.Errorf("Peek expected type = %v but got type = %v (%v)", MsgPing, mt, err)
+			}
+			if m, err := receiver.ReadPing(); err != nil || m.Name != "peer-1" {
+				t.Errorf("ReadPing expected name = %v but got = %v (%v)", "peer-1", m.Name, err)
+			}
+			receiver.WritePing(PingMessage{Name: "peer-2"})
+		}()
+
+		if err := sender.WritePing(PingMessage{Name: "peer-1"}); err != nil {
+			t.Errorf("WritePing not expected error = %v", err)
+		}
+
+		output, err := sender.ReadPing()
+		if err != nil {
+			t.Errorf("ReadPing not expected error = %v", err)
+		}
+		if output.Name != "peer-2" {
+			t.Errorf("ReadPing expected name = %v but got = %v", "peer-2", output.Name)
+		}
+	})
+
+	t.Run("peer doesn't support ping", func(t *testing.T) {
+		sender, _ := pipeHandshake(t, Capabilities, Capabilities&^CapPing)
+
+		if err := sender.WritePing(PingMessage{}); err == nil {
+			t.Errorf("WritePing expected error = %v", err)
+		}
+	})
+}
+
+func Test_Conn_Result(t *testing.T) {
+	t.Run("write and read the result", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+		rm := ResultMessage{Code: ResultChecksumMismatch, Reason: "checksum doesn't match", Failed: []int{1}}
+
+		go receiver.WriteResult(rm)
+
+		output, err := sender.ReadResult()
+		if err != nil {
+			t.Errorf("ReadResult not expected error = %v", err)
+		}
+		if !reflect.DeepEqual(output, rm) {
+			t.Errorf("ReadResult expected output = %v but got output = %v", rm, output)
+		}
+	})
+
+	t.Run("peer doesn't support results", func(t *testing.T) {
+		_, receiver := pipeHandshake(t, Capabilities&^CapResult, Capabilities)
+
+		if err := receiver.WriteResult(ResultMessage{Code: ResultOK}); err == nil {
+			t.Errorf("WriteResult expected error = %v", err)
+		}
+	})
+}
+
+func Test_Conn_Cancel(t *testing.T) {
+	t.Run("cancel while reading data", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+
+		go func() {
+			sender.DataWriter().Write([]byte("hello "))
+			sender.WriteCancel()
+		}()
+
+		if _, err := io.ReadAll(receiver.DataReader()); !errors.Is(err, ErrCancelled) {
+			t.Errorf("DataReader expected error = %v but got = %v", ErrCancelled, err)
+		}
+	})
+
+	t.Run("cancel while waiting for the result", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+
+		go receiver.WriteCancel()
+
+		if _, err := sender.ReadResult(); !errors.Is(err, ErrCancelled) {
+			t.Errorf("ReadResult expected error = %v but got = %v", ErrCancelled, err)
+		}
+	})
+
+	t.Run("peer doesn't support cancel", func(t *testing.T) {
+		sender, _ := pipeHandshake(t, Capabilities, Capabilities&^CapCancel)
+
+		if err := sender.WriteCancel(); err == nil {
+			t.Errorf("WriteCancel expected error = %v", err)
+		}
+	})
+}
+
+func Test_Conn_Pause(t *testing.T) {
+	t.Run("pause and resume while reading data", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+
+		var got []bool
+		receiver.OnPause = func(paused bool) {
+			got = append(got, paused)
+		}
+
+		go func() {
+			sender.DataWriter().Write([]byte("hello "))
+			sender.WritePause(true)
+			sender.WritePause(false)
+			sender.DataWriter().Write([]byte("world"))
+			sender.CloseData()
+		}()
+
+		data, err := io.ReadAll(receiver.DataReader())
+		if err != nil {
+			t.Fatalf("DataReader not expected error = %v", err)
+		}
+
+		if string(data) != "hello world" {
+			t.Errorf("DataReader expected data = %v but got = %v", "hello world", string(data))
+		}
+
+		if len(got) != 2 || !got[0] || got[1] {
+			t.Errorf("OnPause expected = %v but got = %v", []bool{true, false}, got)
+		}
+	})
+
+	t.Run("pause before a peek", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+
+		var got []bool
+		receiver.OnPause = func(paused bool) {
+			got = append(got, paused)
+		}
+
+		go func() {
+			sender.WritePause(true)
+			sender.WriteRequest(RequestMessage{FileName: "a.txt", FileSize: 1, Hostname: "peer-1", Checksum: "aaaa"})
+		}()
+
+		if mt, err := receiver.Peek(); err != nil || mt != MsgRequest {
+			t.Fatalf("Peek expected type = %v but got type = %v (%v)", MsgRequest, mt, err)
+		}
+
+		var m RequestMessage
+		if err := receiver.ReadRequest(&m); err != nil || m.FileName != "a.txt" {
+			t.Errorf("ReadRequest expected file a.txt but got = %v (%v)", m, err)
+		}
+
+		if len(got) != 1 || !got[0] {
+			t.Errorf("OnPause expected = %v but got = %v", []bool{true}, got)
+		}
+	})
+
+	t.Run("pause while waiting for the result", func(t *testing.T) {
+		sender, receiver := pipeHandshake(t, Capabilities, Capabilities)
+
+		paused := false
+		sender.OnPause = func(p bool) {
+			paused = p
+		}
+
+		go func() {
+			receiver.WritePause(true)
+			receiver.WriteResult(ResultMessage{Code: ResultOK})
+		}()
+
+		m, err := sender.ReadResult()
+		if err != nil {
+			t.Fatalf("ReadResult not expected error = %v", err)
+		}
+
+		if m.Code != ResultOK {
+			t.Errorf("ReadResult expected code = %v but got = %v", ResultOK, m.Code)
+		}
+
+		if !paused {
+			t.Errorf("OnPause expected paused = %v but got = %v", true, paused)
+		}
+	})
+
+	t.Run("peer doesn't support pause", func(t *testing.T) {
+		sender, _ := pipeHandshake(t, Capabilities, Capabilities&^CapPause)
+
+		if err := sender.WritePause(true); err == nil {
+			t.Errorf("WritePause expected error = %v", err)
+		}
+	})
+}
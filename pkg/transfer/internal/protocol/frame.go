@@ -0,0 +1,142 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MsgType identifies the type of the payload carried by a frame.
+type MsgType byte
+
+const (
+	// MsgRequest carries a RequestMessage.
+	MsgRequest MsgType = iota + 1
+	// MsgDecision carries a DecisionMessage.
+	MsgDecision
+	// MsgData carries a chunk of the file content.
+	MsgData
+	// MsgDataEnd signals that there is no more file content to send.
+	MsgDataEnd
+	// MsgPair carries a PairMessage.
+	MsgPair
+	// MsgResult carries a ResultMessage.
+	MsgResult
+	// MsgCancel signals that the transfer is cancelled, it has no payload.
+	MsgCancel
+	// MsgPause signals that the transfer is paused, it has no payload.
+	MsgPause
+	// MsgResume signals that a paused transfer continues, it has no payload.
+	MsgResume
+	// MsgPing carries a PingMessage.
+	MsgPing
+)
+
+// String convert a message type into a string representation.
+func (t MsgType) String() string {
+	switch t {
+	case MsgRequest:
+		return `Request`
+	case MsgDecision:
+		return `Decision`
+	case MsgData:
+		return `Data`
+	case MsgDataEnd:
+		return `DataEnd`
+	case MsgPair:
+		return `Pair`
+	case MsgResult:
+		return `Result`
+	case MsgCancel:
+		return `Cancel`
+	case MsgPause:
+		return `Pause`
+	case MsgResume:
+		return `Resume`
+	case MsgPing:
+		return `Ping`
+	}
+	return fmt.Sprintf("Unknown(%d)", byte(t))
+}
+
+const (
+	// frameHeaderLen is the length of the frame header, 1 byte for the
+	// message type and 4 bytes for the payload length.
+	frameHeaderLen = 5
+	// MaxPayloadLen is the maximum payload length accepted on a frame, it
+	// needs to fit the request message of directories with many files.
+	MaxPayloadLen = 16 << 20 //16MB
+)
+
+// WriteFrame will write a frame with the message type t and the payload
+// to the output.
+//
+// If there is an error, it can be because the writer was nil, the payload
+// is larger than MaxPayloadLen or an error writing to the output.
+func WriteFrame(t MsgType, payload []byte, out io.Writer) error {
+	if out == nil {
+		return fmt.Errorf("protocol write frame error: output writer is nil")
+	}
+
+	if len(payload) > MaxPayloadLen {
+		return fmt.Errorf("protocol write frame error: payload too large %d", len(payload))
+	}
+
+	p := make([]byte, frameHeaderLen+len(payload))
+	p[0] = byte(t)
+	binary.BigEndian.PutUint32(p[1:frameHeaderLen], uint32(len(payload)))
+	copy(p[frameHeaderLen:], payload)
+
+	if _, err := out.Write(p); err != nil {
+		return fmt.Errorf("protocol write frame error writing the output: %v", err)
+	}
+
+	return nil
+}
+
+// ReadFrame will read one frame from the input and return the message
+// type and the payload.
+//
+// If there is an error, it can be because the reader was nil, an error
+// reading the input or the payload length is larger than MaxPayloadLen.
+func ReadFrame(in io.Reader) (MsgType, []byte, error) {
+	if in == nil {
+		return 0, nil, fmt.Errorf("protocol read frame error: input reader is nil")
+	}
+
+	header := make([]byte, frameHeaderLen)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return 0, nil, fmt.Errorf("protocol read frame error reading the header: %w", err)
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxPayloadLen {
+		return 0, nil, fmt.Errorf("protocol read frame error: payload too large %d", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(in, payload); err != nil {
+		return 0, nil, fmt.Errorf("protocol read frame error reading the payload: %w", err)
+	}
+
+	return MsgType(header[0]), payload, nil
+}
+
+// writeMessage will encode the message m and write it as a frame of the
+// type t to the output.
+func writeMessage(t MsgType, m interface{}, out io.Writer) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("protocol write message %v error encoding: %v", t, err)
+	}
+	return WriteFrame(t, payload, out)
+}
+
+// decodeMessage will decode the payload of a frame into m.
+func decodeMessage(t MsgType, payload []byte, m interface{}) error {
+	if err := json.Unmarshal(payload, m); err != nil {
+		return fmt.Errorf("protocol read message %v error decoding: %v", t, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func Test_WriteFrame(t *testing.T) {
+	t.Run("frame with payload", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		want := []byte{3, 0, 0, 0, 3, 97, 98, 99}
+
+		if err := WriteFrame(MsgData, []byte("abc"), output); err != nil {
+			t.Errorf("WriteFrame not expected error = %v", err)
+		}
+		if !reflect.DeepEqual(output.Bytes(), want) {
+			t.Errorf("WriteFrame expected output = %v but got output = %v", want, output.Bytes())
+		}
+	})
+
+	t.Run("frame without payload", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		want := []byte{4, 0, 0, 0, 0}
+
+		if err := WriteFrame(MsgDataEnd, nil, output); err != nil {
+			t.Errorf("WriteFrame not expected error = %v", err)
+		}
+		if !reflect.DeepEqual(output.Bytes(), want) {
+			t.Errorf("WriteFrame expected output = %v but got output = %v", want, output.Bytes())
+		}
+	})
+
+	t.Run("payload too large", func(t *testing.T) {
+		output := &bytes.Buffer{}
+
+		if err := WriteFrame(MsgData, make([]byte, MaxPayloadLen+1), output); err == nil {
+			t.Errorf("WriteFrame expected error = %v", err)
+		}
+		if output.Len() != 0 {
+			t.Errorf("WriteFrame expected empty output but got = %v", output.Len())
+		}
+	})
+
+	t.Run("output writer is nil", func(t *testing.T) {
+		if err := WriteFrame(MsgData, nil, nil); err == nil {
+			t.Errorf("WriteFrame expected error = %v", err)
+		}
+	})
+}
+
+func Test_ReadFrame(t *testing.T) {
+	t.Run("frame with payload", func(t *testing.T) {
+		input := bytes.NewBuffer([]byte{3, 0, 0, 0, 3, 97, 98, 99})
+
+		mt, payload, err := ReadFrame(input)
+		if err != nil {
+			t.Errorf("ReadFrame not expected error = %v", err)
+		}
+		if mt != MsgData {
+			t.Errorf("ReadFrame expected type = %v but got type = %v", MsgData, mt)
+		}
+		if string(payload) != "abc" {
+			t.Errorf("ReadFrame expected payload = %v but got payload = %v", "abc", string(payload))
+		}
+	})
+
+	t.Run("frame with incomplete payload", func(t *testing.T) {
+		input := bytes.NewBuffer([]byte{3, 0, 0, 0, 3, 97})
+
+		if _, _, err := ReadFrame(input); err == nil {
+			t.Errorf("ReadFrame expected error = %v", err)
+		}
+	})
+
+	t.Run("frame with payload too large", func(t *testing.T) {
+		input := bytes.NewBuffer([]byte{3, 255, 255, 255, 255})
+
+		if _, _, err := ReadFrame(input); err == nil {
+			t.Errorf("ReadFrame expected error = %v", err)
+		}
+	})
+
+	t.Run("input reader is nil", func(t *testing.T) {
+		if _, _, err := ReadFrame(nil); err == nil {
+			t.Errorf("ReadFrame expected error = %v", err)
+		}
+	})
+}
+
+func Test_MsgType_String(t *testing.T) {
+	t.Run("known type", func(t *testing.T) {
+		if MsgRequest.String() != "Request" {
+			t.Errorf("String expected = %v but got = %v", "Request", MsgRequest.String())
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		if MsgType(200).String() != "Unknown(200)" {
+			t.Errorf("String expected = %v but got = %v", "Unknown(200)", MsgType(200).String())
+		}
+	})
+}
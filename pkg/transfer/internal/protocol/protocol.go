@@ -28,11 +28,36 @@ const messageRequestLen = fieldChecksumLen + fieldFileSizeLen + fieldFileNameLen
 
 // RequestMessage wraps the request message data that is sent and received  by
 // the peers when a new file transfer is requested.
+//
+// When a directory is transferred Dir is true, FileName is the directory name,
+// FileSize the sum of all the files and Files the list of files inside of it.
+// Dir and Files are only sent on the framed protocol and require CapDirectory.
+//
+// When a batch of files is transferred Batch is true, FileSize is the sum of
+// all the files and Files the list of files of the batch, it requires CapBatch.
+//
+// Reconnect is true when the sender lost the connection of a paused transfer
+// and asks the receiver to continue it, it requires CapPause.
+//
+// ID is the id of the transfer shared by both peers, it's only sent on the
+// framed protocol.
 type RequestMessage struct {
-	FileName string
-	FileSize int64
-	Hostname string
-	Checksum string
+	ID        string        `json:"id,omitempty"`
+	FileName  string        `json:"name"`
+	FileSize  int64         `json:"size"`
+	Hostname  string        `json:"host"`
+	Checksum  string        `json:"checksum"`
+	Dir       bool          `json:"dir,omitempty"`
+	Batch     bool          `json:"batch,omitempty"`
+	Files     []FileMessage `json:"files,omitempty"`
+	Reconnect bool          `json:"reconnect,omitempty"`
+}
+
+// FileMessage describes one of the files of a directory or batch transfer.
+type FileMessage struct {
+	Path     string `json:"path"` // Path relative to the directory, using slash as separator.
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
 }
 
 // WriteRequestMessage will create a structured binary message to sent to
@@ -99,12 +124,14 @@ func ReadRequestMessage(m *RequestMessage, in io.Reader) error {
 		return fmt.Errorf("protocol read request message error: request message is nil")
 	}
 
-	rc, err := in.Read(bufferMessage)
+	// The message can arrive split in multiple reads, ReadFull will make
+	// sure the full message is read or fail if the input ends before.
+	_, err := io.ReadFull(in, bufferMessage)
 	switch {
+	case err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("protocol read request message error: message size not correct")
 	case err != nil:
 		return fmt.Errorf("protocol read request message error reading the input: %v", err)
-	case rc != messageRequestLen:
-		return fmt.Errorf("protocol read request message error: message size not correct")
 	}
 
 	size, err := strconv.ParseInt(
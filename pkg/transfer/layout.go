@@ -31,6 +31,23 @@ func (l *transferLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
 	col6Width := (size.Width - col5X - col5Width)
 	col6X := col5X + col5Width - theme.Padding()
 
+	// The details button is only visible for transfers with files and is
+	// placed at the end of the name column.
+	if objects[6].Visible() {
+		col7Width := float32(40)
+		col7X := col2X + col2Width - col7Width
+		layout.ResizeAndMove(objects[6], col7Width, col7X, l.maxMinSizeHeight)
+		col2Width -= col7Width + theme.Padding()
+	}
+
+	// The speed and time of the transfer take the end of the name column,
+	// before the details button.
+	if objects[8].Visible() {
+		col9Width := col2Width * 0.5
+		layout.ResizeAndMove(objects[8], col9Width, col2X+col2Width-col9Width, l.maxMinSizeHeight)
+		col2Width -= col9Width + theme.Padding()
+	}
+
 	layout.ResizeAndMove(objects[0], col1Width, col1X, l.maxMinSizeHeight)
 	layout.ResizeAndMove(objects[1], col2Width, col2X, l.maxMinSizeHeight)
 	layout.ResizeAndMove(objects[2], col3Width, col3X, l.maxMinSizeHeight)
@@ -38,9 +55,22 @@ func (l *transferLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
 	layout.ResizeAndMove(objects[4], col5Width, col5X, l.maxMinSizeHeight)
 	layout.ResizeAndMove(objects[5], col6Width, col6X, l.maxMinSizeHeight)
 
+	// The dismiss button is only visible for finished transfers, when the
+	// actions are hidden, and is placed at the end of the row.
+	if objects[7].Visible() {
+		col8Width := float32(40)
+		layout.ResizeAndMove(objects[7], col8Width, col6X+col6Width-col8Width, l.maxMinSizeHeight)
+	}
+
 	col6 := objects[5].(*fyne.Container)
 	if col6.Objects[0].Visible() {
-		layout.ResizeAndMove(col6.Objects[0], col6Width, theme.Padding(), l.maxMinSizeHeight)
+		// The pause and cancel buttons are placed at the end of the
+		// progress bar.
+		col64Width := float32(40)
+		col61Width := col6Width - (col64Width+theme.Padding())*2
+		layout.ResizeAndMove(col6.Objects[0], col61Width, theme.Padding(), l.maxMinSizeHeight)
+		layout.ResizeAndMove(col6.Objects[4], col64Width, theme.Padding()*2+col61Width, l.maxMinSizeHeight)
+		layout.ResizeAndMove(col6.Objects[3], col64Width, theme.Padding()*3+col61Width+col64Width, l.maxMinSizeHeight)
 		return
 	}
 
@@ -59,3 +89,31 @@ func (l *transferLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
 	l.maxMinSizeHeight = height
 	return size
 }
+
+type historyLayout struct {
+	maxMinSizeHeight float32
+}
+
+// Layout will calculate the size and position of each object in a row
+// of the History List.
+func (l *historyLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	col1Width := float32(25)
+	col1X := theme.Padding()
+	layout.ResizeAndMove(objects[0], col1Width, col1X, l.maxMinSizeHeight)
+
+	// Name, peer, size, status and finished date share the remaining width.
+	widths := []float32{0.36, 0.2, 0.1, 0.13, 0.21}
+	available := size.Width - col1X - col1Width - theme.Padding()*float32(len(widths))
+	posX := col1X + col1Width + theme.Padding()
+	for j, w := range widths {
+		layout.ResizeAndMove(objects[j+1], available*w, posX, l.maxMinSizeHeight)
+		posX += available*w + theme.Padding()
+	}
+}
+
+// MinSize will calculate the minimum size allowed that.
+func (l *historyLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	size, height := layout.MinSize(l.maxMinSizeHeight, objects)
+	l.maxMinSizeHeight = height
+	return size
+}
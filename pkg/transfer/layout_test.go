@@ -41,6 +41,15 @@ func Test_transferListLayout_Layout(t *testing.T) {
 			}
 		}()
 
+		details := container.NewWithoutLayout()
+		details.Hide()
+
+		dismiss := container.NewWithoutLayout()
+		dismiss.Hide()
+
+		stats := container.NewWithoutLayout()
+		stats.Hide()
+
 		objects := []fyne.CanvasObject{
 			container.NewWithoutLayout(),
 			container.NewWithoutLayout(),
@@ -51,7 +60,12 @@ func Test_transferListLayout_Layout(t *testing.T) {
 				container.NewWithoutLayout(),
 				container.NewWithoutLayout(),
 				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
 			),
+			details,
+			dismiss,
+			stats,
 		}
 
 		l.Layout(objects, fyne.NewSize(900, 600))
@@ -82,10 +96,18 @@ func Test_transferListLayout_Layout(t *testing.T) {
 
 		actions := objects[5].(*fyne.Container)
 
-		if err6 := checkPosAndSize(actions.Objects[0], 170.65688, 4); err6 != nil {
+		if err6 := checkPosAndSize(actions.Objects[0], 82.656876, 4); err6 != nil {
 			t.Errorf("object 6: %v", err6)
 		}
 
+		if err7 := checkPosAndSize(actions.Objects[4], 40, 90.656876); err7 != nil {
+			t.Errorf("object 7: %v", err7)
+		}
+
+		if err8 := checkPosAndSize(actions.Objects[3], 40, 134.65688); err8 != nil {
+			t.Errorf("object 8: %v", err8)
+		}
+
 	})
 
 	t.Run("valid number of objects without progress bar", func(t *testing.T) {
@@ -100,6 +122,15 @@ func Test_transferListLayout_Layout(t *testing.T) {
 		pb := container.NewWithoutLayout()
 		pb.Hide()
 
+		details := container.NewWithoutLayout()
+		details.Hide()
+
+		dismiss := container.NewWithoutLayout()
+		dismiss.Hide()
+
+		stats := container.NewWithoutLayout()
+		stats.Hide()
+
 		objects := []fyne.CanvasObject{
 			container.NewWithoutLayout(),
 			container.NewWithoutLayout(),
@@ -110,7 +141,11 @@ func Test_transferListLayout_Layout(t *testing.T) {
 				pb,
 				container.NewWithoutLayout(),
 				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
 			),
+			details,
+			dismiss,
+			stats,
 		}
 
 		l.Layout(objects, fyne.NewSize(900, 600))
@@ -149,6 +184,129 @@ func Test_transferListLayout_Layout(t *testing.T) {
 			t.Errorf("object 8: %v", err8)
 		}
 	})
+
+	t.Run("valid number of objects with details button", func(t *testing.T) {
+		l := &transferLayout{}
+
+		defer func() {
+			if err := recover(); err != nil {
+				t.Errorf("Layout expected no panic = %v", err)
+			}
+		}()
+
+		dismiss := container.NewWithoutLayout()
+		dismiss.Hide()
+
+		stats := container.NewWithoutLayout()
+		stats.Hide()
+
+		objects := []fyne.CanvasObject{
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+			),
+			container.NewWithoutLayout(),
+			dismiss,
+			stats,
+		}
+
+		l.Layout(objects, fyne.NewSize(900, 600))
+
+		if err1 := checkPosAndSize(objects[1], 323.5, 33); err1 != nil {
+			t.Errorf("object 1: %v", err1)
+		}
+
+		if err2 := checkPosAndSize(objects[2], 133.125, 404.5); err2 != nil {
+			t.Errorf("object 2: %v", err2)
+		}
+
+		if err6 := checkPosAndSize(objects[6], 40, 360.5); err6 != nil {
+			t.Errorf("object 6: %v", err6)
+		}
+	})
+
+	t.Run("valid number of objects with dismiss button", func(t *testing.T) {
+		l := &transferLayout{}
+
+		actions := container.NewWithoutLayout(
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+		)
+		actions.Hide()
+
+		details := container.NewWithoutLayout()
+		details.Hide()
+
+		stats := container.NewWithoutLayout()
+		stats.Hide()
+
+		objects := []fyne.CanvasObject{
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			actions,
+			details,
+			container.NewWithoutLayout(),
+			stats,
+		}
+
+		l.Layout(objects, fyne.NewSize(900, 600))
+
+		if err7 := checkPosAndSize(objects[7], 40, 856); err7 != nil {
+			t.Errorf("object 7: %v", err7)
+		}
+	})
+
+	t.Run("valid number of objects with stats label", func(t *testing.T) {
+		l := &transferLayout{}
+
+		details := container.NewWithoutLayout()
+		details.Hide()
+
+		dismiss := container.NewWithoutLayout()
+		dismiss.Hide()
+
+		objects := []fyne.CanvasObject{
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(),
+			container.NewWithoutLayout(
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+				container.NewWithoutLayout(),
+			),
+			details,
+			dismiss,
+			container.NewWithoutLayout(),
+		}
+
+		l.Layout(objects, fyne.NewSize(900, 600))
+
+		if err1 := checkPosAndSize(objects[1], 179.75, 33); err1 != nil {
+			t.Errorf("object 1: %v", err1)
+		}
+
+		if err8 := checkPosAndSize(objects[8], 183.75, 216.75); err8 != nil {
+			t.Errorf("object 8: %v", err8)
+		}
+	})
 }
 
 func checkPosAndSize(obj fyne.CanvasObject, width, posX float32) error {
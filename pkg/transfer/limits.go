@@ -0,0 +1,153 @@
+package transfer
+
+import (
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+)
+
+// RateOptions are the bandwidth limits the user can choose, in bytes per
+// second, 0 means unlimited.
+var RateOptions = []int64{0, 100e3, 500e3, 1e6, 5e6, 10e6, 50e6}
+
+// OnLimitsChange is a function that is executed everytime a limit changes,
+// the peer is empty for the global limit.
+type OnLimitsChange func(peer string, rate int64)
+
+// Limits are the bandwidth limits of the transfers in bytes per second, 0
+// means unlimited.
+//
+// The global limit is shared by all the transfers and the limit of each
+// peer is shared by the transfers with that peer, a transfer is limited by
+// both. The limits can change while the transfers are running.
+type Limits struct {
+	OnLimitsChange
+	mu     sync.Mutex
+	global *file.Limiter
+	peers  map[string]*file.Limiter
+}
+
+// NewLimits will create the Limits without any limit.
+func NewLimits() *Limits {
+	return &Limits{
+		global: file.NewLimiter(0),
+		peers:  make(map[string]*file.Limiter),
+	}
+}
+
+// Global returns the global limit.
+func (l *Limits) Global() int64 {
+	return l.global.Rate()
+}
+
+// SetGlobal will change the global limit.
+func (l *Limits) SetGlobal(rate int64) {
+	l.global.SetRate(rate)
+	if l.OnLimitsChange != nil {
+		l.OnLimitsChange("", rate)
+	}
+}
+
+// Peer returns the limit of the peer.
+func (l *Limits) Peer(name string) int64 {
+	return l.peer(name).Rate()
+}
+
+// SetPeer will change the limit of the peer.
+func (l *Limits) SetPeer(name string, rate int64) {
+	l.peer(name).SetRate(rate)
+	if l.OnLimitsChange != nil {
+		l.OnLimitsChange(name, rate)
+	}
+}
+
+// Peers returns the limit of each peer that is limited.
+func (l *Limits) Peers() map[string]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rates := make(map[string]int64, len(l.peers))
+	for name, lim := range l.peers {
+		if rate := lim.Rate(); rate > 0 {
+			rates[name] = rate
+		}
+	}
+	return rates
+}
+
+// peer returns the limiter of the peer, it's created if it doesn't exist
+// so the transfers running get the changes made later.
+func (l *Limits) peer(name string) *file.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lim, ok := l.peers[name]
+	if !ok {
+		lim = file.NewLimiter(0)
+		l.peers[name] = lim
+	}
+	return lim
+}
+
+// limiters returns the limiters of a transfer with the peer.
+func (l *Limits) limiters(peer string) []*file.Limiter {
+	if l == nil {
+		return nil
+	}
+	return []*file.Limiter{l.global, l.peer(peer)}
+}
+
+// FormatRate will convert a limit into a string representation.
+func FormatRate(rate int64) string {
+	if rate <= 0 {
+		return "Unlimited"
+	}
+	return byteCountSI(rate) + "/s"
+}
+
+// NewLimitSelect creates a select with the RateOptions starting with the
+// rate selected, onChange is executed when the user selects another rate.
+func NewLimitSelect(rate int64, onChange func(rate int64)) *widget.Select {
+	options := make([]string, 0, len(RateOptions))
+	rates := make(map[string]int64, len(RateOptions))
+	for _, r := range RateOptions {
+		options = append(options, FormatRate(r))
+		rates[FormatRate(r)] = r
+	}
+
+	s := widget.NewSelect(options, nil)
+	s.SetSelected(FormatRate(rate))
+	s.OnChanged = func(selected string) {
+		onChange(rates[selected])
+	}
+	return s
+}
+
+// NewLimitsBar creates the bar that shows and changes the global limit.
+func NewLimitsBar(limits *Limits) fyne.CanvasObject {
+	return container.NewHBox(
+		widget.NewLabel("Bandwidth limit"),
+		NewLimitSelect(limits.Global(), limits.SetGlobal),
+	)
+}
+
+// ShowLimitDialog will show a dialog where the user selects the limit of
+// the peer, onSelect is executed if the user confirms.
+func ShowLimitDialog(peer string, rate int64, onSelect func(rate int64), parent fyne.Window) {
+	selected := rate
+	items := []*widget.FormItem{
+		widget.NewFormItem("Limit", NewLimitSelect(rate, func(r int64) {
+			selected = r
+		})),
+	}
+
+	dialog.ShowForm("Bandwidth limit of "+peer, "Save", "Cancel", items, func(ok bool) {
+		if ok {
+			onSelect(selected)
+		}
+	}, parent)
+}
@@ -0,0 +1,71 @@
+package transfer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Limits(t *testing.T) {
+	t.Run("change the limit of a running transfer", func(t *testing.T) {
+		l := NewLimits()
+		lim := l.limiters("peer-1")
+
+		l.SetGlobal(1e6)
+		l.SetPeer("peer-1", 500e3)
+
+		if lim[0].Rate() != 1e6 {
+			t.Errorf("SetGlobal expected rate = %v but got = %v", 1e6, lim[0].Rate())
+		}
+
+		if lim[1].Rate() != 500e3 {
+			t.Errorf("SetPeer expected rate = %v but got = %v", 500e3, lim[1].Rate())
+		}
+	})
+
+	t.Run("limited peers", func(t *testing.T) {
+		l := NewLimits()
+		l.SetPeer("peer-1", 500e3)
+		l.SetPeer("peer-2", 0)
+
+		want := map[string]int64{"peer-1": 500e3}
+		if got := l.Peers(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Peers expected = %v but got = %v", want, got)
+		}
+
+		if l.Peer("peer-3") != 0 {
+			t.Errorf("Peer expected = %v but got = %v", 0, l.Peer("peer-3"))
+		}
+	})
+
+	t.Run("notify changes", func(t *testing.T) {
+		l := NewLimits()
+
+		var peers []string
+		l.OnLimitsChange = func(peer string, rate int64) {
+			peers = append(peers, peer)
+		}
+
+		l.SetGlobal(1e6)
+		l.SetPeer("peer-1", 1e6)
+
+		if want := []string{"", "peer-1"}; !reflect.DeepEqual(peers, want) {
+			t.Errorf("OnLimitsChange expected = %v but got = %v", want, peers)
+		}
+	})
+}
+
+func Test_FormatRate(t *testing.T) {
+	tests := []struct {
+		rate int64
+		want string
+	}{
+		{rate: 0, want: "Unlimited"},
+		{rate: 500e3, want: "500.0 KB/s"},
+		{rate: 10e6, want: "10.0 MB/s"},
+	}
+	for _, tt := range tests {
+		if got := FormatRate(tt.rate); got != tt.want {
+			t.Errorf("FormatRate expected = %v but got = %v", tt.want, got)
+		}
+	}
+}
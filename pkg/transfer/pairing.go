@@ -0,0 +1,195 @@
+package transfer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/pake"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer/internal/protocol"
+)
+
+// Time to wait for the pairing to complete, it includes the time the user
+// takes to type the code on the other peer.
+const pairTimeout = 120 //seconds
+
+// ErrPairRejected signals that the peer rejected or cancelled the pairing.
+var ErrPairRejected = errors.New(`PAIRING REJECTED`)
+
+// PairRequest is a function that asks the user for the code shown on the
+// peer that wants to pair, ok is false if the user cancelled.
+type PairRequest func(name string, addr net.Addr) (code string, ok bool)
+
+// PairDone is a function called when a pairing started by a peer ends, the
+// fingerprint is the one confirmed by the code if err is nil.
+type PairDone func(name string, addr net.Addr, fingerprint string, err error)
+
+// Pair will start a pairing with the peer on the address using the code that
+// is shown to the user to be typed on the peer.
+//
+// Both sides run a password-authenticated key exchange using the code and
+// the fingerprints of the TLS certificates, so the pairing only succeeds if
+// the peer knows the code and the TLS connection is not intercepted.
+//
+// The addresses on the networks of the ifaces, all the interfaces if nil,
+// are tried first.
+//
+// If there is an error, it can be because the peer doesn't support pairing,
+// the peer rejected it, the code doesn't match or a connection error.
+func Pair(ctx context.Context, addr net.Addr, name, code string, id *identity.Identity, ifaces []net.Interface) (string, error) {
+	if id == nil {
+		return "", fmt.Errorf("pairing pair error: identity is nil")
+	}
+
+	conn, err := dial(addr, false, id, "", ifaces)
+	if err != nil {
+		return "", err
+	}
+	defer closeConn(conn)
+
+	tc, ok := conn.Conn.(*tls.Conn)
+	if !ok || !conn.proto.Has(protocol.CapPair) {
+		return "", fmt.Errorf("pairing pair error: peer doesn't support pairing")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeConn(conn)
+		case <-stop:
+		}
+	}()
+
+	if err = conn.SetDeadline(time.Now().Add(pairTimeout * time.Second)); err != nil {
+		return "", fmt.Errorf("pairing pair set timeout error: %v", err)
+	}
+
+	fingerprint := identity.PeerFingerprint(tc.ConnectionState())
+	ex, err := pake.New(pake.RoleA, []byte(pake.NormalizeCode(code)), []byte(id.Fingerprint()), []byte(fingerprint))
+	if err != nil {
+		return "", err
+	}
+
+	if err = conn.proto.WritePair(protocol.PairMessage{Name: name, Share: ex.Share()}); err != nil {
+		return "", pairError(ctx, err)
+	}
+
+	answer, err := conn.proto.ReadPair()
+	if err != nil {
+		return "", pairError(ctx, err)
+	}
+	if !answer.Accept {
+		return "", ErrPairRejected
+	}
+
+	if err = ex.Finish(answer.Share); err != nil {
+		return "", err
+	}
+	if err = ex.Verify(answer.Confirm); err != nil {
+		return "", err
+	}
+
+	if err = conn.proto.WritePair(protocol.PairMessage{Accept: true, Confirm: ex.Confirmation()}); err != nil {
+		return "", pairError(ctx, err)
+	}
+
+	ack, err := conn.proto.ReadPair()
+	if err != nil {
+		return "", pairError(ctx, err)
+	}
+	if !ack.Accept {
+		return "", pake.ErrConfirmation
+	}
+
+	return fingerprint, nil
+}
+
+// pairError returns the context error if the pairing was cancelled,
+// otherwise the error.
+func pairError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ErrPairRejected
+	}
+	return err
+}
+
+// handlePair will answer the pairing started by the sender, asking the user
+// for the code shown on the sender.
+func (rv *Receiver) handlePair(conn net.Conn, pc *protocol.Conn, fingerprint string) {
+	if err := conn.SetDeadline(time.Now().Add(pairTimeout * time.Second)); err != nil {
+		clog.Error(err)
+		return
+	}
+
+	req, err := pc.ReadPair()
+	if err != nil {
+		clog.Error(err)
+		return
+	}
+
+	fp, err := rv.pair(conn.RemoteAddr(), pc, req, fingerprint)
+	if rv.PairDone != nil {
+		rv.PairDone(req.Name, conn.RemoteAddr(), fp, err)
+	}
+	if err != nil {
+		clog.Error(err)
+	}
+}
+
+// pair will run the receiver side of the key exchange and return the
+// fingerprint of the sender if the codes match.
+func (rv *Receiver) pair(addr net.Addr, pc *protocol.Conn, req protocol.PairMessage, fingerprint string) (string, error) {
+	reject := func() error {
+		if err := pc.WritePair(protocol.PairMessage{}); err != nil {
+			return err
+		}
+		return ErrPairRejected
+	}
+
+	if fingerprint == "" || rv.PairRequest == nil {
+		return "", reject()
+	}
+
+	code, ok := rv.PairRequest(req.Name, addr)
+	if !ok {
+		return "", reject()
+	}
+
+	ex, err := pake.New(pake.RoleB, []byte(pake.NormalizeCode(code)), []byte(fingerprint), []byte(rv.id.Fingerprint()))
+	if err != nil {
+		return "", err
+	}
+
+	if err = ex.Finish(req.Share); err != nil {
+		return "", err
+	}
+
+	answer := protocol.PairMessage{Accept: true, Share: ex.Share(), Confirm: ex.Confirmation()}
+	if err = pc.WritePair(answer); err != nil {
+		return "", err
+	}
+
+	confirm, err := pc.ReadPair()
+	if err != nil {
+		return "", err
+	}
+
+	if err = ex.Verify(confirm.Confirm); err != nil {
+		if wErr := pc.WritePair(protocol.PairMessage{}); wErr != nil {
+			clog.Error(wErr)
+		}
+		return "", err
+	}
+
+	if err = pc.WritePair(protocol.PairMessage{Accept: true}); err != nil {
+		return "", err
+	}
+	return fingerprint, nil
+}
@@ -0,0 +1,93 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+	"github.com/fabiodcorreia/catch-my-file/pkg/pake"
+)
+
+// pairResult is the result of the pairing on the receiver side.
+type pairResult struct {
+	name        string
+	fingerprint string
+	err         error
+}
+
+// pairWithReceiver will start a receiver on the port that answers the
+// pairing with the typed code, if ok is false the user cancels.
+func pairWithReceiver(t *testing.T, port int, code, typed string, ok bool) (string, pairResult, *identity.Identity, *identity.Identity, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sID, _ := identity.New()
+	rID, _ := identity.New()
+
+	done := make(chan pairResult, 1)
+	rv := NewReceiver(port, NewStore(), rID)
+	rv.PairRequest = func(name string, addr net.Addr) (string, bool) {
+		return typed, ok
+	}
+	rv.PairDone = func(name string, addr net.Addr, fingerprint string, err error) {
+		done <- pairResult{name: name, fingerprint: fingerprint, err: err}
+	}
+	if err := rv.Run(ctx, make(chan interface{})); err != nil {
+		t.Fatalf("receiver run not expected error = %v", err)
+	}
+
+	addr, _ := net.ResolveTCPAddr(network.Type, fmt.Sprintf("localhost:%d", port))
+	fp, err := Pair(ctx, addr, "sender", code, sID, nil)
+	return fp, <-done, sID, rID, err
+}
+
+func Test_Pair(t *testing.T) {
+	t.Run("pair with the same code", func(t *testing.T) {
+		fp, res, sID, rID, err := pairWithReceiver(t, 9941, "123456", "123-456", true)
+		if err != nil {
+			t.Fatalf("Pair not expected error = %v", err)
+		}
+
+		if fp != rID.Fingerprint() {
+			t.Errorf("Pair expected fingerprint = %v but got = %v", rID.Fingerprint(), fp)
+		}
+
+		if res.err != nil {
+			t.Errorf("PairDone not expected error = %v", res.err)
+		}
+
+		if res.fingerprint != sID.Fingerprint() {
+			t.Errorf("PairDone expected fingerprint = %v but got = %v", sID.Fingerprint(), res.fingerprint)
+		}
+
+		if res.name != "sender" {
+			t.Errorf("PairDone expected name = %v but got = %v", "sender", res.name)
+		}
+	})
+
+	t.Run("pair with a different code", func(t *testing.T) {
+		_, res, _, _, err := pairWithReceiver(t, 9942, "123456", "654321", true)
+		if !errors.Is(err, pake.ErrConfirmation) {
+			t.Errorf("Pair expected error = %v but got = %v", pake.ErrConfirmation, err)
+		}
+
+		if res.err == nil {
+			t.Errorf("PairDone expected error but got = %v", res.err)
+		}
+	})
+
+	t.Run("pair cancelled by the receiver", func(t *testing.T) {
+		_, res, _, _, err := pairWithReceiver(t, 9943, "123456", "", false)
+		if !errors.Is(err, ErrPairRejected) {
+			t.Errorf("Pair expected error = %v but got = %v", ErrPairRejected, err)
+		}
+
+		if !errors.Is(res.err, ErrPairRejected) {
+			t.Errorf("PairDone expected error = %v but got = %v", ErrPairRejected, res.err)
+		}
+	})
+}
@@ -0,0 +1,346 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer/internal/protocol"
+)
+
+const (
+	// Number of times the sender tries to reconnect a paused transfer.
+	reconnectAttempts = 12
+	// Time to wait before each reconnect attempt.
+	reconnectDelay = 5 //seconds
+)
+
+// DefaultDetachTimeout is the time a paused transfer that lost the
+// connection waits for the sender to reconnect, twice the time the sender
+// keeps trying.
+const DefaultDetachTimeout = 2 * reconnectAttempts * reconnectDelay * time.Second
+
+// ErrNotReconnected signals that the sender of a paused transfer that lost
+// the connection didn't reconnect before the DetachTimeout.
+var ErrNotReconnected = errors.New("receiver detach error: sender didn't reconnect")
+
+// ErrConnectionLost signals that the connection of a paused transfer was
+// lost, the transfer can continue with Reconnect.
+var ErrConnectionLost = errors.New(`CONNECTION LOST`)
+
+// pauseGate holds the data of a transfer while it's paused by one of the
+// peers, once the transfer ends it can't be paused anymore.
+type pauseGate struct {
+	mu      sync.Mutex
+	paused  bool
+	stopped bool
+	resumed chan struct{} // resumed is closed when the transfer is resumed.
+}
+
+// newPauseGate will create a pauseGate that starts paused or not.
+func newPauseGate(paused bool) *pauseGate {
+	g := &pauseGate{resumed: make(chan struct{})}
+	g.set(paused)
+	return g
+}
+
+// set will pause or resume the gate and return true if it changed.
+func (g *pauseGate) set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stopped || g.paused == paused {
+		return false
+	}
+
+	g.paused = paused
+	if paused {
+		g.resumed = make(chan struct{})
+	} else {
+		close(g.resumed)
+	}
+	return true
+}
+
+// isPaused returns true if the gate is paused.
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// stop will prevent the gate from changing, it's called once all the data
+// is transferred.
+func (g *pauseGate) stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.stopped = true
+}
+
+// wait will block while the gate is paused or until the context is cancelled.
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	resumed := g.resumed
+	paused := g.paused
+	g.mu.Unlock()
+
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pausedWriter is an io.Writer that waits for the gate before each write,
+// it holds the stream loop while the transfer is paused.
+type pausedWriter struct {
+	ctx  context.Context
+	gate *pauseGate
+	w    io.Writer
+}
+
+// Write will wait while the gate is paused and write p to the output.
+func (w *pausedWriter) Write(p []byte) (int, error) {
+	if err := w.gate.wait(w.ctx); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// watchPause will create the pause gate of the transfer with the id
+// and connect it to the store and to the peer, a pause or resume made on
+// one side is sent to the other side. The returned function must be called
+// once all the data is transferred.
+//
+// If the peer doesn't support pause the gate is never paused.
+func watchPause(id string, pc *protocol.Conn, store *TransferStore, paused bool) (*pauseGate, func()) {
+	if !pc.Has(protocol.CapPause) {
+		return newPauseGate(false), func() {}
+	}
+
+	gate := newPauseGate(paused)
+	pc.OnPause = func(paused bool) {
+		if gate.set(paused) {
+			setPaused(id, store, paused)
+		}
+	}
+
+	store.SetPause(id, func(paused bool) {
+		if !gate.set(paused) {
+			return
+		}
+		if err := pc.WritePause(paused); err != nil {
+			clog.Error(err)
+		}
+		setPaused(id, store, paused)
+	})
+
+	if paused {
+		if err := pc.WritePause(true); err != nil {
+			clog.Error(err)
+		}
+	}
+
+	var once sync.Once
+	return gate, func() {
+		once.Do(func() {
+			gate.stop()
+			store.SetPause(id, nil)
+		})
+	}
+}
+
+// setPaused will update the status of the transfer with the id to
+// Paused or back to Accepted, only transfers running are updated.
+func setPaused(id string, store *TransferStore, paused bool) {
+	t := store.Get(id)
+	switch {
+	case t == nil:
+		return
+	case paused && t.Status == Accepted:
+		t.Status = Paused
+	case !paused && t.Status == Paused:
+		t.Status = Accepted
+	default:
+		return
+	}
+	store.Update(id, t)
+}
+
+// Reconnect will send again the request of a paused transfer after its
+// connection was lost, the receiver continues the transfer from the data
+// already received. The connection returned is used on WaitConfirmation.
+//
+// Only single file transfers can be reconnected, it's tried up to
+// reconnectAttempts times. If the context is cancelled ErrCancelled is
+// returned.
+func Reconnect(ctx context.Context, t *Transfer, id *identity.Identity) (*Conn, error) {
+	if t.HasFiles() {
+		return nil, fmt.Errorf("sender reconnect error: only single files can be reconnected")
+	}
+
+	t.reconnect = true
+
+	var err error
+	for attempt := 1; attempt <= reconnectAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, ErrCancelled
+		case <-time.After(reconnectDelay * time.Second):
+		}
+
+		var conn *Conn
+		conn, err = SendTransferReq(ctx, t, id)
+		if err == nil {
+			return conn, nil
+		}
+		clog.Info("reconnect attempt %d to %v failed: %v", attempt, t.SenderAddr, err)
+	}
+	return nil, fmt.Errorf("sender reconnect error: %v", err)
+}
+
+// detachedKey identifies a paused transfer that lost the connection, the
+// sender must present the same certificate or use the same address if the
+// connection doesn't use TLS.
+type detachedKey struct {
+	peer     string
+	name     string
+	checksum string
+	size     int64
+}
+
+// newDetachedKey will create the key of the single file download t.
+func newDetachedKey(t *Transfer) detachedKey {
+	peer := t.PeerFingerprint
+	if peer == "" {
+		peer = addrHost(t.SenderAddr)
+	}
+	return detachedKey{
+		peer:     peer,
+		name:     t.FileName,
+		checksum: t.FileChecksum,
+		size:     t.FileSize,
+	}
+}
+
+// addrHost returns the host of the address without the port.
+func addrHost(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// detached is a paused transfer that lost the connection, cancel stops
+// watching the cancel of the user.
+type detached struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+// detach will keep the paused transfer with the id that lost the
+// connection waiting for the sender to reconnect, the partial file is kept
+// and the transfer can still be resumed, paused or cancelled by the user.
+//
+// If the sender doesn't reconnect before the DetachTimeout the transfer
+// ends with ErrNotReconnected and the partial file is removed.
+func (rv *Receiver) detach(ctx context.Context, id string, t *Transfer) {
+	key := newDetachedKey(t)
+	dctx, cancel := rv.store.WithCancel(ctx, id)
+	timeout := time.NewTimer(rv.DetachTimeout)
+
+	rv.mu.Lock()
+	if rv.detached == nil {
+		rv.detached = make(map[detachedKey]detached)
+	}
+	rv.detached[key] = detached{id: id, cancel: cancel}
+	rv.mu.Unlock()
+
+	rv.store.SetPause(id, func(paused bool) {
+		setPaused(id, rv.store, paused)
+	})
+
+	clog.Info("transfer %s lost the connection while paused, waiting for the sender", id)
+
+	go func() {
+		defer timeout.Stop()
+
+		expired := false
+		select {
+		case <-dctx.Done():
+		case <-timeout.C:
+			expired = true
+		}
+
+		// The transfer was reattached or the receiver is stopping.
+		if _, ok := rv.forget(key, id); !ok || ctx.Err() != nil {
+			return
+		}
+
+		removePartial(t.LocalFilePath)
+		if expired {
+			clog.Info("transfer %s sender didn't reconnect", id)
+			cancel()
+			t.SetError(ErrNotReconnected)
+		} else {
+			t.Status = Cancelled
+		}
+		rv.store.SetPause(id, nil)
+		rv.store.Update(id, t)
+	}()
+}
+
+// reattach will return the id of the detached transfer that matches
+// the request of the reconnecting sender, ok is false if there is none.
+func (rv *Receiver) reattach(pc *protocol.Conn, t *Transfer) (string, bool) {
+	if !t.reconnect || t.HasFiles() || t.Untrusted || !pc.Has(protocol.CapPause) {
+		return "", false
+	}
+
+	key := newDetachedKey(t)
+
+	rv.mu.Lock()
+	d, ok := rv.detached[key]
+	rv.mu.Unlock()
+
+	if !ok {
+		return "", false
+	}
+
+	if d, ok = rv.forget(key, d.id); !ok {
+		return "", false
+	}
+
+	rv.store.SetPause(d.id, nil)
+	d.cancel()
+	return d.id, true
+}
+
+// forget will remove the detached transfer with the id and return it,
+// ok is false if it's not detached anymore.
+func (rv *Receiver) forget(key detachedKey, id string) (detached, bool) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	d, ok := rv.detached[key]
+	if !ok || d.id != id {
+		return d, false
+	}
+	delete(rv.detached, key)
+	return d, true
+}
@@ -0,0 +1,202 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+)
+
+func Test_pauseGate(t *testing.T) {
+	t.Run("wait while paused", func(t *testing.T) {
+		g := newPauseGate(true)
+
+		done := make(chan error)
+		go func() {
+			done <- g.wait(context.Background())
+		}()
+
+		select {
+		case <-done:
+			t.Fatalf("wait expected to block while paused")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if !g.set(false) {
+			t.Errorf("set expected gate changed")
+		}
+
+		if err := <-done; err != nil {
+			t.Errorf("wait not expected error = %v", err)
+		}
+	})
+
+	t.Run("wait cancelled", func(t *testing.T) {
+		g := newPauseGate(true)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := g.wait(ctx); err == nil {
+			t.Errorf("wait expected error = %v", err)
+		}
+	})
+
+	t.Run("set the same state", func(t *testing.T) {
+		g := newPauseGate(false)
+
+		if g.set(false) {
+			t.Errorf("set expected gate not changed")
+		}
+
+		if !g.set(true) || !g.isPaused() {
+			t.Errorf("set expected gate paused")
+		}
+	})
+
+	t.Run("set after stop", func(t *testing.T) {
+		g := newPauseGate(false)
+		g.stop()
+
+		if g.set(true) || g.isPaused() {
+			t.Errorf("set expected gate not paused after stop")
+		}
+	})
+}
+
+func Test_pausedWriter(t *testing.T) {
+	t.Run("write after resume", func(t *testing.T) {
+		g := newPauseGate(true)
+
+		var buf bytes.Buffer
+		w := &pausedWriter{ctx: context.Background(), gate: g, w: &buf}
+
+		time.AfterFunc(20*time.Millisecond, func() { g.set(false) })
+
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatalf("Write not expected error = %v", err)
+		}
+
+		if buf.String() != "hello" {
+			t.Errorf("Write expected = %v but got = %v", "hello", buf.String())
+		}
+	})
+}
+
+func Test_setPaused(t *testing.T) {
+	tests := []struct {
+		name   string
+		status Status
+		paused bool
+		want   Status
+	}{
+		{"running transfer paused", Accepted, true, Paused},
+		{"paused transfer resumed", Paused, false, Accepted},
+		{"waiting transfer not paused", Waiting, true, Waiting},
+		{"cancelled transfer not resumed", Cancelled, false, Cancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			tr := NewTransfer("a.txt", "abc", "peer-1", 1, nil, Download)
+			tr.Status = tt.status
+			id := store.Add(tr)
+
+			setPaused(id, store, tt.paused)
+
+			if got := store.Get(id).Status; got != tt.want {
+				t.Errorf("setPaused expected status = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("transfer removed", func(t *testing.T) {
+		store := NewStore()
+		tr := NewTransfer("a.txt", "abc", "peer-1", 1, nil, Download)
+		tr.Status = Cancelled
+		id := store.Add(tr)
+		if err := store.Remove(id); err != nil {
+			t.Fatalf("Remove not expected error = %v", err)
+		}
+
+		setPaused(id, store, true)
+
+		if store.Size() != 0 {
+			t.Errorf("setPaused expected no transfer but got = %v", store.List())
+		}
+	})
+}
+
+func Test_newDetachedKey(t *testing.T) {
+	t.Run("key by fingerprint", func(t *testing.T) {
+		a := NewTransfer("a.txt", "abc", "peer-1", 1, nil, Download)
+		a.PeerFingerprint = "fp"
+		b := NewTransfer("a.txt", "abc", "peer-1", 1, nil, Download)
+		b.PeerFingerprint = "other"
+
+		if newDetachedKey(a) == newDetachedKey(b) {
+			t.Errorf("newDetachedKey expected different keys for different fingerprints")
+		}
+	})
+
+	t.Run("key by address without fingerprint", func(t *testing.T) {
+		a := NewTransfer("a.txt", "abc", "peer-1", 1, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}, Download)
+		b := NewTransfer("a.txt", "abc", "peer-1", 1, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 2000}, Download)
+
+		if newDetachedKey(a) != newDetachedKey(b) {
+			t.Errorf("newDetachedKey expected the same key for the same host")
+		}
+	})
+}
+
+func Test_Receiver_detach(t *testing.T) {
+	// detached will add a paused download with a partial file to the store
+	// of the receiver and detach it.
+	detached := func(t *testing.T, ctx context.Context, rv *Receiver) (string, string) {
+		tr := NewTransfer("a.txt", "abc", "peer-1", 10, nil, Download)
+		tr.LocalFilePath = filepath.Join(t.TempDir(), "a.txt")
+		tr.Status = Paused
+		part := file.PartialPath(tr.LocalFilePath)
+		if err := os.WriteFile(part, []byte("hello"), 0600); err != nil {
+			t.Fatalf("WriteFile not expected error = %v", err)
+		}
+
+		id := rv.store.Add(tr)
+		rv.detach(ctx, id, rv.store.Get(id))
+		return id, part
+	}
+
+	t.Run("sender doesn't reconnect", func(t *testing.T) {
+		rv := NewReceiver(0, NewStore(), nil)
+		rv.DetachTimeout = 100 * time.Millisecond
+
+		id, part := detached(t, context.Background(), rv)
+		time.Sleep(500 * time.Millisecond)
+
+		if tr := rv.store.Get(id); tr.Status != Error || !errors.Is(tr.Error(), ErrNotReconnected) {
+			t.Errorf("detach expected status %v but got = %v (%v)", Error, tr.Status, tr.Error())
+		}
+
+		if _, err := os.Stat(part); !os.IsNotExist(err) {
+			t.Errorf("detach expected partial file removed but got = %v", err)
+		}
+	})
+
+	t.Run("cancelled by the user", func(t *testing.T) {
+		rv := NewReceiver(0, NewStore(), nil)
+
+		id, _ := detached(t, context.Background(), rv)
+		rv.store.Cancel(id)
+		time.Sleep(200 * time.Millisecond)
+
+		if tr := rv.store.Get(id); tr.Status != Cancelled {
+			t.Errorf("detach expected status %v but got = %v", Cancelled, tr.Status)
+		}
+	})
+}
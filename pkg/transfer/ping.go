@@ -0,0 +1,84 @@
+package transfer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer/internal/protocol"
+)
+
+// Time to wait for the peer to answer the ping.
+const pingTimeout = 5 //seconds
+
+// Ping will check if there is a peer receiving transfers on the address and
+// return its name and the fingerprint of its certificate, the fingerprint is
+// empty if the connection doesn't use TLS. The addresses on the networks of
+// the ifaces, all the interfaces if nil, are tried first.
+//
+// If there is an error, it can be because there is nothing listening on the
+// address, the peer doesn't support ping or a connection error.
+func Ping(ctx context.Context, addr net.Addr, name string, id *identity.Identity, ifaces []net.Interface) (string, string, error) {
+	conn, err := dial(addr, false, id, "", ifaces)
+	if err != nil {
+		return "", "", err
+	}
+	defer closeConn(conn)
+
+	if !conn.proto.Has(protocol.CapPing) {
+		return "", "", fmt.Errorf("ping error: peer doesn't support ping")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeConn(conn)
+		case <-stop:
+		}
+	}()
+
+	if err = conn.SetDeadline(time.Now().Add(pingTimeout * time.Second)); err != nil {
+		return "", "", fmt.Errorf("ping set timeout error: %v", err)
+	}
+
+	if err = conn.proto.WritePing(protocol.PingMessage{Name: name}); err != nil {
+		return "", "", err
+	}
+
+	answer, err := conn.proto.ReadPing()
+	if err != nil {
+		return "", "", err
+	}
+
+	var fingerprint string
+	if tc, ok := conn.Conn.(*tls.Conn); ok {
+		fingerprint = identity.PeerFingerprint(tc.ConnectionState())
+	}
+	return answer.Name, fingerprint, nil
+}
+
+// handlePing will answer the ping sent by the sender with the name of the
+// local peer.
+func (rv *Receiver) handlePing(conn net.Conn, pc *protocol.Conn) {
+	if err := conn.SetDeadline(time.Now().Add(pingTimeout * time.Second)); err != nil {
+		clog.Error(err)
+		return
+	}
+
+	req, err := pc.ReadPing()
+	if err != nil {
+		clog.Error(err)
+		return
+	}
+
+	clog.Info("ping from %s on %v", req.Name, conn.RemoteAddr())
+	if err = pc.WritePing(protocol.PingMessage{Name: rv.name}); err != nil {
+		clog.Error(err)
+	}
+}
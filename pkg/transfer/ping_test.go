@@ -0,0 +1,67 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
+	"github.com/fabiodcorreia/catch-my-file/pkg/network"
+)
+
+func Test_Ping(t *testing.T) {
+	t.Run("ping the receiver", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sID, _ := identity.New()
+		rID, _ := identity.New()
+
+		rv := NewReceiver(9949, NewStore(), rID)
+		rv.name = "receiver"
+		if err := rv.Run(ctx, make(chan interface{})); err != nil {
+			t.Fatalf("receiver run not expected error = %v", err)
+		}
+
+		addr, _ := net.ResolveTCPAddr(network.Type, "localhost:9949")
+		name, fp, err := Ping(ctx, addr, "sender", sID, nil)
+		if err != nil {
+			t.Fatalf("Ping not expected error = %v", err)
+		}
+
+		if name != "receiver" {
+			t.Errorf("Ping expected name = %v but got = %v", "receiver", name)
+		}
+
+		if fp != rID.Fingerprint() {
+			t.Errorf("Ping expected fingerprint = %v but got = %v", rID.Fingerprint(), fp)
+		}
+	})
+
+	t.Run("ping the receiver on one of the addresses", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rv := NewReceiver(9951, NewStore(), nil)
+		rv.name = "receiver"
+		if err := rv.Run(ctx, make(chan interface{})); err != nil {
+			t.Fatalf("receiver run not expected error = %v", err)
+		}
+
+		addrs := network.Addrs{
+			{IP: net.ParseIP("127.0.0.1"), Port: 9952},
+			{IP: net.ParseIP("127.0.0.1"), Port: 9951},
+		}
+		if name, _, err := Ping(ctx, addrs, "sender", nil, nil); err != nil || name != "receiver" {
+			t.Errorf("Ping expected name = %v but got = %v (%v)", "receiver", name, err)
+		}
+	})
+
+	t.Run("nothing listening on the address", func(t *testing.T) {
+		addr, _ := net.ResolveTCPAddr(network.Type, fmt.Sprintf("localhost:%d", 9950))
+		if _, _, err := Ping(context.Background(), addr, "sender", nil, nil); err == nil {
+			t.Errorf("Ping expected error but got = %v", err)
+		}
+	})
+}
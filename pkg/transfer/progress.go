@@ -0,0 +1,170 @@
+package transfer
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultProgressInterval is the minimum interval between the progress sent
+// to the subscribers of a transfer, the updates in between are merged.
+const DefaultProgressInterval = 200 * time.Millisecond
+
+// Time the rate takes to follow a change of the throughput, the rate is an
+// exponential moving average of the throughput between the updates.
+const rateSmoothing = 2 * time.Second
+
+// Progress is the progress of a transfer at a moment.
+type Progress struct {
+	Fraction    float64       // Fraction of the data transferred, from 0 to 1.
+	Transferred int64         // Transferred is the number of bytes transferred.
+	Size        int64         // Size is the number of bytes to transfer.
+	Rate        float64       // Rate is the current throughput in bytes per second.
+	ETA         time.Duration // ETA is the time left at the current rate, 0 if unknown.
+	Elapsed     time.Duration // Elapsed is the time spent transferring, without the pauses.
+	Average     float64       // Average is the throughput of the Elapsed time in bytes per second.
+}
+
+// progressFeed sends the progress of a transfer to its subscribers.
+//
+// Each subscriber has a channel that only holds the last progress, so a
+// subscriber that is not reading never blocks the transfer.
+type progressFeed struct {
+	subs    map[chan Progress]struct{}
+	sampled time.Time   // Time of the last progress used on the rate.
+	counted float64     // Bytes transferred during the Elapsed time.
+	sent    time.Time   // Time of the last progress sent.
+	pending bool        // Pending is true if the last progress wasn't sent.
+	flush   *time.Timer // Flush sends the pending progress after the interval.
+	closed  bool        // Closed is true after the transfer ends.
+}
+
+// The methods below access the progress of the transfer and must be called
+// with the lock of the store held.
+
+// progressFeed will create and return the feed of the transfer.
+func (t *Transfer) progressFeed() *progressFeed {
+	if t.feed == nil {
+		t.feed = &progressFeed{subs: make(map[chan Progress]struct{})}
+	}
+	return t.feed
+}
+
+// subscribe returns a new channel that receives the progress of the
+// transfer, the last progress is sent right away if there is one.
+//
+// If the transfer already ended the channel returned is closed.
+func (t *Transfer) subscribe() chan Progress {
+	sub := make(chan Progress, 1)
+	if t.Status.IsFinal() || (t.feed != nil && t.feed.closed) {
+		close(sub)
+		return sub
+	}
+
+	t.progressFeed().subs[sub] = struct{}{}
+	if t.prog.Size > 0 {
+		sub <- t.prog
+	}
+	return sub
+}
+
+// unsubscribe will stop sending the progress to the channel and close it.
+func (t *Transfer) unsubscribe(sub chan Progress) {
+	if t.feed == nil {
+		return
+	}
+
+	if _, ok := t.feed.subs[sub]; ok {
+		delete(t.feed.subs, sub)
+		close(sub)
+	}
+}
+
+// setProgress will set the bytes transferred out of the size at the time
+// now and update the rate and the ETA.
+func (t *Transfer) setProgress(transferred, size int64, now time.Time) {
+	f := t.progressFeed()
+
+	p := Progress{
+		Transferred: transferred,
+		Size:        size,
+		Rate:        t.prog.Rate,
+		Elapsed:     t.prog.Elapsed,
+		Average:     t.prog.Average,
+	}
+	if size > 0 {
+		p.Fraction = float64(transferred) / float64(size)
+	}
+
+	if dt := now.Sub(f.sampled); !f.sampled.IsZero() && dt > 0 {
+		bytes := math.Max(float64(transferred-t.prog.Transferred), 0)
+		rate := bytes / dt.Seconds()
+		if p.Rate == 0 {
+			p.Rate = rate
+		} else {
+			p.Rate += (1 - math.Exp(-dt.Seconds()/rateSmoothing.Seconds())) * (rate - p.Rate)
+		}
+
+		// Only the bytes of the intervals measured count on the average,
+		// like the time, so a resumed transfer doesn't count the offset.
+		f.counted += bytes
+		p.Elapsed += dt
+		p.Average = f.counted / p.Elapsed.Seconds()
+	}
+	f.sampled = now
+
+	if p.Rate > 0 && size > transferred {
+		p.ETA = time.Duration(float64(size-transferred) / p.Rate * float64(time.Second))
+	}
+
+	t.prog = p
+	f.pending = true
+}
+
+// resetRate will start the rate again from the next progress, the time the
+// transfer is paused doesn't count on the rate.
+func (t *Transfer) resetRate() {
+	if t.feed != nil {
+		t.feed.sampled = time.Time{}
+	}
+	t.prog.Rate = 0
+	t.prog.ETA = 0
+}
+
+// publish will send the last progress to each subscriber without blocking,
+// a progress not read yet by the subscriber is replaced.
+func (t *Transfer) publish(now time.Time) {
+	f := t.progressFeed()
+	for sub := range f.subs {
+		select {
+		case <-sub:
+		default:
+		}
+		sub <- t.prog
+	}
+	f.sent = now
+	f.pending = false
+}
+
+// closeProgress will send the pending progress and close the channels of
+// the subscribers, no progress is sent after it.
+func (t *Transfer) closeProgress() {
+	f := t.feed
+	if f == nil || f.closed {
+		return
+	}
+
+	if f.flush != nil {
+		f.flush.Stop()
+		f.flush = nil
+	}
+
+	if f.pending {
+		t.publish(time.Now())
+	}
+
+	for sub := range f.subs {
+		close(sub)
+	}
+	f.subs = nil
+	f.closed = true
+}
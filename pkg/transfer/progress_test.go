@@ -0,0 +1,124 @@
+package transfer
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Transfer_setProgress(t *testing.T) {
+	start := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("first progress has no rate", func(t *testing.T) {
+		tr := &Transfer{}
+		tr.setProgress(100, 1000, start)
+
+		if p := tr.Progress(); p.Fraction != 0.1 || p.Rate != 0 || p.ETA != 0 {
+			t.Errorf("setProgress expected fraction 0.1 without rate but got = %v", p)
+		}
+	})
+
+	t.Run("rate and eta from the throughput", func(t *testing.T) {
+		tr := &Transfer{}
+		tr.setProgress(0, 1000, start)
+		tr.setProgress(100, 1000, start.Add(time.Second))
+
+		if p := tr.Progress(); p.Rate != 100 || p.ETA != 9*time.Second {
+			t.Errorf("setProgress expected rate 100 and eta 9s but got = %v and %v", p.Rate, p.ETA)
+		}
+	})
+
+	t.Run("rate follows the throughput", func(t *testing.T) {
+		tr := &Transfer{}
+		tr.setProgress(0, 10000, start)
+		tr.setProgress(100, 10000, start.Add(time.Second))
+		tr.setProgress(400, 10000, start.Add(2*time.Second))
+
+		if p := tr.Progress(); p.Rate <= 100 || p.Rate >= 300 {
+			t.Errorf("setProgress expected rate between 100 and 300 but got = %v", p.Rate)
+		}
+	})
+
+	t.Run("average without the pauses", func(t *testing.T) {
+		tr := &Transfer{}
+		tr.setProgress(500, 2000, start)
+		tr.setProgress(700, 2000, start.Add(time.Second))
+		tr.resetRate()
+		tr.setProgress(900, 2000, start.Add(time.Minute))
+		tr.setProgress(1300, 2000, start.Add(time.Minute+time.Second))
+
+		if p := tr.Progress(); p.Elapsed != 2*time.Second || p.Average != 300 {
+			t.Errorf("setProgress expected elapsed 2s and average 300 but got = %v and %v", p.Elapsed, p.Average)
+		}
+	})
+
+	t.Run("no eta when done", func(t *testing.T) {
+		tr := &Transfer{}
+		tr.setProgress(0, 100, start)
+		tr.setProgress(100, 100, start.Add(time.Second))
+
+		if p := tr.Progress(); p.Fraction != 1 || p.ETA != 0 {
+			t.Errorf("setProgress expected fraction 1 without eta but got = %v", p)
+		}
+	})
+
+	t.Run("reset rate", func(t *testing.T) {
+		tr := &Transfer{}
+		tr.setProgress(0, 1000, start)
+		tr.setProgress(100, 1000, start.Add(time.Second))
+		tr.resetRate()
+		tr.setProgress(150, 1000, start.Add(time.Minute))
+
+		if p := tr.Progress(); p.Rate != 0 || p.Transferred != 150 {
+			t.Errorf("setProgress expected rate 0 after reset but got = %v", p)
+		}
+
+		tr.setProgress(200, 1000, start.Add(time.Minute+time.Second))
+		if p := tr.Progress(); p.Rate != 50 {
+			t.Errorf("setProgress expected rate 50 after reset but got = %v", p.Rate)
+		}
+	})
+}
+
+func Test_Transfer_publish(t *testing.T) {
+	t.Run("publish replaces the unread progress", func(t *testing.T) {
+		tr := &Transfer{}
+		sub := tr.subscribe()
+
+		tr.setProgress(1, 4, time.Now())
+		tr.publish(time.Now())
+		tr.setProgress(2, 4, time.Now())
+		tr.publish(time.Now())
+
+		if p := <-sub; p.Fraction != 0.5 {
+			t.Errorf("publish expected progress 0.5 but got = %v", p.Fraction)
+		}
+
+		select {
+		case p := <-sub:
+			t.Errorf("publish expected a single progress but got = %v", p)
+		default:
+		}
+	})
+
+	t.Run("close sends the pending progress", func(t *testing.T) {
+		tr := &Transfer{}
+		sub := tr.subscribe()
+
+		tr.setProgress(4, 4, time.Now())
+		tr.closeProgress()
+
+		if p, ok := <-sub; !ok || p.Fraction != 1 {
+			t.Errorf("closeProgress expected progress 1 but got = %v", p)
+		}
+
+		if _, ok := <-sub; ok {
+			t.Errorf("closeProgress expected closed channel")
+		}
+
+		if late := tr.subscribe(); late == nil {
+			t.Errorf("subscribe expected a channel")
+		} else if _, ok := <-late; ok {
+			t.Errorf("subscribe expected closed channel after close")
+		}
+	})
+}
@@ -2,48 +2,165 @@ package transfer
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
 	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
 	"github.com/fabiodcorreia/catch-my-file/pkg/network"
 	"github.com/fabiodcorreia/catch-my-file/pkg/transfer/internal/protocol"
 )
 
+var (
+	// ErrChecksumMismatch signals that the checksum of the data received
+	// doesn't match the checksum of the request.
+	ErrChecksumMismatch = errors.New("checksum doesn't match")
+	// ErrSizeMismatch signals that the size of the data received doesn't
+	// match the size of the request.
+	ErrSizeMismatch = errors.New("data size doesn't match")
+	// ErrReceiveFailed signals that the receiver failed to receive or store
+	// the data.
+	ErrReceiveFailed = errors.New("receiver failed to receive the data")
+)
+
 // Done is channel used to singal the termination of the service.
 type Done chan<- interface{}
 
+// VerifyPeer is a function that checks if the peer on the address is known
+// and the fingerprint of the certificate it presented matches with the
+// pinned fingerprint, the fingerprint is empty if the connection doesn't use
+// TLS.
+//
+// It returns the name of the known peer if the fingerprint matches the one
+// pinned or paired for it, empty if the peer has no fingerprint pinned, and
+// false if the peer is unknown or the fingerprint doesn't match.
+type VerifyPeer func(addr net.Addr, fingerprint string) (string, bool)
+
+// Receiver waits for the requests of the senders.
+//
+// If Interfaces is set it only listens on the addresses of those network
+// interfaces, otherwise on all of them. A paused transfer that lost the
+// connection waits for the sender to reconnect during the DetachTimeout.
 type Receiver struct {
-	port  int
-	store *TransferStore
+	VerifyPeer
+	PairRequest
+	PairDone
+	Interfaces    []net.Interface
+	DetachTimeout time.Duration
+	name          string // Name of the local peer sent on the ping answer.
+	port          int
+	store         *TransferStore
+	id            *identity.Identity
+	mu            sync.Mutex
+	detached      map[detachedKey]detached // Paused transfers waiting for the sender to reconnect.
 }
 
 // NewReceiver will create a new Receiver server that will wait for
 // connections on the specified port.
-func NewReceiver(port int, store *TransferStore) *Receiver {
+//
+// If the identity is not nil the connections with senders that support
+// it are upgraded to TLS.
+func NewReceiver(port int, store *TransferStore, id *identity.Identity) *Receiver {
 	return &Receiver{
-		port:  port,
-		store: store,
+		DetachTimeout: DefaultDetachTimeout,
+		name:          network.Hostname(),
+		port:          port,
+		store:         store,
+		id:            id,
 	}
 }
 
-// Run will start the receiver starting the listener to receive requests.
+// Run will start the receiver starting the listeners to receive requests,
+// the done channel is closed once all of them are closed.
 func (rv *Receiver) Run(ctx context.Context, done Done) error {
-	listener, lErr := net.Listen(network.Type, fmt.Sprintf(":%d", rv.port))
-	if lErr != nil {
+	listeners, err := rv.listen()
+	if err != nil {
 		close(done)
-		return fmt.Errorf("receiver run listen error: %v", lErr)
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, listener := range listeners {
+		wg.Add(1)
+		go func(listener net.Listener) {
+			defer wg.Done()
+			rv.waitForRequests(ctx, listener)
+		}(listener)
+		go watchdog(ctx, listener)
 	}
 
-	go waitForRequests(ctx, listener, done, rv.store)
-	go watchdog(ctx, listener)
+	go func() {
+		wg.Wait()
+		clog.Info("Receiver server is closed")
+		close(done)
+	}()
 
 	return nil
 }
 
+// listen will start a listener on each address of the Interfaces, if they
+// are not set a single listener on all the interfaces.
+//
+// If there is an error, it can be because one of the listeners couldn't
+// start or the interfaces don't have addresses.
+func (rv *Receiver) listen() ([]net.Listener, error) {
+	if rv.Interfaces == nil {
+		listener, err := net.Listen(network.Type, fmt.Sprintf(":%d", rv.port))
+		if err != nil {
+			return nil, fmt.Errorf("receiver run listen error: %v", err)
+		}
+		return []net.Listener{listener}, nil
+	}
+
+	listeners := make([]net.Listener, 0, len(rv.Interfaces))
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	for _, iface := range rv.Interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("receiver run listen error on %s: %v", iface.Name, err)
+		}
+
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			host := ipnet.IP.String()
+			if ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+				host += "%" + iface.Name
+			}
+
+			listener, err := net.Listen(network.Type, net.JoinHostPort(host, strconv.Itoa(rv.port)))
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("receiver run listen error on %s: %v", iface.Name, err)
+			}
+			listeners = append(listeners, listener)
+		}
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("receiver run listen error: the interfaces have no addresses")
+	}
+	return listeners, nil
+}
+
 // watchdog will wait until the context gets cancelled and after
 // that it will stop the listener.
 func watchdog(ctx context.Context, listener net.Listener) {
@@ -54,123 +171,669 @@ func watchdog(ctx context.Context, listener net.Listener) {
 }
 
 // waitForRequests will wait for new connections from senders and for each
-// connection will handle handle the request.
-func waitForRequests(ctx context.Context, listener net.Listener, done Done, store *TransferStore) {
+// connection will handle handle the request, until the listener is closed.
+func (rv *Receiver) waitForRequests(ctx context.Context, listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			switch {
-			case errors.Is(err, net.ErrClosed):
-				clog.Info("Receiver server is closed")
-			default:
+			if !errors.Is(err, net.ErrClosed) {
 				clog.Error(err)
 			}
-			close(done)
 			return
 		}
-		go handleRequest(ctx, conn, store)
+		go rv.handleRequest(ctx, conn)
 	}
 }
 
 // handleRequest will receive a new connection, add the transfer to the store,
 // wait for the confirmation or rejection and if accepted start receiving and
 // storing the file.
-func handleRequest(ctx context.Context, conn net.Conn, store *TransferStore) {
+func (rv *Receiver) handleRequest(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
 
-	id, err := reqDecisionAndWait(ctx, store, conn, conn.RemoteAddr())
+	store := rv.store
+
+	pc, err := protocol.Accept(conn, capabilities(rv.id))
+	if err != nil {
+		clog.Error(err)
+		return
+	}
+
+	fingerprint, err := rv.upgrade(conn, pc)
+	if err != nil {
+		clog.Error(err)
+		return
+	}
+
+	if pc.Has(protocol.CapPair) || pc.Has(protocol.CapPing) {
+		mt, err := pc.Peek()
+		if err != nil {
+			clog.Error(err)
+			return
+		}
+		switch mt {
+		case protocol.MsgPair:
+			rv.handlePair(conn, pc, fingerprint)
+			return
+		case protocol.MsgPing:
+			rv.handlePing(conn, pc)
+			return
+		}
+	}
+
+	var verified string
+	untrusted := false
+	if rv.VerifyPeer != nil {
+		var ok bool
+		verified, ok = rv.VerifyPeer(conn.RemoteAddr(), fingerprint)
+		untrusted = !ok
+	}
+	if untrusted {
+		clog.Info("sender %v is unknown or doesn't match the pinned fingerprint, possible impersonation", conn.RemoteAddr())
+	}
+
+	t, err := readRequest(pc, conn.RemoteAddr(), fingerprint, untrusted)
 	if err != nil {
 		clog.Error(err)
 		return
 	}
+	t.VerifiedName = verified
+
+	// A paused transfer that lost the connection continues without asking
+	// the user again.
+	id, reattached := rv.reattach(pc, t)
+	if !reattached {
+		id, err = waitDecision(ctx, store, t)
+		if err != nil {
+			clog.Error(err)
+			return
+		}
+	}
 
+	// The transfer cancelled while waiting can be removed before the
+	// decision is written, the sender is answered as rejected.
 	trans := store.Get(id)
+	if trans == nil {
+		clog.Info("transfer %s removed before the decision", id)
+		if err = pc.WriteDecision(protocol.DecisionMessage{}); err != nil {
+			clog.Error(err)
+		}
+		return
+	}
+	accepted := trans.Status == Accepted || reattached
+
+	var offset int64
+	if accepted && pc.Has(protocol.CapResume) && !trans.HasFiles() {
+		offset = resumeOffset(trans)
+	}
 
 	clog.Info("writing decision to sender: %v", trans.Status)
 
-	if err = protocol.WriteDecision(trans.Status == Accepted, conn); err != nil {
+	decision := protocol.DecisionMessage{
+		Accept: accepted,
+		Offset: offset,
+		Files:  selectedFiles(trans),
+	}
+
+	if err = pc.WriteDecision(decision); err != nil {
 		trans.SetError(err)
 		store.Update(id, trans)
 		clog.Error(err)
 		return
 	}
 
-	if trans.Status != Accepted {
-		clog.Info("transfer rejected %d", id)
+	if !accepted {
+		clog.Info("transfer rejected %s", id)
 		return //It was rejected just end the work
 	}
 
-	// The stored file should get updated with the path where to store the file
-	w, err := file.Open(trans.LocalFilePath, file.OPEN_WRITE)
-	if err != nil {
-		clog.Error(err)
-		return
-	}
+	trans.setFilesStatus(Accepted)
+	store.Update(id, trans)
 
-	defer func() {
-		if cErr := w.Close(); cErr != nil {
-			clog.Error(cErr)
-		}
-	}()
+	tctx, cancel := store.WithCancel(ctx, id)
+	defer cancel()
 
-	clog.Info("receiving file from sender and store at: %s", trans.LocalFilePath)
+	stopWatch := cancelOnDone(tctx, conn, pc)
+	defer stopWatch()
 
-	rcvSize, err := file.Stream(ctx, conn, w, func(transferred int) {
-		store.UpdateProgress(id, float64(transferred)/float64(trans.FileSize))
-	})
+	gate, stopPause := watchPause(id, pc, store, trans.Status == Paused)
+	defer stopPause()
+
+	size := trans.SelectedSize()
+	onProg := func(transferred int) {
+		store.UpdateProgress(id, offset+int64(transferred), size)
+	}
+
+	lim := store.Limits.limiters(trans.SenderName)
+
+	var rcvSize int
+	if trans.HasFiles() {
+		rcvSize, err = receiveFiles(tctx, pc, trans, onProg, lim)
+	} else {
+		rcvSize, err = receiveFile(tctx, pc, trans, offset, onProg, lim)
+		rcvSize += int(offset)
+	}
+	if err != nil && (tctx.Err() != nil || errors.Is(err, protocol.ErrCancelled)) {
+		receiverCancelled(ctx, tctx, id, pc, trans, store, stopWatch, err)
+		return
+	}
+	if err != nil && gate.isPaused() && !trans.HasFiles() {
+		stopPause()
+		if paused := store.Get(id); paused != nil {
+			rv.detach(ctx, id, paused)
+		}
+		return
+	}
+	stopPause()
 	if err != nil {
 		trans.SetError(err)
 		store.Update(id, trans)
 		clog.Error(err)
+		writeResult(pc, trans, err)
 		return
 	}
 
 	trans.Status = Verifying
+	trans.setFilesStatus(Verifying)
 	store.Update(id, trans)
 
-	verifyFile(ctx, trans, rcvSize, id, store)
+	switch {
+	case trans.Directory:
+		err = verifyDirectory(tctx, trans, rcvSize)
+	case trans.Batch:
+		err = verifyBatch(tctx, trans, rcvSize)
+	default:
+		err = verifyFile(tctx, trans, rcvSize)
+	}
+	if err != nil && tctx.Err() != nil {
+		receiverCancelled(ctx, tctx, id, pc, trans, store, stopWatch, err)
+		return
+	}
+	if err != nil {
+		clog.Error(err)
+		trans.SetError(err)
+	} else {
+		trans.Status = Completed
+	}
+	store.Update(id, trans)
+	writeResult(pc, trans, err)
+}
+
+// cancelOnDone will start a new goroutine that signals the sender when the
+// context is cancelled, until the returned function is called. The returned
+// function waits for the goroutine to end and returns true if the sender
+// was signaled.
+//
+// The read deadline is set so the receiver doesn't wait forever for the
+// answer of the sender, if the sender doesn't support cancel the connection
+// is closed instead.
+func cancelOnDone(ctx context.Context, conn net.Conn, pc *protocol.Conn) func() bool {
+	done := make(chan interface{})
+	sent := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			sent <- false
+			return
+		}
+
+		if !pc.Has(protocol.CapCancel) {
+			closeConn(conn)
+			sent <- true
+			return
+		}
+
+		if err := conn.SetReadDeadline(time.Now().Add(cancelTimeout * time.Second)); err != nil {
+			clog.Error(err)
+		}
+		if err := pc.WriteCancel(); err != nil {
+			clog.Error(err)
+		}
+		sent <- true
+	}()
+
+	var once sync.Once
+	var signaled bool
+	return func() bool {
+		once.Do(func() {
+			close(done)
+			signaled = <-sent
+		})
+		return signaled
+	}
+}
+
+// receiverCancelled will end the transfer cancelled by the user or by the
+// sender, removing the partial files received. If the receiver is stopping
+// the partial files are kept so the transfer can be resumed later.
+//
+// If the sender cancelled it's answered with a cancel, otherwise the data
+// is discarded until the sender answers the cancel, unless the answer
+// already stopped the receiving with err.
+func receiverCancelled(ctx, tctx context.Context, id string, pc *protocol.Conn, t *Transfer, store *TransferStore, stopWatch func() bool, err error) {
+	clog.Info("transfer cancelled %s", id)
+
+	signaled := stopWatch()
+	switch {
+	case tctx.Err() == nil:
+		if err := pc.WriteCancel(); err != nil {
+			clog.Error(err)
+		}
+	case pc.Has(protocol.CapCancel):
+		if !signaled {
+			if err := pc.WriteCancel(); err != nil {
+				clog.Error(err)
+			}
+		}
+		if !errors.Is(err, protocol.ErrCancelled) {
+			waitCancel(pc)
+		}
+	}
+
+	if ctx.Err() == nil {
+		removePartials(t)
+	}
+	t.Status = Cancelled
+	t.setFilesStatus(Cancelled)
+	store.Update(id, t)
+}
+
+// waitCancel will discard the data sent by the sender until it answers the
+// cancel or the read deadline is reached.
+func waitCancel(pc *protocol.Conn) {
+	for {
+		// A nil error means the end of the data, the answer comes after it.
+		_, err := io.Copy(io.Discard, pc.DataReader())
+		if errors.Is(err, protocol.ErrCancelled) {
+			return
+		}
+		if err != nil {
+			clog.Error(err)
+			return
+		}
+	}
+}
+
+// removePartials will remove the partial files of the transfer.
+func removePartials(t *Transfer) {
+	if !t.HasFiles() {
+		removePartial(t.LocalFilePath)
+		return
+	}
+
+	for _, f := range t.Files {
+		if f.Status == Rejected {
+			continue
+		}
+		if filePath, err := t.filePath(f); err == nil {
+			removePartial(filePath)
+		}
+	}
+}
+
+// writeResult will send the result of the verification to the sender, if
+// the sender doesn't support it nothing is sent.
+func writeResult(pc *protocol.Conn, t *Transfer, err error) {
+	if !pc.Has(protocol.CapResult) {
+		return
+	}
+
+	if wErr := pc.WriteResult(resultMessage(t, err)); wErr != nil {
+		clog.Error(wErr)
+	}
+}
+
+// resultMessage will create the result message from the error of the
+// verification, on a batch the files with Error are the failed ones.
+func resultMessage(t *Transfer, err error) protocol.ResultMessage {
+	m := protocol.ResultMessage{Code: protocol.ResultOK}
+	switch {
+	case err == nil:
+		return m
+	case errors.Is(err, ErrChecksumMismatch):
+		m.Code = protocol.ResultChecksumMismatch
+	case errors.Is(err, ErrSizeMismatch):
+		m.Code = protocol.ResultSizeMismatch
+	default:
+		m.Code = protocol.ResultIOError
+	}
+	m.Reason = err.Error()
+
+	if t.Batch {
+		for i, f := range t.Files {
+			if f.Status == Error {
+				m.Failed = append(m.Failed, i)
+			}
+		}
+	}
+	return m
+}
+
+// upgrade will upgrade the connection to TLS if both peers support it and
+// return the fingerprint of the sender certificate, empty if not upgraded.
+func (rv *Receiver) upgrade(conn net.Conn, pc *protocol.Conn) (string, error) {
+	if !pc.Has(protocol.CapTLS) {
+		return "", nil
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout * time.Second)); err != nil {
+		return "", fmt.Errorf("receiver upgrade set handshake timeout error: %v", err)
+	}
+
+	tc := tls.Server(conn, rv.id.ServerConfig())
+	if err := tc.Handshake(); err != nil {
+		return "", fmt.Errorf("receiver upgrade tls handshake error: %v", err)
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return "", fmt.Errorf("receiver upgrade reset handshake timeout error: %v", err)
+	}
+
+	pc.Upgrade(tc)
+	return identity.PeerFingerprint(tc.ConnectionState()), nil
+}
+
+// selectedFiles returns the indexes of the batch files that were accepted
+// by the user, nil if the transfer is not an accepted batch.
+func selectedFiles(t *Transfer) []int {
+	if !t.Batch || t.Status != Accepted {
+		return nil
+	}
+
+	selected := make([]int, 0, len(t.Files))
+	for i, f := range t.Files {
+		if f.Status != Rejected {
+			selected = append(selected, i)
+		}
+	}
+	return selected
 }
 
-func verifyFile(ctx context.Context, t *Transfer, rcvSize, id int, store *TransferStore) {
-	f, err := file.Open(t.LocalFilePath, file.OPEN_READ)
+// resumeOffset returns the offset from where the transfer can continue based
+// on the partial file left by a previous transfer to the same path.
+//
+// If the partial file is not smaller than the file being transferred it
+// can't be the same file and the transfer starts from the beginning.
+func resumeOffset(t *Transfer) int64 {
+	size := file.PartialSize(t.LocalFilePath)
+	if size >= t.FileSize {
+		return 0
+	}
+	return size
+}
+
+// receiveFile will store the file content sent by the sender on the partial
+// file starting from the offset and return the amount of data received, the
+// receiving is limited by the limiters.
+func receiveFile(ctx context.Context, pc *protocol.Conn, t *Transfer, offset int64, onProg file.OnProgressChange, lim []*file.Limiter) (int, error) {
+	w, err := file.OpenPartial(t.LocalFilePath, offset)
 	if err != nil {
-		clog.Error(err)
+		return -1, err
 	}
 
 	defer func() {
-		if cErr := f.Close(); cErr != nil {
-			clog.Error(err)
+		if cErr := w.Close(); cErr != nil {
+			clog.Error(cErr)
 		}
 	}()
 
-	if err = verifyTransfer(ctx, t, rcvSize, f); err != nil {
-		t.SetError(err)
+	clog.Info("receiving file from sender and store at: %s from offset: %d", t.LocalFilePath, offset)
+
+	return file.Stream(ctx, pc.DataReader(), w, onProg, lim...)
+}
+
+// receiveFiles will store the content of each file of the directory or batch
+// sent by the sender on its partial file and return the amount of data
+// received. The files rejected by the user are not sent.
+//
+// The sender sends the files one after the other, the size of each file
+// is used to know where a file ends and the next starts.
+func receiveFiles(ctx context.Context, pc *protocol.Conn, t *Transfer, onProg file.OnProgressChange, lim []*file.Limiter) (int, error) {
+	in := pc.DataReader()
+
+	clog.Info("receiving files from sender and store at: %s", t.LocalFilePath)
+
+	var received int
+	for _, f := range t.Files {
+		if f.Status == Rejected {
+			continue
+		}
+
+		filePath, err := t.filePath(f)
+		if err != nil {
+			return -1, err
+		}
+
+		if err = file.CreateDirs(filePath); err != nil {
+			return -1, err
+		}
+
+		w, err := file.OpenPartial(filePath, 0)
+		if err != nil {
+			return -1, err
+		}
+
+		n, err := file.Stream(ctx, io.LimitReader(in, f.Size), w, func(transferred int) {
+			onProg(received + transferred)
+		}, lim...)
+
+		if cErr := w.Close(); cErr != nil {
+			clog.Error(cErr)
+		}
+
+		if err != nil {
+			return -1, err
+		}
+
+		received += n
+	}
+
+	// Consume the end of the data, anything else means the sender sent more
+	// data than the files on the request.
+	n, err := in.Read(make([]byte, 1))
+	if errors.Is(err, protocol.ErrCancelled) {
+		return -1, err
+	}
+	if n != 0 || err != io.EOF {
+		return -1, fmt.Errorf("receiver receive files error: more data than expected")
+	}
+
+	return received, nil
+}
+
+// verifyFile will verify the partial file content, if it's valid the partial
+// file replaces the destination file.
+//
+// If the verification fails the partial file is removed, so the next transfer
+// to the same path doesn't resume from invalid content.
+func verifyFile(ctx context.Context, t *Transfer, rcvSize int) error {
+	f, err := file.Open(file.PartialPath(t.LocalFilePath), file.OPEN_READ)
+	if err != nil {
+		return err
+	}
+
+	err = verifyTransfer(ctx, t, rcvSize, f)
+
+	if cErr := f.Close(); cErr != nil {
+		clog.Error(cErr)
+	}
+
+	if err != nil {
+		removePartial(t.LocalFilePath)
+		return err
+	}
+
+	return file.CompletePartial(t.LocalFilePath)
+}
+
+// verifyDirectory will verify the size and checksum of each file received,
+// if all of them are valid they replace the destination files.
+//
+// If the verification fails all the partial files are removed.
+func verifyDirectory(ctx context.Context, t *Transfer, rcvSize int) error {
+	paths := make([]string, 0, len(t.Files))
+	for _, f := range t.Files {
+		filePath, err := file.SafeJoin(t.LocalFilePath, f.Path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filePath)
+	}
+
+	err := verifyEntries(ctx, t, rcvSize, paths)
+	for _, p := range paths {
+		if err != nil {
+			removePartial(p)
+		} else if cErr := file.CompletePartial(p); cErr != nil {
+			err = cErr
+		}
+	}
+
+	if err != nil {
+		t.setFilesStatus(Error)
 	} else {
-		t.Status = Completed
+		t.setFilesStatus(Completed)
 	}
+	return err
+}
 
-	store.Update(id, t)
+// verifyBatch will verify the checksum of each file of the batch received,
+// each file is independent so the valid files replace the destination files
+// and only the invalid ones are removed and marked with Error.
+//
+// If the data received doesn't match the size of the selected files all of
+// them are removed.
+func verifyBatch(ctx context.Context, t *Transfer, rcvSize int) error {
+	var sizeErr error
+	if int64(rcvSize) != t.SelectedSize() {
+		sizeErr = fmt.Errorf("receiver verify batch error: %w", ErrSizeMismatch)
+	}
+
+	var failed int
+	var firstErr error
+	for i, f := range t.Files {
+		if f.Status == Rejected {
+			continue
+		}
+
+		filePath, err := t.filePath(f)
+		if err == nil {
+			err = sizeErr
+		}
+		if err == nil {
+			err = verifyPartial(ctx, filePath, f.Checksum)
+		}
+		if err == nil {
+			err = file.CompletePartial(filePath)
+		}
+
+		if err != nil {
+			clog.Error(fmt.Errorf("receiver verify batch error on file %s: %v", f.Path, err))
+			removePartial(filePath)
+			t.Files[i].Status = Error
+			if failed == 0 {
+				firstErr = err
+			}
+			failed++
+			continue
+		}
+		t.Files[i].Status = Completed
+	}
+
+	if sizeErr != nil {
+		return sizeErr
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("receiver verify batch error: %d files are not valid, %w", failed, firstErr)
+	}
+	return nil
 }
 
-// reqDecisionAndWait will add the transfer to the store and wait for confirmation
-// by the user or a cancelation of the context.
-func reqDecisionAndWait(ctx context.Context, store *TransferStore, r io.Reader, addr net.Addr) (int, error) {
+// verifyEntries will check if the data received matches with the directory
+// size and if each partial file matches with the checksum on the request.
+func verifyEntries(ctx context.Context, t *Transfer, rcvSize int, paths []string) error {
+	if int64(rcvSize) != t.FileSize {
+		return fmt.Errorf("receiver verify directory error: %w", ErrSizeMismatch)
+	}
+
+	for i, f := range t.Files {
+		if err := verifyPartial(ctx, paths[i], f.Checksum); err != nil {
+			return fmt.Errorf("receiver verify directory error on file %s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// verifyPartial will check if the checksum of the partial file of the file
+// path matches with the checksum provided.
+func verifyPartial(ctx context.Context, filePath, checksum string) error {
+	r, err := file.Open(file.PartialPath(filePath), file.OPEN_READ)
+	if err != nil {
+		return err
+	}
+
+	check, err := file.Checksum(ctx, r)
+
+	if cErr := r.Close(); cErr != nil {
+		clog.Error(cErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if check != checksum {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// removePartial will remove the partial file of the file path.
+func removePartial(filePath string) {
+	if err := os.Remove(file.PartialPath(filePath)); err != nil && !os.IsNotExist(err) {
+		clog.Error(err)
+	}
+}
+
+// readRequest will read the request sent by the sender and create the
+// download transfer with the fingerprint of the sender and if it's untrusted.
+func readRequest(pc *protocol.Conn, addr net.Addr, fingerprint string, untrusted bool) (*Transfer, error) {
 	var rm protocol.RequestMessage
-	if err := protocol.ReadRequestMessage(&rm, r); err != nil {
+	if err := pc.ReadRequest(&rm); err != nil {
 		clog.Error(err)
-		return -1, err
+		return nil, err
 	}
 
-	id, wait := store.AddToWait(NewTransfer(rm.FileName, rm.Checksum, rm.Hostname, rm.FileSize, addr, Download))
+	t, err := newTransferFromRequest(rm, addr)
+	if err != nil {
+		return nil, err
+	}
+	t.PeerFingerprint = fingerprint
+	t.Untrusted = untrusted
+	t.reconnect = rm.Reconnect
 
-	clog.Info("waiting for trans: %d", id)
+	// The sender shares the id of the transfer, older senders don't.
+	if validID(rm.ID) {
+		t.ID = rm.ID
+	}
+	return t, nil
+}
+
+// waitDecision will add the transfer to the store and wait for confirmation
+// by the user or a cancelation of the context.
+func waitDecision(ctx context.Context, store *TransferStore, t *Transfer) (string, error) {
+	id, wait := store.AddToWait(t)
+
+	clog.Info("waiting for trans: %s", id)
 
 	select {
 	case <-wait:
 		return id, nil
 	case <-ctx.Done():
-		clog.Info("waiting interrupted: %d", id)
-		return -1, ctx.Err()
+		clog.Info("waiting interrupted: %s", id)
+		return "", ctx.Err()
 	}
 }
 
@@ -182,7 +845,7 @@ func verifyTransfer(ctx context.Context, trans *Transfer, rcvSize int, in io.Rea
 	}
 
 	if int64(rcvSize) != trans.FileSize {
-		return fmt.Errorf("receiver verify transfer error: data size don't match")
+		return fmt.Errorf("receiver verify transfer error: %w", ErrSizeMismatch)
 	}
 
 	check, err := file.Checksum(ctx, in)
@@ -191,7 +854,86 @@ func verifyTransfer(ctx context.Context, trans *Transfer, rcvSize int, in io.Rea
 	}
 
 	if check != trans.FileChecksum {
-		return fmt.Errorf("receiver verify transfer error: checksum doesn't match")
+		return fmt.Errorf("receiver verify transfer error: %w", ErrChecksumMismatch)
 	}
 	return nil
 }
+
+// newTransferFromRequest will create a download transfer from the request
+// message.
+//
+// If the request is for a directory or a batch the files are validated to
+// make sure the paths can't escape the destination directory and the sizes
+// match the total size of the request.
+func newTransferFromRequest(rm protocol.RequestMessage, addr net.Addr) (*Transfer, error) {
+	switch {
+	case rm.Dir:
+		return newDirectoryFromRequest(rm, addr)
+	case rm.Batch:
+		return newBatchFromRequest(rm, addr)
+	}
+	return NewTransfer(rm.FileName, rm.Checksum, rm.Hostname, rm.FileSize, addr, Download), nil
+}
+
+// newDirectoryFromRequest will create a directory download transfer from the
+// request message.
+func newDirectoryFromRequest(rm protocol.RequestMessage, addr net.Addr) (*Transfer, error) {
+	if !isFileName(rm.FileName) {
+		return nil, fmt.Errorf("receiver request error: invalid directory name %q", rm.FileName)
+	}
+
+	files := make([]file.Entry, 0, len(rm.Files))
+	for _, f := range rm.Files {
+		if _, err := file.SafeJoin(rm.FileName, f.Path); err != nil || f.Size < 0 {
+			return nil, fmt.Errorf("receiver request error: invalid file %q on directory %q", f.Path, rm.FileName)
+		}
+		files = append(files, toEntry(f))
+	}
+
+	t := NewDirectoryTransfer(rm.FileName, rm.Hostname, files, addr, Download)
+	if t.FileSize != rm.FileSize {
+		return nil, fmt.Errorf("receiver request error: directory %q size doesn't match the files", rm.FileName)
+	}
+	return t, nil
+}
+
+// newBatchFromRequest will create a batch download transfer from the request
+// message, all the files are stored on the same folder so each file name must
+// be unique and can't have directories.
+func newBatchFromRequest(rm protocol.RequestMessage, addr net.Addr) (*Transfer, error) {
+	if len(rm.Files) == 0 {
+		return nil, fmt.Errorf("receiver request error: batch without files")
+	}
+
+	files := make([]File, 0, len(rm.Files))
+	names := make(map[string]bool, len(rm.Files))
+	for _, f := range rm.Files {
+		if !isFileName(f.Path) || f.Size < 0 || names[f.Path] {
+			return nil, fmt.Errorf("receiver request error: invalid file %q on batch", f.Path)
+		}
+		names[f.Path] = true
+		files = append(files, File{Entry: toEntry(f), Status: Waiting})
+	}
+
+	t := NewBatchTransfer(rm.Hostname, files, addr, Download)
+	if t.FileSize != rm.FileSize {
+		return nil, fmt.Errorf("receiver request error: batch size doesn't match the files")
+	}
+	return t, nil
+}
+
+// isFileName returns true if the name is a valid file name without any
+// directory.
+func isFileName(name string) bool {
+	_, err := file.SafeJoin("", name)
+	return err == nil && !strings.Contains(name, "/")
+}
+
+// toEntry will convert the protocol representation of a file into an entry.
+func toEntry(f protocol.FileMessage) file.Entry {
+	return file.Entry{
+		Path:     f.Path,
+		Size:     f.Size,
+		Checksum: f.Checksum,
+	}
+}
@@ -3,11 +3,16 @@ package transfer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
 	"github.com/fabiodcorreia/catch-my-file/pkg/network"
 	"github.com/fabiodcorreia/catch-my-file/pkg/transfer/internal/protocol"
 )
@@ -135,7 +140,50 @@ func Test_watchdog(t *testing.T) {
 	})
 }
 
-func Test_reqDecisionAndWait(t *testing.T) {
+func Test_Receiver_listen(t *testing.T) {
+	t.Run("listen on the addresses of the interfaces", func(t *testing.T) {
+		var loopback []net.Interface
+		ifaces, _ := net.Interfaces()
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagLoopback != 0 {
+				loopback = append(loopback, iface)
+			}
+		}
+		if len(loopback) == 0 {
+			t.Skip("no loopback interface")
+		}
+
+		rv := NewReceiver(9953, NewStore(), nil)
+		rv.Interfaces = loopback
+
+		listeners, err := rv.listen()
+		if err != nil {
+			t.Fatalf("listen not expected error = %v", err)
+		}
+		defer func() {
+			for _, l := range listeners {
+				l.Close()
+			}
+		}()
+
+		for _, l := range listeners {
+			if ip := l.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+				t.Errorf("listen expected loopback address but got = %v", ip)
+			}
+		}
+	})
+
+	t.Run("interfaces without addresses", func(t *testing.T) {
+		rv := NewReceiver(9953, NewStore(), nil)
+		rv.Interfaces = []net.Interface{}
+
+		if _, err := rv.listen(); err == nil {
+			t.Errorf("listen expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_readRequest(t *testing.T) {
 	rm := protocol.RequestMessage{
 		FileName: "file-1",
 		FileSize: 1000,
@@ -143,76 +191,807 @@ func Test_reqDecisionAndWait(t *testing.T) {
 		Checksum: "check123",
 	}
 
-	t.Run("send request message and wait for decision accepted", func(t *testing.T) {
-		ctx := context.Background()
+	t.Run("read request message with the sender fingerprint", func(t *testing.T) {
 		inOut := bytes.NewBuffer(make([]byte, 0))
-		store := NewStore()
-
 		protocol.WriteRequestMessage(rm, inOut)
 
+		tt, err := readRequest(protocol.NewLegacyConn(inOut), nil, "aaaa", true)
+		if err != nil {
+			t.Fatalf("readRequest not expected error but got = %v", err)
+		}
+
+		if tt.FileName != "file-1" || tt.SenderName != "peer-1" || tt.Direction != Download {
+			t.Errorf("readRequest expected download of file-1 from peer-1 but got = %v", tt)
+		}
+
+		if tt.PeerFingerprint != "aaaa" || !tt.Untrusted {
+			t.Errorf("readRequest expected untrusted fingerprint = %v but got = %v", "aaaa", tt.PeerFingerprint)
+		}
+	})
+
+	t.Run("connection without request", func(t *testing.T) {
+		if _, err := readRequest(protocol.NewLegacyConn(bytes.NewBuffer(nil)), nil, "", false); err == nil {
+			t.Errorf("readRequest expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_waitDecision(t *testing.T) {
+	t.Run("wait for decision accepted", func(t *testing.T) {
+		store := NewStore()
+
 		go func() {
 			time.Sleep(100 * time.Millisecond)
-			fmt.Printf("Store=%p and MU=%p\n", store, &store.mu) //For some reason the race detector stops after this log
-			tt := store.Get(0)
+			tt := store.List()[0]
 			tt.Status = Accepted
-			store.Update(0, tt)
+			store.Update(tt.ID, tt)
 		}()
 
-		_, err := reqDecisionAndWait(ctx, store, inOut, nil)
-
+		id, err := waitDecision(context.Background(), store, NewTransfer("file-1", "check123", "peer-1", 1000, nil, Download))
 		if err != nil {
-			t.Errorf("request decision and wait not excepted error but got = %v", err)
+			t.Errorf("waitDecision not expected error but got = %v", err)
+		}
+
+		if tt := store.Get(id); tt == nil || tt.Status != Accepted {
+			t.Errorf("waitDecision expected transfer accepted but got = %v", tt)
 		}
 	})
 
-	t.Run("send request message and wait for decision rejected", func(t *testing.T) {
-		ctx := context.Background()
-		inOut := bytes.NewBuffer(make([]byte, 0))
+	t.Run("wait for decision rejected", func(t *testing.T) {
 		store := NewStore()
 
-		protocol.WriteRequestMessage(rm, inOut)
-
 		go func() {
 			time.Sleep(100 * time.Millisecond)
-			fmt.Printf("Store=%p and MU=%p\n", store, &store.mu) //For some reason the race detector stops after this log
-			tt := store.Get(0)
+			tt := store.List()[0]
 			tt.Status = Rejected
-			store.Update(0, tt)
+			store.Update(tt.ID, tt)
 		}()
 
-		_, err := reqDecisionAndWait(ctx, store, inOut, nil)
-
-		if err != nil {
-			t.Errorf("request decision and wait not excepted error but got = %v", err)
+		if _, err := waitDecision(context.Background(), store, NewTransfer("file-1", "check123", "peer-1", 1000, nil, Download)); err != nil {
+			t.Errorf("waitDecision not expected error but got = %v", err)
 		}
 	})
 
-	t.Run("send request message and wait unitl cancelation", func(t *testing.T) {
-		ctx := context.Background()
-		ctx, cancel := context.WithCancel(ctx)
-		inOut := bytes.NewBuffer(make([]byte, 0))
-		store := NewStore()
-
-		protocol.WriteRequestMessage(rm, inOut)
+	t.Run("wait until cancelation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
 
 		go func() {
 			time.Sleep(100 * time.Millisecond)
 			cancel()
 		}()
 
-		_, err := reqDecisionAndWait(ctx, store, inOut, nil)
+		if _, err := waitDecision(ctx, NewStore(), NewTransfer("file-1", "check123", "peer-1", 1000, nil, Download)); err == nil {
+			t.Errorf("waitDecision expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_resumeOffset(t *testing.T) {
+	t.Run("no partial file", func(t *testing.T) {
+		tr := NewTransfer("file.txt", "", "", 1000, nil, Download)
+		tr.LocalFilePath = filepath.Join(t.TempDir(), "file.txt")
+
+		if offset := resumeOffset(tr); offset != 0 {
+			t.Errorf("resumeOffset expected = %v but got = %v", 0, offset)
+		}
+	})
+
+	t.Run("partial file smaller than the file", func(t *testing.T) {
+		tr := NewTransfer("file.txt", "", "", 1000, nil, Download)
+		tr.LocalFilePath = filepath.Join(t.TempDir(), "file.txt")
+		os.WriteFile(file.PartialPath(tr.LocalFilePath), make([]byte, 400), 0600)
+
+		if offset := resumeOffset(tr); offset != 400 {
+			t.Errorf("resumeOffset expected = %v but got = %v", 400, offset)
+		}
+	})
+
+	t.Run("partial file not smaller than the file", func(t *testing.T) {
+		tr := NewTransfer("file.txt", "", "", 1000, nil, Download)
+		tr.LocalFilePath = filepath.Join(t.TempDir(), "file.txt")
+		os.WriteFile(file.PartialPath(tr.LocalFilePath), make([]byte, 1000), 0600)
+
+		if offset := resumeOffset(tr); offset != 0 {
+			t.Errorf("resumeOffset expected = %v but got = %v", 0, offset)
+		}
+	})
+}
+
+// sendToReceiver will start a receiver, send the transfer tr to it and accept
+// the transfer on the receiver side to be stored on dst.
+//
+// It returns the first progress reported on the sender and the final state
+// of the transfer on the sender and receiver stores.
+func sendToReceiver(t *testing.T, port int, tr *Transfer, dst string, rejected ...int) (float64, *Transfer, *Transfer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sID, _ := identity.New()
+	rID, _ := identity.New()
+
+	rStore := NewStore()
+	rv := NewReceiver(port, rStore, rID)
+	rv.VerifyPeer = func(addr net.Addr, fingerprint string) (string, bool) {
+		if fingerprint != sID.Fingerprint() {
+			return "", false
+		}
+		return "peer-s", true
+	}
+	if err := rv.Run(ctx, make(chan interface{})); err != nil {
+		t.Fatalf("receiver run not expected error = %v", err)
+	}
+
+	tr.SenderAddr, _ = net.ResolveTCPAddr(network.Type, fmt.Sprintf("localhost:%d", port))
+	tr.PeerFingerprint = rID.Fingerprint()
+	sStore := NewStore()
+	i := sStore.Add(tr)
+
+	firstProgress := make(chan float64, 1)
+	go func() {
+		progress, _ := sStore.Subscribe(i)
+		for p := range progress {
+			select {
+			case firstProgress <- p.Fraction:
+			default:
+			}
+		}
+	}()
+
+	go func() {
+		for rStore.Size() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		rt := rStore.Get(i)
+		for _, j := range rejected {
+			rt.Files[j].Status = Rejected
+		}
+		rt.LocalFilePath = dst
+		rt.Status = Accepted
+		rStore.Update(i, rt)
+	}()
+
+	conn, err := SendTransferReq(ctx, sStore.Get(i), sID)
+	if err != nil {
+		t.Fatalf("send transfer request not expected error = %v", err)
+	}
+	defer conn.Close()
+
+	// The sender transfer ends with the error, like the application does.
+	if err = WaitConfirmation(ctx, i, conn, sStore); err != nil {
+		st := sStore.Get(i)
+		st.SetError(err)
+		sStore.Update(i, st)
+	}
+
+	for j := 0; j < 100 && (rStore.Size() == 0 || !rStore.Get(i).Status.IsFinal()); j++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return <-firstProgress, sStore.Get(i), rStore.Get(i)
+}
+
+// cancelWithReceiver will send the transfer to a new receiver on the port
+// and cancel it after the first progress, on the sender if onSender is true
+// or on the receiver otherwise.
+func cancelWithReceiver(t *testing.T, port int, tr *Transfer, dst string, onSender bool) (*Transfer, *Transfer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sID, _ := identity.New()
+	rID, _ := identity.New()
+
+	rStore := NewStore()
+	if err := NewReceiver(port, rStore, rID).Run(ctx, make(chan interface{})); err != nil {
+		t.Fatalf("receiver run not expected error = %v", err)
+	}
+
+	tr.SenderAddr, _ = net.ResolveTCPAddr(network.Type, fmt.Sprintf("localhost:%d", port))
+	// The progress never blocks the transfer, the limit keeps it running
+	// until it is cancelled.
+	sStore := NewStore()
+	sStore.Limits.SetGlobal(1 << 18)
+	i := sStore.Add(tr)
+
+	follow := func(s *TransferStore, id string, cancelFirst bool) {
+		progress, _ := s.Subscribe(id)
+		for range progress {
+			if cancelFirst {
+				s.Cancel(id)
+				cancelFirst = false
+			}
+		}
+	}
+	go follow(sStore, i, onSender)
+
+	go func() {
+		for rStore.Size() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		go follow(rStore, i, !onSender)
+		rt := rStore.Get(i)
+		rt.LocalFilePath = dst
+		rt.Status = Accepted
+		rStore.Update(i, rt)
+	}()
+
+	sCtx, sCancel := sStore.WithCancel(ctx, i)
+	defer sCancel()
+
+	conn, err := SendTransferReq(sCtx, sStore.Get(i), sID)
+	if err != nil {
+		t.Fatalf("send transfer request not expected error = %v", err)
+	}
+	defer conn.Close()
+
+	err = WaitConfirmation(sCtx, i, conn, sStore)
+
+	for j := 0; j < 100 && (rStore.Size() == 0 || !rStore.Get(i).Status.IsFinal()); j++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return sStore.Get(i), rStore.Get(i), err
+}
+
+// newFileTransfer will create an upload transfer of the file src.
+func newFileTransfer(src string) *Transfer {
+	f, _ := os.Open(src)
+	check, _ := file.Checksum(context.Background(), f)
+	f.Close()
+	name, size, _ := file.Lookup(src)
+
+	tr := NewTransfer(name, check, "peer-1", size, nil, Upload)
+	tr.LocalFilePath = src
+	return tr
+}
+
+// newDirTransfer will create an upload transfer of the directory src.
+func newBatchTransfer(paths ...string) *Transfer {
+	files := make([]File, 0, len(paths))
+	for _, p := range paths {
+		f, _ := os.Open(p)
+		check, _ := file.Checksum(context.Background(), f)
+		f.Close()
+		name, size, _ := file.Lookup(p)
+		files = append(files, File{Entry: file.Entry{Path: name, Size: size, Checksum: check}, LocalPath: p, Status: Waiting})
+	}
+	return NewBatchTransfer("peer-1", files, nil, Upload)
+}
+
+func newDirTransfer(src string) *Transfer {
+	files, _ := file.Manifest(context.Background(), src)
+	tr := NewDirectoryTransfer(filepath.Base(src), "peer-1", files, nil, Upload)
+	tr.LocalFilePath = src
+	return tr
+}
+
+func Test_handleRequest(t *testing.T) {
+	content := bytes.Repeat([]byte("catch my file "), 10000)
+
+	t.Run("receive the full file", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "src.txt")
+		dst := filepath.Join(t.TempDir(), "dst.txt")
+		os.WriteFile(src, content, 0600)
+
+		_, st, rt := sendToReceiver(t, 9934, newFileTransfer(src), dst)
+
+		if rt.Status != Completed {
+			t.Errorf("handleRequest expected status = %v but got = %v (%v)", Completed, rt.Status, rt.Error())
+		}
+
+		if st.Status == Error {
+			t.Errorf("handleRequest expected sender without error but got = %v", st.Error())
+		}
+
+		if received, _ := os.ReadFile(dst); !bytes.Equal(received, content) {
+			t.Errorf("handleRequest expected the received file to match the sent file")
+		}
+
+		if rt.PeerFingerprint == "" || rt.Untrusted {
+			t.Errorf("handleRequest expected trusted sender fingerprint but got = %v", rt.PeerFingerprint)
+		}
+
+		if rt.VerifiedName != "peer-s" {
+			t.Errorf("handleRequest expected verified sender = %v but got = %v", "peer-s", rt.VerifiedName)
+		}
+
+		if rt.ID != st.ID {
+			t.Errorf("handleRequest expected the id of the sender = %v but got = %v", st.ID, rt.ID)
+		}
+	})
+
+	t.Run("receiver with a different fingerprint", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rID, _ := identity.New()
+		if err := NewReceiver(9939, NewStore(), rID).Run(ctx, make(chan interface{})); err != nil {
+			t.Fatalf("receiver run not expected error = %v", err)
+		}
+
+		sID, _ := identity.New()
+		tr := newFileTransfer(os.Args[0])
+		tr.SenderAddr, _ = net.ResolveTCPAddr(network.Type, "localhost:9939")
+		tr.PeerFingerprint = sID.Fingerprint()
+
+		if _, err := SendTransferReq(ctx, tr, sID); !errors.Is(err, identity.ErrFingerprintMismatch) {
+			t.Errorf("SendTransferReq expected error = %v but got = %v", identity.ErrFingerprintMismatch, err)
+		}
+	})
+
+	t.Run("receiver without TLS when a fingerprint is expected", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		if err := NewReceiver(9940, NewStore(), nil).Run(ctx, make(chan interface{})); err != nil {
+			t.Fatalf("receiver run not expected error = %v", err)
+		}
+
+		sID, _ := identity.New()
+		tr := newFileTransfer(os.Args[0])
+		tr.SenderAddr, _ = net.ResolveTCPAddr(network.Type, "localhost:9940")
+		tr.PeerFingerprint = sID.Fingerprint()
+
+		if _, err := SendTransferReq(ctx, tr, sID); err == nil {
+			t.Errorf("SendTransferReq expected error = %v", err)
+		}
+	})
+
+	t.Run("resume from the partial file", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "src.txt")
+		dst := filepath.Join(t.TempDir(), "dst.txt")
+		os.WriteFile(src, content, 0600)
+		os.WriteFile(file.PartialPath(dst), content[:len(content)/2], 0600)
+
+		progress, _, rt := sendToReceiver(t, 9935, newFileTransfer(src), dst)
+
+		if rt.Status != Completed {
+			t.Errorf("handleRequest expected status = %v but got = %v (%v)", Completed, rt.Status, rt.Error())
+		}
+
+		if progress <= 0.5 {
+			t.Errorf("handleRequest expected first progress > 0.5 but got = %v", progress)
+		}
+
+		if received, _ := os.ReadFile(dst); !bytes.Equal(received, content) {
+			t.Errorf("handleRequest expected the received file to match the sent file")
+		}
+	})
+
+	t.Run("partial file with different content", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "src.txt")
+		dst := filepath.Join(t.TempDir(), "dst.txt")
+		os.WriteFile(src, content, 0600)
+		os.WriteFile(file.PartialPath(dst), make([]byte, 100), 0600)
+
+		_, st, rt := sendToReceiver(t, 9936, newFileTransfer(src), dst)
+
+		if rt.Status != Error {
+			t.Errorf("handleRequest expected status = %v but got = %v", Error, rt.Status)
+		}
+
+		if st.Status != Error || !errors.Is(st.Error(), ErrChecksumMismatch) {
+			t.Errorf("handleRequest expected sender error = %v but got = %v", ErrChecksumMismatch, st.Error())
+		}
+
+		if size := file.PartialSize(dst); size != 0 {
+			t.Errorf("handleRequest expected partial file removed but got size = %v", size)
+		}
+	})
+	t.Run("receive a directory", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "src")
+		dst := filepath.Join(t.TempDir(), "src")
+		os.MkdirAll(filepath.Join(src, "sub", "deep"), 0750)
+		os.WriteFile(filepath.Join(src, "a.txt"), content, 0600)
+		os.WriteFile(filepath.Join(src, "empty.txt"), []byte{}, 0600)
+		os.WriteFile(filepath.Join(src, "sub", "deep", "b.txt"), content[:1000], 0600)
+
+		_, _, rt := sendToReceiver(t, 9937, newDirTransfer(src), dst)
+
+		if rt.Status != Completed {
+			t.Errorf("handleRequest expected status = %v but got = %v (%v)", Completed, rt.Status, rt.Error())
+		}
+
+		if !rt.Directory || len(rt.Files) != 3 {
+			t.Errorf("handleRequest expected directory with 3 files but got = %v", rt.Files)
+		}
+
+		for _, f := range []string{"a.txt", "empty.txt", "sub/deep/b.txt"} {
+			want, _ := os.ReadFile(filepath.Join(src, f))
+			if received, err := os.ReadFile(filepath.Join(dst, f)); err != nil || !bytes.Equal(received, want) {
+				t.Errorf("handleRequest expected the received file %s to match the sent file", f)
+			}
+		}
+	})
+
+	t.Run("receive the selected files of a batch", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		os.WriteFile(filepath.Join(src, "a.txt"), content, 0600)
+		os.WriteFile(filepath.Join(src, "b.txt"), content[:1000], 0600)
+		os.WriteFile(filepath.Join(src, "c.txt"), content[:10], 0600)
+
+		tr := newBatchTransfer(filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt"), filepath.Join(src, "c.txt"))
+		_, st, rt := sendToReceiver(t, 9938, tr, dst, 1)
+
+		if rt.Status != Completed {
+			t.Errorf("handleRequest expected status = %v but got = %v (%v)", Completed, rt.Status, rt.Error())
+		}
+
+		want := []Status{Completed, Rejected, Completed}
+		for j, f := range rt.Files {
+			if f.Status != want[j] || st.Files[j].Status != want[j] {
+				t.Errorf("handleRequest expected file %s status = %v but got = %v and %v", f.Path, want[j], f.Status, st.Files[j].Status)
+			}
+		}
+
+		for _, f := range []string{"a.txt", "c.txt"} {
+			want, _ := os.ReadFile(filepath.Join(src, f))
+			if received, err := os.ReadFile(filepath.Join(dst, f)); err != nil || !bytes.Equal(received, want) {
+				t.Errorf("handleRequest expected the received file %s to match the sent file", f)
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(dst, "b.txt")); !os.IsNotExist(err) {
+			t.Errorf("handleRequest expected the rejected file to not be received")
+		}
+	})
+}
+
+func Test_handleRequest_cancel(t *testing.T) {
+	content := bytes.Repeat([]byte("catch my file "), 100000)
+
+	for name, tc := range map[string]struct {
+		port     int
+		onSender bool
+	}{
+		"cancelled by the sender":   {port: 9944, onSender: true},
+		"cancelled by the receiver": {port: 9945, onSender: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src.txt")
+			dst := filepath.Join(t.TempDir(), "dst.txt")
+			os.WriteFile(src, content, 0600)
+
+			st, rt, err := cancelWithReceiver(t, tc.port, newFileTransfer(src), dst, tc.onSender)
+			if !errors.Is(err, ErrCancelled) {
+				t.Errorf("WaitConfirmation expected error = %v but got = %v", ErrCancelled, err)
+			}
+
+			if st.Status != Cancelled || rt.Status != Cancelled {
+				t.Errorf("handleRequest expected status = %v but got = %v and %v", Cancelled, st.Status, rt.Status)
+			}
+
+			if size := file.PartialSize(dst); size != 0 {
+				t.Errorf("handleRequest expected partial file removed but got size = %v", size)
+			}
+		})
+	}
+}
+
+func Test_newTransferFromRequest(t *testing.T) {
+	t.Run("single file request", func(t *testing.T) {
+		tr, err := newTransferFromRequest(protocol.RequestMessage{FileName: "file.txt", FileSize: 10}, nil)
+
+		if err != nil {
+			t.Errorf("newTransferFromRequest not expected error = %v", err)
+		}
+		if tr.Directory || tr.Direction != Download {
+			t.Errorf("newTransferFromRequest expected single file download but got = %v", tr)
+		}
+	})
+
+	t.Run("directory request", func(t *testing.T) {
+		tr, err := newTransferFromRequest(protocol.RequestMessage{
+			FileName: "dir",
+			FileSize: 10,
+			Dir:      true,
+			Files:    []protocol.FileMessage{{Path: "a.txt", Size: 4}, {Path: "sub/b.txt", Size: 6}},
+		}, nil)
+
+		if err != nil {
+			t.Errorf("newTransferFromRequest not expected error = %v", err)
+		}
+		if !tr.Directory || len(tr.Files) != 2 || tr.FileSize != 10 {
+			t.Errorf("newTransferFromRequest expected directory with 2 files but got = %v", tr)
+		}
+	})
+
+	t.Run("directory request with path outside of the directory", func(t *testing.T) {
+		_, err := newTransferFromRequest(protocol.RequestMessage{
+			FileName: "dir",
+			FileSize: 4,
+			Dir:      true,
+			Files:    []protocol.FileMessage{{Path: "../a.txt", Size: 4}},
+		}, nil)
 
 		if err == nil {
-			t.Errorf("request decision and wait not excepted error but got = %v", err)
+			t.Errorf("newTransferFromRequest expected error = %v", err)
 		}
 	})
 
-	t.Run("store is nil", func(t *testing.T) {
-		ctx := context.Background()
-		_, err := reqDecisionAndWait(ctx, nil, nil, nil)
+	t.Run("directory request with invalid name", func(t *testing.T) {
+		_, err := newTransferFromRequest(protocol.RequestMessage{
+			FileName: "..",
+			FileSize: 4,
+			Dir:      true,
+			Files:    []protocol.FileMessage{{Path: "a.txt", Size: 4}},
+		}, nil)
+
+		if err == nil {
+			t.Errorf("newTransferFromRequest expected error = %v", err)
+		}
+	})
+
+	t.Run("batch request", func(t *testing.T) {
+		tr, err := newTransferFromRequest(protocol.RequestMessage{
+			FileSize: 10,
+			Batch:    true,
+			Files:    []protocol.FileMessage{{Path: "a.txt", Size: 4}, {Path: "b.txt", Size: 6}},
+		}, nil)
+
+		if err != nil {
+			t.Errorf("newTransferFromRequest not expected error = %v", err)
+		}
+		if !tr.Batch || len(tr.Files) != 2 || tr.FileName != "a.txt and 1 more" {
+			t.Errorf("newTransferFromRequest expected batch with 2 files but got = %v", tr)
+		}
+	})
+
+	t.Run("batch request with directories on the file name", func(t *testing.T) {
+		_, err := newTransferFromRequest(protocol.RequestMessage{
+			FileSize: 4,
+			Batch:    true,
+			Files:    []protocol.FileMessage{{Path: "sub/a.txt", Size: 4}},
+		}, nil)
 
 		if err == nil {
-			t.Errorf("request decision and wait excepted error but got = %v", err)
+			t.Errorf("newTransferFromRequest expected error = %v", err)
 		}
 	})
+
+	t.Run("batch request with repeated file names", func(t *testing.T) {
+		_, err := newTransferFromRequest(protocol.RequestMessage{
+			FileSize: 8,
+			Batch:    true,
+			Files:    []protocol.FileMessage{{Path: "a.txt", Size: 4}, {Path: "a.txt", Size: 4}},
+		}, nil)
+
+		if err == nil {
+			t.Errorf("newTransferFromRequest expected error = %v", err)
+		}
+	})
+
+	t.Run("batch request without files", func(t *testing.T) {
+		if _, err := newTransferFromRequest(protocol.RequestMessage{Batch: true}, nil); err == nil {
+			t.Errorf("newTransferFromRequest expected error = %v", err)
+		}
+	})
+
+	t.Run("directory request with size not matching", func(t *testing.T) {
+		_, err := newTransferFromRequest(protocol.RequestMessage{
+			FileName: "dir",
+			FileSize: 10,
+			Dir:      true,
+			Files:    []protocol.FileMessage{{Path: "a.txt", Size: 4}},
+		}, nil)
+
+		if err == nil {
+			t.Errorf("newTransferFromRequest expected error = %v", err)
+		}
+	})
+}
+
+// pauseWithReceiver will send the transfer to a receiver on the port, on the
+// first progress it's paused by the sender or the receiver and once both
+// sides are paused it's resumed. It returns the status of both sides while
+// paused, the transfers after the end and the error of WaitConfirmation.
+func pauseWithReceiver(t *testing.T, port int, tr *Transfer, dst string, onSender bool) ([2]Status, *Transfer, *Transfer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sID, _ := identity.New()
+	rID, _ := identity.New()
+
+	rStore := NewStore()
+	if err := NewReceiver(port, rStore, rID).Run(ctx, make(chan interface{})); err != nil {
+		t.Fatalf("receiver run not expected error = %v", err)
+	}
+
+	tr.SenderAddr, _ = net.ResolveTCPAddr(network.Type, fmt.Sprintf("localhost:%d", port))
+	sStore := NewStore()
+	i := sStore.Add(tr)
+
+	var paused [2]Status
+	pausedDone := make(chan interface{})
+	follow := func(s *TransferStore, id string, pauseFirst bool) {
+		progress, _ := s.Subscribe(id)
+		for range progress {
+			if !pauseFirst {
+				continue
+			}
+			pauseFirst = false
+			s.Pause(id, true)
+
+			go func() {
+				defer close(pausedDone)
+				for k := 0; k < 100 && (sStore.Get(i).Status != Paused || rStore.Get(i).Status != Paused); k++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				paused = [2]Status{sStore.Get(i).Status, rStore.Get(i).Status}
+				s.Pause(id, false)
+			}()
+		}
+	}
+	go follow(sStore, i, onSender)
+
+	go func() {
+		for rStore.Size() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		go follow(rStore, i, !onSender)
+		rt := rStore.Get(i)
+		rt.LocalFilePath = dst
+		rt.Status = Accepted
+		rStore.Update(i, rt)
+	}()
+
+	conn, err := SendTransferReq(ctx, sStore.Get(i), sID)
+	if err != nil {
+		t.Fatalf("send transfer request not expected error = %v", err)
+	}
+	defer conn.Close()
+
+	err = WaitConfirmation(ctx, i, conn, sStore)
+	<-pausedDone
+
+	for j := 0; j < 100 && !rStore.Get(i).Status.IsFinal(); j++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return paused, sStore.Get(i), rStore.Get(i), err
+}
+
+func Test_handleRequest_pause(t *testing.T) {
+	// The content needs to be large enough to not be sent before the
+	// receiver pauses.
+	content := bytes.Repeat([]byte("catch my file "), 2000000)
+
+	for name, tc := range map[string]struct {
+		port     int
+		onSender bool
+	}{
+		"paused by the sender":   {port: 9946, onSender: true},
+		"paused by the receiver": {port: 9947, onSender: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src.txt")
+			dst := filepath.Join(t.TempDir(), "dst.txt")
+			os.WriteFile(src, content, 0600)
+
+			paused, _, rt, err := pauseWithReceiver(t, tc.port, newFileTransfer(src), dst, tc.onSender)
+			if err != nil {
+				t.Errorf("WaitConfirmation not expected error = %v", err)
+			}
+
+			if paused[0] != Paused || paused[1] != Paused {
+				t.Errorf("handleRequest expected paused status = %v but got = %v and %v", Paused, paused[0], paused[1])
+			}
+
+			if rt.Status != Completed {
+				t.Errorf("handleRequest expected status = %v but got = %v", Completed, rt.Status)
+			}
+
+			if got, _ := os.ReadFile(dst); !bytes.Equal(got, content) {
+				t.Errorf("handleRequest expected the content received to match")
+			}
+		})
+	}
+}
+
+func Test_handleRequest_reconnect(t *testing.T) {
+	content := bytes.Repeat([]byte("catch my file "), 100000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := filepath.Join(t.TempDir(), "src.txt")
+	dst := filepath.Join(t.TempDir(), "dst.txt")
+	os.WriteFile(src, content, 0600)
+
+	sID, _ := identity.New()
+	rID, _ := identity.New()
+
+	rStore := NewStore()
+	if err := NewReceiver(9948, rStore, rID).Run(ctx, make(chan interface{})); err != nil {
+		t.Fatalf("receiver run not expected error = %v", err)
+	}
+
+	tr := newFileTransfer(src)
+	tr.SenderAddr, _ = net.ResolveTCPAddr(network.Type, "localhost:9948")
+	sStore := NewStore()
+	sStore.Limits.SetGlobal(1 << 18)
+	i := sStore.Add(tr)
+
+	go func() {
+		for rStore.Size() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		rt := rStore.Get(i)
+		rt.LocalFilePath = dst
+		rt.Status = Accepted
+		rStore.Update(i, rt)
+	}()
+
+	conn, err := SendTransferReq(ctx, sStore.Get(i), sID)
+	if err != nil {
+		t.Fatalf("send transfer request not expected error = %v", err)
+	}
+
+	// Pause on the first progress and drop the connection once both sides
+	// are paused.
+	go func() {
+		first := true
+		progress, _ := sStore.Subscribe(i)
+		for range progress {
+			if !first {
+				continue
+			}
+			first = false
+			sStore.Pause(i, true)
+			go func(c *Conn) {
+				for k := 0; k < 100 && (rStore.Get(i).Status != Paused); k++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				c.Close()
+			}(conn)
+		}
+	}()
+
+	err = WaitConfirmation(ctx, i, conn, sStore)
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("WaitConfirmation expected error = %v but got = %v", ErrConnectionLost, err)
+	}
+
+	for k := 0; k < 100 && rStore.Get(i).Status != Paused; k++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := sStore.Get(i).Status; st != Paused {
+		t.Errorf("WaitConfirmation expected status = %v but got = %v", Paused, st)
+	}
+
+	// Resume once the transfer is running again.
+	go func() {
+		for k := 0; k < 200 && sStore.Get(i).Status == Paused; k++ {
+			sStore.Pause(i, false)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	rtr := sStore.Get(i)
+	rtr.reconnect = true
+	conn, err = SendTransferReq(ctx, rtr, sID)
+	if err != nil {
+		t.Fatalf("send transfer request not expected error = %v", err)
+	}
+	defer conn.Close()
+
+	if err = WaitConfirmation(ctx, i, conn, sStore); err != nil {
+		t.Errorf("WaitConfirmation not expected error = %v", err)
+	}
+
+	for k := 0; k < 100 && !rStore.Get(i).Status.IsFinal(); k++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if rStore.Size() != 1 {
+		t.Errorf("handleRequest expected the reconnect to continue the same transfer but got = %v transfers", rStore.Size())
+	}
+
+	if rt := rStore.Get(i); rt.Status != Completed {
+		t.Errorf("handleRequest expected status = %v but got = %v", Completed, rt.Status)
+	}
+
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, content) {
+		t.Errorf("handleRequest expected the content received to match")
+	}
 }
@@ -0,0 +1,138 @@
+package transfer
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Rules decide the transfers received without asking the user, a transfer
+// is accepted only if it follows all the rules.
+//
+// A transfer from an unknown sender or one that doesn't match the pinned
+// fingerprint is always rejected.
+//
+// The names on Allow are matched with the known peer verified by its pinned
+// or paired fingerprint, not with the name the sender reports, so when they
+// are set a sender that wasn't verified is rejected.
+type Rules struct {
+	Allow    []string // Allow are the names of the peers allowed to send, any peer if empty.
+	MaxSize  int64    // MaxSize is the maximum size of a transfer in bytes, 0 means no limit.
+	Patterns []string // Patterns are the patterns the names of the files must match, any name if empty.
+}
+
+// Validate returns an error if one of the patterns is malformed.
+func (r *Rules) Validate() error {
+	for _, p := range r.Patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("transfer rules error: invalid pattern %q: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// Check returns an error with the reason if the download t doesn't follow
+// the rules.
+//
+// The name of each file of a directory or batch must match one of the
+// patterns, the folders of a directory are not checked.
+func (r *Rules) Check(t *Transfer) error {
+	if t.Untrusted {
+		return fmt.Errorf("sender %s is unknown or doesn't match the pinned fingerprint", t.SenderName)
+	}
+
+	if len(r.Allow) > 0 {
+		if t.VerifiedName == "" {
+			return fmt.Errorf("sender %s is not verified by a pinned fingerprint", t.SenderName)
+		}
+		if !contains(r.Allow, t.VerifiedName) {
+			return fmt.Errorf("sender %s is not allowed", t.VerifiedName)
+		}
+	}
+
+	if r.MaxSize > 0 && t.FileSize > r.MaxSize {
+		return fmt.Errorf("size %s is over the maximum of %s", byteCountSI(t.FileSize), byteCountSI(r.MaxSize))
+	}
+
+	if len(r.Patterns) == 0 {
+		return nil
+	}
+
+	names := []string{t.FileName}
+	if t.HasFiles() {
+		names = names[:0]
+		for _, f := range t.Files {
+			names = append(names, path.Base(f.Path))
+		}
+	}
+
+	for _, name := range names {
+		if !r.match(name) {
+			return fmt.Errorf("file %s doesn't match any pattern", name)
+		}
+	}
+	return nil
+}
+
+// Decide will accept the download t into the directory if it follows the
+// rules or reject it otherwise, the error is the reason of the rejection.
+//
+// The file or directory is stored inside of the directory with the name
+// sent, the files of a batch are stored on the directory.
+func (r *Rules) Decide(t *Transfer, dir string) error {
+	err := r.Check(t)
+	if err == nil {
+		err = t.AcceptInto(dir)
+	}
+
+	if err != nil {
+		t.Status = Rejected
+	}
+	return err
+}
+
+// match returns true if the name matches one of the patterns.
+func (r *Rules) match(name string) bool {
+	for _, p := range r.Patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns true if the name is one of the names.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSize will convert a size like 500MB or 2GB into bytes, the units
+// are the same used to show the sizes (KB, MB, GB, TB) and without unit
+// the size is in bytes.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+
+	mult := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(s, unit) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit))
+			for j := 0; j <= i; j++ {
+				mult *= 1000
+			}
+			break
+		}
+	}
+	s = strings.TrimSuffix(s, "B")
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("transfer parse size error: invalid size %q", size)
+	}
+	return int64(n * float64(mult)), nil
+}
@@ -0,0 +1,150 @@
+package transfer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+)
+
+func Test_Rules_Decide(t *testing.T) {
+	newFile := func(name, sender string, size int64) *Transfer {
+		return NewTransfer(name, "abc", sender, size, nil, Download)
+	}
+
+	t.Run("file accepted without rules", func(t *testing.T) {
+		r := &Rules{}
+		tr := newFile("a.txt", "peer-1", 1000)
+		if err := r.Decide(tr, "/srv/inbox"); err != nil {
+			t.Fatalf("Decide not expected error = %v", err)
+		}
+
+		if tr.Status != Accepted {
+			t.Errorf("Decide expected status = %v but got = %v", Accepted, tr.Status)
+		}
+
+		if want := filepath.Join("/srv/inbox", "a.txt"); tr.LocalFilePath != want {
+			t.Errorf("Decide expected path = %v but got = %v", want, tr.LocalFilePath)
+		}
+	})
+
+	t.Run("sender allowed", func(t *testing.T) {
+		r := &Rules{Allow: []string{"peer-1"}}
+		tr := newFile("a.txt", "other", 1000)
+		tr.VerifiedName = "peer-1"
+		if err := r.Decide(tr, "/srv/inbox"); err != nil || tr.Status != Accepted {
+			t.Errorf("Decide expected status = %v but got = %v", Accepted, tr.Status)
+		}
+	})
+
+	t.Run("sender not allowed", func(t *testing.T) {
+		r := &Rules{Allow: []string{"peer-2"}}
+		tr := newFile("a.txt", "peer-2", 1000)
+		tr.VerifiedName = "peer-1"
+		if err := r.Decide(tr, "/srv/inbox"); err == nil {
+			t.Errorf("Decide expected error but got = %v", err)
+		}
+
+		if tr.Status != Rejected {
+			t.Errorf("Decide expected status = %v but got = %v", Rejected, tr.Status)
+		}
+	})
+
+	t.Run("sender not verified", func(t *testing.T) {
+		r := &Rules{Allow: []string{"peer-1"}}
+		tr := newFile("a.txt", "peer-1", 1000)
+		if err := r.Decide(tr, "/srv/inbox"); err == nil || tr.Status != Rejected {
+			t.Errorf("Decide expected status = %v but got = %v", Rejected, tr.Status)
+		}
+	})
+
+	t.Run("sender untrusted", func(t *testing.T) {
+		r := &Rules{Allow: []string{"peer-1"}}
+		tr := newFile("a.txt", "peer-1", 1000)
+		tr.Untrusted = true
+		if err := r.Decide(tr, "/srv/inbox"); err == nil || tr.Status != Rejected {
+			t.Errorf("Decide expected status = %v but got = %v", Rejected, tr.Status)
+		}
+	})
+
+	t.Run("size over the maximum", func(t *testing.T) {
+		r := &Rules{MaxSize: 999}
+		tr := newFile("a.txt", "peer-1", 1000)
+		if err := r.Decide(tr, "/srv/inbox"); err == nil || tr.Status != Rejected {
+			t.Errorf("Decide expected status = %v but got = %v", Rejected, tr.Status)
+		}
+	})
+
+	t.Run("file name matches the pattern", func(t *testing.T) {
+		r := &Rules{Patterns: []string{"*.zip", "*.txt"}}
+		tr := newFile("a.txt", "peer-1", 1000)
+		if err := r.Decide(tr, "/srv/inbox"); err != nil || tr.Status != Accepted {
+			t.Errorf("Decide expected status = %v but got = %v", Accepted, tr.Status)
+		}
+	})
+
+	t.Run("file of a directory doesn't match the pattern", func(t *testing.T) {
+		r := &Rules{Patterns: []string{"*.txt"}}
+		tr := NewDirectoryTransfer("docs", "peer-1", []file.Entry{
+			{Path: "a.txt", Size: 1},
+			{Path: "sub/b.exe", Size: 1},
+		}, nil, Download)
+		if err := r.Decide(tr, "/srv/inbox"); err == nil || tr.Status != Rejected {
+			t.Errorf("Decide expected status = %v but got = %v", Rejected, tr.Status)
+		}
+	})
+
+	t.Run("batch stored on the directory", func(t *testing.T) {
+		r := &Rules{Patterns: []string{"*.txt"}}
+		tr := NewBatchTransfer("peer-1", []File{
+			{Entry: file.Entry{Path: "a.txt", Size: 1}, Status: Waiting},
+			{Entry: file.Entry{Path: "b.txt", Size: 1}, Status: Waiting},
+		}, nil, Download)
+		if err := r.Decide(tr, "/srv/inbox"); err != nil {
+			t.Fatalf("Decide not expected error = %v", err)
+		}
+
+		if tr.LocalFilePath != "/srv/inbox" {
+			t.Errorf("Decide expected path = %v but got = %v", "/srv/inbox", tr.LocalFilePath)
+		}
+	})
+}
+
+func Test_Rules_Validate(t *testing.T) {
+	if err := (&Rules{Patterns: []string{"*.txt"}}).Validate(); err != nil {
+		t.Errorf("Validate not expected error = %v", err)
+	}
+
+	if err := (&Rules{Patterns: []string{"[a-"}}).Validate(); err == nil {
+		t.Errorf("Validate expected error but got = %v", err)
+	}
+}
+
+func Test_ParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"1000", 1000},
+		{"500KB", 500e3},
+		{"1.5 GB", 1.5e9},
+		{"2mb", 2e6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := ParseSize(tt.size)
+			if err != nil {
+				t.Fatalf("ParseSize not expected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize expected = %v but got = %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("invalid size", func(t *testing.T) {
+		if _, err := ParseSize("ten"); err == nil {
+			t.Errorf("ParseSize expected error but got = %v", err)
+		}
+	})
+}
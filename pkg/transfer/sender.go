@@ -2,14 +2,17 @@ package transfer
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
 	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+	"github.com/fabiodcorreia/catch-my-file/pkg/identity"
 	"github.com/fabiodcorreia/catch-my-file/pkg/network"
 	"github.com/fabiodcorreia/catch-my-file/pkg/transfer/internal/protocol"
 )
@@ -19,41 +22,100 @@ const (
 	dialTimeout = 10 //seconds
 	// Time to wait to send the transfer request.
 	writeTimeout = 30 //seconds
+	// Time to wait for the receiver to answer the protocol handshake.
+	handshakeTimeout = 10 //seconds
+	// Time to wait for the peer to answer a cancel.
+	cancelTimeout = 10 //seconds
 )
 
 // ErrRejected signals that transfer was rejected.
 var ErrRejected = errors.New(`REJECTED`)
 
+// ErrCancelled signals that transfer was cancelled by one of the peers.
+var ErrCancelled = errors.New(`CANCELLED`)
+
+// ErrUnreachable signals that it wasn't possible to connect with the
+// receiver, like when it left the network.
+var ErrUnreachable = errors.New(`UNREACHABLE`)
+
+// Conn is the connection with the receiver of a transfer.
+type Conn struct {
+	net.Conn
+	proto *protocol.Conn
+	gate  *pauseGate
+}
+
 // SendTransferReq receives a transfer, generates a request transfer
 // message and send it to the receiver.
 //
+// The connection starts with the protocol handshake, if the receiver
+// doesn't support it a new connection is made using the legacy protocol.
+//
+// If the identity is not nil and the receiver supports it the connection
+// is upgraded to TLS, if the transfer has the PeerFingerprint the receiver
+// certificate must match it and the connection must be upgraded.
+//
+// If the receiver advertised its protocol version the legacy protocol is
+// never used, and if it advertised its capabilities a directory or batch
+// it doesn't support fails without connecting.
+//
 // If there is an error, it can be because it wasn't possible to establish
-// a connection with the receiver, an error setting the timeout or an error
-// when writing the message to the receiver.
-func SendTransferReq(ctx context.Context, t *Transfer) (net.Conn, error) {
+// a connection with the receiver, wrapping ErrUnreachable, the receiver
+// fingerprint doesn't match,
+// an error setting the timeout or an error when writing the message to the
+// receiver.
+func SendTransferReq(ctx context.Context, t *Transfer, id *identity.Identity) (*Conn, error) {
 
 	rm := protocol.RequestMessage{
-		FileName: t.FileName,
-		FileSize: t.FileSize,
-		Hostname: t.SenderName,
-		Checksum: t.FileChecksum,
+		ID:        t.ID,
+		FileName:  t.FileName,
+		FileSize:  t.FileSize,
+		Hostname:  t.LocalName,
+		Checksum:  t.FileChecksum,
+		Dir:       t.Directory,
+		Batch:     t.Batch,
+		Files:     toFileMessages(t.Files),
+		Reconnect: t.reconnect,
 	}
 
-	conn, err := net.DialTimeout(network.Type, t.SenderAddr.String(), dialTimeout*time.Second)
+	if err := checkAdvertised(t); err != nil {
+		return nil, err
+	}
+
+	conn, err := dial(t.SenderAddr, false, id, t.PeerFingerprint, t.Interfaces)
+	if errors.Is(err, protocol.ErrLegacyPeer) && t.PeerProtocol == 0 {
+		clog.Info("receiver %v doesn't support the handshake, using legacy protocol", t.SenderAddr)
+		conn, err = dial(t.SenderAddr, true, id, t.PeerFingerprint, t.Interfaces)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("sender send transfer request error connecting: %v", err)
+		return nil, err
+	}
+
+	if t.PeerFingerprint != "" && !conn.proto.Has(protocol.CapTLS) {
+		closeConn(conn)
+		return nil, fmt.Errorf("sender send transfer request error: receiver didn't use TLS, possible impersonation")
+	}
+
+	if t.Directory && !conn.proto.Has(protocol.CapDirectory) {
+		closeConn(conn)
+		return nil, fmt.Errorf("sender send transfer request error: receiver doesn't support directories")
+	}
+
+	if t.Batch && !conn.proto.Has(protocol.CapBatch) {
+		closeConn(conn)
+		return nil, fmt.Errorf("sender send transfer request error: receiver doesn't support batches")
 	}
 
 	if err = conn.SetWriteDeadline(time.Now().Add(writeTimeout * time.Second)); err != nil {
-		if err = conn.Close(); err != nil {
-			return conn, err
+		if cErr := conn.Close(); cErr != nil {
+			return nil, cErr
 		}
 		return nil, fmt.Errorf("sender send transfer request set timeout error: %v", err)
 	}
 
-	if err = protocol.WriteRequestMessage(rm, conn); err != nil {
+	if err = conn.proto.WriteRequest(rm); err != nil {
 		if cErr := conn.Close(); cErr != nil {
-			return conn, cErr
+			return nil, cErr
 		}
 		return nil, err
 	}
@@ -66,40 +128,389 @@ func SendTransferReq(ctx context.Context, t *Transfer) (net.Conn, error) {
 	return conn, nil
 }
 
+// checkAdvertised returns an error if the transfer needs a capability the
+// receiver advertised it doesn't support, a receiver that didn't advertise
+// its capabilities is checked after the handshake.
+func checkAdvertised(t *Transfer) error {
+	if t.PeerCapabilities == nil {
+		return nil
+	}
+
+	advertised := protocol.ParseCapabilities(t.PeerCapabilities)
+	if t.Directory && advertised&protocol.CapDirectory == 0 {
+		return fmt.Errorf("sender send transfer request error: receiver doesn't support directories")
+	}
+	if t.Batch && advertised&protocol.CapBatch == 0 {
+		return fmt.Errorf("sender send transfer request error: receiver doesn't support batches")
+	}
+	return nil
+}
+
+// dial will establish a connection with the receiver and make the protocol
+// handshake, if legacy is true the handshake is skipped. If both support it
+// the connection is upgraded to TLS and the receiver certificate must match
+// the expected fingerprint, if not empty. The addresses on the networks of
+// the ifaces, all the interfaces if nil, are tried first.
+//
+// If the receiver doesn't answer the handshake protocol.ErrLegacyPeer is
+// returned and the connection is closed.
+func dial(addr net.Addr, legacy bool, id *identity.Identity, expected string, ifaces []net.Interface) (*Conn, error) {
+	if addr == nil {
+		return nil, fmt.Errorf("sender dial error: address is nil")
+	}
+
+	conn, err := network.Dial(addr, dialTimeout*time.Second, ifaces)
+	if err != nil {
+		return nil, fmt.Errorf("sender send transfer request error connecting: %w: %v", ErrUnreachable, err)
+	}
+
+	if legacy {
+		return &Conn{Conn: conn, proto: protocol.NewLegacyConn(conn)}, nil
+	}
+
+	if err = conn.SetDeadline(time.Now().Add(handshakeTimeout * time.Second)); err != nil {
+		closeConn(conn)
+		return nil, fmt.Errorf("sender dial set handshake timeout error: %v", err)
+	}
+
+	pc, err := protocol.Handshake(conn, capabilities(id))
+	if err != nil {
+		closeConn(conn)
+		return nil, err
+	}
+
+	if pc.Has(protocol.CapTLS) {
+		tc := tls.Client(conn, id.ClientConfig(expected))
+		if err = tc.Handshake(); err != nil {
+			closeConn(conn)
+			return nil, fmt.Errorf("sender dial tls handshake error: %w", err)
+		}
+		pc.Upgrade(tc)
+		conn = tc
+	}
+
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		closeConn(conn)
+		return nil, fmt.Errorf("sender dial reset handshake timeout error: %v", err)
+	}
+
+	return &Conn{Conn: conn, proto: pc}, nil
+}
+
+// ProtocolVersion is the version of the transfer protocol advertised to
+// the other peers.
+const ProtocolVersion = int(protocol.Version)
+
+// Capabilities returns the names of the protocol capabilities advertised
+// to the other peers, TLS is only supported if there is an identity.
+func Capabilities(id *identity.Identity) []string {
+	return capabilities(id).Names()
+}
+
+// capabilities returns the protocol capabilities supported, TLS is only
+// supported if there is an identity to use on the connection.
+func capabilities(id *identity.Identity) protocol.Capability {
+	if id == nil {
+		return protocol.Capabilities &^ protocol.CapTLS
+	}
+	return protocol.Capabilities
+}
+
 // WaitConfirmation will wait until the receiver accepts or rejects the transfer.
 //
 // If rejected it will just terminate and update the transfer status. Otherwise
-// it will start sending the file content to the receiver.
-func WaitConfirmation(ctx context.Context, i int, inOut io.ReadWriteCloser, store *TransferStore) error {
-	done := make(chan interface{})
+// it will start sending the file content to the receiver, on a batch only the
+// files selected by the receiver are sent.
+//
+// If the receiver supports it, after sending all the content it waits for
+// the result of the verification made by the receiver, if it failed an error
+// wrapping ErrChecksumMismatch, ErrSizeMismatch or ErrReceiveFailed is
+// returned.
+//
+// If the context is cancelled or the receiver cancels the transfer, the
+// transfer and its files are updated to Cancelled and ErrCancelled is
+// returned.
+//
+// While the transfer is paused by one of the peers the sending is held, if
+// the connection is lost meanwhile ErrConnectionLost is returned and the
+// transfer can continue with Reconnect.
+func WaitConfirmation(ctx context.Context, id string, conn *Conn, store *TransferStore) error {
+	stopWatch := closeOnDone(ctx, conn)
+	defer stopWatch()
+
+	decision, err := conn.proto.ReadDecision()
+	if err != nil {
+		if ctx.Err() != nil {
+			return cancelled(id, store.Get(id), store)
+		}
+		return fmt.Errorf("sender wait confirmation read decision error: %v", err)
+	}
+
+	// After the decision the receiver is told about the cancellation instead
+	// of closing the connection, so it can clean up.
+	if conn.proto.Has(protocol.CapCancel) {
+		stopWatch()
+	}
+
+	trans := store.Get(id)
+	if trans == nil {
+		return ErrCancelled
+	}
+
+	if !decision.Accept {
+		return ErrRejected
+	}
+
+	offset := decision.Offset
+	if offset < 0 || offset > trans.FileSize || (offset > 0 && trans.HasFiles()) {
+		return fmt.Errorf("sender wait confirmation error: invalid resume offset %d", offset)
+	}
+
+	if trans.Batch {
+		if err = selectFiles(trans, decision.Files); err != nil {
+			return err
+		}
+	}
+
+	// A reconnected transfer keeps the pause made before the connection
+	// was lost.
+	paused := trans.Status == Paused
+	if !paused {
+		trans.Status = Accepted
+	}
+	trans.setFilesStatus(Accepted)
+	store.Update(id, trans)
+
+	if offset > 0 {
+		clog.Info("resuming transfer id:%s from offset: %d", id, offset)
+	}
+
+	size := trans.SelectedSize()
+	onProg := func(transferred int) {
+		store.UpdateProgress(id, offset+int64(transferred), size)
+	}
+
+	// Anything sent by the receiver before the end of the data, like a
+	// cancel, stops the sending.
+	sendCtx, stopSend := context.WithCancel(ctx)
+	defer stopSend()
+
+	var stopPause func()
+	conn.gate, stopPause = watchPause(id, conn.proto, store, paused)
+	defer stopPause()
+
+	var results <-chan resultReply
+	if conn.proto.Has(protocol.CapResult) {
+		results = readResult(conn, stopSend)
+	}
+
+	err = sendData(sendCtx, conn, trans, offset, onProg, store.Limits.limiters(trans.SenderName))
+	lost := conn.gate.isPaused() && !trans.HasFiles()
+	stopPause()
+	switch {
+	case ctx.Err() != nil:
+		cancelReceiver(conn, results)
+		return cancelled(id, trans, store)
+	case err != nil && sendCtx.Err() == nil:
+		return err
+	}
 
+	if results == nil {
+		trans.setFilesStatus(Completed)
+		store.Update(id, trans)
+		return nil
+	}
+
+	if err == nil {
+		trans.Status = Verifying
+		trans.setFilesStatus(Verifying)
+		store.Update(id, trans)
+	}
+
+	var reply resultReply
+	select {
+	case reply = <-results:
+	case <-ctx.Done():
+		cancelReceiver(conn, nil)
+		return cancelled(id, trans, store)
+	}
+
+	switch {
+	case errors.Is(reply.err, protocol.ErrCancelled):
+		// Answer the receiver so it knows the sending stopped.
+		if err = conn.proto.WriteCancel(); err != nil {
+			clog.Error(err)
+		}
+		return cancelled(id, trans, store)
+	case reply.err != nil && lost:
+		return fmt.Errorf("%w: %v", ErrConnectionLost, reply.err)
+	case reply.err != nil:
+		return fmt.Errorf("sender wait confirmation read result error: %v", reply.err)
+	}
+
+	err = applyResult(trans, reply.m)
+	store.Update(id, trans)
+	return err
+}
+
+// resultReply is the result sent by the receiver or the error reading it.
+type resultReply struct {
+	m   protocol.ResultMessage
+	err error
+}
+
+// readResult will start a new goroutine to read the result sent by the
+// receiver, once anything is read onRead is called.
+func readResult(conn *Conn, onRead func()) <-chan resultReply {
+	results := make(chan resultReply, 1)
+	go func() {
+		m, err := conn.proto.ReadResult()
+		onRead()
+		results <- resultReply{m: m, err: err}
+	}()
+	return results
+}
+
+// sendData will send the content of the file or files to the receiver and
+// signal the end of the data, the sending is limited by the limiters.
+func sendData(ctx context.Context, conn *Conn, t *Transfer, offset int64, onProg file.OnProgressChange, lim []*file.Limiter) error {
+	var err error
+	if t.HasFiles() {
+		err = sendFiles(ctx, conn, t, onProg, lim)
+	} else {
+		err = sendFile(ctx, conn, t.LocalFilePath, offset, onProg, lim)
+	}
+	if err != nil {
+		return err
+	}
+	return conn.proto.CloseData()
+}
+
+// closeOnDone will start a new goroutine that closes the connection if the
+// context is cancelled, until the returned function is called.
+func closeOnDone(ctx context.Context, conn *Conn) func() {
+	done := make(chan interface{})
 	go func() {
 		select {
 		case <-ctx.Done():
-			if err := inOut.Close(); err != nil {
-				clog.Error(err)
-			}
+			closeConn(conn)
 		case <-done:
 		}
 	}()
 
-	accept, err := protocol.ReadDecision(inOut)
-	if err != nil {
-		return fmt.Errorf("sender wait confirmation read decision error: %v", err)
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
 	}
+}
 
-	close(done) // clean the context cancellation goroutine if it wasn't cancelled.
+// cancelReceiver will send the cancel to the receiver and wait until it
+// answers or cancelTimeout is reached, so the receiver can clean up before
+// the connection is closed.
+func cancelReceiver(conn *Conn, results <-chan resultReply) {
+	if !conn.proto.Has(protocol.CapCancel) {
+		return
+	}
 
-	trans := store.Get(i)
+	if err := conn.proto.WriteCancel(); err != nil {
+		clog.Error(err)
+		return
+	}
 
-	if !accept {
-		return ErrRejected
+	if results == nil {
+		return
 	}
 
-	trans.Status = Accepted
-	store.Update(i, trans)
+	select {
+	case <-results:
+	case <-time.After(cancelTimeout * time.Second):
+		clog.Info("receiver %v didn't answer the cancel", conn.RemoteAddr())
+	}
+}
+
+// cancelled will update the transfer and its files to Cancelled and return
+// ErrCancelled, if the transfer was removed meanwhile there is nothing to
+// update.
+func cancelled(id string, t *Transfer, store *TransferStore) error {
+	if t == nil {
+		return ErrCancelled
+	}
+	t.Status = Cancelled
+	t.setFilesStatus(Cancelled)
+	store.Update(id, t)
+	return ErrCancelled
+}
+
+// applyResult will update the files status with the result of the
+// verification sent by the receiver and return the error if it failed.
+//
+// On a directory all the files fail together, on a batch only the files on
+// the result fail.
+func applyResult(t *Transfer, m protocol.ResultMessage) error {
+	var base error
+	switch m.Code {
+	case protocol.ResultOK:
+	case protocol.ResultChecksumMismatch:
+		base = ErrChecksumMismatch
+	case protocol.ResultSizeMismatch:
+		base = ErrSizeMismatch
+	default:
+		base = ErrReceiveFailed
+	}
+
+	switch {
+	case base == nil:
+		t.setFilesStatus(Completed)
+	case t.Batch && len(m.Failed) > 0:
+		t.setFilesStatus(Completed)
+		for _, idx := range m.Failed {
+			if idx >= 0 && idx < len(t.Files) && t.Files[idx].Status != Rejected {
+				t.Files[idx].Status = Error
+			}
+		}
+	default:
+		t.setFilesStatus(Error)
+	}
 
-	r, err := file.Open(trans.LocalFilePath, file.OPEN_READ)
+	if base == nil {
+		return nil
+	}
+	if m.Reason == "" {
+		return base
+	}
+	return fmt.Errorf("%w, receiver reported: %s", base, m.Reason)
+}
+
+// selectFiles will mark the files of the batch that were not selected by
+// the receiver as Rejected.
+//
+// If there is an error, it can be because no file was selected or the
+// selection has indexes not ordered or out of the batch range.
+func selectFiles(t *Transfer, selected []int) error {
+	if len(selected) == 0 {
+		return fmt.Errorf("sender wait confirmation error: no files selected")
+	}
+
+	next := 0
+	for _, idx := range selected {
+		if idx < next || idx >= len(t.Files) {
+			return fmt.Errorf("sender wait confirmation error: invalid file selection %v", selected)
+		}
+		for ; next < idx; next++ {
+			t.Files[next].Status = Rejected
+		}
+		next = idx + 1
+	}
+	for ; next < len(t.Files); next++ {
+		t.Files[next].Status = Rejected
+	}
+	return nil
+}
+
+// sendFile will send the content of the file to the receiver starting
+// from the offset.
+func sendFile(ctx context.Context, conn *Conn, filePath string, offset int64, onProg file.OnProgressChange, lim []*file.Limiter) error {
+	r, err := file.Open(filePath, file.OPEN_READ)
 	if err != nil {
 		return fmt.Errorf("sender wait confirmation open file to send error: %v", err)
 	}
@@ -110,9 +521,84 @@ func WaitConfirmation(ctx context.Context, i int, inOut io.ReadWriteCloser, stor
 		}
 	}()
 
-	_, err = file.Stream(ctx, r, inOut, func(transferred int) {
-		store.UpdateProgress(i, float64(transferred)/float64(trans.FileSize))
-	})
-
+	_, err = file.StreamFrom(ctx, r, conn.dataWriter(ctx), offset, onProg, lim...)
 	return err
 }
+
+// sendFiles will send the content of each file of the directory or batch
+// one after the other, the receiver uses the size of each file to split them.
+// The files rejected by the receiver are skipped.
+//
+// If a file changed its size since the transfer was requested the transfer
+// fails since the receiver would not be able to split the files.
+func sendFiles(ctx context.Context, conn *Conn, t *Transfer, onProg file.OnProgressChange, lim []*file.Limiter) error {
+	var sent int
+	for _, f := range t.Files {
+		if f.Status == Rejected {
+			continue
+		}
+
+		filePath, err := t.filePath(f)
+		if err != nil {
+			return err
+		}
+
+		r, err := file.Open(filePath, file.OPEN_READ)
+		if err != nil {
+			return fmt.Errorf("sender send files open file to send error: %v", err)
+		}
+
+		n, err := file.Stream(ctx, io.LimitReader(r, f.Size), conn.dataWriter(ctx), func(transferred int) {
+			onProg(sent + transferred)
+		}, lim...)
+
+		if cErr := r.Close(); cErr != nil {
+			clog.Error(fmt.Errorf("sender send files close file to send error: %v", cErr))
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if int64(n) != f.Size {
+			return fmt.Errorf("sender send files error: file %s changed size", f.Path)
+		}
+
+		sent += n
+	}
+	return nil
+}
+
+// dataWriter returns the writer of the file content, it holds the writes
+// while the transfer is paused.
+func (c *Conn) dataWriter(ctx context.Context) io.Writer {
+	if c.gate == nil {
+		return c.proto.DataWriter()
+	}
+	return &pausedWriter{ctx: ctx, gate: c.gate, w: c.proto.DataWriter()}
+}
+
+// closeConn will close the connection and log the error if any.
+func closeConn(c io.Closer) {
+	if err := c.Close(); err != nil {
+		clog.Error(err)
+	}
+}
+
+// toFileMessages will convert the files of a directory or batch transfer
+// into the protocol representation.
+func toFileMessages(files []File) []protocol.FileMessage {
+	if len(files) == 0 {
+		return nil
+	}
+
+	fm := make([]protocol.FileMessage, 0, len(files))
+	for _, f := range files {
+		fm = append(fm, protocol.FileMessage{
+			Path:     f.Path,
+			Size:     f.Size,
+			Checksum: f.Checksum,
+		})
+	}
+	return fm
+}
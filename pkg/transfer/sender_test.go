@@ -0,0 +1,155 @@
+package transfer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+	"github.com/fabiodcorreia/catch-my-file/pkg/transfer/internal/protocol"
+)
+
+// newBatch will create a batch upload transfer with 3 files.
+func newBatch() *Transfer {
+	return NewBatchTransfer("peer-1", []File{
+		{Entry: file.Entry{Path: "a.txt", Size: 1}, Status: Waiting},
+		{Entry: file.Entry{Path: "b.txt", Size: 2}, Status: Waiting},
+		{Entry: file.Entry{Path: "c.txt", Size: 4}, Status: Waiting},
+	}, nil, Upload)
+}
+
+func Test_selectFiles(t *testing.T) {
+
+	t.Run("select some files", func(t *testing.T) {
+		tr := newBatch()
+
+		if err := selectFiles(tr, []int{0, 2}); err != nil {
+			t.Errorf("selectFiles not expected error = %v", err)
+		}
+		if tr.Files[1].Status != Rejected || tr.Files[0].Status == Rejected || tr.Files[2].Status == Rejected {
+			t.Errorf("selectFiles expected only the file 1 rejected but got = %v", tr.Files)
+		}
+		if tr.SelectedSize() != 5 {
+			t.Errorf("selectFiles expected selected size = %v but got = %v", 5, tr.SelectedSize())
+		}
+	})
+
+	t.Run("no files selected", func(t *testing.T) {
+		if err := selectFiles(newBatch(), nil); err == nil {
+			t.Errorf("selectFiles expected error = %v", err)
+		}
+	})
+
+	t.Run("index out of range", func(t *testing.T) {
+		if err := selectFiles(newBatch(), []int{0, 3}); err == nil {
+			t.Errorf("selectFiles expected error = %v", err)
+		}
+	})
+
+	t.Run("index repeated", func(t *testing.T) {
+		if err := selectFiles(newBatch(), []int{1, 1}); err == nil {
+			t.Errorf("selectFiles expected error = %v", err)
+		}
+	})
+}
+
+func Test_applyResult(t *testing.T) {
+	t.Run("verified by the receiver", func(t *testing.T) {
+		tr := newBatch()
+
+		if err := applyResult(tr, protocol.ResultMessage{Code: protocol.ResultOK}); err != nil {
+			t.Errorf("applyResult not expected error = %v", err)
+		}
+		for _, f := range tr.Files {
+			if f.Status != Completed {
+				t.Errorf("applyResult expected file %s status = %v but got = %v", f.Path, Completed, f.Status)
+			}
+		}
+	})
+
+	t.Run("some files of the batch failed", func(t *testing.T) {
+		tr := newBatch()
+		tr.Files[2].Status = Rejected
+
+		err := applyResult(tr, protocol.ResultMessage{Code: protocol.ResultChecksumMismatch, Reason: "1 files are not valid", Failed: []int{1}})
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("applyResult expected error = %v but got = %v", ErrChecksumMismatch, err)
+		}
+
+		want := []Status{Completed, Error, Rejected}
+		for j, f := range tr.Files {
+			if f.Status != want[j] {
+				t.Errorf("applyResult expected file %s status = %v but got = %v", f.Path, want[j], f.Status)
+			}
+		}
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		if err := applyResult(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload), protocol.ResultMessage{Code: protocol.ResultSizeMismatch}); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("applyResult expected error = %v but got = %v", ErrSizeMismatch, err)
+		}
+	})
+
+	t.Run("unknown result code", func(t *testing.T) {
+		if err := applyResult(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload), protocol.ResultMessage{Code: "unknown"}); !errors.Is(err, ErrReceiveFailed) {
+			t.Errorf("applyResult expected error = %v but got = %v", ErrReceiveFailed, err)
+		}
+	})
+}
+
+func Test_checkAdvertised(t *testing.T) {
+	t.Run("capabilities not advertised", func(t *testing.T) {
+		if err := checkAdvertised(newBatch()); err != nil {
+			t.Errorf("checkAdvertised not expected error = %v", err)
+		}
+	})
+
+	t.Run("batch advertised", func(t *testing.T) {
+		tr := newBatch()
+		tr.PeerCapabilities = []string{"batch", "tls"}
+
+		if err := checkAdvertised(tr); err != nil {
+			t.Errorf("checkAdvertised not expected error = %v", err)
+		}
+	})
+
+	t.Run("batch not advertised", func(t *testing.T) {
+		tr := newBatch()
+		tr.PeerCapabilities = []string{"directory", "tls"}
+
+		if err := checkAdvertised(tr); err == nil {
+			t.Errorf("checkAdvertised expected error but got = %v", err)
+		}
+	})
+
+	t.Run("directory not advertised", func(t *testing.T) {
+		tr := NewDirectoryTransfer("dir", "peer-1", []file.Entry{{Path: "a.txt", Size: 1}}, nil, Upload)
+		tr.PeerCapabilities = []string{}
+
+		if err := checkAdvertised(tr); err == nil {
+			t.Errorf("checkAdvertised expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_cancelled(t *testing.T) {
+	t.Run("transfer cancelled", func(t *testing.T) {
+		store := NewStore()
+		id := store.Add(NewTransfer("a.txt", "abc", "peer-1", 1, nil, Upload))
+
+		if err := cancelled(id, store.Get(id), store); !errors.Is(err, ErrCancelled) {
+			t.Errorf("cancelled expected error = %v but got = %v", ErrCancelled, err)
+		}
+
+		if got := store.Get(id).Status; got != Cancelled {
+			t.Errorf("cancelled expected status = %v but got = %v", Cancelled, got)
+		}
+	})
+
+	t.Run("transfer removed", func(t *testing.T) {
+		store := NewStore()
+
+		if err := cancelled("missing", store.Get("missing"), store); !errors.Is(err, ErrCancelled) {
+			t.Errorf("cancelled expected error = %v but got = %v", ErrCancelled, err)
+		}
+	})
+}
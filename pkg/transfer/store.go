@@ -1,140 +1,481 @@
 package transfer
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
 )
 
 // OnStoreChange is a function that is executed everytime a
 // transfer is added, removed or updated to the store.
-type OnStoreChange func(i int)
+type OnStoreChange func(id string)
 
 // TransferStore is a thread-safe store that allows to store, retrieve, remove,
 // and update transfer and also get notification when the content of the store changes.
+//
+// The transfers are identified by their ID and kept in the order they were
+// added. The Limits of the store are applied to all its transfers and the
+// transfers that finish are recorded on the History, if there is one.
 type TransferStore struct {
 	OnStoreChange
-	mu   sync.Mutex
-	data []*Transfer
+	Limits  *Limits
+	History *History
+	// ProgressInterval is the minimum interval between the progress sent to
+	// the subscribers of a transfer.
+	ProgressInterval time.Duration
+	mu               sync.Mutex
+	data             []*Transfer
+	index            map[string]*Transfer
 }
 
 // NewTransferStore will create a new instance of TransferStore which is thread-safe.
 func NewStore() *TransferStore {
 	return &TransferStore{
-		data: make([]*Transfer, 0, 3),
+		Limits:           NewLimits(),
+		ProgressInterval: DefaultProgressInterval,
+		data:             make([]*Transfer, 0, 3),
+		index:            make(map[string]*Transfer),
 	}
 }
 
-// Get will return an immutable transfer by the position i on the store.
+// Get will return an immutable transfer with the id, if there is no
+// transfer with that id returns nil.
 //
 // This transfer instance is a copy of the instance stored and for that
 // reason any changes to the returned instance will not have effect on the
 // stored instance.
-func (s *TransferStore) Get(i int) *Transfer {
+func (s *TransferStore) Get(id string) *Transfer {
 	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if i < 0 || i > s.Size()-1 {
+	t, ok := s.index[id]
+	if !ok {
 		return nil
 	}
+	return t.copy()
+}
 
-	//Make a copy of the object stored to avoid outside mutations.
-	cp := new(Transfer)
-	*cp = *s.data[i]
-
-	s.mu.Unlock()
+// List will return a copy of all the transfers in the order they were
+// added.
+func (s *TransferStore) List() []*Transfer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return cp
+	list := make([]*Transfer, 0, len(s.data))
+	for _, t := range s.data {
+		list = append(list, t.copy())
+	}
+	return list
 }
 
-// Add will add a transfer to the store and return is position. If t is ni
-// the transfer is not added and returns -1.
+// Add will add a transfer to the store and return its id. If t is nil the
+// transfer is not added and returns an empty id.
+//
+// If there is already a transfer with the same id, like a transfer sent to
+// the local peer, the transfer gets a new id.
 //
 // Also executes the function OnStoreChange after the transfer gets added.
-func (s *TransferStore) Add(t *Transfer) int {
+func (s *TransferStore) Add(t *Transfer) string {
 	if t == nil {
-		return -1
+		return ""
 	}
+
 	s.mu.Lock()
+	if _, ok := s.index[t.ID]; ok || t.ID == "" {
+		t.ID = newID()
+	}
 	s.data = append(s.data, t)
-	i := len(s.data) - 1
+	s.index[t.ID] = t
+	id := t.ID
 	s.mu.Unlock()
 
 	if s.OnStoreChange != nil {
-		s.OnStoreChange(i)
+		s.OnStoreChange(id)
 	}
 
-	return i
+	return id
 }
 
-// Update will update the tranfer stored at position i with the values of t.
+// Remove will remove the transfer with the id from the store, only the
+// transfers with a final status can be removed.
 //
-// Only the status, localfilepath and error are updated. It Also executes the
-// function OnStoreChange after the transfer gets updated.
+// Also executes the function OnStoreChange after the transfer gets removed.
+//
+// If there is an error, it can be because there is no transfer with the id
+// or the transfer didn't finish yet.
+func (s *TransferStore) Remove(id string) error {
+	s.mu.Lock()
+	t, ok := s.index[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("transfer store remove error: transfer %s not found", id)
+	}
+
+	if !t.Status.IsFinal() {
+		s.mu.Unlock()
+		return fmt.Errorf("transfer store remove error: transfer %s didn't finish", id)
+	}
+
+	s.remove(t)
+	s.mu.Unlock()
+
+	if s.OnStoreChange != nil {
+		s.OnStoreChange(id)
+	}
+	return nil
+}
+
+// RemoveFinished will remove all the transfers with a final status from the
+// store and return the number of transfers removed.
+//
+// Also executes the function OnStoreChange after each transfer gets removed.
+func (s *TransferStore) RemoveFinished() int {
+	s.mu.Lock()
+	var removed []string
+	for _, t := range append([]*Transfer(nil), s.data...) {
+		if t.Status.IsFinal() {
+			s.remove(t)
+			removed = append(removed, t.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	if s.OnStoreChange != nil {
+		for _, id := range removed {
+			s.OnStoreChange(id)
+		}
+	}
+	return len(removed)
+}
+
+// remove will remove the transfer t from the store and close its channels,
+// so no one is left waiting for it. It must be called with the lock held.
+func (s *TransferStore) remove(t *Transfer) {
+	delete(s.index, t.ID)
+	for j := range s.data {
+		if s.data[j] == t {
+			s.data = append(s.data[:j], s.data[j+1:]...)
+			break
+		}
+	}
+
+	if t.wait != nil {
+		close(t.wait)
+		t.wait = nil
+	}
+	t.closeProgress()
+}
+
+// Update will update the tranfer stored with the id with the values of t.
+//
+// Only the status, localfilepath, files status and error are updated. It Also
+// executes the function OnStoreChange after the transfer gets updated.
 //
 // If the status changes from Waiting it will close the waiting channel.
 //
-// If the status change to a final status it will close the progress channel.
-func (s *TransferStore) Update(i int, t *Transfer) {
-	if i < 0 || i > s.Size()-1 || t == nil {
+// If the status change to a final status it will close the progress channel
+// and record the transfer on the History. Once the transfer has a final
+// status it's not updated anymore, so a late update from a transfer that
+// was cancelled doesn't replace it.
+func (s *TransferStore) Update(id string, t *Transfer) {
+	if t == nil {
 		return
 	}
 
 	s.mu.Lock()
-	s.update(i, t)
+	stored, ok := s.index[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	s.updated(id, stored, t)
+}
+
+// Decide will update the download with the id with the decision on t, like
+// Update, only if it's still Waiting for a decision. The status is checked
+// and updated at once so the decisions taken at the same time, like on the
+// window and the control API, don't replace each other.
+//
+// If there is an error, it's because the transfer doesn't exist, it's not a
+// download or it was already decided.
+func (s *TransferStore) Decide(id string, t *Transfer) error {
+	if t == nil {
+		return fmt.Errorf("transfer %s is not waiting for a decision", id)
+	}
+
+	s.mu.Lock()
+	stored, ok := s.index[id]
+	if !ok || stored.Direction != Download || stored.Status != Waiting {
+		s.mu.Unlock()
+		return fmt.Errorf("transfer %s is not waiting for a decision", id)
+	}
+	s.updated(id, stored, t)
+	return nil
+}
+
+// ClearError will remove the error of the transfer with the id once it was
+// shown, the status is kept. Since a transfer with an Error status is not
+// updated anymore this is the only way to change it.
+//
+// Also executes the function OnStoreChange after the error gets removed.
+func (s *TransferStore) ClearError(id string) {
+	s.mu.Lock()
+	stored, ok := s.index[id]
+	if !ok || stored.err == nil {
+		s.mu.Unlock()
+		return
+	}
+	stored.err = nil
 	s.mu.Unlock()
 
 	if s.OnStoreChange != nil {
-		s.OnStoreChange(i)
+		s.OnStoreChange(id)
 	}
 }
 
-func (s *TransferStore) update(i int, t *Transfer) {
-	s.data[i].Status = t.Status
-	s.data[i].LocalFilePath = t.LocalFilePath
-	s.data[i].err = t.err
+// updated will update the stored transfer with the id with the values of t
+// and notify the change, it must be called with the lock held and it
+// releases it. A transfer with a final status is left as it is, unless t
+// is the transfer stored, as the one given to Add, that was already changed.
+func (s *TransferStore) updated(id string, stored, t *Transfer) {
+	if stored.Status.IsFinal() && stored != t {
+		s.mu.Unlock()
+		return
+	}
+	finished := update(stored, t)
+	s.mu.Unlock()
+
+	if finished {
+		s.record(id)
+	}
+
+	if s.OnStoreChange != nil {
+		s.OnStoreChange(id)
+	}
+}
+
+// update will update the stored transfer with the values of t and return
+// true if the status changed to a final status.
+func update(stored, t *Transfer) bool {
+	finished := !stored.Status.IsFinal() && t.Status.IsFinal()
+
+	// The time the transfer is paused doesn't count on the rate.
+	if stored.Status != t.Status && (stored.Status == Paused || t.Status == Paused) {
+		stored.resetRate()
+	}
+	stored.Status = t.Status
+	stored.LocalFilePath = t.LocalFilePath
+	stored.err = t.err
+
+	for j := range stored.Files {
+		if j < len(t.Files) {
+			stored.Files[j].Status = t.Files[j].Status
+		}
+	}
 
 	// If the waiting channel is open and the status is not waiting,
 	// it will close the channel to unlock the waiting.
-	if s.data[i].wait != nil && t.Status != Waiting {
-		close(s.data[i].wait)
-		s.data[i].wait = nil
+	if stored.wait != nil && t.Status != Waiting {
+		close(stored.wait)
+		stored.wait = nil
+	}
+
+	if stored.Status.IsFinal() {
+		stored.closeProgress()
+	}
+	return finished
+}
+
+// record will add the transfer with the id to the History.
+func (s *TransferStore) record(id string) {
+	if s.History == nil {
+		return
+	}
+
+	t := s.Get(id)
+	if t == nil {
+		return
 	}
 
-	if s.data[i].Status.IsFinal() && s.data[i].prog != nil {
-		close(s.data[i].prog)
-		s.data[i].prog = nil
+	if err := s.History.Add(NewRecord(t, time.Now())); err != nil {
+		clog.Error(fmt.Errorf("transfer store record error: %v", err))
+	}
+}
+
+// WithCancel returns a context derived from ctx for the transfer with the
+// id that is cancelled when Cancel is called for the transfer, the cancel
+// function returned must be called once the transfer ends.
+//
+// If the transfer was already cancelled the context returned is cancelled.
+func (s *TransferStore) WithCancel(ctx context.Context, id string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.index[id]
+	if !ok || t.Status == Cancelled {
+		cancel()
+		return ctx, cancel
+	}
+
+	t.cancel = cancel
+	return ctx, cancel
+}
+
+// Cancel will cancel the transfer with the id, if the transfer is running
+// its context is cancelled and the transfer is responsible to end with the
+// status Cancelled, otherwise the status is changed right away.
+//
+// Transfers with a final status are not cancelled.
+func (s *TransferStore) Cancel(id string) {
+	s.mu.Lock()
+	stored, ok := s.index[id]
+	if !ok || stored.Status.IsFinal() {
+		s.mu.Unlock()
+		return
+	}
+
+	cancel := stored.cancel
+	if cancel == nil {
+		t := *stored
+		t.Status = Cancelled
+		t.setFilesStatus(Cancelled)
+		update(stored, &t)
+	}
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		return
+	}
+
+	s.record(id)
+
+	if s.OnStoreChange != nil {
+		s.OnStoreChange(id)
+	}
+}
+
+// SetPause will set the function that pauses or resumes the running transfer
+// with the id, nil removes it.
+func (s *TransferStore) SetPause(id string, pause func(paused bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.index[id]; ok {
+		t.pause = pause
+	}
+}
+
+// Pause will pause the transfer with the id or resume it if paused is
+// false, the transfer is responsible to update its status to Paused.
+//
+// Only running transfers that can be paused are affected.
+func (s *TransferStore) Pause(id string, paused bool) {
+	s.mu.Lock()
+	t, ok := s.index[id]
+	if !ok || t.Status.IsFinal() {
+		s.mu.Unlock()
+		return
+	}
+	pause := t.pause
+	s.mu.Unlock()
+
+	if pause != nil {
+		pause(paused)
 	}
 }
 
 // Size will return the current number of elements on the store.
 func (s *TransferStore) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return len(s.data)
 }
 
-// AddToWait will add a transfer to the store, return is position and it will
+// AddToWait will add a transfer to the store, return its id and it will
 // also return a channel that allows to wait until this transfer status changes
 // from waiting to another status.
-func (s *TransferStore) AddToWait(t *Transfer) (int, <-chan interface{}) {
-	id := s.Add(t)
-	if id == -1 {
-		return id, nil
+//
+// The channel is created before the transfer is added, so the decision can
+// be made by the function OnStoreChange.
+func (s *TransferStore) AddToWait(t *Transfer) (string, <-chan interface{}) {
+	if t == nil {
+		return "", nil
 	}
-	return id, s.data[id].waitDecision()
+	wait := t.waitDecision()
+	return s.Add(t), wait
 }
 
-// FollowProgress returns a channel for the transfer on the specified position
-// that allow the consumer to get the current progress of the transfer
-// everytime it changes.
-func (s *TransferStore) FollowProgress(i int) <-chan float64 {
-	if i < 0 || i > s.Size()-1 {
-		return nil
+// Subscribe returns a channel that receives the progress of the transfer
+// with the id and a function to cancel the subscription. The channel only
+// holds the last progress, so a subscriber that is not reading never blocks
+// the transfer.
+//
+// The channel is closed when the transfer gets a final status or is
+// removed, if the transfer already finished or there is no transfer with
+// the id the channel returned is already closed.
+func (s *TransferStore) Subscribe(id string) (<-chan Progress, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.index[id]
+	if !ok {
+		closed := make(chan Progress)
+		close(closed)
+		return closed, func() {}
+	}
+
+	sub := t.subscribe()
+	return sub, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		t.unsubscribe(sub)
 	}
-	return s.data[i].progress()
 }
 
-// UpdateProgress allows to update the progress of the transfer on the
-// specified index.
+// UpdateProgress allows to update the progress of the transfer with the id
+// with the bytes transferred out of the size. It never blocks.
 //
-// Everythime this function is called the channel from FollowProgress
-// will get the data provided here.
-func (s *TransferStore) UpdateProgress(id int, progress float64) {
-	s.data[id].progress() <- progress
+// The progress is sent to the subscribers at most once per
+// ProgressInterval, the updates in between are merged and the last one is
+// sent at the end of the interval.
+func (s *TransferStore) UpdateProgress(id string, transferred, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.index[id]
+	if !ok || t.Status.IsFinal() {
+		return
+	}
+
+	now := time.Now()
+	t.setProgress(transferred, size, now)
+
+	f := t.feed
+	if wait := s.ProgressInterval - now.Sub(f.sent); wait > 0 {
+		if f.flush == nil {
+			f.flush = time.AfterFunc(wait, func() {
+				s.flushProgress(t)
+			})
+		}
+		return
+	}
+	t.publish(now)
+}
+
+// flushProgress will send the pending progress of the transfer t at the end
+// of the interval.
+func (s *TransferStore) flushProgress(t *Transfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t.feed.flush = nil
+	if t.feed.pending && !t.feed.closed {
+		t.publish(time.Now())
+	}
 }
@@ -1,30 +1,34 @@
 package transfer
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 )
 
 func Test_TransferStore_Get(t *testing.T) {
 	t.Run("get with empty store", func(t *testing.T) {
 		s := NewStore()
-		tr := s.Get(0)
+		tr := s.Get("a1")
 
 		if tr != nil {
 			t.Errorf("get expected nil but got %v", tr)
 		}
 	})
 
-	t.Run("get with invalid index", func(t *testing.T) {
+	t.Run("get with invalid id", func(t *testing.T) {
 		s := NewStore()
-		tr := s.Get(-1)
+		s.Add(&Transfer{})
+		tr := s.Get("")
 
 		if tr != nil {
 			t.Errorf("get expected nil but got %v", tr)
 		}
 	})
 
-	t.Run("get with valid index", func(t *testing.T) {
+	t.Run("get with valid id", func(t *testing.T) {
 		s := NewStore()
 		i := s.Add(&Transfer{})
 		tr := s.Get(i)
@@ -33,6 +37,17 @@ func Test_TransferStore_Get(t *testing.T) {
 			t.Errorf("get expected non nil but got %v", tr)
 		}
 	})
+
+	t.Run("get with files returns a copy", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{Batch: true, Files: []File{{Status: Waiting}}})
+		tr := s.Get(i)
+		tr.Files[0].Status = Rejected
+
+		if s.Get(i).Files[0].Status != Waiting {
+			t.Errorf("get expected files status = %v but got %v", Waiting, s.Get(i).Files[0].Status)
+		}
+	})
 }
 
 func Test_TransferStore_Add(t *testing.T) {
@@ -40,30 +55,174 @@ func Test_TransferStore_Add(t *testing.T) {
 		s := NewStore()
 		i := s.Add(nil)
 
-		if i != -1 {
-			t.Errorf("add expected nil but got %v", i)
+		if i != "" {
+			t.Errorf("add expected empty id but got %v", i)
 		}
 	})
 
 	t.Run("add valid transfer", func(t *testing.T) {
+		s := NewStore()
+		tr := NewTransfer("a.txt", "", "peer-1", 1, nil, Upload)
+		i := s.Add(tr)
+
+		if i != tr.ID {
+			t.Errorf("add expected %v but got %v", tr.ID, i)
+		}
+	})
+
+	t.Run("add transfer without id", func(t *testing.T) {
 		s := NewStore()
 		i := s.Add(&Transfer{})
 
-		if i != 0 {
-			t.Errorf("add expected 0 but got %v", i)
+		if !validID(i) || s.Get(i) == nil {
+			t.Errorf("add expected a new id but got %q", i)
+		}
+	})
+
+	t.Run("add transfer with duplicated id", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{ID: "abc", FileName: "a.txt"})
+		j := s.Add(&Transfer{ID: "abc", FileName: "b.txt"})
+
+		if i != "abc" || j == i || s.Get(j).FileName != "b.txt" {
+			t.Errorf("add expected a new id for b.txt but got %v and %v", i, j)
 		}
 	})
 
 	t.Run("add valid transfer with callback", func(t *testing.T) {
 		s := NewStore()
 		var changeEvent string
-		s.OnStoreChange = func(i int) {
-			changeEvent = fmt.Sprintf("Index Changed = %d", i)
+		s.OnStoreChange = func(id string) {
+			changeEvent = fmt.Sprintf("Transfer Changed = %s", id)
+		}
+		i := s.Add(&Transfer{})
+
+		if changeEvent != "Transfer Changed = "+i {
+			t.Errorf("add expected Transfer Changed = %s but got %v", i, changeEvent)
+		}
+	})
+}
+
+func Test_TransferStore_List(t *testing.T) {
+	t.Run("list with empty store", func(t *testing.T) {
+		s := NewStore()
+
+		if list := s.List(); len(list) != 0 {
+			t.Errorf("list expected empty but got %v", list)
+		}
+	})
+
+	t.Run("list on insertion order", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{FileName: "a.txt"})
+		j := s.Add(&Transfer{FileName: "b.txt"})
+
+		list := s.List()
+		if len(list) != 2 || list[0].ID != i || list[1].ID != j {
+			t.Errorf("list expected %v and %v but got %v", i, j, list)
+		}
+	})
+
+	t.Run("list returns copies", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{Status: Waiting})
+		s.List()[0].Status = Rejected
+
+		if s.Get(i).Status != Waiting {
+			t.Errorf("list expected status = %v but got %v", Waiting, s.Get(i).Status)
+		}
+	})
+}
+
+func Test_TransferStore_Remove(t *testing.T) {
+	t.Run("remove finished transfer", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{FileName: "a.txt", Status: Completed})
+		j := s.Add(&Transfer{FileName: "b.txt"})
+
+		var changeEvent string
+		s.OnStoreChange = func(id string) {
+			changeEvent = id
+		}
+
+		if err := s.Remove(i); err != nil {
+			t.Fatalf("remove not expected error = %v", err)
+		}
+
+		if s.Get(i) != nil || s.Size() != 1 || s.List()[0].ID != j {
+			t.Errorf("remove expected only %v but got %v", j, s.List())
+		}
+
+		if changeEvent != i {
+			t.Errorf("remove expected change of %v but got %v", i, changeEvent)
+		}
+	})
+
+	t.Run("remove running transfer", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{Status: Accepted})
+
+		if err := s.Remove(i); err == nil || s.Get(i) == nil {
+			t.Errorf("remove expected error but got = %v", err)
+		}
+	})
+
+	t.Run("remove closes the channels", func(t *testing.T) {
+		s := NewStore()
+		tr := &Transfer{}
+		wait := tr.waitDecision()
+		prog := tr.subscribe()
+		tr.Status = Rejected
+		i := s.Add(tr)
+
+		if err := s.Remove(i); err != nil {
+			t.Fatalf("remove not expected error = %v", err)
+		}
+
+		select {
+		case <-wait:
+		default:
+			t.Errorf("remove expected wait channel closed")
+		}
+
+		if _, ok := <-prog; ok {
+			t.Errorf("remove expected progress channel closed")
+		}
+	})
+
+	t.Run("remove missing transfer", func(t *testing.T) {
+		s := NewStore()
+
+		if err := s.Remove("a1"); err == nil {
+			t.Errorf("remove expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_TransferStore_RemoveFinished(t *testing.T) {
+	s := NewStore()
+	running := s.Add(&Transfer{Status: Accepted})
+	s.Add(&Transfer{Status: Completed})
+	s.Add(&Transfer{Status: Rejected})
+
+	var changed []string
+	s.OnStoreChange = func(id string) {
+		changed = append(changed, id)
+	}
+
+	t.Run("finished transfers removed", func(t *testing.T) {
+		if n := s.RemoveFinished(); n != 2 || len(changed) != 2 {
+			t.Errorf("remove finished expected 2 removed but got = %d (%v)", n, changed)
 		}
-		_ = s.Add(&Transfer{})
 
-		if changeEvent != "Index Changed = 0" {
-			t.Errorf("add expected Index Changed = 0 but got %v", changeEvent)
+		if s.Size() != 1 || s.Get(running) == nil {
+			t.Errorf("remove finished expected only %v but got = %v", running, s.List())
+		}
+	})
+
+	t.Run("nothing to remove", func(t *testing.T) {
+		if n := s.RemoveFinished(); n != 0 {
+			t.Errorf("remove finished expected 0 removed but got = %d", n)
 		}
 	})
 }
@@ -77,10 +236,10 @@ func Test_TransferStore_Update(t *testing.T) {
 		}()
 
 		s := NewStore()
-		s.Update(0, &Transfer{})
+		s.Update("a1", &Transfer{})
 	})
 
-	t.Run("update with invalid index", func(t *testing.T) {
+	t.Run("update with invalid id", func(t *testing.T) {
 		defer func() {
 			if err := recover(); err != nil {
 				t.Errorf("update not expected panic = %v", err)
@@ -88,7 +247,8 @@ func Test_TransferStore_Update(t *testing.T) {
 		}()
 
 		s := NewStore()
-		s.Update(-1, &Transfer{})
+		s.Add(&Transfer{})
+		s.Update("", &Transfer{})
 	})
 
 	t.Run("update to nil transfer", func(t *testing.T) {
@@ -123,19 +283,159 @@ func Test_TransferStore_Update(t *testing.T) {
 	t.Run("update transfer to error state with callback ", func(t *testing.T) {
 		s := NewStore()
 		var changeEvent string
-		s.OnStoreChange = func(i int) {
-			changeEvent = fmt.Sprintf("Index Changed = %d", i)
+		s.OnStoreChange = func(id string) {
+			changeEvent = fmt.Sprintf("Transfer Changed = %s", id)
 		}
 		i := s.Add(&Transfer{})
+		changeEvent = ""
 		tr1 := s.Get(i)
 		tr1.SetError(fmt.Errorf("my error"))
 		s.Update(i, tr1)
 
-		if changeEvent != "Index Changed = 0" {
-			t.Errorf("update expected Index Changed = 0 but got %v", changeEvent)
+		if changeEvent != "Transfer Changed = "+i {
+			t.Errorf("update expected Transfer Changed = %s but got %v", i, changeEvent)
+		}
+	})
+
+	t.Run("update after final status ignored", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Download))
+		s.Cancel(i)
+
+		changed := false
+		s.OnStoreChange = func(id string) {
+			changed = true
+		}
+
+		tr := s.Get(i)
+		tr.Status = Accepted
+		tr.LocalFilePath = "/tmp/a.txt"
+		s.Update(i, tr)
+
+		if got := s.Get(i); got.Status != Cancelled || got.LocalFilePath != "" {
+			t.Errorf("update expected status = Cancelled but got = %v on %v", got.Status, got.LocalFilePath)
+		}
+
+		if changed {
+			t.Errorf("update expected no change notified but got = %v", changed)
+		}
+	})
+}
+
+func Test_TransferStore_ClearError(t *testing.T) {
+	t.Run("error cleared", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Download))
+		tr := s.Get(i)
+		tr.SetError(fmt.Errorf("my error"))
+		s.Update(i, tr)
+
+		changed := false
+		s.OnStoreChange = func(id string) {
+			changed = true
+		}
+		s.ClearError(i)
+
+		if got := s.Get(i); got.Status != Error || got.Error() != nil {
+			t.Errorf("clear error expected status = Error without error but got = %v with %v", got.Status, got.Error())
+		}
+
+		if !changed {
+			t.Errorf("clear error expected change notified but got = %v", changed)
+		}
+	})
+
+	t.Run("transfer without error", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Download))
+
+		changed := false
+		s.OnStoreChange = func(id string) {
+			changed = true
+		}
+		s.ClearError(i)
+		s.ClearError("missing")
+
+		if changed {
+			t.Errorf("clear error expected no change notified but got = %v", changed)
+		}
+	})
+}
+
+func Test_TransferStore_Decide(t *testing.T) {
+	t.Run("download waiting decided", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("file-1", "abc", "peer-1", 100, nil, Download))
+		tr := s.Get(i)
+		tr.Status = Rejected
+		if err := s.Decide(i, tr); err != nil {
+			t.Fatalf("decide not expected error = %v", err)
+		}
+
+		if st := s.Get(i).Status; st != Rejected {
+			t.Errorf("decide expected status = %v but got = %v", Rejected, st)
+		}
+	})
+
+	t.Run("download already decided", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("file-1", "abc", "peer-1", 100, nil, Download))
+		tr := s.Get(i)
+		tr.Status = Rejected
+		s.Update(i, tr)
+
+		tr.Status = Accepted
+		if err := s.Decide(i, tr); err == nil {
+			t.Errorf("decide expected error but got = %v", err)
+		}
+
+		if st := s.Get(i).Status; st != Rejected {
+			t.Errorf("decide expected status = %v but got = %v", Rejected, st)
 		}
 	})
 
+	t.Run("upload not decided", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("file-1", "abc", "peer-1", 100, nil, Upload))
+		tr := s.Get(i)
+		tr.Status = Accepted
+		if err := s.Decide(i, tr); err == nil {
+			t.Errorf("decide expected error but got = %v", err)
+		}
+	})
+
+	t.Run("only one decision at the same time", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("file-1", "abc", "peer-1", 100, nil, Download))
+
+		var wg sync.WaitGroup
+		decided := make(chan Status, 10)
+		for j := 0; j < 10; j++ {
+			status := Accepted
+			if j%2 == 0 {
+				status = Rejected
+			}
+			wg.Add(1)
+			go func(status Status) {
+				defer wg.Done()
+				tr := s.Get(i)
+				tr.Status = status
+				if err := s.Decide(i, tr); err == nil {
+					decided <- status
+				}
+			}(status)
+		}
+		wg.Wait()
+		close(decided)
+
+		if len(decided) != 1 {
+			t.Fatalf("decide expected one decision but got = %d", len(decided))
+		}
+
+		if want, st := <-decided, s.Get(i).Status; st != want {
+			t.Errorf("decide expected status = %v but got = %v", want, st)
+		}
+	})
 }
 
 func Test_TransferStore_AddToWait(t *testing.T) {
@@ -165,53 +465,340 @@ func Test_TransferStore_AddToWait(t *testing.T) {
 			t.Errorf("add to wait expected status Accepted but got = %v", tt.Status.String())
 		}
 	})
+
+	t.Run("add to wait transfer decided when added and unlock", func(t *testing.T) {
+		s := NewStore()
+		s.OnStoreChange = func(i string) {
+			if tr := s.Get(i); tr.Status == Waiting {
+				tr.Status = Rejected
+				s.Update(i, tr)
+			}
+		}
+		i, wait := s.AddToWait(&Transfer{Status: Waiting})
+
+		select {
+		case <-wait:
+		case <-time.After(time.Second):
+			t.Fatalf("add to wait expected wait to be closed")
+		}
+
+		if tt := s.Get(i); tt.Status != Rejected {
+			t.Errorf("add to wait expected status Rejected but got = %v", tt.Status.String())
+		}
+	})
 }
 
-func Test_TransferStore_FollowProgress(t *testing.T) {
-	t.Run("follow progress of invalid index", func(t *testing.T) {
+func Test_TransferStore_Subscribe(t *testing.T) {
+	t.Run("subscribe invalid id", func(t *testing.T) {
 		s := NewStore()
-		progress := s.FollowProgress(-1)
+		s.Add(&Transfer{})
+		progress, _ := s.Subscribe("")
 
-		if progress != nil {
-			t.Errorf("follow progress expected nil but got = %v", progress)
+		if _, ok := <-progress; ok {
+			t.Errorf("subscribe expected closed channel but got = %v", progress)
 		}
 	})
 
-	t.Run("follow progress with empty store", func(t *testing.T) {
+	t.Run("subscribe with empty store", func(t *testing.T) {
 		s := NewStore()
-		progress := s.FollowProgress(0)
+		progress, cancel := s.Subscribe("a1")
+		cancel()
+
+		if _, ok := <-progress; ok {
+			t.Errorf("subscribe expected closed channel but got = %v", progress)
+		}
+	})
+
+	t.Run("subscribe finished transfer", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{Status: Completed})
+		progress, _ := s.Subscribe(i)
+
+		if _, ok := <-progress; ok {
+			t.Errorf("subscribe expected closed channel")
+		}
+	})
+
+	t.Run("subscribe receives the last progress", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{})
+		s.UpdateProgress(i, 10, 40)
 
-		if progress != nil {
-			t.Errorf("follow progress expected nil but got = %v", progress)
+		progress, cancel := s.Subscribe(i)
+		defer cancel()
+
+		if p := <-progress; p.Fraction != 0.25 || p.Transferred != 10 || p.Size != 40 {
+			t.Errorf("subscribe expected progress 10 of 40 but got = %v", p)
 		}
 	})
 
-	t.Run("follow progress change to complete", func(t *testing.T) {
+	t.Run("subscribe change to complete", func(t *testing.T) {
 		s := NewStore()
 		i := s.Add(&Transfer{})
 
-		progress := s.FollowProgress(i)
+		progress, _ := s.Subscribe(i)
 
 		go func() {
-			s.UpdateProgress(i, 10)
+			s.UpdateProgress(i, 10, 10)
 			tt := s.Get(i)
 			tt.Status = Completed
 			s.Update(i, tt)
 		}()
 
-		val := <-progress
+		var last Progress
+		for p := range progress {
+			last = p
+		}
 
 		tr := s.Get(i)
 		if tr.Status != Completed {
-			t.Errorf("follow progress expected status Completed but got = %v", tr.Status.String())
+			t.Errorf("subscribe expected status Completed but got = %v", tr.Status.String())
 		}
 
-		if val != 10 {
-			t.Errorf("ollow progress expected progress 10 but got = %v", val)
+		if last.Fraction != 1 {
+			t.Errorf("subscribe expected progress 1 but got = %v", last.Fraction)
+		}
+	})
+
+	t.Run("cancel closes the channel", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{})
+
+		progress, cancel := s.Subscribe(i)
+		cancel()
+		cancel()
+		s.UpdateProgress(i, 1, 2)
+
+		if _, ok := <-progress; ok {
+			t.Errorf("subscribe expected closed channel after cancel")
 		}
 	})
 }
 
 func Test_TransferStore_UpdateProgress(t *testing.T) {
+	t.Run("update progress without subscribers", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{})
+
+		done := make(chan interface{})
+		go func() {
+			defer close(done)
+			for k := int64(1); k <= 1000; k++ {
+				s.UpdateProgress(i, k, 1000)
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("update progress expected to not block")
+		}
+	})
+
+	t.Run("update progress keeps the last progress", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{})
+
+		s.UpdateProgress(i, 25, 100)
+		s.UpdateProgress(i, 50, 100)
+
+		if p := s.Get(i).Progress(); p.Fraction != 0.5 || p.Transferred != 50 {
+			t.Errorf("update progress expected progress 0.5 but got = %v", p)
+		}
+	})
+
+	t.Run("update progress merges the updates", func(t *testing.T) {
+		s := NewStore()
+		s.ProgressInterval = 50 * time.Millisecond
+		i := s.Add(&Transfer{})
+
+		progress, cancel := s.Subscribe(i)
+		defer cancel()
+
+		s.UpdateProgress(i, 10, 100)
+		s.UpdateProgress(i, 20, 100)
+		s.UpdateProgress(i, 30, 100)
+
+		if p := <-progress; p.Transferred != 10 {
+			t.Errorf("update progress expected first progress 10 but got = %v", p.Transferred)
+		}
+
+		select {
+		case p := <-progress:
+			if p.Transferred != 30 {
+				t.Errorf("update progress expected merged progress 30 but got = %v", p.Transferred)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("update progress expected pending progress to be sent")
+		}
+	})
+
+	t.Run("update progress to many subscribers", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(&Transfer{})
 
+		subs := make([]<-chan Progress, 3)
+		for k := range subs {
+			subs[k], _ = s.Subscribe(i)
+		}
+
+		s.UpdateProgress(i, 5, 10)
+
+		for k, sub := range subs {
+			if p := <-sub; p.Fraction != 0.5 {
+				t.Errorf("update progress expected subscriber %d progress 0.5 but got = %v", k, p.Fraction)
+			}
+		}
+	})
+}
+
+func Test_TransferStore_Cancel(t *testing.T) {
+	t.Run("cancel transfer not started", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload))
+
+		s.Cancel(i)
+
+		if tr := s.Get(i); tr.Status != Cancelled {
+			t.Errorf("cancel expected status = %v but got = %v", Cancelled, tr.Status)
+		}
+
+		ctx, cancel := s.WithCancel(context.Background(), i)
+		defer cancel()
+		if ctx.Err() == nil {
+			t.Errorf("with cancel expected context cancelled")
+		}
+	})
+
+	t.Run("cancel running transfer", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload))
+
+		ctx, cancel := s.WithCancel(context.Background(), i)
+		defer cancel()
+
+		s.Cancel(i)
+
+		if ctx.Err() == nil {
+			t.Errorf("cancel expected context cancelled")
+		}
+
+		if tr := s.Get(i); tr.Status != Waiting {
+			t.Errorf("cancel expected status = %v but got = %v", Waiting, tr.Status)
+		}
+	})
+
+	t.Run("cancel transfer with final status", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload))
+		tr := s.Get(i)
+		tr.Status = Completed
+		s.Update(i, tr)
+
+		s.Cancel(i)
+
+		if tr := s.Get(i); tr.Status != Completed {
+			t.Errorf("cancel expected status = %v but got = %v", Completed, tr.Status)
+		}
+	})
+}
+
+func Test_TransferStore_History(t *testing.T) {
+	t.Run("finished transfers recorded once", func(t *testing.T) {
+		s := NewStore()
+		s.History, _ = LoadHistory("")
+
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Download))
+		tr := s.Get(i)
+		tr.Status = Accepted
+		s.Update(i, tr)
+
+		if s.History.Size() != 0 {
+			t.Errorf("update expected no records but got = %d", s.History.Size())
+		}
+
+		tr.Status = Completed
+		s.Update(i, tr)
+		s.Update(i, tr)
+
+		records := s.History.Search("")
+		if len(records) != 1 || records[0].FileName != "a.txt" || records[0].Status != Completed {
+			t.Errorf("update expected a.txt completed recorded but got = %v", records)
+		}
+	})
+
+	t.Run("cancelled transfer recorded", func(t *testing.T) {
+		s := NewStore()
+		s.History, _ = LoadHistory("")
+
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload))
+		s.Cancel(i)
+
+		records := s.History.Search("")
+		if len(records) != 1 || records[0].Status != Cancelled {
+			t.Errorf("cancel expected a.txt cancelled recorded but got = %v", records)
+		}
+	})
+
+	t.Run("store without history", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload))
+
+		defer func() {
+			if err := recover(); err != nil {
+				t.Errorf("cancel not expected panic = %v", err)
+			}
+		}()
+		s.Cancel(i)
+	})
+}
+
+func Test_TransferStore_Pause(t *testing.T) {
+	t.Run("pause running transfer", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload))
+
+		var got []bool
+		s.SetPause(i, func(paused bool) {
+			got = append(got, paused)
+		})
+
+		s.Pause(i, true)
+		s.Pause(i, false)
+
+		if len(got) != 2 || !got[0] || got[1] {
+			t.Errorf("pause expected = %v but got = %v", []bool{true, false}, got)
+		}
+	})
+
+	t.Run("pause transfer not running", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload))
+
+		s.Pause(i, true)
+
+		if tr := s.Get(i); tr.Status != Waiting {
+			t.Errorf("pause expected status = %v but got = %v", Waiting, tr.Status)
+		}
+	})
+
+	t.Run("pause transfer with final status", func(t *testing.T) {
+		s := NewStore()
+		i := s.Add(NewTransfer("a.txt", "", "peer-1", 1, nil, Upload))
+
+		paused := false
+		s.SetPause(i, func(p bool) {
+			paused = p
+		})
+
+		tr := s.Get(i)
+		tr.Status = Completed
+		s.Update(i, tr)
+
+		s.Pause(i, true)
+
+		if paused {
+			t.Errorf("pause expected transfer with final status not paused")
+		}
+	})
 }
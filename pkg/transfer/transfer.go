@@ -1,7 +1,14 @@
 package transfer
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"net"
+	"strconv"
+	"time"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
 )
 
 // Status represents the Transfer status.
@@ -20,12 +27,18 @@ const (
 	Completed
 	// Transfer is error state.
 	Error
+	// Transfer was cancelled by one of the peers.
+	Cancelled
+	// Transfer was paused by one of the peers.
+	Paused
+	// Transfer is waiting for a free worker to start.
+	Queued
 )
 
 // IsFinal returns true if the status is a final status, which
 // means it will not change anymore.
 func (s Status) IsFinal() bool {
-	return (s == Error || s == Rejected || s == Completed)
+	return (s == Error || s == Rejected || s == Completed || s == Cancelled)
 }
 
 // String convert a transfer status into a string representation
@@ -44,10 +57,32 @@ func (s Status) String() string {
 		return `Completed`
 	case Error:
 		return `Error`
+	case Cancelled:
+		return `Cancelled`
+	case Paused:
+		return `Paused`
+	case Queued:
+		return `Queued`
 	}
 	return ``
 }
 
+// MarshalText converts the status into its string representation.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText converts the string representation into the status.
+func (s *Status) UnmarshalText(text []byte) error {
+	for st := Waiting; st <= Queued; st++ {
+		if st.String() == string(text) {
+			*s = st
+			return nil
+		}
+	}
+	return fmt.Errorf("transfer status unmarshal error: unknown status %q", text)
+}
+
 // Direction represents the direction of the transfer.
 //
 // Upload or Download.
@@ -60,19 +95,60 @@ const (
 	Download
 )
 
+// File is one of the files of a directory or batch transfer.
+type File struct {
+	file.Entry
+	LocalPath string // Full path to local file system of a batch upload file. Sender/read path.
+	Status    Status // Status of the file, files not selected by the receiver are Rejected.
+}
+
 // Transfer wraps the transfer information
 type Transfer struct {
 	Direction
+	// ID identifies the transfer on the store, it's shared with the peer so
+	// both sides refer to the same transfer.
+	ID            string
 	Status        Status
 	SenderName    string
 	SenderAddr    net.Addr
 	FileName      string
 	FileChecksum  string
 	FileSize      int64
-	LocalFilePath string           // Full path to local file system. Sender/read path, Receiver/save path.
-	wait          chan interface{} // Waiting channel used to notify when the user accepted or rejected.
-	prog          chan float64     // Progress channel used to report the progress updates.
-	err           error            // Error that occurred to the transfer.
+	Directory     bool   // Directory is true if the transfer is a directory with the Files inside.
+	Batch         bool   // Batch is true if the transfer is a group of independent Files.
+	Files         []File // Files of the directory or batch, empty if the transfer is a single file.
+	LocalFilePath string // Full path to local file system. Sender/read path, Receiver/save path.
+	// PeerFingerprint is the fingerprint of the peer certificate, on uploads
+	// it's the fingerprint expected and on downloads the one presented.
+	PeerFingerprint string
+	// PeerProtocol and PeerCapabilities are the protocol version and the
+	// names of the capabilities the receiver of an upload advertised on the
+	// discovery, zero and nil if unknown.
+	PeerProtocol     int
+	PeerCapabilities []string
+	// Interfaces are the network interfaces used to connect to the receiver
+	// of an upload, the addresses on their networks are tried first, nil
+	// to use all of them.
+	Interfaces []net.Interface
+	// Untrusted is true if the peer of a download is unknown or doesn't
+	// match the fingerprint pinned for it, it can be an impersonation.
+	Untrusted bool
+	// VerifiedName is the name of the known peer of a download whose pinned
+	// or paired fingerprint matches the certificate presented, empty if the
+	// sender wasn't verified. SenderName is the name the sender reported.
+	VerifiedName string
+	// LocalName is the name of the local peer sent to the receiver on the
+	// request of an upload.
+	LocalName string
+	// Created is the time the transfer was requested.
+	Created   time.Time
+	wait      chan interface{} // Waiting channel used to notify when the user accepted or rejected.
+	prog      Progress         // Last progress reported.
+	feed      *progressFeed    // Feed that sends the progress to the subscribers.
+	cancel    func()           // Cancel function of the context of the running transfer.
+	pause     func(bool)       // Pause function of the running transfer.
+	reconnect bool             // Reconnect is true if the request continues a paused transfer.
+	err       error            // Error that occurred to the transfer.
 }
 
 // NewTransfer creates a new Transfer instance.
@@ -82,6 +158,7 @@ type Transfer struct {
 // the size of the file, the address of the peer and the direction.
 func NewTransfer(name, check, sender string, size int64, addr net.Addr, dir Direction) *Transfer {
 	return &Transfer{
+		ID:           newID(),
 		Status:       Waiting,
 		Direction:    dir,
 		SenderName:   sender,
@@ -89,6 +166,131 @@ func NewTransfer(name, check, sender string, size int64, addr net.Addr, dir Dire
 		FileName:     name,
 		FileChecksum: check,
 		FileSize:     size,
+		Created:      time.Now(),
+	}
+}
+
+// NewDirectoryTransfer creates a new Transfer instance for a directory.
+//
+// It requires the name of the directory, the peers name that is sending or
+// receiving, the files inside of the directory, the address of the peer and
+// the direction. The size of the transfer is the sum of the files size.
+func NewDirectoryTransfer(name, sender string, entries []file.Entry, addr net.Addr, dir Direction) *Transfer {
+	files := make([]File, 0, len(entries))
+	for _, e := range entries {
+		files = append(files, File{Entry: e, Status: Waiting})
+	}
+
+	t := NewTransfer(name, "", sender, sumSize(files), addr, dir)
+	t.Directory = true
+	t.Files = files
+	return t
+}
+
+// NewBatchTransfer creates a new Transfer instance for a group of files that
+// are sent on the same request.
+//
+// It requires the peers name that is sending or receiving, the files of the
+// batch, the address of the peer and the direction. The name of the transfer
+// is generated from the name of the files and the size is the sum of the
+// files size.
+func NewBatchTransfer(sender string, files []File, addr net.Addr, dir Direction) *Transfer {
+	name := ""
+	switch {
+	case len(files) == 1:
+		name = files[0].Path
+	case len(files) > 1:
+		name = fmt.Sprintf("%s and %d more", files[0].Path, len(files)-1)
+	}
+
+	t := NewTransfer(name, "", sender, sumSize(files), addr, dir)
+	t.Batch = true
+	t.Files = files
+	return t
+}
+
+// sumSize returns the sum of the size of the files.
+func sumSize(files []File) int64 {
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	return size
+}
+
+// HasFiles returns true if the transfer is a directory or a batch.
+func (t *Transfer) HasFiles() bool {
+	return t.Directory || t.Batch
+}
+
+// SelectedSize returns the amount of data that will be transferred, on a
+// batch transfer the files rejected by the receiver are not transferred.
+func (t *Transfer) SelectedSize() int64 {
+	if !t.HasFiles() {
+		return t.FileSize
+	}
+
+	var size int64
+	for _, f := range t.Files {
+		if f.Status != Rejected {
+			size += f.Size
+		}
+	}
+	return size
+}
+
+// Progress returns the last progress reported.
+func (t *Transfer) Progress() Progress {
+	return t.prog
+}
+
+// AcceptInto will accept the download to be stored inside of the directory,
+// the file or directory is stored with the name sent and the files of a
+// batch are stored on the directory.
+//
+// If there is an error, it can be because the name sent is not valid.
+func (t *Transfer) AcceptInto(dir string) error {
+	localPath := dir
+	if !t.Batch {
+		var err error
+		if localPath, err = file.SafeJoin(dir, t.FileName); err != nil {
+			return err
+		}
+	}
+
+	t.LocalFilePath = localPath
+	t.Status = Accepted
+	return nil
+}
+
+// Select will mark the files of the batch that are not on the selected
+// indexes as Rejected, so they are not received.
+//
+// If there is an error, it can be because no file was selected or the
+// selection has indexes not ordered or out of the batch range.
+func (t *Transfer) Select(selected []int) error {
+	if !t.Batch {
+		return fmt.Errorf("transfer select error: only the files of a batch can be selected")
+	}
+	return selectFiles(t, selected)
+}
+
+// filePath returns the local path of one of the files of the transfer, it's
+// the local path of the file if set or the path relative to LocalFilePath.
+func (t *Transfer) filePath(f File) (string, error) {
+	if f.LocalPath != "" {
+		return f.LocalPath, nil
+	}
+	return file.SafeJoin(t.LocalFilePath, f.Path)
+}
+
+// setFilesStatus will change the status of all the files that were not
+// rejected by the receiver.
+func (t *Transfer) setFilesStatus(s Status) {
+	for i := range t.Files {
+		if t.Files[i].Status != Rejected {
+			t.Files[i].Status = s
+		}
 	}
 }
 
@@ -103,6 +305,14 @@ func (t *Transfer) Error() error {
 	return t.err
 }
 
+// copy returns a copy of the transfer that doesn't share the files.
+func (t *Transfer) copy() *Transfer {
+	cp := new(Transfer)
+	*cp = *t
+	cp.Files = append([]File(nil), t.Files...)
+	return cp
+}
+
 // waitDecision will create and return a channel that will be used to signal
 // when the transfer status changed from Waiting to anotehr status.
 func (t *Transfer) waitDecision() <-chan interface{} {
@@ -112,11 +322,25 @@ func (t *Transfer) waitDecision() <-chan interface{} {
 	return t.wait
 }
 
-// progress will create and return a channel that will be used to stream the
-// amount of bytes already transferred.
-func (t *Transfer) progress() chan float64 {
-	if t.prog == nil {
-		t.prog = make(chan float64)
+// newID returns a new random ID for a transfer.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
 	}
-	return t.prog
+	return hex.EncodeToString(b)
+}
+
+// validID returns true if the ID received from a peer can be used, it must
+// have up to 64 letters, digits or dashes.
+func validID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
 }
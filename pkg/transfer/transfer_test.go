@@ -1 +1,78 @@
 package transfer
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
+)
+
+func Test_Transfer_AcceptInto(t *testing.T) {
+	t.Run("file stored inside of the directory", func(t *testing.T) {
+		tr := NewTransfer("a.txt", "abc", "peer-1", 1, nil, Download)
+		if err := tr.AcceptInto("/srv/inbox"); err != nil {
+			t.Fatalf("AcceptInto not expected error = %v", err)
+		}
+
+		if want := filepath.Join("/srv/inbox", "a.txt"); tr.LocalFilePath != want || tr.Status != Accepted {
+			t.Errorf("AcceptInto expected path = %v and status = %v but got = %v and %v", want, Accepted, tr.LocalFilePath, tr.Status)
+		}
+	})
+
+	t.Run("batch stored on the directory", func(t *testing.T) {
+		tr := NewBatchTransfer("peer-1", []File{{Entry: file.Entry{Path: "a.txt", Size: 1}}}, nil, Download)
+		if err := tr.AcceptInto("/srv/inbox"); err != nil {
+			t.Fatalf("AcceptInto not expected error = %v", err)
+		}
+
+		if tr.LocalFilePath != "/srv/inbox" {
+			t.Errorf("AcceptInto expected path = %v but got = %v", "/srv/inbox", tr.LocalFilePath)
+		}
+	})
+}
+
+func Test_Transfer_Select(t *testing.T) {
+	t.Run("files not selected are rejected", func(t *testing.T) {
+		tr := NewBatchTransfer("peer-1", []File{
+			{Entry: file.Entry{Path: "a.txt", Size: 1}, Status: Waiting},
+			{Entry: file.Entry{Path: "b.txt", Size: 1}, Status: Waiting},
+		}, nil, Download)
+
+		if err := tr.Select([]int{1}); err != nil {
+			t.Fatalf("Select not expected error = %v", err)
+		}
+
+		if tr.Files[0].Status != Rejected || tr.Files[1].Status != Waiting {
+			t.Errorf("Select expected status = %v and %v but got = %v and %v", Rejected, Waiting, tr.Files[0].Status, tr.Files[1].Status)
+		}
+	})
+
+	t.Run("select files of a single file", func(t *testing.T) {
+		tr := NewTransfer("a.txt", "abc", "peer-1", 1, nil, Download)
+		if err := tr.Select([]int{0}); err == nil {
+			t.Errorf("Select expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_validID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "new id", id: newID(), want: true},
+		{name: "with dash", id: "a1-b2", want: true},
+		{name: "empty", id: "", want: false},
+		{name: "path separator", id: "../a1", want: false},
+		{name: "too long", id: strings.Repeat("a", 65), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validID(tt.id); got != tt.want {
+				t.Errorf("validID expected %v but got = %v", tt.want, got)
+			}
+		})
+	}
+}
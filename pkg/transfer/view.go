@@ -2,20 +2,40 @@ package transfer
 
 import (
 	"fmt"
+	"image/color"
+	"strings"
+	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
+	"github.com/fabiodcorreia/catch-my-file/pkg/file"
 )
 
 // TransferList is an extended version of widget.List where is uses a store
 // to hold the list items.
 type TransferList struct {
 	widget.List
-	store  *TransferStore
-	Parent fyne.Window
+	store     *TransferStore
+	Parent    fyne.Window
+	mu        sync.Mutex
+	rows      map[*fyne.Container]string // Transfer id shown on each row.
+	following map[string]bool            // Transfers with the progress followed.
+	data      map[string]*itemData       // Progress bound to the row of each transfer.
+}
+
+// itemData is the progress of a transfer bound to the progress bar and the
+// speed of the row showing it, so it can be updated while the rows are
+// reused by other transfers.
+type itemData struct {
+	fraction binding.Float
+	stats    binding.String
 }
 
 // NewView creates a new TransferList which is just an extended version
@@ -24,11 +44,17 @@ type TransferList struct {
 // Everytime the store content changes the view is refreshed.
 func NewView(store *TransferStore) *TransferList {
 	tl := &TransferList{
-		store:  store,
-		Parent: fyne.CurrentApp().Driver().AllWindows()[0],
+		store:     store,
+		Parent:    fyne.CurrentApp().Driver().AllWindows()[0],
+		rows:      make(map[*fyne.Container]string),
+		following: make(map[string]bool),
+		data:      make(map[string]*itemData),
 	}
 
-	store.OnStoreChange = func(i int) {
+	store.OnStoreChange = func(id string) {
+		if store.Get(id) == nil {
+			tl.unbind(id)
+		}
 		tl.Refresh()
 	}
 
@@ -40,6 +66,14 @@ func NewView(store *TransferStore) *TransferList {
 	return tl
 }
 
+// NewClearButton creates the button that removes the finished transfers
+// from the store.
+func NewClearButton(store *TransferStore) *widget.Button {
+	return widget.NewButtonWithIcon("Clear finished", theme.ContentClearIcon(), func() {
+		store.RemoveFinished()
+	})
+}
+
 // createItem creates a new template list item with the
 // default widgets and custom layout.
 func (tl *TransferList) createItem() fyne.CanvasObject {
@@ -54,80 +88,268 @@ func (tl *TransferList) createItem() fyne.CanvasObject {
 		}), // Status
 		container.NewHBox(
 			widget.NewProgressBar(),
-			widget.NewButtonWithIcon("", theme.ConfirmIcon(), func() {}), // Accept
-			widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {}),  // Reject
+			widget.NewButtonWithIcon("", theme.ConfirmIcon(), func() {}),    // Accept
+			widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {}),     // Reject
+			widget.NewButtonWithIcon("", theme.CancelIcon(), func() {}),     // Cancel
+			widget.NewButtonWithIcon("", theme.MediaPauseIcon(), func() {}), // Pause/Resume
 		),
+		widget.NewButtonWithIcon("", theme.InfoIcon(), func() {}),         // Files details
+		widget.NewButtonWithIcon("", theme.ContentClearIcon(), func() {}), // Dismiss
+		widget.NewLabel(""), // Speed and time
 	)
 }
 
 // updateItem will be executed for each row of the list when it needs
-// to be updated.
+// to be updated, the rows are reused by other transfers when a transfer
+// is removed.
 func (tl *TransferList) updateItem(i widget.ListItemID, item fyne.CanvasObject) {
-	t := tl.store.Get(i)
-
-	wDirection := item.(*fyne.Container).Objects[0].(*widget.Icon)
-	wName := item.(*fyne.Container).Objects[1].(*widget.Label)
-	wSource := item.(*fyne.Container).Objects[2].(*widget.Label)
-	wSize := item.(*fyne.Container).Objects[3].(*widget.Label)
-	wStatus := item.(*fyne.Container).Objects[4].(*widget.Label)
-	cActions := item.(*fyne.Container).Objects[5].(*fyne.Container)
-
-	// Set the text labels and status
-	setItemLabels(t, wStatus, wName, wSize, wSource)
+	t := tl.transferAt(i)
+	if t == nil {
+		return
+	}
+	id := t.ID
+
+	row := item.(*fyne.Container)
+	wDirection := row.Objects[0].(*widget.Icon)
+	wName := row.Objects[1].(*widget.Label)
+	wSource := row.Objects[2].(*widget.Label)
+	wSize := row.Objects[3].(*widget.Label)
+	wStatus := row.Objects[4].(*widget.Label)
+	cActions := row.Objects[5].(*fyne.Container)
+	wDetails := row.Objects[6].(*widget.Button)
+	wDismiss := row.Objects[7].(*widget.Button)
+	wStats := row.Objects[8].(*widget.Label)
+
+	pbar := cActions.Objects[0].(*widget.ProgressBar)
+	data := tl.dataOf(id)
+
+	// These values only change when the row shows another transfer.
+	if tl.bind(row, id) {
+		pbar.Bind(data.fraction)
+		wStats.Bind(data.stats)
+		tl.follow(id)
+
+		// The labels that don't change are set again for the new transfer.
+		wName.Wrapping = fyne.TextWrapOff
+
+		cActions.Objects[3].(*widget.Button).OnTapped = func() {
+			tl.store.Cancel(id)
+		}
 
-	// If the status is a final status hide the actions container
-	showHideActions(t.Status, cActions)
+		cActions.Objects[4].(*widget.Button).OnTapped = func() {
+			if t := tl.store.Get(id); t != nil {
+				tl.store.Pause(id, t.Status != Paused)
+			}
+		}
 
-	// These values will not change so they only need to be initiazlied once.
-	if wDirection.Resource == nil {
+		wDismiss.OnTapped = func() {
+			if err := tl.store.Remove(id); err != nil {
+				clog.Error(err)
+			}
+		}
 
-		followProgress(i, cActions.Objects[0].(*widget.ProgressBar), tl.store)
+		// A sender that doesn't match the pinned fingerprint is flagged with
+		// a warning instead of the direction icon.
+		wDirection.SetResource(nil)
+		if t.Untrusted {
+			wDirection.SetResource(theme.WarningIcon())
+		}
 
 		// Set the transfer direction icon based on the transfer direction
 		setItemDirection(wDirection, t.Direction)
 
-		if t.Direction == Upload {
-			showHidePBar(true, cActions)
-			showHideAccRej(false, cActions)
+		if t.HasFiles() {
+			wDetails.Show()
+			wDetails.OnTapped = func() {
+				showFilesDialog(tl.store.Get(id), tl.Parent)
+			}
 		} else {
-			showHidePBar(false, cActions)
-			showHideAccRej(true, cActions)
+			wDetails.Hide()
 		}
 
-		if cActions.Objects[1].Visible() {
-			cActions.Objects[1].(*widget.Button).OnTapped = func() {
-				saveDialog := dialog.NewFileSave(func(uc fyne.URIWriteCloser, err error) {
-					if err != nil || uc == nil {
-						return // if error or uc is null user cancel dialog
-					}
-
-					t.LocalFilePath = uc.URI().Path()
-					t.Status = Accepted
-					tl.store.Update(i, t)
+		// The row can show another transfer when the buttons are tapped, the
+		// transfer is taken again from the store.
+		cActions.Objects[1].(*widget.Button).OnTapped = func() {
+			t := tl.store.Get(id)
+			if t == nil {
+				return
+			}
 
-					showHidePBar(true, cActions)
-					showHideAccRej(false, cActions)
+			onAccept := func(path string) {
+				t.LocalFilePath = path
+				t.Status = Accepted
+				if err := tl.store.Decide(id, t); err != nil {
+					clog.Error(err)
+				}
+			}
 
+			switch {
+			case t.Batch:
+				showSelectDialog(t, func() {
+					showFolderDialog("", onAccept, tl.Parent)
 				}, tl.Parent)
-				saveDialog.SetFileName(t.FileName)
-				saveDialog.Show()
+			case t.Directory:
+				showFolderDialog(t.FileName, onAccept, tl.Parent)
+			default:
+				showSaveDialog(t.FileName, onAccept, tl.Parent)
+			}
+		}
+		cActions.Objects[2].(*widget.Button).OnTapped = func() {
+			t := tl.store.Get(id)
+			if t == nil {
+				return
 			}
-			cActions.Objects[2].(*widget.Button).OnTapped = func() {
-				t.Status = Rejected
-				tl.store.Update(i, t)
+			t.Status = Rejected
+			if err := tl.store.Decide(id, t); err != nil {
+				clog.Error(err)
 			}
 		}
 	}
 
+	// Set the text labels and status
+	setItemLabels(t, wStatus, wName, wSize, wSource)
+
+	// If the status is a final status hide the actions container and show
+	// the dismiss button
+	showHideActions(t.Status, cActions)
+	showHideDismiss(t.Status, wDismiss)
+
+	// A download waiting for a decision shows the accept and reject
+	// buttons, the other transfers show the progress.
+	waiting := t.Direction == Download && t.Status == Waiting
+	showHidePBar(!waiting, cActions)
+	showHideAccRej(waiting, cActions)
+
+	// The pause button resumes the transfer while it's paused.
+	setPauseIcon(t.Status, cActions.Objects[4].(*widget.Button))
+
+	// A transfer queued for a free worker can only be cancelled.
+	if t.Status == Queued {
+		cActions.Objects[4].(*widget.Button).Hide()
+	}
+
+	data.set(t.Status, t.Progress())
+	setItemStats(t.Status, t.Progress(), wStats)
+
 	if t.Status == Error && t.Error() != nil {
 		dialog.ShowError(t.Error(), tl.Parent)
 
 		//! Really don't like this
-		go func() {
-			t.err = nil
-			tl.store.Update(i, t)
-		}()
+		go tl.store.ClearError(id)
+	}
+}
+
+// showSaveDialog will ask the user where to save the file and execute the
+// onAccept with the selected path.
+func showSaveDialog(fileName string, onAccept func(path string), parent fyne.Window) {
+	saveDialog := dialog.NewFileSave(func(uc fyne.URIWriteCloser, err error) {
+		if err != nil || uc == nil {
+			return // if error or uc is null user cancel dialog
+		}
+
+		// The file is written later from the partial file, the writer
+		// opened by the dialog is not needed.
+		if cErr := uc.Close(); cErr != nil {
+			clog.Error(cErr)
+		}
+		onAccept(uc.URI().Path())
+	}, parent)
+	saveDialog.SetFileName(fileName)
+	saveDialog.Show()
+}
+
+// showFolderDialog will ask the user in which folder the directory should
+// be created and execute the onAccept with the path of the directory.
+//
+// If the dirName is empty the onAccept is executed with the selected folder.
+func showFolderDialog(dirName string, onAccept func(path string), parent fyne.Window) {
+	dialog.ShowFolderOpen(func(lu fyne.ListableURI, err error) {
+		if err != nil || lu == nil {
+			return // if error or lu is null user cancel dialog
+		}
+
+		if dirName == "" {
+			onAccept(lu.Path())
+			return
+		}
+
+		path, err := file.SafeJoin(lu.Path(), dirName)
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		onAccept(path)
+	}, parent)
+}
+
+// showSelectDialog will ask the user which files of the batch should be
+// received, the files not selected are marked as Rejected and onSelect is
+// executed if at least one file was selected.
+func showSelectDialog(t *Transfer, onSelect func(), parent fyne.Window) {
+	checks := make([]*widget.Check, 0, len(t.Files))
+	files := container.NewVBox()
+	for _, f := range t.Files {
+		c := widget.NewCheck(fileOption(f), nil)
+		c.SetChecked(true)
+		checks = append(checks, c)
+		files.Add(c)
 	}
+
+	dialog.ShowCustomConfirm("Select files to receive", "Accept", "Cancel", filesContainer(files), func(accept bool) {
+		if !accept || !anyChecked(checks) {
+			return
+		}
+
+		for j, c := range checks {
+			if c.Checked {
+				t.Files[j].Status = Waiting
+			} else {
+				t.Files[j].Status = Rejected
+			}
+		}
+		onSelect()
+	}, parent)
+}
+
+// anyChecked returns true if at least one of the checks is checked.
+func anyChecked(checks []*widget.Check) bool {
+	for _, c := range checks {
+		if c.Checked {
+			return true
+		}
+	}
+	return false
+}
+
+// showFilesDialog will show the files of a directory or batch transfer
+// with the status of each one.
+func showFilesDialog(t *Transfer, parent fyne.Window) {
+	if t == nil {
+		return
+	}
+
+	files := container.NewVBox()
+	for _, f := range t.Files {
+		files.Add(container.NewBorder(nil, nil, nil, widget.NewLabelWithStyle(f.Status.String(), fyne.TextAlignTrailing, fyne.TextStyle{
+			Bold: true,
+		}), widget.NewLabel(fileOption(f))))
+	}
+
+	dialog.ShowCustom(t.FileName, "Close", filesContainer(files), parent)
+}
+
+// filesContainer will wrap the content on a scroll container with a minimum
+// size to fit a list of files.
+func filesContainer(content fyne.CanvasObject) fyne.CanvasObject {
+	rect := canvas.NewRectangle(color.Transparent)
+	rect.SetMinSize(fyne.NewSize(400, 200))
+	return container.NewMax(rect, container.NewVScroll(content))
+}
+
+// fileOption returns the description of a file of the transfer with the
+// path and the size.
+func fileOption(f File) string {
+	return fmt.Sprintf("%s (%s)", f.Path, byteCountSI(f.Size))
 }
 
 // length return the length of the List
@@ -135,26 +357,128 @@ func (tl *TransferList) length() int {
 	return tl.store.Size()
 }
 
-// followProgress will start a new goroutine to follow the progress
-// of a transfer after it got accepted.
-func followProgress(i int, pbar *widget.ProgressBar, store *TransferStore) {
+// transferAt returns the transfer shown on the row i, if there is no
+// transfer on that row returns nil.
+func (tl *TransferList) transferAt(i int) *Transfer {
+	list := tl.store.List()
+	if i < 0 || i >= len(list) {
+		return nil
+	}
+	return list[i]
+}
+
+// bind will set the transfer with the id as the one shown on the row and
+// return true if the row was showing another transfer.
+func (tl *TransferList) bind(row *fyne.Container, id string) bool {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	if tl.rows[row] == id {
+		return false
+	}
+	tl.rows[row] = id
+	return true
+}
+
+// dataOf returns the progress bound to the row showing the transfer with
+// the id, it's created the first time the transfer is shown.
+func (tl *TransferList) dataOf(id string) *itemData {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	d, ok := tl.data[id]
+	if !ok {
+		d = &itemData{fraction: binding.NewFloat(), stats: binding.NewString()}
+		tl.data[id] = d
+	}
+	return d
+}
+
+// unbind will remove the progress of the transfer with the id once it was
+// removed from the store.
+func (tl *TransferList) unbind(id string) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	delete(tl.data, id)
+}
+
+// set will update the progress p of the transfer with the status and return
+// true if the speed and time of the transfer start to be shown.
+func (d *itemData) set(status Status, p Progress) bool {
+	text := statsText(status, p)
+	shown, err := d.stats.Get()
+	if err != nil {
+		clog.Error(err)
+	}
+
+	if err = d.fraction.Set(p.Fraction); err != nil {
+		clog.Error(err)
+	}
+	if err = d.stats.Set(text); err != nil {
+		clog.Error(err)
+	}
+	return shown == "" && text != ""
+}
+
+// follow will start a new goroutine to follow the progress of the transfer
+// with the id until it ends, the progress bound to the row showing the
+// transfer is updated. A transfer is only followed once.
+func (tl *TransferList) follow(id string) {
+	tl.mu.Lock()
+	if tl.following[id] {
+		tl.mu.Unlock()
+		return
+	}
+	tl.following[id] = true
+	tl.mu.Unlock()
+
+	data := tl.dataOf(id)
+	progress, _ := tl.store.Subscribe(id)
 	go func() {
-		for {
-			val, ok := <-store.FollowProgress(i)
-			if !ok {
-				break
+		for p := range progress {
+			t := tl.store.Get(id)
+			if t == nil {
+				continue
+			}
+
+			// The speed is hidden until the transfer has progress, the
+			// row is refreshed to show it.
+			if data.set(t.Status, p) {
+				tl.Refresh()
 			}
-			pbar.SetValue(val)
 		}
+
+		tl.mu.Lock()
+		delete(tl.following, id)
+		tl.mu.Unlock()
 	}()
 }
 
-// showHidePBar will show or hide the progress bar.
+// showHidePBar will show or hide the progress bar and the cancel and pause
+// buttons.
 func showHidePBar(show bool, cProAction *fyne.Container) {
 	if show {
 		cProAction.Objects[0].(*widget.ProgressBar).Show()
+		cProAction.Objects[3].(*widget.Button).Show()
+		cProAction.Objects[4].(*widget.Button).Show()
 	} else {
 		cProAction.Objects[0].(*widget.ProgressBar).Hide()
+		cProAction.Objects[3].(*widget.Button).Hide()
+		cProAction.Objects[4].(*widget.Button).Hide()
+	}
+}
+
+// setPauseIcon will set the icon of the pause button to resume if the
+// status is Paused or to pause otherwise.
+func setPauseIcon(status Status, wPause *widget.Button) {
+	icon := theme.MediaPauseIcon()
+	if status == Paused {
+		icon = theme.MediaPlayIcon()
+	}
+
+	if wPause.Icon != icon {
+		wPause.SetIcon(icon)
 	}
 }
 
@@ -179,6 +503,16 @@ func showHideActions(status Status, container *fyne.Container) {
 	}
 }
 
+// showHideDismiss will show the dismiss button if the status is a terminal
+// status or hide it otherwise.
+func showHideDismiss(status Status, wDismiss *widget.Button) {
+	if status.IsFinal() {
+		wDismiss.Show()
+	} else {
+		wDismiss.Hide()
+	}
+}
+
 // setItemLabels will setup the labels displayed on each row.
 func setItemLabels(t *Transfer, wStatus, wName, wSize, wSource *widget.Label) {
 	// Only update the status if it changes.
@@ -193,12 +527,66 @@ func setItemLabels(t *Transfer, wStatus, wName, wSize, wSource *widget.Label) {
 		wStatus.Wrapping = fyne.TextTruncate
 		wSize.Wrapping = fyne.TextTruncate
 
-		wName.SetText(t.FileName)
+		if t.Directory {
+			wName.SetText(fmt.Sprintf("%s (%d files)", t.FileName, len(t.Files)))
+		} else {
+			wName.SetText(t.FileName)
+		}
 		wSize.SetText(byteCountSI(t.FileSize))
 		wSource.SetText(t.SenderName)
 	}
 }
 
+// setItemStats will show the speed and the time of the transfer, or hide
+// them if the transfer has none.
+func setItemStats(status Status, p Progress, wStats *widget.Label) {
+	text := statsText(status, p)
+	if text == "" {
+		wStats.Hide()
+		return
+	}
+
+	wStats.Wrapping = fyne.TextTruncate
+	if wStats.Text != text {
+		wStats.SetText(text)
+	}
+	wStats.Show()
+}
+
+// statsText returns the description of the progress p of a transfer with the
+// status. A running transfer has the bytes transferred, the current and
+// average speed and the time left, a completed one the time it took and the
+// average speed.
+func statsText(status Status, p Progress) string {
+	switch {
+	case status == Completed && p.Elapsed > 0:
+		return fmt.Sprintf("%s, avg %s", formatDuration(p.Elapsed), FormatRate(int64(p.Average)))
+	case status.IsFinal() || p.Size == 0:
+		return ""
+	}
+
+	parts := []string{fmt.Sprintf("%s / %s", byteCountSI(p.Transferred), byteCountSI(p.Size))}
+	if p.Rate > 0 {
+		parts = append(parts, FormatRate(int64(p.Rate)))
+	}
+	if p.Average > 0 {
+		parts = append(parts, "avg "+FormatRate(int64(p.Average)))
+	}
+	if p.ETA > 0 {
+		parts = append(parts, formatDuration(p.ETA)+" left")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatDuration will convert a duration into a string rounded to the
+// second, or to the millisecond if it's shorter than a second.
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
 // setItemDirection will set the icon upload or download depending on
 // the direction of the transfer.
 func setItemDirection(wDirection *widget.Icon, direction Direction) {
@@ -240,6 +240,68 @@ func Test_showHideActions(t *testing.T) {
 	})
 }
 
+func Test_showHideDismiss(t *testing.T) {
+	t.Run("running transfer", func(t *testing.T) {
+		b := widget.NewButton("", func() {})
+		showHideDismiss(Accepted, b)
+		if b.Visible() {
+			t.Errorf("showHideDismiss expected button hidden but got visible")
+		}
+	})
+
+	t.Run("finished transfer", func(t *testing.T) {
+		b := widget.NewButton("", func() {})
+		b.Hide()
+		showHideDismiss(Completed, b)
+		if !b.Visible() {
+			t.Errorf("showHideDismiss expected button visible but got hidden")
+		}
+	})
+}
+
+func Test_statsText(t *testing.T) {
+	tests := []struct {
+		name   string
+		status Status
+		p      Progress
+		want   string
+	}{
+		{name: "waiting transfer", status: Waiting, want: ""},
+		{name: "running transfer", status: Accepted, p: Progress{Transferred: 2e6, Size: 10e6, Rate: 1e6, Average: 500e3, ETA: 8 * time.Second}, want: "2.0 MB / 10.0 MB, 1.0 MB/s, avg 500.0 KB/s, 8s left"},
+		{name: "first progress", status: Accepted, p: Progress{Transferred: 1e3, Size: 10e6}, want: "1.0 KB / 10.0 MB"},
+		{name: "paused transfer", status: Paused, p: Progress{Transferred: 2e6, Size: 10e6, Average: 500e3}, want: "2.0 MB / 10.0 MB, avg 500.0 KB/s"},
+		{name: "completed transfer", status: Completed, p: Progress{Transferred: 10e6, Size: 10e6, Elapsed: 80 * time.Second, Average: 125e3}, want: "1m20s, avg 125.0 KB/s"},
+		{name: "quick transfer", status: Completed, p: Progress{Transferred: 1e3, Size: 1e3, Elapsed: 1500 * time.Microsecond, Average: 666e3}, want: "2ms, avg 666.0 KB/s"},
+		{name: "cancelled transfer", status: Cancelled, p: Progress{Transferred: 2e6, Size: 10e6, Elapsed: time.Second}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statsText(tt.status, tt.p); got != tt.want {
+				t.Errorf("statsText expected = %q but got = %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_setItemStats(t *testing.T) {
+	t.Run("stats hidden without progress", func(t *testing.T) {
+		l := widget.NewLabel("")
+		setItemStats(Waiting, Progress{}, l)
+		if l.Visible() {
+			t.Errorf("setItemStats expected label hidden but got visible")
+		}
+	})
+
+	t.Run("stats shown with progress", func(t *testing.T) {
+		l := widget.NewLabel("")
+		l.Hide()
+		setItemStats(Accepted, Progress{Transferred: 1e3, Size: 2e3}, l)
+		if !l.Visible() || l.Text != "1.0 KB / 2.0 KB" {
+			t.Errorf("setItemStats expected label visible with the progress but got = %q", l.Text)
+		}
+	})
+}
+
 func Test_showHideAccRej(t *testing.T) {
 	t.Run("show accept and reject buttons", func(t *testing.T) {
 		c := container.NewWithoutLayout(
@@ -284,6 +346,8 @@ func Test_showHidePBar(t *testing.T) {
 			widget.NewProgressBar(),
 			widget.NewButton("", func() {}),
 			widget.NewButton("", func() {}),
+			widget.NewButton("", func() {}),
+			widget.NewButton("", func() {}),
 		)
 
 		showHidePBar(true, c)
@@ -292,6 +356,14 @@ func Test_showHidePBar(t *testing.T) {
 			t.Errorf("showHidePBar expected accept progress bar visible but got %v", c.Objects[0].Visible())
 		}
 
+		if !c.Objects[3].Visible() {
+			t.Errorf("showHidePBar expected cancel button visible but got %v", c.Objects[3].Visible())
+		}
+
+		if !c.Objects[4].Visible() {
+			t.Errorf("showHidePBar expected pause button visible but got %v", c.Objects[4].Visible())
+		}
+
 	})
 
 	t.Run("hide progress bar", func(t *testing.T) {
@@ -299,6 +371,8 @@ func Test_showHidePBar(t *testing.T) {
 			widget.NewProgressBar(),
 			widget.NewButton("", func() {}),
 			widget.NewButton("", func() {}),
+			widget.NewButton("", func() {}),
+			widget.NewButton("", func() {}),
 		)
 
 		showHidePBar(false, c)
@@ -306,6 +380,14 @@ func Test_showHidePBar(t *testing.T) {
 		if c.Objects[0].Visible() {
 			t.Errorf("showHidePBar expected accept progress bar hiden but got %v", c.Objects[0].Visible())
 		}
+
+		if c.Objects[3].Visible() {
+			t.Errorf("showHidePBar expected cancel button hiden but got %v", c.Objects[3].Visible())
+		}
+
+		if c.Objects[4].Visible() {
+			t.Errorf("showHidePBar expected pause button hiden but got %v", c.Objects[4].Visible())
+		}
 	})
 }
 
@@ -377,9 +459,9 @@ func TestTransferList_updateItem(t *testing.T) {
 
 		tt := NewTransfer("uploadfile.txt", "123123", "peer-1", 1000000, nil, Upload)
 
-		st.Add(tt)
+		i := st.Add(tt)
 		tt.SetError(fmt.Errorf("sample test error"))
-		st.Update(0, tt)
+		st.Update(i, tt)
 
 		time.Sleep(100 * time.Millisecond)
 		test.AssertImageMatches(t, "update-item-transfer-error.png", w.Canvas().Capture())
@@ -394,7 +476,7 @@ func TestTransferList_updateItem(t *testing.T) {
 		w.Resize(fyne.NewSize(900, 600))
 		tl.Parent = w
 
-		st.Add(NewTransfer("downloadfile.txt", "123123", "peer-1", 1000000, nil, Download))
+		i := st.Add(NewTransfer("downloadfile.txt", "123123", "peer-1", 1000000, nil, Download))
 
 		time.Sleep(100 * time.Millisecond)
 		test.TapCanvas(w.Canvas(), fyne.NewPos(845, 60))
@@ -402,7 +484,7 @@ func TestTransferList_updateItem(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
 		test.AssertImageMatches(t, "update-item-transfer-reject.png", w.Canvas().Capture())
 
-		tt := st.Get(0)
+		tt := st.Get(i)
 		if tt.Status != Rejected {
 			t.Errorf("updateItem expected status rejected but got = %v", tt.Status.String())
 		}
@@ -432,3 +514,147 @@ func TestTransferList_updateItem(t *testing.T) {
 
 	})
 }
+
+func TestTransferList_dismiss(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	st := NewStore()
+	tl := NewView(st)
+
+	first := NewTransfer("first.txt", "123123", "peer-1", 1000, nil, Upload)
+	first.Status = Completed
+	st.Add(first)
+	second := st.Add(NewTransfer("second.txt", "123123", "peer-1", 1000, nil, Download))
+
+	item := tl.createItem().(*fyne.Container)
+	tl.updateItem(0, item)
+
+	t.Run("dismiss finished transfer", func(t *testing.T) {
+		if !item.Objects[7].Visible() {
+			t.Fatalf("updateItem expected dismiss button visible")
+		}
+
+		test.Tap(item.Objects[7].(*widget.Button))
+
+		if st.Size() != 1 || st.Get(second) == nil {
+			t.Errorf("dismiss expected only %v but got = %v", second, st.List())
+		}
+	})
+
+	t.Run("row reused by the next transfer", func(t *testing.T) {
+		tl.updateItem(0, item)
+
+		if name := item.Objects[1].(*widget.Label).Text; name != "second.txt" {
+			t.Errorf("updateItem expected name = %v but got = %v", "second.txt", name)
+		}
+
+		if item.Objects[7].Visible() || !item.Objects[5].(*fyne.Container).Objects[1].Visible() {
+			t.Errorf("updateItem expected accept button and dismiss button hidden")
+		}
+
+		test.Tap(item.Objects[5].(*fyne.Container).Objects[2].(*widget.Button))
+
+		if tr := st.Get(second); tr.Status != Rejected {
+			t.Errorf("updateItem expected %v rejected but got = %v", second, tr.Status)
+		}
+	})
+
+	t.Run("clear finished transfers", func(t *testing.T) {
+		test.Tap(NewClearButton(st))
+
+		if st.Size() != 0 {
+			t.Errorf("clear expected empty store but got = %v", st.List())
+		}
+	})
+}
+
+func TestTransferList_queued(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	st := NewStore()
+	tl := NewView(st)
+
+	tr := NewTransfer("queued.txt", "123123", "peer-1", 1000, nil, Upload)
+	tr.Status = Queued
+	id := st.Add(tr)
+
+	item := tl.createItem().(*fyne.Container)
+	tl.updateItem(0, item)
+	actions := item.Objects[5].(*fyne.Container)
+
+	t.Run("queued transfer can only be cancelled", func(t *testing.T) {
+		if !actions.Objects[3].Visible() || actions.Objects[4].Visible() {
+			t.Errorf("updateItem expected cancel button visible and pause button hidden")
+		}
+
+		test.Tap(actions.Objects[3].(*widget.Button))
+
+		if tr := st.Get(id); tr.Status != Cancelled {
+			t.Errorf("cancel expected status = %v but got = %v", Cancelled, tr.Status)
+		}
+	})
+}
+
+func TestTransferList_follow(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	st := NewStore()
+	tl := NewView(st)
+
+	first := NewTransfer("first.txt", "123123", "peer-1", 1000, nil, Upload)
+	first.Status = Accepted
+	firstID := st.Add(first)
+	second := NewTransfer("second.txt", "123123", "peer-1", 1000, nil, Upload)
+	second.Status = Accepted
+	secondID := st.Add(second)
+
+	// The row shows the first transfer and then it's reused by the second.
+	item := tl.createItem().(*fyne.Container)
+	tl.updateItem(0, item)
+	tl.updateItem(1, item)
+	pbar := item.Objects[5].(*fyne.Container).Objects[0].(*widget.ProgressBar)
+
+	t.Run("progress bound to the transfer", func(t *testing.T) {
+		st.UpdateProgress(firstID, 500, 1000)
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if v, _ := tl.dataOf(firstID).fraction.Get(); v == 0.5 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("follow expected progress of %v updated", firstID)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if v, _ := tl.dataOf(secondID).fraction.Get(); v != 0 {
+			t.Errorf("follow expected progress of %v = 0 but got = %v", secondID, v)
+		}
+	})
+
+	t.Run("row reused not changed by the previous transfer", func(t *testing.T) {
+		time.Sleep(100 * time.Millisecond)
+
+		if pbar.Value != 0 {
+			t.Errorf("follow expected progress bar = 0 but got = %v", pbar.Value)
+		}
+	})
+
+	t.Run("progress removed with the transfer", func(t *testing.T) {
+		st.Cancel(firstID)
+		if err := st.Remove(firstID); err != nil {
+			t.Fatalf("Remove not expected error = %v", err)
+		}
+
+		tl.mu.Lock()
+		_, ok := tl.data[firstID]
+		tl.mu.Unlock()
+		if ok {
+			t.Errorf("unbind expected progress of %v removed", firstID)
+		}
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"sync"
-	"sync/atomic"
 
 	"github.com/fabiodcorreia/catch-my-file/pkg/clog"
 )
@@ -23,52 +22,99 @@ type WorkerPool interface {
 	Run(ctx context.Context)
 	// Stop will prevent new tasks be queued and wait for the workers to finish.
 	Stop()
-	// AddTask will add a new WorkerTask to the WorkerPool.
+	// AddTask will add a new WorkerTask to the end of the queue.
 	AddTask(task WorkerTask) error
+	// AddPriorityTask will add a new WorkerTask to the queue before the
+	// tasks with a lower priority.
+	AddPriorityTask(task WorkerTask, priority int) error
 	// IsFull return if all the workers are busy or not.
 	IsFull() bool
+	// Queued returns the number of tasks waiting for a free worker.
+	Queued() int
+}
+
+// queuedTask is a task waiting on the queue for a free worker.
+type queuedTask struct {
+	task     WorkerTask
+	priority int
 }
 
 // workerPool is the private implementation of the WorkerPool.
 type workerPool struct {
 	maxWorkers  int
+	queueSize   int
 	wg          sync.WaitGroup
-	queuedTasks chan WorkerTask
+	mu          sync.Mutex
+	ready       *sync.Cond   // ready signals the workers that a task was queued or the pool stopped.
+	queue       []queuedTask // queue has the tasks by priority, the same priority by arrival.
 	running     bool
-	busyWorkers int32
+	busyWorkers int
 }
 
 // NewPool will create a new instance of WorkerPool and return it.
 //
-// The maxWorkers will set the maximum workers running on the pool.
-func NewPool(maxWorkers int) WorkerPool {
-	return &workerPool{
-		maxWorkers:  maxWorkers,
-		queuedTasks: make(chan WorkerTask),
+// The maxWorkers will set the maximum workers running on the pool and the
+// queueSize the maximum tasks waiting for a free worker.
+func NewPool(maxWorkers, queueSize int) WorkerPool {
+	p := &workerPool{
+		maxWorkers: maxWorkers,
+		queueSize:  queueSize,
 	}
+	p.ready = sync.NewCond(&p.mu)
+	return p
 }
 
 // Run will start the WorkerPool and start the workers to execute.
 func (p *workerPool) Run(ctx context.Context) {
+	p.mu.Lock()
+	p.running = true
+	p.mu.Unlock()
+
 	for i := 0; i < p.maxWorkers; i++ {
 		p.wg.Add(1)
 		go func(workerId int) {
-			for task := range p.queuedTasks {
-				atomic.AddInt32(&p.busyWorkers, 1)
+			defer p.wg.Done()
+			for task := p.next(); task != nil; task = p.next() {
 				task(ctx)
-				atomic.AddInt32(&p.busyWorkers, -1)
+
+				p.mu.Lock()
+				p.busyWorkers--
+				p.mu.Unlock()
 			}
-			p.wg.Done()
 		}(i + 1)
 	}
-	p.running = true
+}
+
+// next will wait for the next task on the queue and mark the worker as
+// busy, once the pool is stopped and the queue is empty returns nil.
+func (p *workerPool) next() WorkerTask {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.queue) == 0 && p.running {
+		p.ready.Wait()
+	}
+
+	if len(p.queue) == 0 {
+		return nil
+	}
+
+	task := p.queue[0].task
+	p.queue[0] = queuedTask{}
+	p.queue = p.queue[1:]
+	p.busyWorkers++
+	return task
 }
 
 // Stop will block the WorkePool to prevent new task to arrive and wait
-// for all the workers to finish the running task before closing the pool.
+// for all the workers to finish the running and the queued tasks before
+// closing the pool.
 func (p *workerPool) Stop() {
+	p.mu.Lock()
 	p.running = false
-	close(p.queuedTasks) // This will prevent the workers to start new jobs
+	p.ready.Broadcast() // This will wake the workers waiting to end them
+	p.mu.Unlock()
+
 	p.wg.Wait()
 	clog.Info("Worker pool is closed")
 }
@@ -76,20 +122,53 @@ func (p *workerPool) Stop() {
 // IsFull will return true if all the workers are busy running tasks or
 // false otherwise.
 func (p *workerPool) IsFull() bool {
-	return int(p.busyWorkers) >= p.maxWorkers
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.busyWorkers >= p.maxWorkers
+}
+
+// Queued returns the number of tasks waiting for a free worker.
+func (p *workerPool) Queued() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if free := p.maxWorkers - p.busyWorkers; len(p.queue) > free {
+		return len(p.queue) - free
+	}
+	return 0
 }
 
-// AddTask will add a new task to the workers queue, if the WorkerPool is
-// not running or if all the workers are busy an error is returned.
+// AddTask will add a new task to the end of the workers queue, if the
+// WorkerPool is not running or if the queue is full an error is returned.
 func (p *workerPool) AddTask(task WorkerTask) error {
+	return p.AddPriorityTask(task, 0)
+}
+
+// AddPriorityTask will add a new task to the workers queue after the tasks
+// with the same or a higher priority, if the WorkerPool is not running or if
+// the queue is full an error is returned.
+func (p *workerPool) AddPriorityTask(task WorkerTask, priority int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	if !p.running {
 		return fmt.Errorf("worker is not running")
 	}
 
-	if p.IsFull() {
-		return fmt.Errorf("worker doesn't have free workers")
+	// The tasks queued while there are free workers start right away, only
+	// the others count on the queue size.
+	if len(p.queue) >= p.queueSize+p.maxWorkers-p.busyWorkers {
+		return fmt.Errorf("worker queue is full, %d tasks waiting", p.queueSize)
+	}
+
+	i := len(p.queue)
+	for i > 0 && p.queue[i-1].priority < priority {
+		i--
 	}
+	p.queue = append(p.queue, queuedTask{})
+	copy(p.queue[i+1:], p.queue[i:])
+	p.queue[i] = queuedTask{task: task, priority: priority}
 
-	p.queuedTasks <- task
+	p.ready.Signal()
 	return nil
 }
@@ -0,0 +1,232 @@
+package worker
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockPool will run a pool of one worker busy with a task that waits until
+// the returned function is called, so the tasks added after are queued.
+func blockPool(t *testing.T, ctx context.Context, queueSize int) (WorkerPool, func()) {
+	p := NewPool(1, queueSize)
+	p.Run(ctx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	if err := p.AddTask(func(ctx context.Context) {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatalf("AddTask not expected error = %v", err)
+	}
+	<-started
+
+	return p, func() { close(release) }
+}
+
+// orderRecorder records the order the tasks run.
+type orderRecorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+// task returns a task that records the name when it runs.
+func (r *orderRecorder) task(name string) WorkerTask {
+	return func(ctx context.Context) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.order = append(r.order, name)
+	}
+}
+
+func Test_workerPool_AddPriorityTask(t *testing.T) {
+	tests := []struct {
+		name       string
+		names      []string
+		priorities []int
+		want       []string
+	}{
+		{
+			name:       "higher priority first",
+			names:      []string{"low", "high", "medium"},
+			priorities: []int{0, 10, 5},
+			want:       []string{"high", "medium", "low"},
+		},
+		{
+			name:       "same priority by arrival",
+			names:      []string{"a", "b", "c", "d"},
+			priorities: []int{1, 1, 1, 1},
+			want:       []string{"a", "b", "c", "d"},
+		},
+		{
+			name:       "same priority by arrival after the higher priority",
+			names:      []string{"a", "b", "c", "d", "e"},
+			priorities: []int{0, 5, 0, 5, -1},
+			want:       []string{"b", "d", "a", "c", "e"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, release := blockPool(t, context.Background(), len(tt.names))
+
+			r := &orderRecorder{}
+			for i, name := range tt.names {
+				if err := p.AddPriorityTask(r.task(name), tt.priorities[i]); err != nil {
+					t.Fatalf("AddPriorityTask not expected error = %v", err)
+				}
+			}
+
+			if got := p.Queued(); got != len(tt.names) {
+				t.Errorf("Queued expected = %d but got = %d", len(tt.names), got)
+			}
+
+			release()
+			p.Stop()
+
+			if len(r.order) != len(tt.want) {
+				t.Fatalf("AddPriorityTask expected order = %v but got = %v", tt.want, r.order)
+			}
+			for i := range tt.want {
+				if r.order[i] != tt.want[i] {
+					t.Errorf("AddPriorityTask expected order = %v but got = %v", tt.want, r.order)
+					break
+				}
+			}
+		})
+	}
+
+	t.Run("queue full", func(t *testing.T) {
+		p, release := blockPool(t, context.Background(), 2)
+		defer p.Stop()
+		defer release()
+
+		if !p.IsFull() {
+			t.Errorf("IsFull expected = true but got = false")
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := p.AddTask(func(ctx context.Context) {}); err != nil {
+				t.Fatalf("AddTask not expected error = %v", err)
+			}
+		}
+
+		if err := p.AddPriorityTask(func(ctx context.Context) {}, 10); err == nil {
+			t.Errorf("AddPriorityTask expected error but got = %v", err)
+		}
+
+		if got := p.Queued(); got != 2 {
+			t.Errorf("Queued expected = 2 but got = %d", got)
+		}
+	})
+
+	t.Run("free workers don't count on the queue", func(t *testing.T) {
+		p := NewPool(2, 0)
+		p.Run(context.Background())
+		defer p.Stop()
+
+		release := make(chan struct{})
+		defer close(release)
+		for i := 0; i < 2; i++ {
+			if err := p.AddTask(func(ctx context.Context) { <-release }); err != nil {
+				t.Fatalf("AddTask not expected error = %v", err)
+			}
+		}
+
+		if err := p.AddTask(func(ctx context.Context) {}); err == nil {
+			t.Errorf("AddTask expected error but got = %v", err)
+		}
+	})
+
+	t.Run("pool not running", func(t *testing.T) {
+		p := NewPool(1, 1)
+		if err := p.AddTask(func(ctx context.Context) {}); err == nil {
+			t.Errorf("AddTask expected error but got = %v", err)
+		}
+	})
+}
+
+func Test_workerPool_Stop(t *testing.T) {
+	t.Run("stop after the context is cancelled", func(t *testing.T) {
+		goroutines := runtime.NumGoroutine()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		p := NewPool(2, 4)
+		p.Run(ctx)
+
+		var mu sync.Mutex
+		cancelled := 0
+		started := make(chan struct{}, 2)
+		for i := 0; i < 6; i++ {
+			if err := p.AddTask(func(ctx context.Context) {
+				select {
+				case started <- struct{}{}:
+				default:
+				}
+				<-ctx.Done()
+				mu.Lock()
+				cancelled++
+				mu.Unlock()
+			}); err != nil {
+				t.Fatalf("AddTask not expected error = %v", err)
+			}
+		}
+		<-started
+		<-started
+
+		cancel()
+
+		stopped := make(chan struct{})
+		go func() {
+			p.Stop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Stop expected to end after the context is cancelled")
+		}
+
+		if cancelled != 6 {
+			t.Errorf("Stop expected the 6 tasks cancelled but got = %d", cancelled)
+		}
+
+		if err := p.AddTask(func(ctx context.Context) {}); err == nil {
+			t.Errorf("AddTask expected error after stop but got = %v", err)
+		}
+
+		// The goroutines of the workers end with Stop.
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := runtime.NumGoroutine(); got > goroutines {
+			t.Errorf("Stop expected %d goroutines but got = %d", goroutines, got)
+		}
+	})
+
+	t.Run("queued tasks run before stop", func(t *testing.T) {
+		p, release := blockPool(t, context.Background(), 3)
+
+		r := &orderRecorder{}
+		for _, name := range []string{"a", "b", "c"} {
+			if err := p.AddTask(r.task(name)); err != nil {
+				t.Fatalf("AddTask not expected error = %v", err)
+			}
+		}
+
+		release()
+		p.Stop()
+
+		if len(r.order) != 3 {
+			t.Errorf("Stop expected 3 tasks run but got = %v", r.order)
+		}
+
+		if p.IsFull() || p.Queued() != 0 {
+			t.Errorf("Stop expected the pool free but got queued = %d", p.Queued())
+		}
+	})
+}